@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configPathUsage documents the flag shared by the server and config commands
+const configPathUsage = "path to a YAML config file, env vars override its values (default $CONFIG_FILE)"
+
+// runConfigCommand implements `api config <subcommand>` and returns the exit code
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: api config print [--config path] [--redacted]")
+		return 2
+	}
+
+	flags := flag.NewFlagSet("config print", flag.ContinueOnError)
+	configPath := flags.String("config", os.Getenv("CONFIG_FILE"), configPathUsage)
+	redact := flags.Bool("redacted", false, "hide secrets such as JWT_SECRET and the database password")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *redact {
+		cfg = cfg.Redacted()
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	defer encoder.Close()
+	if err := encoder.Encode(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to print config:", err)
+		return 1
+	}
+	return 0
+}
@@ -1,100 +1,672 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/ratelimit"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
 )
 
-// Config holds all application configuration loaded from environment variables.
+// minJWTSecretLen is the shortest JWT secret accepted, 32 bytes matches HS256 key size
+const minJWTSecretLen = 32
+
+// minWebhookSecretLen is the shortest bearer token accepted for inbound webhooks
+const minWebhookSecretLen = 32
+
+// redacted replaces secret values in printed configuration
+const redacted = "[REDACTED]"
+
+// Config holds all application configuration. Values are layered: built-in
+// defaults, then the optional YAML config file, then environment variables.
+// Secrets can also be read from files by setting <NAME>_FILE.
 type Config struct {
 	// Database configuration
-	Dsn string
+	Dsn string `yaml:"db_dsn"`
 	// Server configuration
-	ApiPort uint
+	ApiPort           uint   `yaml:"api_port"`
+	ReadTimeout       int    `yaml:"http_read_timeout"`        // in seconds
+	ReadHeaderTimeout int    `yaml:"http_read_header_timeout"` // in seconds
+	WriteTimeout      int    `yaml:"http_write_timeout"`       // in seconds
+	IdleTimeout       int    `yaml:"http_idle_timeout"`        // in seconds
+	ShutdownTimeout   int    `yaml:"http_shutdown_timeout"`    // in seconds
+	MaxHeaderBytes    int    `yaml:"http_max_header_bytes"`    // in bytes
+	TLSCertFile       string `yaml:"tls_cert_file"`            // optional, enables native TLS together with TLSKeyFile
+	TLSKeyFile        string `yaml:"tls_key_file"`
+	TrustProxyHeaders bool   `yaml:"trust_proxy_headers"` // take the client IP from X-Forwarded-For / X-Real-IP
+	MetricsPort       uint   `yaml:"metrics_port"`        // separate listener for /metrics, 0 disables metrics
+
+	// Rate limit configuration, limits are written as <requests>/<window> or "off"
+	RateLimitStore        string          `yaml:"rate_limit_store"`         // memory or postgres
+	RateLimitAuthIP       ratelimit.Limit `yaml:"rate_limit_auth_ip"`       // signup and login per client IP
+	RateLimitAuthAccount  ratelimit.Limit `yaml:"rate_limit_auth_account"`  // signup and login per email
+	RateLimitAPIIP        ratelimit.Limit `yaml:"rate_limit_api_ip"`        // authenticated API per client IP
+	RateLimitPublicIP     ratelimit.Limit `yaml:"rate_limit_public_ip"`     // public waitlist signups per client IP
+	RateLimitPrivacyEmail ratelimit.Limit `yaml:"rate_limit_privacy_email"` // data request links per email
 
 	// Logging configuration
-	LogLevel    string
-	Environment string
+	LogLevel    string `yaml:"log_level"`
+	Environment string `yaml:"environment"`
+
+	// Tracing configuration
+	TracingExporter    string  `yaml:"tracing_exporter"`     // none, otlp or stdout
+	TracingSampleRatio float32 `yaml:"tracing_sample_ratio"` // fraction of new traces to sample, 0..1
 
 	// Authentication configuration
-	JWTSecret      string
-	APIBaseURL     string //base url for the api
-	AvatarPath     string
-	TokenDuration  int // in minutes
-	CookieDuration int // in hours
-}
+	JWTSecret      string `yaml:"jwt_secret"`
+	APIBaseURL     string `yaml:"api_base_url"` //base url for the api
+	AvatarPath     string `yaml:"avatar_path"`
+	LogoPath       string `yaml:"logo_path"`       // uploaded waitlist logos
+	TokenDuration  int    `yaml:"token_duration"`  // in minutes
+	CookieDuration int    `yaml:"cookie_duration"` // in hours
+
+	// Admin configuration
+	AdminUserIDs []int64 `yaml:"admin_user_ids"` // dashboard accounts allowed to use the admin API
+
+	// Account lockout configuration
+	LockoutThreshold   int `yaml:"lockout_threshold"`    // failed logins before locking, 0 disables
+	LockoutDuration    int `yaml:"lockout_duration"`     // first lock in minutes, doubles per consecutive lock
+	LockoutMaxDuration int `yaml:"lockout_max_duration"` // in minutes
+
+	// Captcha configuration, used by waitlists that require a captcha
+	CaptchaProvider  string `yaml:"captcha_provider"`   // none, siteverify (hCaptcha, Turnstile, reCAPTCHA) or fake
+	CaptchaVerifyURL string `yaml:"captcha_verify_url"` // siteverify endpoint of the provider
+	CaptchaSiteKey   string `yaml:"captcha_site_key"`
+	CaptchaSecret    string `yaml:"captcha_secret"`
+	CaptchaScriptURL string `yaml:"captcha_script_url"` // provider script the hosted waitlist pages load
 
-func LoadConfig() *Config {
-	config := &Config{
-		// Database configuration
-		Dsn: getRequiredEnv("DB_DSN"),
+	// Email validation configuration
+	EmailMXLookup         bool   `yaml:"email_mx_lookup"`         // disable for offline deployments, MX checks are then skipped
+	DisposableDomainsFile string `yaml:"disposable_domains_file"` // optional extra blocklist, reloaded when it changes
 
+	// Stats configuration
+	StatsRollupInterval int `yaml:"stats_rollup_interval"` // minutes between hourly rollup refreshes, 0 counts every signup live
+
+	// Job queue configuration
+	JobWorkers      int `yaml:"job_workers"`       // jobs this replica runs at once, 0 leaves them to other replicas
+	JobPollInterval int `yaml:"job_poll_interval"` // milliseconds between looks for due jobs while the queue is idle
+
+	// Email configuration
+	BounceWebhookSecret string          `yaml:"bounce_webhook_secret"` // bearer token of the bounce webhook, empty disables it
+	MailProvider        string          `yaml:"mail_provider"`         // smtp, http or outbox
+	MailFrom            string          `yaml:"mail_from"`             // sender of every email, may include a display name
+	MailRateLimit       ratelimit.Limit `yaml:"mail_rate_limit"`       // emails per window across replicas sharing the rate limit store
+	SMTPHost            string          `yaml:"smtp_host"`
+	SMTPPort            int             `yaml:"smtp_port"`
+	SMTPUsername        string          `yaml:"smtp_username"` // empty skips authentication
+	SMTPPassword        string          `yaml:"smtp_password"`
+	SMTPTLS             string          `yaml:"smtp_tls"`          // starttls, tls or none
+	MailAPIURL          string          `yaml:"mail_api_url"`      // endpoint the http provider posts emails to
+	MailAPIKey          string          `yaml:"mail_api_key"`      // bearer token of the email API
+	MailOutboxPath      string          `yaml:"mail_outbox_path"`  // directory the outbox provider writes .eml files to
+	MailOutboxServe     bool            `yaml:"mail_outbox_serve"` // browse the outbox at /dev/outbox, without authentication
+}
+
+// defaultConfig returns the built-in defaults, the lowest configuration layer
+func defaultConfig() *Config {
+	return &Config{
 		// Server configuration
-		ApiPort: getEnvUintOrDefault("API_PORT", 8080),
+		ApiPort:           8080,
+		MetricsPort:       9090,
+		ReadTimeout:       15,  // default 15 seconds
+		ReadHeaderTimeout: 5,   // default 5 seconds
+		WriteTimeout:      30,  // default 30 seconds
+		IdleTimeout:       120, // default 120 seconds
+		ShutdownTimeout:   20,  // default 20 seconds
+		MaxHeaderBytes:    1 << 20,
+
+		// Rate limit configuration
+		RateLimitStore:        "memory",
+		RateLimitAuthIP:       ratelimit.Limit{Requests: 20, Window: time.Minute},
+		RateLimitAuthAccount:  ratelimit.Limit{Requests: 5, Window: time.Minute},
+		RateLimitAPIIP:        ratelimit.Limit{Requests: 300, Window: time.Minute},
+		RateLimitPublicIP:     ratelimit.Limit{Requests: 30, Window: time.Minute},
+		RateLimitPrivacyEmail: ratelimit.Limit{Requests: 3, Window: time.Hour},
 
 		// Logging configuration
-		LogLevel:    getEnvOrDefault("LOG_LEVEL", "info"),
-		Environment: getEnvOrDefault("ENVIRONMENT", "development"),
+		LogLevel:    "info",
+		Environment: "development",
+
+		// Tracing configuration
+		TracingExporter:    "none",
+		TracingSampleRatio: 1.0,
 
 		// Authentication configuration
-		JWTSecret:      getRequiredEnv("JWT_SECRET"),
-		APIBaseURL:     getEnvOrDefault("API_BASE_URL", "http://localhost:8080/api"),
-		AvatarPath:     getEnvOrDefault("AVATAR_PATH", "./data/avatars"),
-		TokenDuration:  getEnvIntOrDefault("TOKEN_DURATION", 60),  // default 60 minutes
-		CookieDuration: getEnvIntOrDefault("COOKIE_DURATION", 24), // default 24 hours
+		APIBaseURL:     "http://localhost:8080",
+		AvatarPath:     "./data/avatars",
+		LogoPath:       "./data/logos",
+		TokenDuration:  60, // default 60 minutes
+		CookieDuration: 24, // default 24 hours
+
+		// Account lockout configuration
+		LockoutThreshold:   5,
+		LockoutDuration:    15,      // default 15 minutes
+		LockoutMaxDuration: 24 * 60, // default 24 hours
+
+		// Captcha configuration
+		CaptchaProvider: "none",
+
+		// Email validation configuration
+		EmailMXLookup: true,
+
+		// Job queue configuration
+		JobWorkers:      4,
+		JobPollInterval: 1000, // default 1 second
+
+		// Email configuration
+		MailProvider:   "outbox",
+		MailFrom:       "OpenWaitlist <no-reply@localhost>",
+		MailRateLimit:  ratelimit.Limit{Requests: 10, Window: time.Second},
+		SMTPPort:       587,
+		SMTPTLS:        "starttls",
+		MailOutboxPath: "./data/outbox",
 	}
-	return config
 }
 
-// getRequiredEnv gets an environment variable and panics if it's not set
-func getRequiredEnv(key string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		panic(fmt.Sprintf("Required environment variable %s is not set", key))
+// LoadConfig builds the configuration from defaults, the YAML file at path (if
+// not empty) and environment variables, then validates it. All problems are
+// reported together so a misconfigured deployment can be fixed in one go.
+func LoadConfig(path string) (*Config, error) {
+	config := defaultConfig()
+
+	if path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
 	}
-	return value
+
+	env := &envLoader{}
+
+	// Database configuration
+	env.secret("DB_DSN", &config.Dsn)
+
+	// Server configuration
+	env.uint("API_PORT", &config.ApiPort)
+	env.uint("METRICS_PORT", &config.MetricsPort)
+	env.int("HTTP_READ_TIMEOUT", &config.ReadTimeout)
+	env.int("HTTP_READ_HEADER_TIMEOUT", &config.ReadHeaderTimeout)
+	env.int("HTTP_WRITE_TIMEOUT", &config.WriteTimeout)
+	env.int("HTTP_IDLE_TIMEOUT", &config.IdleTimeout)
+	env.int("HTTP_SHUTDOWN_TIMEOUT", &config.ShutdownTimeout)
+	env.int("HTTP_MAX_HEADER_BYTES", &config.MaxHeaderBytes)
+	env.string("TLS_CERT_FILE", &config.TLSCertFile)
+	env.string("TLS_KEY_FILE", &config.TLSKeyFile)
+	env.bool("TRUST_PROXY_HEADERS", &config.TrustProxyHeaders)
+
+	// Rate limit configuration
+	env.string("RATE_LIMIT_STORE", &config.RateLimitStore)
+	env.limit("RATE_LIMIT_AUTH_IP", &config.RateLimitAuthIP)
+	env.limit("RATE_LIMIT_AUTH_ACCOUNT", &config.RateLimitAuthAccount)
+	env.limit("RATE_LIMIT_API_IP", &config.RateLimitAPIIP)
+	env.limit("RATE_LIMIT_PUBLIC_IP", &config.RateLimitPublicIP)
+	env.limit("RATE_LIMIT_PRIVACY_EMAIL", &config.RateLimitPrivacyEmail)
+
+	// Logging configuration
+	env.string("LOG_LEVEL", &config.LogLevel)
+	env.string("ENVIRONMENT", &config.Environment)
+
+	// Tracing configuration
+	env.string("TRACING_EXPORTER", &config.TracingExporter)
+	env.float("TRACING_SAMPLE_RATIO", &config.TracingSampleRatio)
+
+	// Authentication configuration
+	env.secret("JWT_SECRET", &config.JWTSecret)
+	env.string("API_BASE_URL", &config.APIBaseURL)
+	env.string("AVATAR_PATH", &config.AvatarPath)
+	env.string("LOGO_PATH", &config.LogoPath)
+	env.int("TOKEN_DURATION", &config.TokenDuration)
+	env.int("COOKIE_DURATION", &config.CookieDuration)
+
+	// Admin configuration
+	env.int64List("ADMIN_USER_IDS", &config.AdminUserIDs)
+
+	// Account lockout configuration
+	env.int("LOCKOUT_THRESHOLD", &config.LockoutThreshold)
+	env.int("LOCKOUT_DURATION", &config.LockoutDuration)
+	env.int("LOCKOUT_MAX_DURATION", &config.LockoutMaxDuration)
+
+	// Captcha configuration
+	env.string("CAPTCHA_PROVIDER", &config.CaptchaProvider)
+	env.string("CAPTCHA_VERIFY_URL", &config.CaptchaVerifyURL)
+	env.string("CAPTCHA_SITE_KEY", &config.CaptchaSiteKey)
+	env.secret("CAPTCHA_SECRET", &config.CaptchaSecret)
+	env.string("CAPTCHA_SCRIPT_URL", &config.CaptchaScriptURL)
+
+	// Email validation configuration
+	env.bool("EMAIL_MX_LOOKUP", &config.EmailMXLookup)
+	env.string("DISPOSABLE_DOMAINS_FILE", &config.DisposableDomainsFile)
+
+	// Stats configuration
+	env.int("STATS_ROLLUP_INTERVAL", &config.StatsRollupInterval)
+
+	// Job queue configuration
+	env.int("JOB_WORKERS", &config.JobWorkers)
+	env.int("JOB_POLL_INTERVAL", &config.JobPollInterval)
+
+	// Email configuration
+	env.secret("BOUNCE_WEBHOOK_SECRET", &config.BounceWebhookSecret)
+	env.string("MAIL_PROVIDER", &config.MailProvider)
+	env.string("MAIL_FROM", &config.MailFrom)
+	env.limit("MAIL_RATE_LIMIT", &config.MailRateLimit)
+	env.string("SMTP_HOST", &config.SMTPHost)
+	env.int("SMTP_PORT", &config.SMTPPort)
+	env.string("SMTP_USERNAME", &config.SMTPUsername)
+	env.secret("SMTP_PASSWORD", &config.SMTPPassword)
+	env.string("SMTP_TLS", &config.SMTPTLS)
+	env.string("MAIL_API_URL", &config.MailAPIURL)
+	env.secret("MAIL_API_KEY", &config.MailAPIKey)
+	env.string("MAIL_OUTBOX_PATH", &config.MailOutboxPath)
+	env.bool("MAIL_OUTBOX_SERVE", &config.MailOutboxServe)
+
+	problems := append(env.errs, config.Validate()...)
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+	return config, nil
 }
 
-// Helper functions for environment variable parsing
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// ConfigError lists every problem found while loading configuration
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, problem := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(problem)
 	}
-	return defaultValue
+	return b.String()
 }
 
-func getEnvIntOrDefault(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// Validate checks the configuration and returns a human readable message per problem
+func (c *Config) Validate() []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Database configuration
+	if c.Dsn == "" {
+		add("DB_DSN is required")
+	} else if _, err := pgx.ParseConfig(c.Dsn); err != nil {
+		add("DB_DSN is not a valid postgres connection string")
+	}
+
+	// Server configuration
+	if c.ApiPort == 0 || c.ApiPort > 65535 {
+		add("API_PORT must be between 1 and 65535, got %d", c.ApiPort)
+	}
+	if c.MetricsPort > 65535 || (c.MetricsPort != 0 && c.MetricsPort == c.ApiPort) {
+		add("METRICS_PORT must be 0 or a port between 1 and 65535 other than API_PORT, got %d", c.MetricsPort)
+	}
+	for _, setting := range []struct {
+		name  string
+		value int
+	}{
+		{"HTTP_READ_TIMEOUT", c.ReadTimeout},
+		{"HTTP_READ_HEADER_TIMEOUT", c.ReadHeaderTimeout},
+		{"HTTP_WRITE_TIMEOUT", c.WriteTimeout},
+		{"HTTP_IDLE_TIMEOUT", c.IdleTimeout},
+		{"HTTP_SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+		{"HTTP_MAX_HEADER_BYTES", c.MaxHeaderBytes},
+	} {
+		if setting.value <= 0 {
+			add("%s must be greater than 0, got %d", setting.name, setting.value)
 		}
 	}
-	return defaultValue
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		add("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.TLSCertFile != "" {
+		if _, err := os.Stat(c.TLSCertFile); err != nil {
+			add("TLS_CERT_FILE %q is not readable: %v", c.TLSCertFile, err)
+		}
+	}
+	if c.TLSKeyFile != "" {
+		if _, err := os.Stat(c.TLSKeyFile); err != nil {
+			add("TLS_KEY_FILE %q is not readable: %v", c.TLSKeyFile, err)
+		}
+	}
+
+	// Rate limit configuration
+	if c.RateLimitStore != "memory" && c.RateLimitStore != "postgres" {
+		add("RATE_LIMIT_STORE must be memory or postgres, got %q", c.RateLimitStore)
+	}
+
+	// Logging configuration
+	if _, err := zerolog.ParseLevel(c.LogLevel); err != nil || c.LogLevel == "" {
+		add("LOG_LEVEL %q is not a valid level (trace, debug, info, warn, error)", c.LogLevel)
+	}
+	if c.Environment == "" {
+		add("ENVIRONMENT must not be empty")
+	}
+
+	// Tracing configuration
+	switch c.TracingExporter {
+	case "none", "otlp", "stdout":
+	default:
+		add("TRACING_EXPORTER must be one of none, otlp or stdout, got %q", c.TracingExporter)
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		add("TRACING_SAMPLE_RATIO must be between 0 and 1, got %g", c.TracingSampleRatio)
+	}
+
+	// Authentication configuration
+	switch {
+	case c.JWTSecret == "":
+		add("JWT_SECRET is required")
+	case c.JWTSecret == "your_jwt_secret_key":
+		add("JWT_SECRET is still the example value, generate one with `openssl rand -base64 48`")
+	case len(c.JWTSecret) < minJWTSecretLen:
+		add("JWT_SECRET is too weak, it must be at least %d characters long", minJWTSecretLen)
+	}
+	if u, err := url.Parse(c.APIBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		add("API_BASE_URL %q must be an absolute http(s) URL", c.APIBaseURL)
+	}
+	if c.AvatarPath == "" {
+		add("AVATAR_PATH must not be empty")
+	}
+	if c.LogoPath == "" {
+		add("LOGO_PATH must not be empty")
+	}
+	if c.TokenDuration <= 0 {
+		add("TOKEN_DURATION must be greater than 0 minutes, got %d", c.TokenDuration)
+	}
+	if c.CookieDuration <= 0 {
+		add("COOKIE_DURATION must be greater than 0 hours, got %d", c.CookieDuration)
+	}
+
+	// Admin configuration
+	// by ID rather than email, signing up doesn't prove owning the address
+	for _, id := range c.AdminUserIDs {
+		if id <= 0 {
+			add("ADMIN_USER_IDS must be a comma separated list of user IDs, got %d", id)
+		}
+	}
+
+	// Account lockout configuration
+	if c.LockoutThreshold < 0 {
+		add("LOCKOUT_THRESHOLD must not be negative, got %d", c.LockoutThreshold)
+	}
+	if c.LockoutThreshold > 0 && (c.LockoutDuration <= 0 || c.LockoutMaxDuration < c.LockoutDuration) {
+		add("LOCKOUT_DURATION must be greater than 0 and at most LOCKOUT_MAX_DURATION, got %d and %d minutes", c.LockoutDuration, c.LockoutMaxDuration)
+	}
+
+	// Captcha configuration
+	switch c.CaptchaProvider {
+	case "none":
+	case "siteverify":
+		if u, err := url.Parse(c.CaptchaVerifyURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			add("CAPTCHA_VERIFY_URL %q must be an absolute https URL", c.CaptchaVerifyURL)
+		}
+		if c.CaptchaSiteKey == "" || c.CaptchaSecret == "" {
+			add("CAPTCHA_SITE_KEY and CAPTCHA_SECRET are required with the siteverify captcha provider")
+		}
+	case "fake":
+		if c.Environment == "production" {
+			add("CAPTCHA_PROVIDER fake is for development and must not be used in production")
+		}
+	default:
+		add("CAPTCHA_PROVIDER must be one of none, siteverify or fake, got %q", c.CaptchaProvider)
+	}
+	if c.CaptchaScriptURL != "" {
+		if u, err := url.Parse(c.CaptchaScriptURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			add("CAPTCHA_SCRIPT_URL %q must be an absolute https URL", c.CaptchaScriptURL)
+		}
+	}
+
+	// Email validation configuration
+	if c.DisposableDomainsFile != "" {
+		if _, err := os.Stat(c.DisposableDomainsFile); err != nil {
+			add("DISPOSABLE_DOMAINS_FILE %q is not readable: %v", c.DisposableDomainsFile, err)
+		}
+	}
+
+	// Stats configuration
+	if c.StatsRollupInterval < 0 {
+		add("STATS_ROLLUP_INTERVAL must not be negative, got %d", c.StatsRollupInterval)
+	}
+
+	// Job queue configuration
+	if c.JobWorkers < 0 {
+		add("JOB_WORKERS must not be negative, got %d", c.JobWorkers)
+	}
+	if c.JobPollInterval <= 0 {
+		add("JOB_POLL_INTERVAL must be greater than 0 milliseconds, got %d", c.JobPollInterval)
+	}
+
+	// Email configuration
+	if c.BounceWebhookSecret != "" && len(c.BounceWebhookSecret) < minWebhookSecretLen {
+		add("BOUNCE_WEBHOOK_SECRET is too weak, it must be at least %d characters long", minWebhookSecretLen)
+	}
+	if _, err := mail.ParseAddress(c.MailFrom); err != nil {
+		add("MAIL_FROM %q is not a valid email address: %v", c.MailFrom, err)
+	}
+	switch c.MailProvider {
+	case "smtp":
+		if c.SMTPHost == "" {
+			add("SMTP_HOST is required with the smtp mail provider")
+		}
+		if c.SMTPPort <= 0 || c.SMTPPort > 65535 {
+			add("SMTP_PORT must be a valid port, got %d", c.SMTPPort)
+		}
+		switch c.SMTPTLS {
+		case "starttls", "tls":
+		case "none":
+			if c.SMTPUsername != "" {
+				add("SMTP_TLS none would send the SMTP password unencrypted, use starttls or tls with SMTP_USERNAME")
+			}
+		default:
+			add("SMTP_TLS must be one of starttls, tls or none, got %q", c.SMTPTLS)
+		}
+	case "http":
+		if u, err := url.Parse(c.MailAPIURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			add("MAIL_API_URL %q must be an absolute https URL", c.MailAPIURL)
+		}
+	case "outbox":
+		if c.MailOutboxPath == "" {
+			add("MAIL_OUTBOX_PATH is required with the outbox mail provider")
+		}
+		if c.Environment == "production" {
+			add("MAIL_PROVIDER outbox doesn't send emails and must not be used in production, use smtp or http")
+		}
+	default:
+		add("MAIL_PROVIDER must be one of smtp, http or outbox, got %q", c.MailProvider)
+	}
+	if c.MailOutboxServe {
+		// the outbox holds unlock and data request links, anyone reading it can use them
+		if c.MailProvider != "outbox" {
+			add("MAIL_OUTBOX_SERVE needs MAIL_PROVIDER outbox")
+		}
+		if c.Environment == "production" {
+			add("MAIL_OUTBOX_SERVE serves every email without authentication and must not be used in production")
+		}
+	}
+
+	return problems
 }
 
-func getEnvFloatOrDefault(key string, defaultValue float32) float32 {
-	if value := os.Getenv(key); value != "" {
-		if floatValue, err := strconv.ParseFloat(value, 32); err == nil {
-			return float32(floatValue)
+// TLSEnabled reports whether the server should terminate TLS itself
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// Redacted returns a copy of the configuration that is safe to print or log
+func (c *Config) Redacted() *Config {
+	copied := *c
+	if copied.JWTSecret != "" {
+		copied.JWTSecret = redacted
+	}
+	if copied.CaptchaSecret != "" {
+		copied.CaptchaSecret = redacted
+	}
+	if copied.BounceWebhookSecret != "" {
+		copied.BounceWebhookSecret = redacted
+	}
+	if copied.SMTPPassword != "" {
+		copied.SMTPPassword = redacted
+	}
+	if copied.MailAPIKey != "" {
+		copied.MailAPIKey = redacted
+	}
+	copied.Dsn = redactDSN(copied.Dsn)
+	return &copied
+}
+
+// redactDSN hides the password in URL and key=value style connection strings
+func redactDSN(dsn string) string {
+	if dsn == "" {
+		return dsn
+	}
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, hasPassword := u.User.Password(); hasPassword {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		query := u.Query()
+		if query.Has("password") {
+			query.Set("password", "xxxxx")
+			u.RawQuery = query.Encode()
 		}
+		return strings.Replace(u.String(), "xxxxx", redacted, -1)
 	}
-	return defaultValue
+	fields := strings.Fields(dsn)
+	for i, field := range fields {
+		if strings.HasPrefix(field, "password=") {
+			fields[i] = "password=" + redacted
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// envLoader overrides config values from environment variables and collects
+// parse errors instead of silently falling back to the previous value
+type envLoader struct {
+	errs []string
 }
 
-func getEnvUintOrDefault(key string, defaultValue uint) uint {
+// lookup returns the value of key if it is set and not empty
+func (l *envLoader) lookup(key string) (string, bool) {
 	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.ParseUint(value, 10, 32); err == nil {
-			return uint(intValue)
+		return value, true
+	}
+	return "", false
+}
+
+func (l *envLoader) string(key string, target *string) {
+	if value, ok := l.lookup(key); ok {
+		*target = value
+	}
+}
+
+// secret reads key like string, but also accepts <key>_FILE pointing at a file
+// holding the value, as used with docker and kubernetes secrets
+func (l *envLoader) secret(key string, target *string) {
+	fileKey := key + "_FILE"
+	path := os.Getenv(fileKey)
+	if path == "" {
+		l.string(key, target)
+		return
+	}
+	if os.Getenv(key) != "" {
+		l.errs = append(l.errs, fmt.Sprintf("only one of %s and %s may be set", key, fileKey))
+		return
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Sprintf("%s: failed to read %q: %v", fileKey, path, err))
+		return
+	}
+	*target = strings.TrimRight(string(content), "\r\n")
+}
+
+// int64List reads a comma separated list of integers, dropping empty items
+func (l *envLoader) int64List(key string, target *[]int64) {
+	if value, ok := l.lookup(key); ok {
+		items := []int64{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			intValue, err := strconv.ParseInt(item, 10, 64)
+			if err != nil {
+				l.errs = append(l.errs, fmt.Sprintf("%s must be a comma separated list of integers, got %q", key, item))
+				return
+			}
+			items = append(items, intValue)
+		}
+		*target = items
+	}
+}
+
+func (l *envLoader) int(key string, target *int) {
+	if value, ok := l.lookup(key); ok {
+		intValue, err := strconv.Atoi(value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Sprintf("%s must be an integer, got %q", key, value))
+			return
+		}
+		*target = intValue
+	}
+}
+
+func (l *envLoader) uint(key string, target *uint) {
+	if value, ok := l.lookup(key); ok {
+		uintValue, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Sprintf("%s must be a non-negative integer, got %q", key, value))
+			return
 		}
+		*target = uint(uintValue)
 	}
-	return defaultValue
 }
 
-func getEnvUintOrPanic(key string) uint64 {
-	value := getRequiredEnv(key)
-	if uintValue, err := strconv.ParseUint(value, 10, 32); err == nil {
-		return uintValue
+func (l *envLoader) bool(key string, target *bool) {
+	if value, ok := l.lookup(key); ok {
+		boolValue, err := strconv.ParseBool(value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Sprintf("%s must be true or false, got %q", key, value))
+			return
+		}
+		*target = boolValue
+	}
+}
+
+func (l *envLoader) limit(key string, target *ratelimit.Limit) {
+	if value, ok := l.lookup(key); ok {
+		limit, err := ratelimit.ParseLimit(value)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Sprintf("%s: %v", key, err))
+			return
+		}
+		*target = limit
+	}
+}
+
+func (l *envLoader) float(key string, target *float32) {
+	if value, ok := l.lookup(key); ok {
+		floatValue, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			l.errs = append(l.errs, fmt.Sprintf("%s must be a number, got %q", key, value))
+			return
+		}
+		*target = float32(floatValue)
 	}
-	panic("Environment variable " + key + " must be a valid unsigned integer")
 }
@@ -0,0 +1,137 @@
+// Package attribution records where a signup came from: UTM parameters, the
+// referring page, the landing page and a coarse device class
+package attribution
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// Device classes of a user agent
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// Value limits, longer values are cut
+const (
+	maxURLLength   = 2048
+	maxParamLength = 200
+)
+
+// Attribution is where a signup came from. Empty fields weren't known or
+// capture was disabled for the waitlist.
+type Attribution struct {
+	UTMSource   string `json:"utm_source,omitempty"`
+	UTMMedium   string `json:"utm_medium,omitempty"`
+	UTMCampaign string `json:"utm_campaign,omitempty"`
+	UTMTerm     string `json:"utm_term,omitempty"`
+	UTMContent  string `json:"utm_content,omitempty"`
+	Referrer    string `json:"referrer,omitempty"`    // page linking to the form, without its query
+	LandingURL  string `json:"landing_url,omitempty"` // page the form was on
+	Device      string `json:"device,omitempty"`      // one of the Device classes
+}
+
+// Input is what a signup request reports about its origin
+type Input struct {
+	LandingURL string            // page the form was on, the Referer header when the form doesn't say
+	Referrer   string            // document.referrer of that page
+	UserAgent  string            // User-Agent header
+	UTM        map[string]string // explicit utm_* values, taking precedence over the landing URL's
+}
+
+// Capture builds the attribution of a signup. UTM parameters missing from the
+// input are read from the landing page's query string.
+func Capture(input Input) Attribution {
+	a := Attribution{
+		LandingURL: cleanURL(input.LandingURL, true),
+		Referrer:   cleanURL(input.Referrer, false),
+		Device:     ClassifyUserAgent(input.UserAgent),
+	}
+
+	var query url.Values
+	if u, err := url.Parse(a.LandingURL); err == nil {
+		query = u.Query()
+	}
+	for name, target := range map[string]*string{
+		"utm_source":   &a.UTMSource,
+		"utm_medium":   &a.UTMMedium,
+		"utm_campaign": &a.UTMCampaign,
+		"utm_term":     &a.UTMTerm,
+		"utm_content":  &a.UTMContent,
+	} {
+		value := input.UTM[name]
+		if value == "" {
+			value = query.Get(name)
+		}
+		*target = truncate(strings.TrimSpace(value), maxParamLength)
+	}
+	return a
+}
+
+// cleanURL keeps http(s) URLs without their fragment, and without their query
+// unless keepQuery is set. Anything else is dropped.
+func cleanURL(raw string, keepQuery bool) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+	if !keepQuery {
+		u.RawQuery = ""
+	}
+	cleaned := u.String()
+	if len(cleaned) > maxURLLength {
+		return ""
+	}
+	return cleaned
+}
+
+// truncate cuts s to at most n runes
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// botMarkers appear in the user agents of crawlers and scripts
+var botMarkers = []string{"bot", "crawl", "spider", "slurp", "headless", "curl", "wget", "python", "go-http-client", "java/", "okhttp", "axios", "node-fetch"}
+
+// ClassifyUserAgent sorts a User-Agent header into a Device class
+func ClassifyUserAgent(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case ua == "":
+		return DeviceUnknown
+	case containsAny(ua, botMarkers):
+		return DeviceBot
+	case containsAny(ua, []string{"ipad", "tablet", "kindle", "silk/", "playbook"}),
+		strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return DeviceTablet
+	case containsAny(ua, []string{"mobi", "iphone", "ipod", "android", "windows phone"}):
+		return DeviceMobile
+	case containsAny(ua, []string{"windows", "macintosh", "x11", "cros", "linux"}):
+		return DeviceDesktop
+	}
+	return DeviceUnknown
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
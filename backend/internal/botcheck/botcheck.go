@@ -0,0 +1,134 @@
+package botcheck
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Rejection codes returned to clients when a check fails
+const (
+	CodeHoneypot       = "honeypot"
+	CodeTooFast        = "submitted_too_fast"
+	CodeInvalidForm    = "invalid_form_token"
+	CodeProofOfWork    = "invalid_proof_of_work"
+	CodeCaptcha        = "captcha_failed"
+	CodeCaptchaOffline = "captcha_unavailable"
+)
+
+// Submission is what a public signup form sends for bot verification
+type Submission struct {
+	Email        string
+	RemoteIP     string
+	Honeypot     string // hidden field humans never fill in
+	FormToken    string // issued with the challenge, carries when the form was rendered
+	PowNonce     string
+	PowChallenge string
+	CaptchaToken string
+}
+
+// Rejection explains why a submission was classified as a bot
+type Rejection struct {
+	Code    string
+	Message string
+	// Silent rejections should look like success to the client so bots don't adapt
+	Silent bool
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("bot check failed (%s): %s", r.Code, r.Message)
+}
+
+// Check is one anti-bot verification. It returns a *Rejection when the submission
+// fails, or another error when the check itself could not run.
+type Check interface {
+	Name() string
+	Verify(ctx context.Context, submission *Submission) error
+}
+
+// Settings selects the checks that apply to one waitlist
+type Settings struct {
+	Honeypot       bool
+	MinSubmitTime  time.Duration // 0 disables the timing check
+	PowDifficulty  int           // leading zero bits, 0 disables proof of work
+	CaptchaEnabled bool
+}
+
+// Verifier builds and runs the checks configured for a waitlist
+type Verifier struct {
+	secret  []byte
+	captcha CaptchaVerifier // nil when no captcha provider is configured
+	now     func() time.Time
+}
+
+// NewVerifier creates a verifier signing form tokens and challenges with secret.
+// captcha may be nil, waitlists requiring a captcha are then rejected.
+func NewVerifier(secret []byte, captcha CaptchaVerifier) *Verifier {
+	return &Verifier{secret: secret, captcha: captcha, now: time.Now}
+}
+
+// Checks returns the checks enabled by settings, cheapest first
+func (v *Verifier) Checks(settings Settings) []Check {
+	var checks []Check
+	if settings.Honeypot {
+		checks = append(checks, HoneypotCheck{})
+	}
+	if settings.MinSubmitTime > 0 {
+		checks = append(checks, MinSubmitTimeCheck{Secret: v.secret, Min: settings.MinSubmitTime, Now: v.now})
+	}
+	if settings.PowDifficulty > 0 {
+		checks = append(checks, ProofOfWorkCheck{Secret: v.secret, Difficulty: settings.PowDifficulty, Now: v.now})
+	}
+	if settings.CaptchaEnabled {
+		checks = append(checks, CaptchaCheck{Verifier: v.captcha})
+	}
+	return checks
+}
+
+// Verify runs every check enabled by settings and stops at the first failure
+func (v *Verifier) Verify(ctx context.Context, settings Settings, submission *Submission) error {
+	for _, check := range v.Checks(settings) {
+		if err := check.Verify(ctx, submission); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Challenge is handed to the form before it is submitted
+type Challenge struct {
+	FormToken      string `json:"form_token,omitempty"`
+	PowChallenge   string `json:"pow_challenge,omitempty"`
+	PowDifficulty  int    `json:"pow_difficulty,omitempty"`
+	CaptchaSiteKey string `json:"captcha_site_key,omitempty"`
+	HoneypotField  string `json:"honeypot_field,omitempty"`
+}
+
+// NewChallenge issues the tokens a form needs to pass the checks in settings
+func (v *Verifier) NewChallenge(settings Settings) (*Challenge, error) {
+	now := v.now()
+	challenge := &Challenge{}
+
+	if settings.Honeypot {
+		challenge.HoneypotField = HoneypotField
+	}
+	if settings.MinSubmitTime > 0 {
+		token, err := newFormToken(v.secret, now)
+		if err != nil {
+			return nil, err
+		}
+		challenge.FormToken = token
+	}
+	if settings.PowDifficulty > 0 {
+		token, err := newPowChallenge(v.secret, settings.PowDifficulty, now)
+		if err != nil {
+			return nil, err
+		}
+		challenge.PowChallenge = token
+		challenge.PowDifficulty = settings.PowDifficulty
+	}
+	if settings.CaptchaEnabled && v.captcha != nil {
+		challenge.CaptchaSiteKey = v.captcha.SiteKey()
+	}
+	return challenge, nil
+}
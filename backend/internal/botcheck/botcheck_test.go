@@ -0,0 +1,243 @@
+package botcheck
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestVerifier(captcha CaptchaVerifier) (*Verifier, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	verifier := NewVerifier([]byte("test-secret"), captcha)
+	verifier.now = func() time.Time { return now }
+	return verifier, &now
+}
+
+// solve finds a nonce meeting the challenge difficulty for email
+func solve(t *testing.T, challenge, email string, difficulty int) string {
+	t.Helper()
+	for i := 0; i < 1<<20; i++ {
+		nonce := strconv.Itoa(i)
+		if leadingZeroBits(powHash(challenge, email, nonce)) >= difficulty {
+			return nonce
+		}
+	}
+	t.Fatalf("no nonce found for difficulty %d", difficulty)
+	return ""
+}
+
+func rejectionCode(err error) string {
+	var rejection *Rejection
+	if errors.As(err, &rejection) {
+		return rejection.Code
+	}
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return ""
+}
+
+func TestProofOfWork(t *testing.T) {
+	settings := Settings{PowDifficulty: 8}
+	verifier, _ := newTestVerifier(nil)
+	challenge, err := verifier.NewChallenge(settings)
+	if err != nil {
+		t.Fatalf("NewChallenge failed: %v", err)
+	}
+	nonce := solve(t, challenge.PowChallenge, "a@example.com", settings.PowDifficulty)
+
+	easy, err := verifier.NewChallenge(Settings{PowDifficulty: 1})
+	if err != nil {
+		t.Fatalf("NewChallenge failed: %v", err)
+	}
+	// a nonce good enough for the easy challenge but not for the current difficulty
+	var easyNonce string
+	for i := 0; easyNonce == ""; i++ {
+		if zeros := leadingZeroBits(powHash(easy.PowChallenge, "a@example.com", strconv.Itoa(i))); zeros >= 1 && zeros < settings.PowDifficulty {
+			easyNonce = strconv.Itoa(i)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		submission Submission
+		want       string
+	}{
+		{name: "solved", submission: Submission{Email: "a@example.com", PowChallenge: challenge.PowChallenge, PowNonce: nonce}},
+		{name: "email case and spacing", submission: Submission{Email: " A@Example.com", PowChallenge: challenge.PowChallenge, PowNonce: nonce}},
+		{name: "solved for another email", submission: Submission{Email: "b@example.com", PowChallenge: challenge.PowChallenge, PowNonce: nonce}, want: CodeProofOfWork},
+		{name: "missing nonce", submission: Submission{Email: "a@example.com", PowChallenge: challenge.PowChallenge}, want: CodeProofOfWork},
+		{name: "missing challenge", submission: Submission{Email: "a@example.com", PowNonce: nonce}, want: CodeProofOfWork},
+		{name: "challenge below the current difficulty", submission: Submission{Email: "a@example.com", PowChallenge: easy.PowChallenge, PowNonce: easyNonce}, want: CodeProofOfWork},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rejectionCode(verifier.Verify(context.Background(), settings, &tt.submission)); got != tt.want {
+				t.Errorf("Verify = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProofOfWorkExpires(t *testing.T) {
+	settings := Settings{PowDifficulty: 4}
+	verifier, now := newTestVerifier(nil)
+	challenge, err := verifier.NewChallenge(settings)
+	if err != nil {
+		t.Fatalf("NewChallenge failed: %v", err)
+	}
+	submission := Submission{
+		Email:        "a@example.com",
+		PowChallenge: challenge.PowChallenge,
+		PowNonce:     solve(t, challenge.PowChallenge, "a@example.com", settings.PowDifficulty),
+	}
+
+	*now = now.Add(challengeTTL + time.Second)
+	if got := rejectionCode(verifier.Verify(context.Background(), settings, &submission)); got != CodeProofOfWork {
+		t.Errorf("Verify with an expired challenge = %q, want %q", got, CodeProofOfWork)
+	}
+}
+
+func TestMinSubmitTime(t *testing.T) {
+	settings := Settings{MinSubmitTime: 3 * time.Second}
+	verifier, now := newTestVerifier(nil)
+	challenge, err := verifier.NewChallenge(settings)
+	if err != nil {
+		t.Fatalf("NewChallenge failed: %v", err)
+	}
+	rendered := *now
+	tampered := []byte(challenge.FormToken)
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		token string
+		want  string
+	}{
+		{name: "too fast", after: time.Second, token: challenge.FormToken, want: CodeTooFast},
+		{name: "just in time", after: 3 * time.Second, token: challenge.FormToken},
+		{name: "later", after: time.Minute, token: challenge.FormToken},
+		{name: "expired form", after: challengeTTL + time.Second, token: challenge.FormToken, want: CodeInvalidForm},
+		{name: "tampered token", after: time.Minute, token: string(tampered), want: CodeInvalidForm},
+		{name: "missing token", after: time.Minute, want: CodeInvalidForm},
+		{name: "proof of work challenge as form token", after: time.Minute, token: mustPowChallenge(t, verifier, rendered), want: CodeInvalidForm},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*now = rendered.Add(tt.after)
+			submission := Submission{Email: "a@example.com", FormToken: tt.token}
+			if got := rejectionCode(verifier.Verify(context.Background(), settings, &submission)); got != tt.want {
+				t.Errorf("Verify = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustPowChallenge(t *testing.T, verifier *Verifier, now time.Time) string {
+	t.Helper()
+	token, err := newPowChallenge(verifier.secret, 1, now)
+	if err != nil {
+		t.Fatalf("newPowChallenge failed: %v", err)
+	}
+	return token
+}
+
+func TestHoneypot(t *testing.T) {
+	verifier, _ := newTestVerifier(nil)
+	settings := Settings{Honeypot: true}
+
+	if err := verifier.Verify(context.Background(), settings, &Submission{Honeypot: "  "}); err != nil {
+		t.Errorf("Verify with a blank honeypot = %v, want nil", err)
+	}
+
+	err := verifier.Verify(context.Background(), settings, &Submission{Honeypot: "http://spam.example"})
+	var rejection *Rejection
+	if !errors.As(err, &rejection) || rejection.Code != CodeHoneypot || !rejection.Silent {
+		t.Errorf("Verify with a filled honeypot = %v, want a silent %q rejection", err, CodeHoneypot)
+	}
+}
+
+func TestCaptcha(t *testing.T) {
+	settings := Settings{CaptchaEnabled: true}
+	tests := []struct {
+		name    string
+		captcha CaptchaVerifier
+		token   string
+		want    string
+	}{
+		{name: "valid token", captcha: FakeCaptchaVerifier{ValidToken: "ok"}, token: "ok"},
+		{name: "wrong token", captcha: FakeCaptchaVerifier{ValidToken: "ok"}, token: "nope", want: CodeCaptcha},
+		{name: "missing token", captcha: FakeCaptchaVerifier{ValidToken: "ok"}, want: CodeCaptcha},
+		{name: "empty fake accepts nothing", captcha: FakeCaptchaVerifier{}, want: CodeCaptcha},
+		{name: "no provider configured", token: "ok", want: CodeCaptchaOffline},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, _ := newTestVerifier(tt.captcha)
+			submission := Submission{CaptchaToken: tt.token}
+			if got := rejectionCode(verifier.Verify(context.Background(), settings, &submission)); got != tt.want {
+				t.Errorf("Verify = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewChallenge(t *testing.T) {
+	tests := []struct {
+		name     string
+		captcha  CaptchaVerifier
+		settings Settings
+		want     Challenge
+	}{
+		{name: "nothing enabled", settings: Settings{}, want: Challenge{}},
+		{name: "honeypot", settings: Settings{Honeypot: true}, want: Challenge{HoneypotField: HoneypotField}},
+		{name: "captcha", captcha: FakeCaptchaVerifier{}, settings: Settings{CaptchaEnabled: true}, want: Challenge{CaptchaSiteKey: "fake-site-key"}},
+		{name: "captcha without provider", settings: Settings{CaptchaEnabled: true}, want: Challenge{}},
+		{name: "proof of work", settings: Settings{PowDifficulty: 12}, want: Challenge{PowChallenge: "set", PowDifficulty: 12}},
+		{name: "timing", settings: Settings{MinSubmitTime: time.Second}, want: Challenge{FormToken: "set"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, _ := newTestVerifier(tt.captcha)
+			got, err := verifier.NewChallenge(tt.settings)
+			if err != nil {
+				t.Fatalf("NewChallenge failed: %v", err)
+			}
+			// tokens are random, only check whether they were issued
+			if got.FormToken != "" {
+				got.FormToken = "set"
+			}
+			if got.PowChallenge != "" {
+				got.PowChallenge = "set"
+			}
+			if *got != tt.want {
+				t.Errorf("NewChallenge = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		sum  [32]byte
+		want int
+	}{
+		{sum: [32]byte{0xff}, want: 0},
+		{sum: [32]byte{0x01}, want: 7},
+		{sum: [32]byte{0x00, 0x40}, want: 9},
+		{sum: [32]byte{}, want: 256},
+	}
+
+	for _, tt := range tests {
+		if got := leadingZeroBits(tt.sum); got != tt.want {
+			t.Errorf("leadingZeroBits(%x) = %d, want %d", tt.sum[:2], got, tt.want)
+		}
+	}
+}
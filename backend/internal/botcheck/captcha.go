@@ -0,0 +1,98 @@
+package botcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CaptchaVerifier checks a captcha response token with its provider
+type CaptchaVerifier interface {
+	// SiteKey is the public key the form widget is rendered with
+	SiteKey() string
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// SiteVerifyVerifier implements the siteverify protocol shared by hCaptcha,
+// Cloudflare Turnstile and reCAPTCHA: a form POST of secret, response and
+// remoteip answered with {"success": bool}.
+type SiteVerifyVerifier struct {
+	URL       string
+	Secret    string
+	PublicKey string
+	Client    *http.Client
+}
+
+func NewSiteVerifyVerifier(verifyURL, secret, siteKey string) *SiteVerifyVerifier {
+	return &SiteVerifyVerifier{
+		URL:       verifyURL,
+		Secret:    secret,
+		PublicKey: siteKey,
+		Client:    &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (v *SiteVerifyVerifier) SiteKey() string {
+	return v.PublicKey
+}
+
+func (v *SiteVerifyVerifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	ctx, span := tracing.StartSpan(ctx, "captcha.Verify", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	form := url.Values{
+		"secret":   {v.Secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("failed to build captcha request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		tracing.RecordError(span, err)
+		return false, fmt.Errorf("captcha provider request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("captcha provider returned status %d", resp.StatusCode)
+		tracing.RecordError(span, err)
+		return false, err
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode captcha response: %w", err)
+	}
+	return result.Success, nil
+}
+
+// FakeCaptchaVerifier accepts exactly one token without calling any provider.
+// Meant for tests and local development, never for production.
+type FakeCaptchaVerifier struct {
+	ValidToken string
+}
+
+func (FakeCaptchaVerifier) SiteKey() string {
+	return "fake-site-key"
+}
+
+func (v FakeCaptchaVerifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	return token != "" && token == v.ValidToken, nil
+}
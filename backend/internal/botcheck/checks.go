@@ -0,0 +1,147 @@
+package botcheck
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+)
+
+// HoneypotField is the form field name bots tend to fill and humans never see
+const HoneypotField = "website"
+
+const (
+	formTokenPurpose    = "signup-form"
+	powChallengePurpose = "signup-pow"
+
+	// forms and challenges older than this have to be reloaded
+	challengeTTL = time.Hour
+)
+
+// HoneypotCheck rejects submissions that filled the hidden honeypot field
+type HoneypotCheck struct{}
+
+func (HoneypotCheck) Name() string { return "honeypot" }
+
+func (HoneypotCheck) Verify(ctx context.Context, submission *Submission) error {
+	if strings.TrimSpace(submission.Honeypot) != "" {
+		return &Rejection{Code: CodeHoneypot, Message: "honeypot field was filled", Silent: true}
+	}
+	return nil
+}
+
+// MinSubmitTimeCheck rejects forms submitted faster than a human could fill them.
+// The render time comes from a signed form token so clients can't backdate it.
+type MinSubmitTimeCheck struct {
+	Secret []byte
+	Min    time.Duration
+	Now    func() time.Time
+}
+
+func (MinSubmitTimeCheck) Name() string { return "min_submit_time" }
+
+func (c MinSubmitTimeCheck) Verify(ctx context.Context, submission *Submission) error {
+	claims, err := utils.VerifyToken(c.Secret, formTokenPurpose, submission.FormToken, c.Now())
+	if err != nil {
+		return &Rejection{Code: CodeInvalidForm, Message: "the form has expired, please reload the page"}
+	}
+	issuedAt, err := strconv.ParseInt(claims["iat"], 10, 64)
+	if err != nil {
+		return &Rejection{Code: CodeInvalidForm, Message: "the form has expired, please reload the page"}
+	}
+	if c.Now().Sub(time.Unix(issuedAt, 0)) < c.Min {
+		return &Rejection{Code: CodeTooFast, Message: "the form was submitted too quickly, please try again"}
+	}
+	return nil
+}
+
+func newFormToken(secret []byte, now time.Time) (string, error) {
+	return utils.SignToken(secret, formTokenPurpose, map[string]string{
+		"iat": strconv.FormatInt(now.Unix(), 10),
+	}, now.Add(challengeTTL))
+}
+
+// ProofOfWorkCheck requires the client to find a nonce such that
+// sha256(challenge + ":" + lowercased email + ":" + nonce) starts with Difficulty
+// zero bits. Binding the email means one solution can't be replayed for others.
+type ProofOfWorkCheck struct {
+	Secret     []byte
+	Difficulty int
+	Now        func() time.Time
+}
+
+func (ProofOfWorkCheck) Name() string { return "proof_of_work" }
+
+func (c ProofOfWorkCheck) Verify(ctx context.Context, submission *Submission) error {
+	claims, err := utils.VerifyToken(c.Secret, powChallengePurpose, submission.PowChallenge, c.Now())
+	if err != nil {
+		return &Rejection{Code: CodeProofOfWork, Message: "the challenge has expired, please reload the page"}
+	}
+	// the difficulty in force when the challenge was issued is the one to meet,
+	// but never less than what the waitlist currently asks for
+	difficulty, err := strconv.Atoi(claims["d"])
+	if err != nil || difficulty < c.Difficulty {
+		return &Rejection{Code: CodeProofOfWork, Message: "the challenge has expired, please reload the page"}
+	}
+	if submission.PowNonce == "" || leadingZeroBits(powHash(submission.PowChallenge, submission.Email, submission.PowNonce)) < difficulty {
+		return &Rejection{Code: CodeProofOfWork, Message: "proof of work is missing or invalid"}
+	}
+	return nil
+}
+
+func newPowChallenge(secret []byte, difficulty int, now time.Time) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return utils.SignToken(secret, powChallengePurpose, map[string]string{
+		"s": hex.EncodeToString(salt),
+		"d": strconv.Itoa(difficulty),
+	}, now.Add(challengeTTL))
+}
+
+func powHash(challenge, email, nonce string) [32]byte {
+	return sha256.Sum256([]byte(challenge + ":" + strings.ToLower(strings.TrimSpace(email)) + ":" + nonce))
+}
+
+func leadingZeroBits(sum [32]byte) int {
+	count := 0
+	for _, b := range sum {
+		if b == 0 {
+			count += 8
+			continue
+		}
+		return count + bits.LeadingZeros8(b)
+	}
+	return count
+}
+
+// CaptchaCheck delegates to a third party captcha verifier
+type CaptchaCheck struct {
+	Verifier CaptchaVerifier
+}
+
+func (CaptchaCheck) Name() string { return "captcha" }
+
+func (c CaptchaCheck) Verify(ctx context.Context, submission *Submission) error {
+	if c.Verifier == nil {
+		return &Rejection{Code: CodeCaptchaOffline, Message: "captcha verification is not configured"}
+	}
+	if submission.CaptchaToken == "" {
+		return &Rejection{Code: CodeCaptcha, Message: "please complete the captcha"}
+	}
+	ok, err := c.Verifier.Verify(ctx, submission.CaptchaToken, submission.RemoteIP)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &Rejection{Code: CodeCaptcha, Message: "captcha verification failed, please try again"}
+	}
+	return nil
+}
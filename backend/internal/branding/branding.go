@@ -0,0 +1,69 @@
+// Package branding holds the content settings that make a waitlist's public
+// pages look like its owner's: colors, a markdown description and a logo.
+package branding
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var colorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Colors brand the hosted page, and the widget where its own theme doesn't
+// set a color. Empty fields use the defaults.
+type Colors struct {
+	Primary    string `json:"primary,omitempty"` // buttons and links
+	Background string `json:"background,omitempty"`
+	Text       string `json:"text,omitempty"`
+}
+
+// Validate checks the colors are hex colors, safe to put in CSS
+func (c Colors) Validate() error {
+	for name, color := range map[string]string{
+		"primary":    c.Primary,
+		"background": c.Background,
+		"text":       c.Text,
+	} {
+		if color != "" && !colorPattern.MatchString(color) {
+			return fmt.Errorf("%s must be a hex color like #4f46e5", name)
+		}
+	}
+	return nil
+}
+
+var markdown = goldmark.New(goldmark.WithExtensions(extension.Linkify, extension.Strikethrough))
+
+// descriptionPolicy allows the formatting markdown produces, links get
+// rel="nofollow" and open in a new tab
+var descriptionPolicy = bluemonday.UGCPolicy().
+	RequireNoFollowOnLinks(true).
+	AddTargetBlankToFullyQualifiedLinks(true)
+
+// textPolicy strips every tag
+var textPolicy = bluemonday.StrictPolicy()
+
+// RenderMarkdown turns a description into sanitized HTML. Raw HTML in the
+// source is dropped.
+func RenderMarkdown(source string) template.HTML {
+	var rendered bytes.Buffer
+	if err := markdown.Convert([]byte(source), &rendered); err != nil {
+		// goldmark only fails on writer errors, a buffer has none
+		return template.HTML(template.HTMLEscapeString(source))
+	}
+	return template.HTML(descriptionPolicy.SanitizeBytes(rendered.Bytes()))
+}
+
+// PlainText returns the text of a markdown description without formatting,
+// for link previews and other places that can't show HTML
+func PlainText(source string) string {
+	text := textPolicy.Sanitize(string(RenderMarkdown(source)))
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
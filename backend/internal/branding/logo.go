@@ -0,0 +1,62 @@
+package branding
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"  // registers the decoder for DecodeConfig
+	_ "image/jpeg" // registers the decoder for DecodeConfig
+	_ "image/png"  // registers the decoder for DecodeConfig
+	"io"
+	"net/http"
+	"regexp"
+)
+
+// Logo limits, logos are shown small so larger images only waste bandwidth
+const (
+	MaxLogoBytes     = 1 << 20
+	MaxLogoDimension = 2048
+)
+
+// logoTypes are the accepted logo formats. SVG is left out since it can carry scripts.
+var logoTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// logoNamePattern matches the file names the avatar store hands out
+var logoNamePattern = regexp.MustCompile(`^[0-9a-f]{40}\.image$`)
+
+// ReadLogo reads an uploaded logo, checking its size, format and dimensions
+func ReadLogo(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxLogoBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logo: %w", err)
+	}
+	if len(data) > MaxLogoBytes {
+		return nil, fmt.Errorf("logo must be at most %d KB", MaxLogoBytes>>10)
+	}
+	if !logoTypes[http.DetectContentType(data)] {
+		return nil, fmt.Errorf("logo must be a PNG, JPEG or GIF image")
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("logo is not a valid image")
+	}
+	if config.Width > MaxLogoDimension || config.Height > MaxLogoDimension {
+		return nil, fmt.Errorf("logo must be at most %dx%d pixels", MaxLogoDimension, MaxLogoDimension)
+	}
+	return data, nil
+}
+
+// ValidLogoName reports whether name could be a stored logo, so it is safe
+// to look up in the store
+func ValidLogoName(name string) bool {
+	return logoNamePattern.MatchString(name)
+}
+
+// LogoPath is the URL path a stored logo is served on
+func LogoPath(name string) string {
+	return "/logos/" + name
+}
@@ -0,0 +1,141 @@
+// Package consent describes the consent checkboxes on signup forms and what
+// each signup agreed to
+package consent
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Checkbox kinds, also the keys of their versions
+const (
+	KindTerms     = "terms"     // required to join
+	KindMarketing = "marketing" // optional opt-in
+)
+
+// Limits on consent text
+const (
+	maxTextLength = 1000
+	maxURLLength  = 2048
+)
+
+// Checkbox is a consent checkbox. Version is assigned when the waitlist is saved
+// and goes up whenever the text or URL changes, so the version a signup accepted
+// identifies exactly what they were shown.
+type Checkbox struct {
+	Text    string `json:"text"`
+	URL     string `json:"url,omitempty"` // policy the text refers to
+	Version int    `json:"version"`
+}
+
+// Settings are a waitlist's consent checkboxes, either can be left out
+type Settings struct {
+	Terms     *Checkbox `json:"terms,omitempty"`
+	Marketing *Checkbox `json:"marketing,omitempty"`
+}
+
+// Validate checks the checkboxes' text and links
+func (s Settings) Validate() error {
+	for kind, checkbox := range s.Checkboxes() {
+		text := strings.TrimSpace(checkbox.Text)
+		if text == "" || utf8.RuneCountInString(text) > maxTextLength {
+			return fmt.Errorf("%s consent text is required and must be at most %d characters", kind, maxTextLength)
+		}
+		if checkbox.URL == "" {
+			continue
+		}
+		u, err := url.Parse(checkbox.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(checkbox.URL) > maxURLLength {
+			return fmt.Errorf("%s consent url must be an http(s) URL of at most %d characters", kind, maxURLLength)
+		}
+	}
+	return nil
+}
+
+// Checkboxes returns the configured checkboxes by kind
+func (s Settings) Checkboxes() map[string]*Checkbox {
+	checkboxes := map[string]*Checkbox{}
+	if s.Terms != nil {
+		checkboxes[KindTerms] = s.Terms
+	}
+	if s.Marketing != nil {
+		checkboxes[KindMarketing] = s.Marketing
+	}
+	return checkboxes
+}
+
+// Record is what a signup agreed to
+type Record struct {
+	TermsVersion     *int       `json:"terms_version"`     // nil when the form had no terms checkbox
+	Marketing        bool       `json:"marketing"`         // opted in to marketing
+	MarketingVersion *int       `json:"marketing_version"` // marketing text they answered, nil when there was none
+	At               *time.Time `json:"at"`                // when they answered, nil without checkboxes
+	IP               string     `json:"ip,omitempty"`
+}
+
+// Answers are a signup's answers to the checkboxes, with the versions of the
+// text the form showed. A version is 0 when the form didn't show that checkbox.
+type Answers struct {
+	Terms            bool
+	TermsVersion     int
+	Marketing        bool
+	MarketingVersion int
+}
+
+// Accept errors
+var (
+	ErrChanged       = errors.New("consent text changed since the form was shown")
+	ErrTermsRequired = errors.New("terms not accepted")
+)
+
+// Accept records a signup's answers to the checkboxes. ErrChanged is returned
+// when the form showed other versions than the current ones, so a signup is
+// never recorded as agreeing to text it didn't see, and ErrTermsRequired when
+// the terms weren't accepted. Opting in to marketing counts only when the form
+// asked for it.
+func (s Settings) Accept(answers Answers, ip string, now time.Time) (Record, error) {
+	var record Record
+	if currentVersion(s.Terms) != answers.TermsVersion || currentVersion(s.Marketing) != answers.MarketingVersion {
+		return record, ErrChanged
+	}
+	if s.Terms == nil && s.Marketing == nil {
+		return record, nil
+	}
+	if s.Terms != nil {
+		if !answers.Terms {
+			return record, ErrTermsRequired
+		}
+		version := s.Terms.Version
+		record.TermsVersion = &version
+	}
+	if s.Marketing != nil {
+		record.Marketing = answers.Marketing
+		version := s.Marketing.Version
+		record.MarketingVersion = &version
+	}
+	at := now.UTC()
+	record.At = &at
+	record.IP = ip
+	return record, nil
+}
+
+// currentVersion is the version a form showing checkbox sends, 0 without it
+func currentVersion(checkbox *Checkbox) int {
+	if checkbox == nil {
+		return 0
+	}
+	return checkbox.Version
+}
+
+// Version is one saved revision of a checkbox's text
+type Version struct {
+	Kind      string    `json:"kind"`
+	Version   int       `json:"version"`
+	Text      string    `json:"text"`
+	URL       string    `json:"url,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
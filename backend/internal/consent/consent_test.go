@@ -0,0 +1,104 @@
+package consent
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestAccept(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	terms := &Checkbox{Text: "I accept the terms", Version: 2}
+	marketing := &Checkbox{Text: "Send me product news", Version: 3}
+	// answers are stored in UTC whatever the server's zone
+	at := now.UTC()
+
+	tests := []struct {
+		name     string
+		settings Settings
+		answers  Answers
+		want     Record
+		wantErr  error
+	}{
+		{name: "no checkboxes", settings: Settings{}, answers: Answers{}, want: Record{}},
+		{name: "no checkboxes but the form showed some", settings: Settings{}, answers: Answers{Terms: true, TermsVersion: 1}, wantErr: ErrChanged},
+		{
+			name:     "terms accepted",
+			settings: Settings{Terms: terms},
+			answers:  Answers{Terms: true, TermsVersion: 2},
+			want:     Record{TermsVersion: intPtr(2), At: &at, IP: "192.0.2.1"},
+		},
+		{name: "terms not accepted", settings: Settings{Terms: terms}, answers: Answers{TermsVersion: 2}, wantErr: ErrTermsRequired},
+		{name: "terms changed", settings: Settings{Terms: terms}, answers: Answers{Terms: true, TermsVersion: 1}, wantErr: ErrChanged},
+		{name: "terms added after the form loaded", settings: Settings{Terms: terms}, answers: Answers{Terms: true}, wantErr: ErrChanged},
+		{
+			name:     "marketing opt in",
+			settings: Settings{Terms: terms, Marketing: marketing},
+			answers:  Answers{Terms: true, TermsVersion: 2, Marketing: true, MarketingVersion: 3},
+			want:     Record{TermsVersion: intPtr(2), Marketing: true, MarketingVersion: intPtr(3), At: &at, IP: "192.0.2.1"},
+		},
+		{
+			name:     "marketing declined",
+			settings: Settings{Marketing: marketing},
+			answers:  Answers{MarketingVersion: 3},
+			want:     Record{MarketingVersion: intPtr(3), At: &at, IP: "192.0.2.1"},
+		},
+		{name: "marketing changed", settings: Settings{Terms: terms, Marketing: marketing}, answers: Answers{Terms: true, TermsVersion: 2, Marketing: true, MarketingVersion: 2}, wantErr: ErrChanged},
+		{name: "marketing removed", settings: Settings{Terms: terms}, answers: Answers{Terms: true, TermsVersion: 2, Marketing: true, MarketingVersion: 3}, wantErr: ErrChanged},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.settings.Accept(tt.answers, "192.0.2.1", now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Accept error = %v, want %v", err, tt.wantErr)
+			}
+			if formatRecord(got) != formatRecord(tt.want) {
+				t.Errorf("Accept = %s, want %s", formatRecord(got), formatRecord(tt.want))
+			}
+		})
+	}
+}
+
+// formatRecord prints r with its pointers followed, for comparing and reporting
+func formatRecord(r Record) string {
+	version := func(v *int) string {
+		if v == nil {
+			return "nil"
+		}
+		return strconv.Itoa(*v)
+	}
+	at := "nil"
+	if r.At != nil {
+		at = r.At.Format(time.RFC3339)
+	}
+	return fmt.Sprintf("{terms:%s marketing:%v/%s at:%s ip:%s}", version(r.TermsVersion), r.Marketing, version(r.MarketingVersion), at, r.IP)
+}
+
+func TestSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		wantErr  bool
+	}{
+		{name: "empty", settings: Settings{}},
+		{name: "terms with a policy link", settings: Settings{Terms: &Checkbox{Text: "I accept the terms", URL: "https://example.com/terms"}}},
+		{name: "blank text", settings: Settings{Marketing: &Checkbox{Text: "  "}}, wantErr: true},
+		{name: "text too long", settings: Settings{Terms: &Checkbox{Text: strings.Repeat("a", maxTextLength+1)}}, wantErr: true},
+		{name: "non http link", settings: Settings{Terms: &Checkbox{Text: "Terms", URL: "javascript:alert(1)"}}, wantErr: true},
+		{name: "relative link", settings: Settings{Terms: &Checkbox{Text: "Terms", URL: "/terms"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.settings.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
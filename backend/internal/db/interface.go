@@ -2,7 +2,9 @@ package db
 
 import (
 	"context"
+	"time"
 
+	"github.com/anish-chanda/openwaitlist/backend/internal/consent"
 	"github.com/anish-chanda/openwaitlist/backend/internal/models"
 )
 
@@ -11,6 +13,13 @@ type Database interface {
 	// AUTH Stuff
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	CreateUser(ctx context.Context, user *models.User) error
+	RecordLoginAttempt(ctx context.Context, attempt *models.LoginAttempt) error
+	GetAccountLockout(ctx context.Context, email string) (*models.AccountLockout, error)
+	RecordFailedLogin(ctx context.Context, email string, threshold int, baseLock, maxLock time.Duration) (lockout *models.AccountLockout, locked bool, err error)
+	ClearAccountLockout(ctx context.Context, email string) error
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	GetAccountData(ctx context.Context, userID int64) (*models.AccountData, error)
+	DeleteUser(ctx context.Context, userID int64) error
 
 	// WAITLIST Stuff
 	GetWaitlistsByUserID(ctx context.Context, userID int64, searchName string) ([]*models.Waitlist, error)
@@ -19,10 +28,82 @@ type Database interface {
 	GetWaitlistBySlug(ctx context.Context, slug string) (*models.Waitlist, error)
 	UpdateWaitlist(ctx context.Context, waitlist *models.Waitlist) error
 	DeleteWaitlist(ctx context.Context, id int64) error
+	ListConsentVersions(ctx context.Context, waitlistID int64) ([]*consent.Version, error)
+	OfferWaitlistTransfer(ctx context.Context, waitlistID, fromUserID, toUserID int64) error
+	CancelWaitlistTransfer(ctx context.Context, waitlistID int64) error
+	ListWaitlistTransfers(ctx context.Context, toUserID int64) ([]*models.WaitlistTransfer, error)
+	AcceptWaitlistTransfer(ctx context.Context, transferID, toUserID int64) (*models.Waitlist, error)
+	DeclineWaitlistTransfer(ctx context.Context, transferID, toUserID int64) error
+
+	// SIGNUP Stuff
+	CreateWaitlistSignup(ctx context.Context, signup *models.WaitlistSignup) error
+	ListWaitlistSignups(ctx context.Context, waitlistID int64, filter models.SignupFilter) (signups []*models.WaitlistSignup, total int64, err error)
+	GetWaitlistSignup(ctx context.Context, waitlistID, signupID int64) (*models.WaitlistSignup, error)
+	GetWaitlistSignupByReferralCode(ctx context.Context, waitlistID int64, code string) (*models.WaitlistSignup, error)
+	UpdateWaitlistSignup(ctx context.Context, signup *models.WaitlistSignup) error
+	DeleteWaitlistSignups(ctx context.Context, waitlistID int64, signupIDs []int64) (int64, error)
+	MarkWaitlistSignupsInvited(ctx context.Context, waitlistID int64, signupIDs []int64, invitedAt time.Time) (int64, error)
+	MoveWaitlistSignupsToTop(ctx context.Context, waitlistID int64, signupIDs []int64) (int64, error)
+	MoveWaitlistSignup(ctx context.Context, waitlistID, signupID, position int64) error
+	CountAdmittedSignups(ctx context.Context, waitlistID int64) (int64, error)
+	AdmitQueuedSignups(ctx context.Context, waitlistID int64, joinedBefore time.Time) (int64, error)
+
+	// INVITE Stuff
+	CreateInviteCodes(ctx context.Context, invites []*models.InviteCode, invitedAt time.Time) error
+	ListInviteCodes(ctx context.Context, waitlistID int64, filter models.InviteCodeFilter) (invites []*models.InviteCode, total int64, err error)
+	RevokeInviteCode(ctx context.Context, waitlistID, inviteID int64, now time.Time) (*models.InviteCode, error)
+	GetRedeemableInviteCode(ctx context.Context, waitlistID int64, codeHash []byte, now time.Time) (*models.InviteCode, error)
+	RedeemInviteCode(ctx context.Context, waitlistID int64, codeHash []byte, now time.Time) (*models.InviteCode, error)
+	GetInviteSigningKey(ctx context.Context, waitlistID int64, newKey []byte) ([]byte, error)
+	RotateInviteSigningKey(ctx context.Context, waitlistID int64, key []byte) error
+
+	// DATA REQUEST Stuff
+	GetSubscriberData(ctx context.Context, email string) (*models.SubscriberData, error)
+	EraseSubscriber(ctx context.Context, email, mode string) (erased int64, waitlistIDs []int64, err error)
+	RecordDataRequest(ctx context.Context, request *models.DataRequest) error
+
+	// SUPPRESSION Stuff
+	SuppressEmail(ctx context.Context, suppression *models.EmailSuppression) error
+	RemoveEmailSuppression(ctx context.Context, email, reason string) (bool, error)
+	GetEmailSuppression(ctx context.Context, email string) (*models.EmailSuppression, error)
+	UpdateSignupSubscription(ctx context.Context, signupID int64, email string, subscribed, marketing bool) error
+
+	// STATS Stuff
+	GetWaitlistStats(ctx context.Context, waitlistID int64, query models.StatsQuery) (*models.WaitlistStats, error)
+	RefreshSignupRollups(ctx context.Context, now time.Time, lookback time.Duration) error
+
+	// VIEW Stuff
+	GetViewSalt(ctx context.Context, day time.Time, salt []byte) ([]byte, error)
+	RecordWaitlistView(ctx context.Context, waitlistID int64, day time.Time, visitorHash []byte) error
+	DeleteExpiredViewVisitors(ctx context.Context, day time.Time) error
+
+	// EVENT Stuff
+	ListScheduledWaitlists(ctx context.Context) ([]*models.Waitlist, error)
+	RecordWaitlistEvent(ctx context.Context, event *models.WaitlistEvent) (recorded bool, err error)
+
+	// JOB Stuff
+	EnqueueJob(ctx context.Context, job *models.Job) (enqueued bool, err error)
+	EnqueueScheduledJob(ctx context.Context, schedule, spec string, now, next time.Time, job *models.Job) (enqueued bool, err error)
+	ClaimJob(ctx context.Context, kinds []string, worker string) (*models.Job, error)
+	CompleteJob(ctx context.Context, id int64) error
+	FailJob(ctx context.Context, id int64, lastError string, retryAt *time.Time) error
+	SnoozeJob(ctx context.Context, id int64, runAt time.Time) error
+	ReleaseStaleJobs(ctx context.Context, lockedBefore time.Time) (int64, error)
+	ListJobs(ctx context.Context, filter models.JobFilter) (jobs []*models.Job, total int64, err error)
+	CountJobs(ctx context.Context) ([]*models.JobCount, error)
+	GetJob(ctx context.Context, id int64) (*models.Job, error)
+	RetryJob(ctx context.Context, id int64) (*models.Job, error)
+	RetryDeadJobs(ctx context.Context, kind string) (int64, error)
+	DeleteJob(ctx context.Context, id int64) error
+
+	// RATE LIMIT Stuff
+	TakeRateLimitToken(ctx context.Context, key string, capacity int, window time.Duration) (allowed bool, tokens float64, err error)
+	DeleteExpiredRateLimits(ctx context.Context, now time.Time) error
 
 	// other helper functions
 	Connect(dsn string) error
 	Ping(ctx context.Context) error
 	Close() error
 	Migrate() error
+	PendingMigrations(ctx context.Context) ([]string, error)
 }
@@ -0,0 +1,168 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// GetUserByID returns a dashboard user
+func (s *PostgresDB) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetUserByID")
+	defer done()
+
+	query := `
+		SELECT id, email, auth_provider, password_hash, created_at, updated_at, display_name
+		FROM users
+		WHERE id = $1
+	`
+	var user models.User
+	err := s.conn.QueryRow(ctx, query, id).Scan(
+		&user.ID, &user.Email, &user.AuthProvider, &user.PasswordHash, &user.CreatedAt, &user.UpdatedAt, &user.DisplayName,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		s.log.Error("Error getting user by id: ", err)
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+	return &user, nil
+}
+
+// GetAccountData returns a user with every waitlist they own and their login
+// history, read in one snapshot
+func (s *PostgresDB) GetAccountData(ctx context.Context, userID int64) (*models.AccountData, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetAccountData")
+	defer done()
+
+	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	data := &models.AccountData{User: &models.User{}}
+	err = tx.QueryRow(ctx, `
+		SELECT id, email, auth_provider, password_hash, created_at, updated_at, display_name
+		FROM users
+		WHERE id = $1
+	`, userID).Scan(
+		&data.User.ID, &data.User.Email, &data.User.AuthProvider, &data.User.PasswordHash,
+		&data.User.CreatedAt, &data.User.UpdatedAt, &data.User.DisplayName,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		s.log.Error("Error getting account user: ", err)
+		return nil, fmt.Errorf("error getting user: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT `+waitlistColumns+` FROM waitlists WHERE owner_user_id = $1 ORDER BY created_at, id`, userID)
+	if err != nil {
+		s.log.Error("Error querying account waitlists: ", err)
+		return nil, fmt.Errorf("error querying account waitlists: %w", err)
+	}
+	data.Waitlists, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.Waitlist, error) {
+		return scanWaitlist(row)
+	})
+	if err != nil {
+		s.log.Error("Error scanning account waitlists: ", err)
+		return nil, fmt.Errorf("error scanning account waitlists: %w", err)
+	}
+
+	// attempts made before the account existed only carry the email
+	rows, err = tx.Query(ctx, `
+		SELECT id, email, user_id, ip, succeeded, blocked, attempted_at
+		FROM login_attempts
+		WHERE user_id = $1 OR lower(email) = lower($2)
+		ORDER BY attempted_at, id
+	`, userID, data.User.Email)
+	if err != nil {
+		s.log.Error("Error querying account login attempts: ", err)
+		return nil, fmt.Errorf("error querying account login attempts: %w", err)
+	}
+	data.LoginAttempts, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.LoginAttempt, error) {
+		var attempt models.LoginAttempt
+		err := row.Scan(&attempt.ID, &attempt.Email, &attempt.UserID, &attempt.IP, &attempt.Succeeded, &attempt.Blocked, &attempt.AttemptedAt)
+		return &attempt, err
+	})
+	if err != nil {
+		s.log.Error("Error scanning account login attempts: ", err)
+		return nil, fmt.Errorf("error scanning account login attempts: %w", err)
+	}
+
+	return data, nil
+}
+
+// DeleteUser deletes a dashboard user with their login history and lockout.
+// Waitlists reference their owner with ON DELETE RESTRICT, so active waitlists
+// block the deletion with "user owns active waitlists" until they are archived
+// or their transfer is accepted. Archived waitlists are deleted along with their
+// signups, and transfer offers from or to the user go with it.
+func (s *PostgresDB) DeleteUser(ctx context.Context, userID int64) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "DeleteUser")
+	defer done()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var email string
+	err = tx.QueryRow(ctx, `SELECT email FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&email)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("user not found")
+		}
+		s.log.Error("Error locking user: ", err)
+		return fmt.Errorf("error locking user: %w", err)
+	}
+
+	var active int64
+	err = tx.QueryRow(ctx, `SELECT count(*) FROM waitlists WHERE owner_user_id = $1 AND archived_at IS NULL`, userID).Scan(&active)
+	if err != nil {
+		s.log.Error("Error counting active waitlists: ", err)
+		return fmt.Errorf("error counting active waitlists: %w", err)
+	}
+	if active > 0 {
+		return fmt.Errorf("user owns active waitlists")
+	}
+
+	// archived waitlists go with their signups, and login attempts made before the
+	// account existed only match by email
+	deletes := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`DELETE FROM waitlists WHERE owner_user_id = $1`, []interface{}{userID}},
+		{`DELETE FROM login_attempts WHERE user_id = $1 OR lower(email) = lower($2)`, []interface{}{userID, email}},
+		{`DELETE FROM account_lockouts WHERE email = lower($1)`, []interface{}{email}},
+		{`DELETE FROM users WHERE id = $1`, []interface{}{userID}},
+	}
+	for _, del := range deletes {
+		if _, err := tx.Exec(ctx, del.query, del.args...); err != nil {
+			s.log.Error("Error deleting user: ", err)
+			return fmt.Errorf("error deleting user: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing user deletion: ", err)
+		return fmt.Errorf("error committing user deletion: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/consent"
+	"github.com/jackc/pgx/v5"
+)
+
+// saveConsentVersions sets the version of each of a waitlist's consent
+// checkboxes, adding a new version when its text or URL differs from the latest
+// saved one. Versions sent by clients are ignored.
+func saveConsentVersions(ctx context.Context, tx pgx.Tx, waitlistID int64, settings *consent.Settings) error {
+	for kind, checkbox := range settings.Checkboxes() {
+		var latest consent.Version
+		err := tx.QueryRow(ctx, `
+			SELECT version, text, url FROM waitlist_consent_versions
+			WHERE waitlist_id = $1 AND kind = $2
+			ORDER BY version DESC
+			LIMIT 1
+		`, waitlistID, kind).Scan(&latest.Version, &latest.Text, &latest.URL)
+		if err != nil && err != pgx.ErrNoRows {
+			return err
+		}
+		if err == nil && latest.Text == checkbox.Text && latest.URL == checkbox.URL {
+			checkbox.Version = latest.Version
+			continue
+		}
+
+		checkbox.Version = latest.Version + 1
+		_, err = tx.Exec(ctx, `
+			INSERT INTO waitlist_consent_versions (waitlist_id, kind, version, text, url)
+			VALUES ($1, $2, $3, $4, $5)
+		`, waitlistID, kind, checkbox.Version, checkbox.Text, checkbox.URL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListConsentVersions returns every version of a waitlist's consent text by
+// checkbox, newest first
+func (s *PostgresDB) ListConsentVersions(ctx context.Context, waitlistID int64) ([]*consent.Version, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ListConsentVersions")
+	defer done()
+
+	rows, err := s.conn.Query(ctx, `
+		SELECT kind, version, text, url, created_at
+		FROM waitlist_consent_versions
+		WHERE waitlist_id = $1
+		ORDER BY kind DESC, version DESC
+	`, waitlistID)
+	if err != nil {
+		s.log.Error("Error querying consent versions: ", err)
+		return nil, fmt.Errorf("error querying consent versions: %w", err)
+	}
+	versions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*consent.Version, error) {
+		var version consent.Version
+		err := row.Scan(&version.Kind, &version.Version, &version.Text, &version.URL, &version.CreatedAt)
+		return &version, err
+	})
+	if err != nil {
+		s.log.Error("Error scanning consent versions: ", err)
+		return nil, fmt.Errorf("error scanning consent versions: %w", err)
+	}
+	return versions, nil
+}
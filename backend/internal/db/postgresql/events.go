@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// ListScheduledWaitlists returns the waitlists with a signup window or capacity
+func (s *PostgresDB) ListScheduledWaitlists(ctx context.Context) ([]*models.Waitlist, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ListScheduledWaitlists")
+	defer done()
+
+	query := `
+		SELECT ` + waitlistColumns + `
+		FROM waitlists
+		WHERE archived_at IS NULL
+			AND (opens_at IS NOT NULL OR closes_at IS NOT NULL OR max_signups IS NOT NULL)
+	`
+	rows, err := s.conn.Query(ctx, query)
+	if err != nil {
+		s.log.Error("Error querying scheduled waitlists: ", err)
+		return nil, fmt.Errorf("error querying scheduled waitlists: %w", err)
+	}
+	defer rows.Close()
+
+	var waitlists []*models.Waitlist
+	for rows.Next() {
+		waitlist, err := scanWaitlist(rows)
+		if err != nil {
+			s.log.Error("Error scanning waitlist row: ", err)
+			return nil, fmt.Errorf("error scanning waitlist: %w", err)
+		}
+		waitlists = append(waitlists, waitlist)
+	}
+	if err := rows.Err(); err != nil {
+		s.log.Error("Error iterating waitlist rows: ", err)
+		return nil, fmt.Errorf("error iterating waitlists: %w", err)
+	}
+	return waitlists, nil
+}
+
+// RecordWaitlistEvent stores an event unless one with the same dedup key was
+// already recorded for the waitlist, reporting whether it was stored
+func (s *PostgresDB) RecordWaitlistEvent(ctx context.Context, event *models.WaitlistEvent) (bool, error) {
+	if s.conn == nil {
+		return false, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RecordWaitlistEvent")
+	defer done()
+
+	query := `
+		INSERT INTO waitlist_events (waitlist_id, type, dedup_key, data)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (waitlist_id, dedup_key) DO NOTHING
+		RETURNING id, created_at
+	`
+	data := event.Data
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	err := s.conn.QueryRow(ctx, query, event.WaitlistID, event.Type, event.DedupKey, data).Scan(&event.ID, &event.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		s.log.Error("Error recording waitlist event: ", err)
+		return false, fmt.Errorf("error recording waitlist event: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,280 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// inviteColumns is the column list every invite code query selects, in scanInviteCode order
+const inviteColumns = `id, waitlist_id, signup_id, code_hash, code_hint, max_uses, uses,
+	expires_at, revoked_at, last_used_at, created_at`
+
+// scanInviteCode scans a row selected with inviteColumns, followed by any extra columns
+func scanInviteCode(row pgx.Row, extra ...interface{}) (*models.InviteCode, error) {
+	var invite models.InviteCode
+	dest := []interface{}{
+		&invite.ID,
+		&invite.WaitlistID,
+		&invite.SignupID,
+		&invite.CodeHash,
+		&invite.CodeHint,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.ExpiresAt,
+		&invite.RevokedAt,
+		&invite.LastUsedAt,
+		&invite.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// CreateInviteCodes adds invite codes in one transaction, filling in their IDs
+// and creation times, and moves the waiting signups they were made for to invited
+func (s *PostgresDB) CreateInviteCodes(ctx context.Context, invites []*models.InviteCode, invitedAt time.Time) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "CreateInviteCodes")
+	defer done()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, invite := range invites {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO invite_codes (waitlist_id, signup_id, code_hash, code_hint, max_uses, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at
+		`, invite.WaitlistID, invite.SignupID, invite.CodeHash, invite.CodeHint, invite.MaxUses, invite.ExpiresAt,
+		).Scan(&invite.ID, &invite.CreatedAt)
+		if err != nil {
+			s.log.Error("Error creating invite code: ", err)
+			return fmt.Errorf("error creating invite code: %w", err)
+		}
+		if invite.SignupID == nil {
+			continue
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE waitlist_signups
+			SET status = 'invited', invited_at = coalesce(invited_at, $3)
+			WHERE waitlist_id = $1 AND id = $2 AND status = 'waiting'
+		`, invite.WaitlistID, *invite.SignupID, invitedAt)
+		if err != nil {
+			s.log.Error("Error marking invited signup: ", err)
+			return fmt.Errorf("error marking invited signup: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing invite codes: ", err)
+		return fmt.Errorf("error committing invite codes: %w", err)
+	}
+	return nil
+}
+
+// ListInviteCodes returns a page of a waitlist's invite codes, newest first,
+// and how many match the filter
+func (s *PostgresDB) ListInviteCodes(ctx context.Context, waitlistID int64, filter models.InviteCodeFilter) ([]*models.InviteCode, int64, error) {
+	if s.conn == nil {
+		return nil, 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ListInviteCodes")
+	defer done()
+
+	args := []interface{}{waitlistID}
+	query := "SELECT " + inviteColumns + ", count(*) OVER () FROM invite_codes WHERE waitlist_id = $1"
+	if filter.SignupID != nil {
+		args = append(args, *filter.SignupID)
+		query += fmt.Sprintf(" AND signup_id = $%d", len(args))
+	}
+	query += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		s.log.Error("Error querying invite codes: ", err)
+		return nil, 0, fmt.Errorf("error querying invite codes: %w", err)
+	}
+	defer rows.Close()
+
+	invites := []*models.InviteCode{}
+	var total int64
+	for rows.Next() {
+		invite, err := scanInviteCode(rows, &total)
+		if err != nil {
+			s.log.Error("Error scanning invite code row: ", err)
+			return nil, 0, fmt.Errorf("error scanning invite code: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		s.log.Error("Error iterating invite code rows: ", err)
+		return nil, 0, fmt.Errorf("error iterating invite codes: %w", err)
+	}
+	return invites, total, nil
+}
+
+// RevokeInviteCode stops an invite code from being redeemed, returning an
+// "invite not found" error when the waitlist has no such code
+func (s *PostgresDB) RevokeInviteCode(ctx context.Context, waitlistID, inviteID int64, now time.Time) (*models.InviteCode, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RevokeInviteCode")
+	defer done()
+
+	invite, err := scanInviteCode(s.conn.QueryRow(ctx, `
+		UPDATE invite_codes SET revoked_at = coalesce(revoked_at, $3)
+		WHERE waitlist_id = $1 AND id = $2
+		RETURNING `+inviteColumns,
+		waitlistID, inviteID, now))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("invite not found")
+		}
+		s.log.Error("Error revoking invite code: ", err)
+		return nil, fmt.Errorf("error revoking invite code: %w", err)
+	}
+	return invite, nil
+}
+
+// GetRedeemableInviteCode returns the waitlist's code with the given hash without
+// using it up. Unknown, revoked, expired and used up codes all return an
+// "invite not found" error.
+func (s *PostgresDB) GetRedeemableInviteCode(ctx context.Context, waitlistID int64, codeHash []byte, now time.Time) (*models.InviteCode, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetRedeemableInviteCode")
+	defer done()
+
+	invite, err := scanInviteCode(s.conn.QueryRow(ctx, `
+		SELECT `+inviteColumns+` FROM invite_codes
+		WHERE waitlist_id = $1 AND code_hash = $2 AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > $3)
+			AND (max_uses IS NULL OR uses < max_uses)
+	`, waitlistID, codeHash, now))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("invite not found")
+		}
+		s.log.Error("Error getting invite code: ", err)
+		return nil, fmt.Errorf("error getting invite code: %w", err)
+	}
+	return invite, nil
+}
+
+// RedeemInviteCode uses up one redemption of the waitlist's code with the given
+// hash and accepts the signup it was made for. Unknown, revoked, expired and used
+// up codes all return an "invite not found" error.
+func (s *PostgresDB) RedeemInviteCode(ctx context.Context, waitlistID int64, codeHash []byte, now time.Time) (*models.InviteCode, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RedeemInviteCode")
+	defer done()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	invite, err := scanInviteCode(tx.QueryRow(ctx, `
+		UPDATE invite_codes SET uses = uses + 1, last_used_at = $3
+		WHERE waitlist_id = $1 AND code_hash = $2 AND revoked_at IS NULL
+			AND (expires_at IS NULL OR expires_at > $3)
+			AND (max_uses IS NULL OR uses < max_uses)
+		RETURNING `+inviteColumns,
+		waitlistID, codeHash, now))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("invite not found")
+		}
+		s.log.Error("Error redeeming invite code: ", err)
+		return nil, fmt.Errorf("error redeeming invite code: %w", err)
+	}
+
+	if invite.SignupID != nil {
+		_, err := tx.Exec(ctx, `
+			UPDATE waitlist_signups SET status = 'accepted', invited_at = coalesce(invited_at, $2)
+			WHERE id = $1 AND status <> 'accepted'
+		`, *invite.SignupID, now)
+		if err != nil {
+			s.log.Error("Error accepting invited signup: ", err)
+			return nil, fmt.Errorf("error accepting invited signup: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing invite redemption: ", err)
+		return nil, fmt.Errorf("error committing invite redemption: %w", err)
+	}
+	return invite, nil
+}
+
+// GetInviteSigningKey returns the key signing a waitlist's access tokens,
+// storing newKey as the key when it has none yet
+func (s *PostgresDB) GetInviteSigningKey(ctx context.Context, waitlistID int64, newKey []byte) ([]byte, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetInviteSigningKey")
+	defer done()
+
+	// the select doesn't see the row the insert adds, so one of them returns a key
+	// unless another request committed the key after the snapshot was taken, which
+	// a fresh SELECT then finds
+	var key []byte
+	err := s.conn.QueryRow(ctx, `
+		WITH created AS (
+			INSERT INTO waitlist_invite_keys (waitlist_id, secret) VALUES ($1, $2)
+			ON CONFLICT (waitlist_id) DO NOTHING
+			RETURNING secret
+		)
+		SELECT secret FROM created
+		UNION ALL
+		SELECT secret FROM waitlist_invite_keys WHERE waitlist_id = $1
+		LIMIT 1
+	`, waitlistID, newKey).Scan(&key)
+	if err == pgx.ErrNoRows {
+		err = s.conn.QueryRow(ctx, `SELECT secret FROM waitlist_invite_keys WHERE waitlist_id = $1`, waitlistID).Scan(&key)
+	}
+	if err != nil {
+		s.log.Error("Error getting invite signing key: ", err)
+		return nil, fmt.Errorf("error getting invite signing key: %w", err)
+	}
+	return key, nil
+}
+
+// RotateInviteSigningKey replaces the key signing a waitlist's access tokens
+func (s *PostgresDB) RotateInviteSigningKey(ctx context.Context, waitlistID int64, key []byte) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RotateInviteSigningKey")
+	defer done()
+
+	_, err := s.conn.Exec(ctx, `
+		INSERT INTO waitlist_invite_keys (waitlist_id, secret) VALUES ($1, $2)
+		ON CONFLICT (waitlist_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = now()
+	`, waitlistID, key)
+	if err != nil {
+		s.log.Error("Error rotating invite signing key: ", err)
+		return fmt.Errorf("error rotating invite signing key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,440 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// jobColumns is the column list of jobs, in scanJob order
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, run_at, unique_key,
+	locked_by, locked_at, last_error, created_at, updated_at`
+
+// scanJob scans a row selected with jobColumns, followed by extra destinations
+func scanJob(row pgx.Row, extra ...interface{}) (*models.Job, error) {
+	var job models.Job
+	dest := []interface{}{
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.UniqueKey,
+		&job.LockedBy,
+		&job.LockedAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// querier runs queries on the pool or in a transaction
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// insertJob adds a pending job unless one of its kind with the same unique key
+// is pending or running, filling in job and reporting whether it was added
+func insertJob(ctx context.Context, q querier, job *models.Job) (bool, error) {
+	inserted, err := scanJob(q.QueryRow(ctx, `
+		INSERT INTO jobs (kind, payload, max_attempts, run_at, unique_key)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (kind, unique_key) WHERE unique_key IS NOT NULL AND status IN ('pending', 'running')
+		DO NOTHING
+		RETURNING `+jobColumns,
+		job.Kind, job.Payload, job.MaxAttempts, job.RunAt, job.UniqueKey))
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	*job = *inserted
+	return true, nil
+}
+
+// EnqueueJob adds a pending job, filling in its ID and timestamps. When a job of
+// the same kind with the same unique key is already pending or running nothing
+// is added, job is filled in with that one when it can still be read, and false
+// is returned.
+func (s *PostgresDB) EnqueueJob(ctx context.Context, job *models.Job) (bool, error) {
+	if s.conn == nil {
+		return false, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "EnqueueJob")
+	defer done()
+
+	enqueued, err := insertJob(ctx, s.conn, job)
+	if err != nil {
+		s.log.Error("Error enqueueing job: ", err)
+		return false, fmt.Errorf("error enqueueing job: %w", err)
+	}
+	if enqueued || job.UniqueKey == nil {
+		return enqueued, nil
+	}
+
+	// a separate statement, the insert's snapshot can't see the conflicting job
+	existing, err := scanJob(s.conn.QueryRow(ctx, `
+		SELECT `+jobColumns+` FROM jobs
+		WHERE kind = $1 AND unique_key = $2 AND status IN ('pending', 'running')
+	`, job.Kind, *job.UniqueKey))
+	if err != nil && err != pgx.ErrNoRows {
+		s.log.Error("Error getting duplicate job: ", err)
+		return false, fmt.Errorf("error getting duplicate job: %w", err)
+	}
+	if existing != nil {
+		*job = *existing
+	}
+	return false, nil
+}
+
+// EnqueueScheduledJob enqueues job for a recurring schedule when the schedule is
+// due at now, moving it on to next. The first call for a schedule, or one with a
+// changed spec, only records next. Replicas calling it for the same slot enqueue
+// the job once.
+func (s *PostgresDB) EnqueueScheduledJob(ctx context.Context, schedule, spec string, now, next time.Time, job *models.Job) (bool, error) {
+	if s.conn == nil {
+		return false, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "EnqueueScheduledJob")
+	defer done()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		s.log.Error("Error starting transaction: ", err)
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO job_schedules (name, spec, next_run_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE
+		SET spec = EXCLUDED.spec, next_run_at = EXCLUDED.next_run_at, updated_at = now()
+		WHERE job_schedules.spec <> EXCLUDED.spec
+	`, schedule, spec, next)
+	if err != nil {
+		s.log.Error("Error saving job schedule: ", err)
+		return false, fmt.Errorf("error saving job schedule: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE job_schedules SET next_run_at = $2, updated_at = now()
+		WHERE name = $1 AND next_run_at <= $3
+	`, schedule, next, now)
+	if err != nil {
+		s.log.Error("Error claiming job schedule: ", err)
+		return false, fmt.Errorf("error claiming job schedule: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	enqueued, err := insertJob(ctx, tx, job)
+	if err != nil {
+		s.log.Error("Error enqueueing scheduled job: ", err)
+		return false, fmt.Errorf("error enqueueing scheduled job: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing transaction: ", err)
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return enqueued, nil
+}
+
+// ClaimJob locks the oldest due pending job of one of kinds for worker and
+// starts its next attempt. Jobs locked by other workers are skipped, so workers
+// never wait on each other. Returns nil when no job is due.
+func (s *PostgresDB) ClaimJob(ctx context.Context, kinds []string, worker string) (*models.Job, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ClaimJob")
+	defer done()
+
+	job, err := scanJob(s.conn.QueryRow(ctx, `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_by = $2, locked_at = now(), updated_at = now()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = 'pending' AND run_at <= now() AND kind = ANY($1)
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns,
+		kinds, worker))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		s.log.Error("Error claiming job: ", err)
+		return nil, fmt.Errorf("error claiming job: %w", err)
+	}
+	return job, nil
+}
+
+// CompleteJob deletes a job that succeeded
+func (s *PostgresDB) CompleteJob(ctx context.Context, id int64) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "CompleteJob")
+	defer done()
+
+	if _, err := s.conn.Exec(ctx, `DELETE FROM jobs WHERE id = $1`, id); err != nil {
+		s.log.Error("Error completing job: ", err)
+		return fmt.Errorf("error completing job: %w", err)
+	}
+	return nil
+}
+
+// FailJob records a failed attempt of a running job. It is retried at retryAt,
+// or moved to the dead jobs when retryAt is nil.
+func (s *PostgresDB) FailJob(ctx context.Context, id int64, lastError string, retryAt *time.Time) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "FailJob")
+	defer done()
+
+	_, err := s.conn.Exec(ctx, `
+		UPDATE jobs
+		SET status = CASE WHEN $3::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+			run_at = coalesce($3, run_at), last_error = $2,
+			locked_by = NULL, locked_at = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'running'
+	`, id, lastError, retryAt)
+	if err != nil {
+		s.log.Error("Error failing job: ", err)
+		return fmt.Errorf("error failing job: %w", err)
+	}
+	return nil
+}
+
+// SnoozeJob puts a running job back in the queue to run at runAt, giving back
+// the attempt it was claimed with
+func (s *PostgresDB) SnoozeJob(ctx context.Context, id int64, runAt time.Time) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "SnoozeJob")
+	defer done()
+
+	_, err := s.conn.Exec(ctx, `
+		UPDATE jobs
+		SET status = 'pending', run_at = $2, attempts = greatest(attempts - 1, 0),
+			locked_by = NULL, locked_at = NULL, updated_at = now()
+		WHERE id = $1 AND status = 'running'
+	`, id, runAt)
+	if err != nil {
+		s.log.Error("Error snoozing job: ", err)
+		return fmt.Errorf("error snoozing job: %w", err)
+	}
+	return nil
+}
+
+// ReleaseStaleJobs hands back jobs locked before lockedBefore, whose worker
+// stopped without finishing them. They are retried right away, or moved to the
+// dead jobs when they are out of attempts.
+func (s *PostgresDB) ReleaseStaleJobs(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	if s.conn == nil {
+		return 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ReleaseStaleJobs")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `
+		UPDATE jobs
+		SET status = CASE WHEN attempts >= max_attempts THEN 'dead' ELSE 'pending' END,
+			run_at = now(), last_error = 'worker ' || locked_by || ' stopped before finishing',
+			locked_by = NULL, locked_at = NULL, updated_at = now()
+		WHERE status = 'running' AND locked_at < $1
+	`, lockedBefore)
+	if err != nil {
+		s.log.Error("Error releasing stale jobs: ", err)
+		return 0, fmt.Errorf("error releasing stale jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ListJobs returns the jobs matching filter, most recently updated first, and
+// how many match in total
+func (s *PostgresDB) ListJobs(ctx context.Context, filter models.JobFilter) ([]*models.Job, int64, error) {
+	if s.conn == nil {
+		return nil, 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ListJobs")
+	defer done()
+
+	conditions := ""
+	args := []interface{}{}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if filter.Kind != "" {
+		args = append(args, filter.Kind)
+		conditions += fmt.Sprintf(" AND kind = $%d", len(args))
+	}
+	query := "SELECT " + jobColumns + ", count(*) OVER () FROM jobs WHERE true" + conditions + " ORDER BY updated_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		s.log.Error("Error querying jobs: ", err)
+		return nil, 0, fmt.Errorf("error querying jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*models.Job{}
+	var total int64
+	for rows.Next() {
+		job, err := scanJob(rows, &total)
+		if err != nil {
+			s.log.Error("Error scanning job row: ", err)
+			return nil, 0, fmt.Errorf("error scanning job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		s.log.Error("Error iterating job rows: ", err)
+		return nil, 0, fmt.Errorf("error iterating jobs: %w", err)
+	}
+	return jobs, total, nil
+}
+
+// CountJobs returns the number of jobs by kind and status
+func (s *PostgresDB) CountJobs(ctx context.Context) ([]*models.JobCount, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "CountJobs")
+	defer done()
+
+	rows, err := s.conn.Query(ctx, `
+		SELECT kind, status, count(*) FROM jobs GROUP BY kind, status ORDER BY kind, status
+	`)
+	if err != nil {
+		s.log.Error("Error counting jobs: ", err)
+		return nil, fmt.Errorf("error counting jobs: %w", err)
+	}
+	counts, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.JobCount, error) {
+		var count models.JobCount
+		err := row.Scan(&count.Kind, &count.Status, &count.Count)
+		return &count, err
+	})
+	if err != nil {
+		s.log.Error("Error scanning job counts: ", err)
+		return nil, fmt.Errorf("error scanning job counts: %w", err)
+	}
+	return counts, nil
+}
+
+// GetJob returns a job, or a "job not found" error
+func (s *PostgresDB) GetJob(ctx context.Context, id int64) (*models.Job, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetJob")
+	defer done()
+
+	job, err := scanJob(s.conn.QueryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("job not found")
+		}
+		s.log.Error("Error getting job: ", err)
+		return nil, fmt.Errorf("error getting job: %w", err)
+	}
+	return job, nil
+}
+
+// RetryJob queues a dead job again with fresh attempts. Returns a "job not
+// found" error when there is no dead job with the ID, and "job already queued"
+// when another job with its unique key is pending or running.
+func (s *PostgresDB) RetryJob(ctx context.Context, id int64) (*models.Job, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RetryJob")
+	defer done()
+
+	job, err := scanJob(s.conn.QueryRow(ctx, `
+		UPDATE jobs SET status = 'pending', attempts = 0, run_at = now(), updated_at = now()
+		WHERE id = $1 AND status = 'dead'
+		RETURNING `+jobColumns,
+		id))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("job not found")
+		}
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("job already queued")
+		}
+		s.log.Error("Error retrying job: ", err)
+		return nil, fmt.Errorf("error retrying job: %w", err)
+	}
+	return job, nil
+}
+
+// RetryDeadJobs queues every dead job again, or only those of kind when it isn't
+// empty. Dead jobs whose unique key is already queued are left dead, as are all
+// but the latest of those sharing a unique key.
+func (s *PostgresDB) RetryDeadJobs(ctx context.Context, kind string) (int64, error) {
+	if s.conn == nil {
+		return 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RetryDeadJobs")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `
+		UPDATE jobs SET status = 'pending', attempts = 0, run_at = now(), updated_at = now()
+		WHERE id IN (
+			SELECT DISTINCT ON (kind, coalesce(unique_key, id::text)) id
+			FROM jobs d
+			WHERE status = 'dead' AND ($1 = '' OR kind = $1)
+				AND NOT EXISTS (
+					SELECT 1 FROM jobs q
+					WHERE q.kind = d.kind AND q.unique_key = d.unique_key AND q.status IN ('pending', 'running')
+				)
+			ORDER BY kind, coalesce(unique_key, id::text), id DESC
+		)
+	`, kind)
+	if err != nil {
+		s.log.Error("Error retrying dead jobs: ", err)
+		return 0, fmt.Errorf("error retrying dead jobs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// DeleteJob deletes a dead job, or returns a "job not found" error
+func (s *PostgresDB) DeleteJob(ctx context.Context, id int64) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "DeleteJob")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `DELETE FROM jobs WHERE id = $1 AND status = 'dead'`, id)
+	if err != nil {
+		s.log.Error("Error deleting job: ", err)
+		return fmt.Errorf("error deleting job: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("job not found")
+	}
+	return nil
+}
@@ -9,14 +9,20 @@ import (
 	"strings"
 	"time"
 
+	"github.com/anish-chanda/openwaitlist/backend/internal/formfields"
 	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/metrics"
 	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/tracing"
 	"github.com/anish-chanda/openwaitlist/backend/migrations"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type PostgresDB struct {
-	conn *pgx.Conn
+	// conn is a pool since handlers, probes and background work query concurrently
+	conn *pgxpool.Pool
 	log  logger.ServiceLogger
 }
 
@@ -26,12 +32,29 @@ func NewPostgresDB(log logger.ServiceLogger) *PostgresDB {
 	}
 }
 
+// instrument starts a trace span and latency timer for a database operation.
+// Call the returned func when the operation is done.
+func (s *PostgresDB) instrument(ctx context.Context, operation string) (context.Context, func()) {
+	start := time.Now()
+	ctx, span := tracing.StartSpan(ctx, "db."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		tracing.DBAttributes(operation),
+	)
+	return ctx, func() {
+		metrics.ObserveDBQuery(operation, start)
+		span.End()
+	}
+}
+
 // auth functions
 func (s *PostgresDB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	if s.conn == nil {
 		return nil, fmt.Errorf("database connection is not established")
 	}
 
+	ctx, done := s.instrument(ctx, "GetUserByEmail")
+	defer done()
+
 	query := `
 		SELECT id, email, auth_provider, password_hash, created_at, updated_at, display_name
 		FROM users 
@@ -73,6 +96,9 @@ func (s *PostgresDB) CreateUser(ctx context.Context, user *models.User) error {
 		return fmt.Errorf("database connection is not established")
 	}
 
+	ctx, done := s.instrument(ctx, "CreateUser")
+	defer done()
+
 	query := `
 		INSERT INTO users (email, auth_provider, password_hash, created_at, updated_at, display_name)
 		VALUES ($1, $2, $3, $4, $5, $6)
@@ -101,14 +127,250 @@ func (s *PostgresDB) CreateUser(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+// RecordLoginAttempt stores a login attempt for auditing
+func (s *PostgresDB) RecordLoginAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RecordLoginAttempt")
+	defer done()
+
+	query := `
+		INSERT INTO login_attempts (email, user_id, ip, succeeded, blocked, attempted_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	attempt.AttemptedAt = time.Now()
+
+	err := s.conn.QueryRow(ctx, query,
+		attempt.Email,
+		attempt.UserID,
+		attempt.IP,
+		attempt.Succeeded,
+		attempt.Blocked,
+		attempt.AttemptedAt,
+	).Scan(&attempt.ID)
+
+	if err != nil {
+		s.log.Error("Error recording login attempt: ", err)
+		return fmt.Errorf("error recording login attempt: %w", err)
+	}
+
+	return nil
+}
+
+// GetAccountLockout returns the lockout state for email, an email without failed
+// logins gets an empty unlocked state rather than an error
+func (s *PostgresDB) GetAccountLockout(ctx context.Context, email string) (*models.AccountLockout, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetAccountLockout")
+	defer done()
+
+	query := `
+		SELECT email, failed_count, lockout_count, locked_until, updated_at
+		FROM account_lockouts
+		WHERE email = lower($1)
+	`
+
+	var lockout models.AccountLockout
+	err := s.conn.QueryRow(ctx, query, email).Scan(
+		&lockout.Email,
+		&lockout.FailedCount,
+		&lockout.LockoutCount,
+		&lockout.LockedUntil,
+		&lockout.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return &models.AccountLockout{Email: strings.ToLower(email)}, nil
+		}
+		s.log.Error("Error getting account lockout: ", err)
+		return nil, fmt.Errorf("error getting account lockout: %w", err)
+	}
+
+	return &lockout, nil
+}
+
+// RecordFailedLogin counts a failed login for email and locks the account once
+// threshold failures are reached. Each consecutive lock doubles the duration
+// starting at baseLock, capped at maxLock. locked is true only for the call that
+// caused the lock, so callers notify the user once.
+func (s *PostgresDB) RecordFailedLogin(ctx context.Context, email string, threshold int, baseLock, maxLock time.Duration) (*models.AccountLockout, bool, error) {
+	if s.conn == nil {
+		return nil, false, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RecordFailedLogin")
+	defer done()
+
+	countQuery := `
+		INSERT INTO account_lockouts AS l (email, failed_count, updated_at)
+		VALUES (lower($1), 1, now())
+		ON CONFLICT (email) DO UPDATE SET
+			failed_count = l.failed_count + 1,
+			updated_at = now()
+		RETURNING email, failed_count, lockout_count, locked_until, updated_at
+	`
+
+	var lockout models.AccountLockout
+	err := s.conn.QueryRow(ctx, countQuery, email).Scan(
+		&lockout.Email,
+		&lockout.FailedCount,
+		&lockout.LockoutCount,
+		&lockout.LockedUntil,
+		&lockout.UpdatedAt,
+	)
+	if err != nil {
+		s.log.Error("Error recording failed login: ", err)
+		return nil, false, fmt.Errorf("error recording failed login: %w", err)
+	}
+
+	if threshold <= 0 || lockout.FailedCount < threshold {
+		return &lockout, false, nil
+	}
+
+	// the failed_count guard makes sure only one concurrent request applies the lock
+	lockQuery := `
+		UPDATE account_lockouts SET
+			failed_count = 0,
+			lockout_count = lockout_count + 1,
+			locked_until = now() + make_interval(secs => LEAST($3::float8, $2::float8 * power(2, lockout_count))),
+			updated_at = now()
+		WHERE email = $1 AND failed_count >= $4
+		RETURNING failed_count, lockout_count, locked_until, updated_at
+	`
+
+	err = s.conn.QueryRow(ctx, lockQuery,
+		lockout.Email,
+		baseLock.Seconds(),
+		maxLock.Seconds(),
+		threshold,
+	).Scan(
+		&lockout.FailedCount,
+		&lockout.LockoutCount,
+		&lockout.LockedUntil,
+		&lockout.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			// another request locked the account first
+			return &lockout, false, nil
+		}
+		s.log.Error("Error locking account: ", err)
+		return nil, false, fmt.Errorf("error locking account: %w", err)
+	}
+
+	s.log.Debug(fmt.Sprintf("Locked account %s until %s", lockout.Email, lockout.LockedUntil.Format(time.RFC3339)))
+	return &lockout, true, nil
+}
+
+// ClearAccountLockout forgets failed logins and any lock for email
+func (s *PostgresDB) ClearAccountLockout(ctx context.Context, email string) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ClearAccountLockout")
+	defer done()
+
+	if _, err := s.conn.Exec(ctx, `DELETE FROM account_lockouts WHERE email = lower($1)`, email); err != nil {
+		s.log.Error("Error clearing account lockout: ", err)
+		return fmt.Errorf("error clearing account lockout: %w", err)
+	}
+
+	return nil
+}
+
 // Waitlist functions
+
+// waitlistColumns is the column list every waitlist query selects, in scanWaitlist order
+const waitlistColumns = `id, slug, name, description, owner_user_id, is_public, show_vendor_branding, created_at, archived_at,
+	bot_honeypot, bot_min_submit_seconds, bot_pow_difficulty, bot_captcha,
+	email_gmail_aliases, email_block_disposable, email_check_mx, email_allow_domains, email_deny_domains,
+	form_fields, embed_allowed_origins, widget_theme,
+	logo, brand_colors, success_message, redirect_url, share_text,
+	opens_at, closes_at, max_signups, overflow_mode, capture_attribution, consent, invite_callback_url`
+
+// scanWaitlist scans a row selected with waitlistColumns
+func scanWaitlist(row pgx.Row) (*models.Waitlist, error) {
+	var waitlist models.Waitlist
+	err := row.Scan(
+		&waitlist.ID,
+		&waitlist.Slug,
+		&waitlist.Name,
+		&waitlist.Description,
+		&waitlist.OwnerUserID,
+		&waitlist.IsPublic,
+		&waitlist.ShowVendorBranding,
+		&waitlist.CreatedAt,
+		&waitlist.ArchivedAt,
+		&waitlist.BotHoneypot,
+		&waitlist.BotMinSubmitSeconds,
+		&waitlist.BotPowDifficulty,
+		&waitlist.BotCaptcha,
+		&waitlist.EmailGmailAliases,
+		&waitlist.EmailBlockDisposable,
+		&waitlist.EmailCheckMX,
+		&waitlist.EmailAllowDomains,
+		&waitlist.EmailDenyDomains,
+		&waitlist.FormFields,
+		&waitlist.EmbedAllowedOrigins,
+		&waitlist.WidgetTheme,
+		&waitlist.Logo,
+		&waitlist.BrandColors,
+		&waitlist.SuccessMessage,
+		&waitlist.RedirectURL,
+		&waitlist.ShareText,
+		&waitlist.OpensAt,
+		&waitlist.ClosesAt,
+		&waitlist.MaxSignups,
+		&waitlist.OverflowMode,
+		&waitlist.CaptureAttribution,
+		&waitlist.Consent,
+		&waitlist.InviteCallbackURL,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &waitlist, nil
+}
+
+// nonNilStrings turns a nil slice into an empty one, pgx encodes nil as NULL
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// nonNilFields turns a nil schema into an empty one, it would be stored as JSON null
+func nonNilFields(fields formfields.Schema) formfields.Schema {
+	if fields == nil {
+		return formfields.Schema{}
+	}
+	return fields
+}
+
+// overflowMode defaults an unset mode to rejecting
+func overflowMode(mode models.OverflowMode) models.OverflowMode {
+	if mode == "" {
+		return models.OverflowReject
+	}
+	return mode
+}
+
 func (s *PostgresDB) GetWaitlistsByUserID(ctx context.Context, userID int64, searchName string) ([]*models.Waitlist, error) {
 	if s.conn == nil {
 		return nil, fmt.Errorf("database connection is not established")
 	}
 
+	ctx, done := s.instrument(ctx, "GetWaitlistsByUserID")
+	defer done()
+
 	query := `
-		SELECT id, slug, name, owner_user_id, is_public, show_vendor_branding, created_at, archived_at
+		SELECT ` + waitlistColumns + `
 		FROM waitlists 
 		WHERE owner_user_id = $1 AND archived_at IS NULL
 	`
@@ -131,22 +393,12 @@ func (s *PostgresDB) GetWaitlistsByUserID(ctx context.Context, userID int64, sea
 
 	var waitlists []*models.Waitlist
 	for rows.Next() {
-		var waitlist models.Waitlist
-		err := rows.Scan(
-			&waitlist.ID,
-			&waitlist.Slug,
-			&waitlist.Name,
-			&waitlist.OwnerUserID,
-			&waitlist.IsPublic,
-			&waitlist.ShowVendorBranding,
-			&waitlist.CreatedAt,
-			&waitlist.ArchivedAt,
-		)
+		waitlist, err := scanWaitlist(rows)
 		if err != nil {
 			s.log.Error("Error scanning waitlist row: ", err)
 			return nil, fmt.Errorf("error scanning waitlist: %w", err)
 		}
-		waitlists = append(waitlists, &waitlist)
+		waitlists = append(waitlists, waitlist)
 	}
 
 	if err = rows.Err(); err != nil {
@@ -162,21 +414,61 @@ func (s *PostgresDB) CreateWaitlist(ctx context.Context, waitlist *models.Waitli
 		return fmt.Errorf("database connection is not established")
 	}
 
+	ctx, done := s.instrument(ctx, "CreateWaitlist")
+	defer done()
+
 	query := `
-		INSERT INTO waitlists (slug, name, owner_user_id, is_public, show_vendor_branding, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO waitlists (slug, name, description, owner_user_id, is_public, show_vendor_branding, created_at,
+			bot_honeypot, bot_min_submit_seconds, bot_pow_difficulty, bot_captcha,
+			email_gmail_aliases, email_block_disposable, email_check_mx, email_allow_domains, email_deny_domains,
+			form_fields, embed_allowed_origins, widget_theme,
+			logo, brand_colors, success_message, redirect_url, share_text,
+			opens_at, closes_at, max_signups, overflow_mode, capture_attribution, invite_callback_url)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+			$20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30)
 		RETURNING id
 	`
 
 	waitlist.CreatedAt = time.Now()
 
-	err := s.conn.QueryRow(ctx, query,
+	// the consent text is versioned once the waitlist has an ID
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, query,
 		waitlist.Slug,
 		waitlist.Name,
+		waitlist.Description,
 		waitlist.OwnerUserID,
 		waitlist.IsPublic,
 		waitlist.ShowVendorBranding,
 		waitlist.CreatedAt,
+		waitlist.BotHoneypot,
+		waitlist.BotMinSubmitSeconds,
+		waitlist.BotPowDifficulty,
+		waitlist.BotCaptcha,
+		waitlist.EmailGmailAliases,
+		waitlist.EmailBlockDisposable,
+		waitlist.EmailCheckMX,
+		nonNilStrings(waitlist.EmailAllowDomains),
+		nonNilStrings(waitlist.EmailDenyDomains),
+		nonNilFields(waitlist.FormFields),
+		nonNilStrings(waitlist.EmbedAllowedOrigins),
+		waitlist.WidgetTheme,
+		waitlist.Logo,
+		waitlist.BrandColors,
+		waitlist.SuccessMessage,
+		waitlist.RedirectURL,
+		waitlist.ShareText,
+		waitlist.OpensAt,
+		waitlist.ClosesAt,
+		waitlist.MaxSignups,
+		overflowMode(waitlist.OverflowMode),
+		waitlist.CaptureAttribution,
+		waitlist.InviteCallbackURL,
 	).Scan(&waitlist.ID)
 
 	if err != nil {
@@ -184,6 +476,20 @@ func (s *PostgresDB) CreateWaitlist(ctx context.Context, waitlist *models.Waitli
 		return fmt.Errorf("error creating waitlist: %w", err)
 	}
 
+	if err := saveConsentVersions(ctx, tx, waitlist.ID, &waitlist.Consent); err != nil {
+		s.log.Error("Error saving consent versions: ", err)
+		return fmt.Errorf("error saving consent versions: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE waitlists SET consent = $1 WHERE id = $2`, waitlist.Consent, waitlist.ID); err != nil {
+		s.log.Error("Error creating waitlist: ", err)
+		return fmt.Errorf("error creating waitlist: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing waitlist: ", err)
+		return fmt.Errorf("error committing waitlist: %w", err)
+	}
+
 	s.log.Debug(fmt.Sprintf("Created waitlist with ID: %d", waitlist.ID))
 	return nil
 }
@@ -193,26 +499,16 @@ func (s *PostgresDB) GetWaitlistByID(ctx context.Context, id int64) (*models.Wai
 		return nil, fmt.Errorf("database connection is not established")
 	}
 
+	ctx, done := s.instrument(ctx, "GetWaitlistByID")
+	defer done()
+
 	query := `
-		SELECT id, slug, name, owner_user_id, is_public, show_vendor_branding, created_at, archived_at
+		SELECT ` + waitlistColumns + `
 		FROM waitlists 
 		WHERE id = $1 AND archived_at IS NULL
 	`
 
-	row := s.conn.QueryRow(ctx, query, id)
-
-	var waitlist models.Waitlist
-	err := row.Scan(
-		&waitlist.ID,
-		&waitlist.Slug,
-		&waitlist.Name,
-		&waitlist.OwnerUserID,
-		&waitlist.IsPublic,
-		&waitlist.ShowVendorBranding,
-		&waitlist.CreatedAt,
-		&waitlist.ArchivedAt,
-	)
-
+	waitlist, err := scanWaitlist(s.conn.QueryRow(ctx, query, id))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, fmt.Errorf("waitlist not found")
@@ -221,7 +517,7 @@ func (s *PostgresDB) GetWaitlistByID(ctx context.Context, id int64) (*models.Wai
 		return nil, fmt.Errorf("error getting waitlist: %w", err)
 	}
 
-	return &waitlist, nil
+	return waitlist, nil
 }
 
 func (s *PostgresDB) GetWaitlistBySlug(ctx context.Context, slug string) (*models.Waitlist, error) {
@@ -229,26 +525,16 @@ func (s *PostgresDB) GetWaitlistBySlug(ctx context.Context, slug string) (*model
 		return nil, fmt.Errorf("database connection is not established")
 	}
 
+	ctx, done := s.instrument(ctx, "GetWaitlistBySlug")
+	defer done()
+
 	query := `
-		SELECT id, slug, name, owner_user_id, is_public, show_vendor_branding, created_at, archived_at
+		SELECT ` + waitlistColumns + `
 		FROM waitlists 
 		WHERE slug = $1 AND archived_at IS NULL
 	`
 
-	row := s.conn.QueryRow(ctx, query, slug)
-
-	var waitlist models.Waitlist
-	err := row.Scan(
-		&waitlist.ID,
-		&waitlist.Slug,
-		&waitlist.Name,
-		&waitlist.OwnerUserID,
-		&waitlist.IsPublic,
-		&waitlist.ShowVendorBranding,
-		&waitlist.CreatedAt,
-		&waitlist.ArchivedAt,
-	)
-
+	waitlist, err := scanWaitlist(s.conn.QueryRow(ctx, query, slug))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, fmt.Errorf("waitlist not found")
@@ -257,7 +543,7 @@ func (s *PostgresDB) GetWaitlistBySlug(ctx context.Context, slug string) (*model
 		return nil, fmt.Errorf("error getting waitlist: %w", err)
 	}
 
-	return &waitlist, nil
+	return waitlist, nil
 }
 
 func (s *PostgresDB) UpdateWaitlist(ctx context.Context, waitlist *models.Waitlist) error {
@@ -265,17 +551,63 @@ func (s *PostgresDB) UpdateWaitlist(ctx context.Context, waitlist *models.Waitli
 		return fmt.Errorf("database connection is not established")
 	}
 
+	ctx, done := s.instrument(ctx, "UpdateWaitlist")
+	defer done()
+
 	query := `
 		UPDATE waitlists 
-		SET slug = $1, name = $2, is_public = $3, show_vendor_branding = $4
-		WHERE id = $5 AND archived_at IS NULL
+		SET slug = $1, name = $2, is_public = $3, show_vendor_branding = $4,
+			bot_honeypot = $5, bot_min_submit_seconds = $6, bot_pow_difficulty = $7, bot_captcha = $8,
+			email_gmail_aliases = $9, email_block_disposable = $10, email_check_mx = $11,
+			email_allow_domains = $12, email_deny_domains = $13, form_fields = $14,
+			embed_allowed_origins = $15, widget_theme = $16, description = $17,
+			logo = $18, brand_colors = $19, success_message = $20, redirect_url = $21, share_text = $22,
+			opens_at = $23, closes_at = $24, max_signups = $25, overflow_mode = $26,
+			capture_attribution = $27, consent = $28, invite_callback_url = $29
+		WHERE id = $30 AND archived_at IS NULL
 	`
 
-	_, err := s.conn.Exec(ctx, query,
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := saveConsentVersions(ctx, tx, waitlist.ID, &waitlist.Consent); err != nil {
+		s.log.Error("Error saving consent versions: ", err)
+		return fmt.Errorf("error saving consent versions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, query,
 		waitlist.Slug,
 		waitlist.Name,
 		waitlist.IsPublic,
 		waitlist.ShowVendorBranding,
+		waitlist.BotHoneypot,
+		waitlist.BotMinSubmitSeconds,
+		waitlist.BotPowDifficulty,
+		waitlist.BotCaptcha,
+		waitlist.EmailGmailAliases,
+		waitlist.EmailBlockDisposable,
+		waitlist.EmailCheckMX,
+		nonNilStrings(waitlist.EmailAllowDomains),
+		nonNilStrings(waitlist.EmailDenyDomains),
+		nonNilFields(waitlist.FormFields),
+		nonNilStrings(waitlist.EmbedAllowedOrigins),
+		waitlist.WidgetTheme,
+		waitlist.Description,
+		waitlist.Logo,
+		waitlist.BrandColors,
+		waitlist.SuccessMessage,
+		waitlist.RedirectURL,
+		waitlist.ShareText,
+		waitlist.OpensAt,
+		waitlist.ClosesAt,
+		waitlist.MaxSignups,
+		overflowMode(waitlist.OverflowMode),
+		waitlist.CaptureAttribution,
+		waitlist.Consent,
+		waitlist.InviteCallbackURL,
 		waitlist.ID,
 	)
 
@@ -284,6 +616,11 @@ func (s *PostgresDB) UpdateWaitlist(ctx context.Context, waitlist *models.Waitli
 		return fmt.Errorf("error updating waitlist: %w", err)
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing waitlist update: ", err)
+		return fmt.Errorf("error committing waitlist update: %w", err)
+	}
+
 	s.log.Debug(fmt.Sprintf("Updated waitlist with ID: %d", waitlist.ID))
 	return nil
 }
@@ -293,6 +630,9 @@ func (s *PostgresDB) DeleteWaitlist(ctx context.Context, id int64) error {
 		return fmt.Errorf("database connection is not established")
 	}
 
+	ctx, done := s.instrument(ctx, "DeleteWaitlist")
+	defer done()
+
 	// Soft delete by setting archived_at timestamp
 	query := `
 		UPDATE waitlists 
@@ -310,16 +650,77 @@ func (s *PostgresDB) DeleteWaitlist(ctx context.Context, id int64) error {
 	return nil
 }
 
+// Rate limit functions
+
+// TakeRateLimitToken refills the token bucket for key and takes one token from it
+// in a single upsert, so concurrent requests across replicas can't overspend
+func (s *PostgresDB) TakeRateLimitToken(ctx context.Context, key string, capacity int, window time.Duration) (bool, float64, error) {
+	if s.conn == nil {
+		return false, 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "TakeRateLimitToken")
+	defer done()
+
+	// $2 = capacity, $3 = refill per second, $4 = window in seconds
+	query := `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at, expires_at)
+		VALUES ($1, $2::float8 - 1, TRUE, now(), now() + make_interval(secs => $4::float8))
+		ON CONFLICT (key) DO UPDATE SET
+			tokens = CASE
+				WHEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * $3::float8) >= 1
+				THEN LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * $3::float8) - 1
+				ELSE LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * $3::float8)
+			END,
+			allowed = LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::float8 * $3::float8) >= 1,
+			updated_at = now(),
+			expires_at = now() + make_interval(secs => $4::float8)
+		RETURNING allowed, tokens
+	`
+
+	var allowed bool
+	var tokens float64
+	err := s.conn.QueryRow(ctx, query,
+		key,
+		float64(capacity),
+		float64(capacity)/window.Seconds(),
+		window.Seconds(),
+	).Scan(&allowed, &tokens)
+	if err != nil {
+		s.log.Error("Error taking rate limit token: ", err)
+		return false, 0, fmt.Errorf("error taking rate limit token: %w", err)
+	}
+
+	return allowed, tokens, nil
+}
+
+// DeleteExpiredRateLimits removes buckets that have been idle long enough to be full again
+func (s *PostgresDB) DeleteExpiredRateLimits(ctx context.Context, now time.Time) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "DeleteExpiredRateLimits")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE expires_at < $1`, now)
+	if err != nil {
+		s.log.Error("Error deleting expired rate limits: ", err)
+		return fmt.Errorf("error deleting expired rate limits: %w", err)
+	}
+
+	s.log.Debug(fmt.Sprintf("Deleted %d expired rate limit buckets", tag.RowsAffected()))
+	return nil
+}
+
 // Helper functions
 func (s *PostgresDB) Connect(dsn string) error {
-	parsedDSN, err := pgx.ParseConfig(dsn)
+	parsedDSN, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		s.log.Error("Error parsing DSN: ", err)
 		return err
 	}
-	s.log.Debug(fmt.Sprintf("Connecting to Postgres at: %s:%d", parsedDSN.Host, parsedDSN.Port))
+	s.log.Debug(fmt.Sprintf("Connecting to Postgres at: %s:%d", parsedDSN.ConnConfig.Host, parsedDSN.ConnConfig.Port))
 
-	conn, err := pgx.Connect(context.TODO(), dsn)
+	conn, err := pgxpool.NewWithConfig(context.TODO(), parsedDSN)
 	if err != nil {
 		s.log.Error("Failed to connect to PostgreSQL", err)
 		return fmt.Errorf("failed to connect to database: %w", err)
@@ -333,6 +734,8 @@ func (s *PostgresDB) Ping(ctx context.Context) error {
 	if s.conn == nil {
 		return fmt.Errorf("database connection is not established")
 	}
+	ctx, done := s.instrument(ctx, "Ping")
+	defer done()
 	if err := s.conn.Ping(ctx); err != nil {
 		s.log.Error("Database ping failed: ", err)
 		return fmt.Errorf("database ping failed: %w", err)
@@ -361,55 +764,21 @@ func (s *PostgresDB) Migrate() error {
 		return fmt.Errorf("failed to create migrations table: %w", err)
 	}
 
-	// Get migration files
-	migrationsFS, dirName, err := migrations.GetMigrationsFS("postgresql")
+	migrationsFS, migrationFiles, err := listMigrationFiles()
 	if err != nil {
-		s.log.Error("Failed to get migrations filesystem: ", err)
-		return fmt.Errorf("failed to get migrations filesystem: %w", err)
-	}
-
-	// Read all migration files
-	var migrationFiles []string
-	err = fs.WalkDir(migrationsFS, dirName, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if !d.IsDir() && strings.HasSuffix(path, ".up.sql") {
-			migrationFiles = append(migrationFiles, path)
-		}
-		return nil
-	})
-	if err != nil {
-		s.log.Error("Failed to walk migration files: ", err)
-		return fmt.Errorf("failed to walk migration files: %w", err)
+		s.log.Error("Failed to list migration files: ", err)
+		return err
 	}
 
-	// Sort migration files to ensure proper order
-	sort.Strings(migrationFiles)
-
-	// Get already applied migrations
-	appliedMigrations := make(map[string]bool)
-	rows, err := s.conn.Query(context.Background(), "SELECT version FROM schema_migrations")
+	appliedMigrations, err := s.appliedMigrations(context.Background())
 	if err != nil {
 		s.log.Error("Failed to query applied migrations: ", err)
-		return fmt.Errorf("failed to query applied migrations: %w", err)
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var version string
-		if err := rows.Scan(&version); err != nil {
-			s.log.Error("Failed to scan migration version: ", err)
-			return fmt.Errorf("failed to scan migration version: %w", err)
-		}
-		appliedMigrations[version] = true
+		return err
 	}
 
 	// Apply pending migrations
 	for _, migrationFile := range migrationFiles {
-		// Extract version from filename (e.g., "0001_users_and_waitlist_table.up.sql" -> "0001_users_and_waitlist_table")
-		baseName := filepath.Base(migrationFile)
-		version := strings.TrimSuffix(baseName, ".up.sql")
+		version := migrationVersion(migrationFile)
 
 		if appliedMigrations[version] {
 			s.log.Debug(fmt.Sprintf("Migration %s already applied, skipping...", version))
@@ -459,12 +828,90 @@ func (s *PostgresDB) Migrate() error {
 	return nil
 }
 
-func (s *PostgresDB) Close() error {
-	if s.conn != nil {
-		if err := s.conn.Close(context.TODO()); err != nil {
-			return fmt.Errorf("failed to close database connection: %w", err)
+// PendingMigrations returns the versions of embedded migrations not yet applied
+func (s *PostgresDB) PendingMigrations(ctx context.Context) ([]string, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "PendingMigrations")
+	defer done()
+
+	_, migrationFiles, err := listMigrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedMigrations, err := s.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, migrationFile := range migrationFiles {
+		if version := migrationVersion(migrationFile); !appliedMigrations[version] {
+			pending = append(pending, version)
+		}
+	}
+	return pending, nil
+}
+
+// listMigrationFiles returns the embedded migrations FS and its sorted .up.sql files
+func listMigrationFiles() (fs.FS, []string, error) {
+	migrationsFS, dirName, err := migrations.GetMigrationsFS("postgresql")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get migrations filesystem: %w", err)
+	}
+
+	var migrationFiles []string
+	err = fs.WalkDir(migrationsFS, dirName, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".up.sql") {
+			migrationFiles = append(migrationFiles, path)
 		}
 		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to walk migration files: %w", err)
+	}
+
+	// Sort migration files to ensure proper order
+	sort.Strings(migrationFiles)
+	return migrationsFS, migrationFiles, nil
+}
+
+// migrationVersion extracts the version from a migration filename
+// (e.g., "0001_users_and_waitlist_table.up.sql" -> "0001_users_and_waitlist_table")
+func migrationVersion(migrationFile string) string {
+	return strings.TrimSuffix(filepath.Base(migrationFile), ".up.sql")
+}
+
+// appliedMigrations returns the set of versions recorded in schema_migrations
+func (s *PostgresDB) appliedMigrations(ctx context.Context) (map[string]bool, error) {
+	applied := make(map[string]bool)
+	rows, err := s.conn.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to scan migration version: %w", err)
+		}
+		applied[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+func (s *PostgresDB) Close() error {
+	if s.conn != nil {
+		s.conn.Close()
 	}
 	return nil
 }
@@ -0,0 +1,209 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// subjectEvents matches the events about a data subject, by the signup IDs ($1,
+// as text) or the email ($2) in their payload
+const subjectEvents = `(data->>'signup_id' = ANY($1) OR lower(data->>'email') = lower($2))`
+
+// GetSubscriberData returns every signup of an email address, matched case
+// insensitively across all waitlists, and the event payloads about them
+func (s *PostgresDB) GetSubscriberData(ctx context.Context, email string) (*models.SubscriberData, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetSubscriberData")
+	defer done()
+
+	query := `
+		SELECT ` + signupColumns + `, waitlist_slug, waitlist_name
+		FROM (
+			SELECT s.*, w.slug AS waitlist_slug, w.name AS waitlist_name,
+				(SELECT count(*) FROM waitlist_signups o
+					WHERE o.waitlist_id = s.waitlist_id AND (o.sort_key, o.id) <= (s.sort_key, s.id)) AS queue_position,
+				(SELECT count(*) FROM waitlist_signups r WHERE r.referred_by = s.id) AS referral_count
+			FROM waitlist_signups s
+			JOIN waitlists w ON w.id = s.waitlist_id
+			WHERE lower(s.email) = lower($1)
+		) subject
+		ORDER BY created_at, id
+	`
+	rows, err := s.conn.Query(ctx, query, email)
+	if err != nil {
+		s.log.Error("Error querying subscriber signups: ", err)
+		return nil, fmt.Errorf("error querying subscriber signups: %w", err)
+	}
+	defer rows.Close()
+
+	data := &models.SubscriberData{Signups: []*models.SubscriberSignup{}, Events: []*models.WaitlistEvent{}}
+	var signupIDs []string
+	for rows.Next() {
+		var subscriber models.SubscriberSignup
+		signup, err := scanSignup(rows, &subscriber.WaitlistSlug, &subscriber.WaitlistName)
+		if err != nil {
+			s.log.Error("Error scanning subscriber signup row: ", err)
+			return nil, fmt.Errorf("error scanning subscriber signup: %w", err)
+		}
+		subscriber.WaitlistSignup = signup
+		data.Signups = append(data.Signups, &subscriber)
+		signupIDs = append(signupIDs, strconv.FormatInt(signup.ID, 10))
+	}
+	if err := rows.Err(); err != nil {
+		s.log.Error("Error iterating subscriber signup rows: ", err)
+		return nil, fmt.Errorf("error iterating subscriber signups: %w", err)
+	}
+
+	eventsQuery := `
+		SELECT id, waitlist_id, type, dedup_key, data, created_at
+		FROM waitlist_events
+		WHERE ` + subjectEvents + `
+		ORDER BY created_at, id
+	`
+	rows, err = s.conn.Query(ctx, eventsQuery, nonNilStrings(signupIDs), email)
+	if err != nil {
+		s.log.Error("Error querying subscriber events: ", err)
+		return nil, fmt.Errorf("error querying subscriber events: %w", err)
+	}
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.WaitlistEvent, error) {
+		var event models.WaitlistEvent
+		err := row.Scan(&event.ID, &event.WaitlistID, &event.Type, &event.DedupKey, &event.Data, &event.CreatedAt)
+		return &event, err
+	})
+	if err != nil {
+		s.log.Error("Error scanning subscriber events: ", err)
+		return nil, fmt.Errorf("error scanning subscriber events: %w", err)
+	}
+	data.Events = append(data.Events, events...)
+	return data, nil
+}
+
+// EraseSubscriber erases every signup of an email address, matched case
+// insensitively across all waitlists, and scrubs the event payloads about them.
+// ErasureDelete deletes the signups and events. ErasureAnonymize keeps the
+// signups' place, status, timestamps and consent versions for the owners' counts
+// but clears everything personal and replaces the referral code so old links
+// stop working, and strips personal keys from the event payloads. Returns the number of
+// signups erased and the waitlists they were on.
+func (s *PostgresDB) EraseSubscriber(ctx context.Context, email, mode string) (int64, []int64, error) {
+	if s.conn == nil {
+		return 0, nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "EraseSubscriber")
+	defer done()
+
+	if mode != models.ErasureDelete && mode != models.ErasureAnonymize {
+		return 0, nil, fmt.Errorf("unknown erasure mode %q", mode)
+	}
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT id, waitlist_id FROM waitlist_signups WHERE lower(email) = lower($1) FOR UPDATE`, email)
+	if err != nil {
+		s.log.Error("Error querying subscriber signups: ", err)
+		return 0, nil, fmt.Errorf("error querying subscriber signups: %w", err)
+	}
+	var signupIDs []int64
+	var signupKeys []string
+	waitlistIDs := []int64{}
+	seen := map[int64]bool{}
+	for rows.Next() {
+		var signupID, waitlistID int64
+		if err := rows.Scan(&signupID, &waitlistID); err != nil {
+			rows.Close()
+			s.log.Error("Error scanning subscriber signup row: ", err)
+			return 0, nil, fmt.Errorf("error scanning subscriber signup: %w", err)
+		}
+		signupIDs = append(signupIDs, signupID)
+		signupKeys = append(signupKeys, strconv.FormatInt(signupID, 10))
+		if !seen[waitlistID] {
+			seen[waitlistID] = true
+			waitlistIDs = append(waitlistIDs, waitlistID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		s.log.Error("Error iterating subscriber signup rows: ", err)
+		return 0, nil, fmt.Errorf("error iterating subscriber signups: %w", err)
+	}
+
+	eventsQuery := `DELETE FROM waitlist_events WHERE ` + subjectEvents
+	if mode == models.ErasureAnonymize {
+		eventsQuery = `UPDATE waitlist_events SET data = data - 'email' - 'name' - 'answers' #- '{consent,ip}' WHERE ` + subjectEvents
+	}
+	if _, err := tx.Exec(ctx, eventsQuery, nonNilStrings(signupKeys), email); err != nil {
+		s.log.Error("Error erasing subscriber events: ", err)
+		return 0, nil, fmt.Errorf("error erasing subscriber events: %w", err)
+	}
+
+	// running jobs are left to finish, the worker still holds them
+	_, err = tx.Exec(ctx, `
+		DELETE FROM jobs
+		WHERE kind = 'email.send' AND status <> 'running'
+			AND (payload->>'signup_id' = ANY($1) OR lower(payload->>'to') = lower($2))
+	`, nonNilStrings(signupKeys), email)
+	if err != nil {
+		s.log.Error("Error erasing subscriber emails: ", err)
+		return 0, nil, fmt.Errorf("error erasing subscriber emails: %w", err)
+	}
+
+	signupsQuery := `DELETE FROM waitlist_signups WHERE id = ANY($1)`
+	if mode == models.ErasureAnonymize {
+		signupsQuery = `
+			UPDATE waitlist_signups
+			SET email = 'erased-' || id || '@erased.invalid', email_normalized = 'erased-' || id || '@erased.invalid',
+				name = NULL, answers = '{}', tags = '{}', notes = NULL, referred_by = NULL,
+				referral_code = substr(md5(random()::text || id::text), 1, 10),
+				utm_source = '', utm_medium = '', utm_campaign = '', utm_term = '', utm_content = '',
+				referrer = '', landing_url = '', device = '', consent_ip = ''
+			WHERE id = ANY($1)
+		`
+	}
+	tag, err := tx.Exec(ctx, signupsQuery, signupIDs)
+	if err != nil {
+		s.log.Error("Error erasing subscriber signups: ", err)
+		return 0, nil, fmt.Errorf("error erasing subscriber signups: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing subscriber erasure: ", err)
+		return 0, nil, fmt.Errorf("error committing subscriber erasure: %w", err)
+	}
+	return tag.RowsAffected(), waitlistIDs, nil
+}
+
+// RecordDataRequest adds a data subject request to the audit trail
+func (s *PostgresDB) RecordDataRequest(ctx context.Context, request *models.DataRequest) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RecordDataRequest")
+	defer done()
+
+	query := `
+		INSERT INTO data_requests (kind, subject_hash, mode, signups, waitlist_ids)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+	waitlistIDs := request.WaitlistIDs
+	if waitlistIDs == nil {
+		waitlistIDs = []int64{}
+	}
+	err := s.conn.QueryRow(ctx, query, request.Kind, request.SubjectHash, request.Mode, request.Signups, waitlistIDs).
+		Scan(&request.ID, &request.CreatedAt)
+	if err != nil {
+		s.log.Error("Error recording data request: ", err)
+		return fmt.Errorf("error recording data request: %w", err)
+	}
+	return nil
+}
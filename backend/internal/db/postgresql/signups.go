@@ -0,0 +1,651 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// uniqueViolation is the postgres error code for unique constraint violations
+const uniqueViolation = "23505"
+
+// isUniqueViolation reports whether err was caused by a unique constraint
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// violatesConstraint reports whether err was raised by the named constraint or index
+func violatesConstraint(err error, name string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.ConstraintName == name
+}
+
+// signupColumns is the column list selected from rankedSignups, in scanSignup order
+const signupColumns = `id, waitlist_id, email, email_normalized, name, answers, status, verified_at, invited_at,
+	referred_by, referral_code, utm_source, utm_medium, utm_campaign, utm_term, utm_content, referrer, landing_url, device,
+	terms_version, marketing_opt_in, marketing_version, consent_at, consent_ip, unsubscribed_at, tags, notes, created_at, queue_position, referral_count`
+
+// rankedSignups is the FROM clause for a waitlist's signups ($1) with their queue
+// position and referral count. Positions are computed over the whole waitlist so
+// they stay the same whatever conditions are appended after it.
+const rankedSignups = `
+	FROM (
+		SELECT s.*,
+			row_number() OVER (ORDER BY s.sort_key, s.id) AS queue_position,
+			coalesce(r.referral_count, 0) AS referral_count
+		FROM waitlist_signups s
+		LEFT JOIN (
+			SELECT referred_by, count(*) AS referral_count
+			FROM waitlist_signups
+			WHERE waitlist_id = $1 AND referred_by IS NOT NULL
+			GROUP BY referred_by
+		) r ON r.referred_by = s.id
+		WHERE s.waitlist_id = $1
+	) ranked
+	WHERE true`
+
+// signupSortOrders maps models.SignupSorts to ORDER BY clauses
+var signupSortOrders = map[string]string{
+	"position":    "queue_position",
+	"-position":   "queue_position DESC",
+	"created_at":  "created_at, id",
+	"-created_at": "created_at DESC, id DESC",
+	"referrals":   "referral_count, queue_position",
+	"-referrals":  "referral_count DESC, queue_position",
+}
+
+// scanSignup scans a row selected with signupColumns, followed by extra destinations
+func scanSignup(row pgx.Row, extra ...interface{}) (*models.WaitlistSignup, error) {
+	var signup models.WaitlistSignup
+	dest := []interface{}{
+		&signup.ID,
+		&signup.WaitlistID,
+		&signup.Email,
+		&signup.EmailNormalized,
+		&signup.Name,
+		&signup.Answers,
+		&signup.Status,
+		&signup.VerifiedAt,
+		&signup.InvitedAt,
+		&signup.ReferredBy,
+		&signup.ReferralCode,
+		&signup.Attribution.UTMSource,
+		&signup.Attribution.UTMMedium,
+		&signup.Attribution.UTMCampaign,
+		&signup.Attribution.UTMTerm,
+		&signup.Attribution.UTMContent,
+		&signup.Attribution.Referrer,
+		&signup.Attribution.LandingURL,
+		&signup.Attribution.Device,
+		&signup.Consent.TermsVersion,
+		&signup.Consent.Marketing,
+		&signup.Consent.MarketingVersion,
+		&signup.Consent.At,
+		&signup.Consent.IP,
+		&signup.UnsubscribedAt,
+		&signup.Tags,
+		&signup.Notes,
+		&signup.CreatedAt,
+		&signup.Position,
+		&signup.ReferralCount,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &signup, nil
+}
+
+// CreateWaitlistSignup adds a signup to the end of a waitlist and fills in its
+// position. Returns a "signup already exists" error when the normalized email
+// already joined, and "waitlist is full" when a signup that isn't queued would
+// take the waitlist past its max_signups.
+func (s *PostgresDB) CreateWaitlistSignup(ctx context.Context, signup *models.WaitlistSignup) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "CreateWaitlistSignup")
+	defer done()
+
+	if signup.Status == "" {
+		signup.Status = models.SignupStatusWaiting
+	}
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if signup.Status != models.SignupStatusQueued {
+		// only capped waitlists take the row lock, it serializes their signups
+		// so concurrent ones can't overshoot the cap
+		var maxSignups *int64
+		if err := tx.QueryRow(ctx, `SELECT max_signups FROM waitlists WHERE id = $1`, signup.WaitlistID).Scan(&maxSignups); err != nil {
+			s.log.Error("Error getting waitlist capacity: ", err)
+			return fmt.Errorf("error getting waitlist capacity: %w", err)
+		}
+		if maxSignups != nil {
+			// the count runs in its own statement after the lock is held, a
+			// statement's snapshot predates the lock wait and would miss the
+			// signup the previous holder just committed
+			if err := tx.QueryRow(ctx, `SELECT max_signups FROM waitlists WHERE id = $1 FOR UPDATE`, signup.WaitlistID).Scan(&maxSignups); err != nil {
+				s.log.Error("Error locking waitlist: ", err)
+				return fmt.Errorf("error locking waitlist: %w", err)
+			}
+			var admitted int64
+			countQuery := `SELECT count(*) FROM waitlist_signups WHERE waitlist_id = $1 AND status <> 'queued'`
+			if err := tx.QueryRow(ctx, countQuery, signup.WaitlistID).Scan(&admitted); err != nil {
+				s.log.Error("Error checking waitlist capacity: ", err)
+				return fmt.Errorf("error checking waitlist capacity: %w", err)
+			}
+			if maxSignups != nil && admitted >= *maxSignups {
+				return fmt.Errorf("waitlist is full")
+			}
+		}
+	}
+
+	query := `
+		INSERT INTO waitlist_signups (waitlist_id, email, email_normalized, name, answers, referred_by, referral_code, status, created_at,
+			utm_source, utm_medium, utm_campaign, utm_term, utm_content, referrer, landing_url, device,
+			terms_version, marketing_opt_in, marketing_version, consent_at, consent_ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)
+		RETURNING id, tags, sort_key
+	`
+
+	signup.CreatedAt = time.Now()
+
+	var sortKey float64
+	err = tx.QueryRow(ctx, query,
+		signup.WaitlistID,
+		signup.Email,
+		signup.EmailNormalized,
+		signup.Name,
+		nonNilAnswers(signup.Answers),
+		signup.ReferredBy,
+		signup.ReferralCode,
+		signup.Status,
+		signup.CreatedAt,
+		signup.Attribution.UTMSource,
+		signup.Attribution.UTMMedium,
+		signup.Attribution.UTMCampaign,
+		signup.Attribution.UTMTerm,
+		signup.Attribution.UTMContent,
+		signup.Attribution.Referrer,
+		signup.Attribution.LandingURL,
+		signup.Attribution.Device,
+		signup.Consent.TermsVersion,
+		signup.Consent.Marketing,
+		signup.Consent.MarketingVersion,
+		signup.Consent.At,
+		signup.Consent.IP,
+	).Scan(&signup.ID, &signup.Tags, &sortKey)
+
+	if err != nil {
+		if isUniqueViolation(err) && !violatesConstraint(err, "waitlist_signups_referral_code_idx") {
+			return fmt.Errorf("signup already exists")
+		}
+		s.log.Error("Error creating waitlist signup: ", err)
+		return fmt.Errorf("error creating waitlist signup: %w", err)
+	}
+
+	positionQuery := `
+		SELECT count(*) FROM waitlist_signups
+		WHERE waitlist_id = $1 AND (sort_key, id) <= ($2, $3)
+	`
+	if err := tx.QueryRow(ctx, positionQuery, signup.WaitlistID, sortKey, signup.ID).Scan(&signup.Position); err != nil {
+		s.log.Error("Error getting waitlist signup position: ", err)
+		return fmt.Errorf("error getting waitlist signup position: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing waitlist signup: ", err)
+		return fmt.Errorf("error committing waitlist signup: %w", err)
+	}
+
+	s.log.Debug(fmt.Sprintf("Created waitlist signup with ID: %d", signup.ID))
+	return nil
+}
+
+// CountAdmittedSignups counts a waitlist's signups that count towards its
+// capacity, which is all of them except queued ones
+func (s *PostgresDB) CountAdmittedSignups(ctx context.Context, waitlistID int64) (int64, error) {
+	if s.conn == nil {
+		return 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "CountAdmittedSignups")
+	defer done()
+
+	var count int64
+	query := `SELECT count(*) FROM waitlist_signups WHERE waitlist_id = $1 AND status <> 'queued'`
+	if err := s.conn.QueryRow(ctx, query, waitlistID).Scan(&count); err != nil {
+		s.log.Error("Error counting waitlist signups: ", err)
+		return 0, fmt.Errorf("error counting waitlist signups: %w", err)
+	}
+	return count, nil
+}
+
+// AdmitQueuedSignups turns the queued signups of a waitlist that joined before
+// a time into waiting ones, in queue order, as far as its max_signups allows.
+// It takes the waitlist row lock CreateWaitlistSignup takes, so concurrent
+// admissions and signups can't overshoot the cap.
+func (s *PostgresDB) AdmitQueuedSignups(ctx context.Context, waitlistID int64, joinedBefore time.Time) (int64, error) {
+	if s.conn == nil {
+		return 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "AdmitQueuedSignups")
+	defer done()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var maxSignups *int64
+	if err := tx.QueryRow(ctx, `SELECT max_signups FROM waitlists WHERE id = $1 FOR UPDATE`, waitlistID).Scan(&maxSignups); err != nil {
+		s.log.Error("Error locking waitlist: ", err)
+		return 0, fmt.Errorf("error locking waitlist: %w", err)
+	}
+
+	// LIMIT NULL is no limit
+	var limit *int64
+	if maxSignups != nil {
+		var admitted int64
+		countQuery := `SELECT count(*) FROM waitlist_signups WHERE waitlist_id = $1 AND status <> 'queued'`
+		if err := tx.QueryRow(ctx, countQuery, waitlistID).Scan(&admitted); err != nil {
+			s.log.Error("Error checking waitlist capacity: ", err)
+			return 0, fmt.Errorf("error checking waitlist capacity: %w", err)
+		}
+		remaining := *maxSignups - admitted
+		if remaining <= 0 {
+			return 0, nil
+		}
+		limit = &remaining
+	}
+
+	query := `
+		UPDATE waitlist_signups SET status = 'waiting'
+		WHERE id IN (
+			SELECT id FROM waitlist_signups
+			WHERE waitlist_id = $1 AND status = 'queued' AND created_at < $2
+			ORDER BY sort_key, id
+			LIMIT $3
+		)
+	`
+	result, err := tx.Exec(ctx, query, waitlistID, joinedBefore, limit)
+	if err != nil {
+		s.log.Error("Error admitting queued signups: ", err)
+		return 0, fmt.Errorf("error admitting queued signups: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// nonNilAnswers turns nil answers into an empty object, they would be stored as JSON null
+func nonNilAnswers(answers map[string]interface{}) map[string]interface{} {
+	if answers == nil {
+		return map[string]interface{}{}
+	}
+	return answers
+}
+
+// searchTSQuery turns free text into a prefix tsquery matching every word, so
+// "acme eng" finds "Acme Corp" / "engineering". Returns "" when nothing is searchable.
+func searchTSQuery(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+// escapeLike escapes the LIKE wildcards in a literal pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// ListWaitlistSignups returns one page of the signups of a waitlist matching
+// filter, and the total number of matches
+func (s *PostgresDB) ListWaitlistSignups(ctx context.Context, waitlistID int64, filter models.SignupFilter) ([]*models.WaitlistSignup, int64, error) {
+	if s.conn == nil {
+		return nil, 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ListWaitlistSignups")
+	defer done()
+
+	conditions := ""
+	args := []interface{}{waitlistID}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		// emails tokenize as a whole, so partial emails are matched with ILIKE
+		emailMatch := "email ILIKE " + arg("%"+escapeLike(search)+"%")
+		if tsquery := searchTSQuery(search); tsquery != "" {
+			conditions += fmt.Sprintf(" AND (search_vector @@ to_tsquery('simple', %s) OR %s)", arg(tsquery), emailMatch)
+		} else {
+			conditions += " AND " + emailMatch
+		}
+	}
+	if filter.Status != "" {
+		conditions += " AND status = " + arg(filter.Status)
+	}
+	if filter.Verified != nil {
+		if *filter.Verified {
+			conditions += " AND verified_at IS NOT NULL"
+		} else {
+			conditions += " AND verified_at IS NULL"
+		}
+	}
+	if filter.Invited != nil {
+		if *filter.Invited {
+			conditions += " AND invited_at IS NOT NULL"
+		} else {
+			conditions += " AND invited_at IS NULL"
+		}
+	}
+	if filter.MinReferrals != nil {
+		conditions += " AND referral_count >= " + arg(*filter.MinReferrals)
+	}
+	if filter.MaxReferrals != nil {
+		conditions += " AND referral_count <= " + arg(*filter.MaxReferrals)
+	}
+	if filter.CreatedAfter != nil {
+		conditions += " AND created_at >= " + arg(*filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		conditions += " AND created_at < " + arg(*filter.CreatedBefore)
+	}
+	if filter.Tag != "" {
+		conditions += " AND tags @> ARRAY[" + arg(filter.Tag) + "::text]"
+	}
+	if len(filter.Answers) > 0 {
+		conditions += " AND answers @> " + arg(filter.Answers) + "::jsonb"
+	}
+	filterArgs := len(args)
+
+	order, ok := signupSortOrders[filter.Sort]
+	if !ok {
+		order = signupSortOrders["position"]
+	}
+	query := "SELECT " + signupColumns + ", count(*) OVER () " + rankedSignups + conditions + " ORDER BY " + order
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+	if filter.Offset > 0 {
+		query += " OFFSET " + arg(filter.Offset)
+	}
+
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		s.log.Error("Error listing waitlist signups: ", err)
+		return nil, 0, fmt.Errorf("error listing waitlist signups: %w", err)
+	}
+	defer rows.Close()
+
+	var signups []*models.WaitlistSignup
+	var total int64
+	for rows.Next() {
+		signup, err := scanSignup(rows, &total)
+		if err != nil {
+			s.log.Error("Error scanning waitlist signup: ", err)
+			return nil, 0, fmt.Errorf("error scanning waitlist signup: %w", err)
+		}
+		signups = append(signups, signup)
+	}
+	if err := rows.Err(); err != nil {
+		s.log.Error("Error iterating waitlist signups: ", err)
+		return nil, 0, fmt.Errorf("error iterating waitlist signups: %w", err)
+	}
+
+	// the total comes with the rows, a page past the end has to count separately
+	if len(signups) == 0 && filter.Offset > 0 {
+		countQuery := "SELECT count(*) " + rankedSignups + conditions
+		if err := s.conn.QueryRow(ctx, countQuery, args[:filterArgs]...).Scan(&total); err != nil {
+			s.log.Error("Error counting waitlist signups: ", err)
+			return nil, 0, fmt.Errorf("error counting waitlist signups: %w", err)
+		}
+	}
+
+	return signups, total, nil
+}
+
+// GetWaitlistSignup returns one signup of a waitlist
+func (s *PostgresDB) GetWaitlistSignup(ctx context.Context, waitlistID, signupID int64) (*models.WaitlistSignup, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetWaitlistSignup")
+	defer done()
+
+	query := "SELECT " + signupColumns + rankedSignups + " AND id = $2"
+	signup, err := scanSignup(s.conn.QueryRow(ctx, query, waitlistID, signupID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("signup not found")
+		}
+		s.log.Error("Error getting waitlist signup: ", err)
+		return nil, fmt.Errorf("error getting waitlist signup: %w", err)
+	}
+	return signup, nil
+}
+
+// GetWaitlistSignupByReferralCode returns the signup of a waitlist whose referral link carries code
+func (s *PostgresDB) GetWaitlistSignupByReferralCode(ctx context.Context, waitlistID int64, code string) (*models.WaitlistSignup, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetWaitlistSignupByReferralCode")
+	defer done()
+
+	query := "SELECT " + signupColumns + rankedSignups + " AND referral_code = $2"
+	signup, err := scanSignup(s.conn.QueryRow(ctx, query, waitlistID, code))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("signup not found")
+		}
+		s.log.Error("Error getting waitlist signup by referral code: ", err)
+		return nil, fmt.Errorf("error getting waitlist signup: %w", err)
+	}
+	return signup, nil
+}
+
+// UpdateWaitlistSignup saves the owner-editable fields of a signup: status,
+// invited_at, tags and notes
+func (s *PostgresDB) UpdateWaitlistSignup(ctx context.Context, signup *models.WaitlistSignup) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "UpdateWaitlistSignup")
+	defer done()
+
+	query := `
+		UPDATE waitlist_signups
+		SET status = $1, invited_at = $2, tags = $3, notes = $4
+		WHERE waitlist_id = $5 AND id = $6
+	`
+
+	tags := signup.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	tag, err := s.conn.Exec(ctx, query, signup.Status, signup.InvitedAt, tags, signup.Notes, signup.WaitlistID, signup.ID)
+	if err != nil {
+		s.log.Error("Error updating waitlist signup: ", err)
+		return fmt.Errorf("error updating waitlist signup: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("signup not found")
+	}
+	return nil
+}
+
+// DeleteWaitlistSignups removes signups from a waitlist and returns how many were deleted
+func (s *PostgresDB) DeleteWaitlistSignups(ctx context.Context, waitlistID int64, signupIDs []int64) (int64, error) {
+	if s.conn == nil {
+		return 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "DeleteWaitlistSignups")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `DELETE FROM waitlist_signups WHERE waitlist_id = $1 AND id = ANY($2)`, waitlistID, signupIDs)
+	if err != nil {
+		s.log.Error("Error deleting waitlist signups: ", err)
+		return 0, fmt.Errorf("error deleting waitlist signups: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MarkWaitlistSignupsInvited moves waiting signups to invited and returns how many changed
+func (s *PostgresDB) MarkWaitlistSignupsInvited(ctx context.Context, waitlistID int64, signupIDs []int64, invitedAt time.Time) (int64, error) {
+	if s.conn == nil {
+		return 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "MarkWaitlistSignupsInvited")
+	defer done()
+
+	query := `
+		UPDATE waitlist_signups
+		SET status = 'invited', invited_at = coalesce(invited_at, $3)
+		WHERE waitlist_id = $1 AND id = ANY($2) AND status = 'waiting'
+	`
+	tag, err := s.conn.Exec(ctx, query, waitlistID, signupIDs, invitedAt)
+	if err != nil {
+		s.log.Error("Error marking waitlist signups invited: ", err)
+		return 0, fmt.Errorf("error marking waitlist signups invited: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MoveWaitlistSignupsToTop moves signups to the front of the queue, keeping
+// their order relative to each other, and returns how many moved
+func (s *PostgresDB) MoveWaitlistSignupsToTop(ctx context.Context, waitlistID int64, signupIDs []int64) (int64, error) {
+	if s.conn == nil {
+		return 0, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "MoveWaitlistSignupsToTop")
+	defer done()
+
+	query := `
+		WITH head AS (
+			SELECT coalesce(min(sort_key), 0) AS sort_key FROM waitlist_signups WHERE waitlist_id = $1
+		), moved AS (
+			SELECT id, row_number() OVER (ORDER BY sort_key DESC, id DESC) AS n
+			FROM waitlist_signups
+			WHERE waitlist_id = $1 AND id = ANY($2)
+		)
+		UPDATE waitlist_signups s
+		SET sort_key = head.sort_key - moved.n
+		FROM head, moved
+		WHERE s.id = moved.id
+	`
+	tag, err := s.conn.Exec(ctx, query, waitlistID, signupIDs)
+	if err != nil {
+		s.log.Error("Error moving waitlist signups to top: ", err)
+		return 0, fmt.Errorf("error moving waitlist signups to top: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MoveWaitlistSignup places a signup at a 1-based position, positions past the
+// end move it to the back. Moves on a waitlist are serialized so concurrent
+// moves can't pick the same slot.
+func (s *PostgresDB) MoveWaitlistSignup(ctx context.Context, waitlistID, signupID, position int64) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "MoveWaitlistSignup")
+	defer done()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT id FROM waitlists WHERE id = $1 FOR UPDATE`, waitlistID); err != nil {
+		s.log.Error("Error locking waitlist: ", err)
+		return fmt.Errorf("error locking waitlist: %w", err)
+	}
+
+	var exists bool
+	existsQuery := `SELECT EXISTS (SELECT 1 FROM waitlist_signups WHERE waitlist_id = $1 AND id = $2)`
+	if err := tx.QueryRow(ctx, existsQuery, waitlistID, signupID).Scan(&exists); err != nil {
+		s.log.Error("Error getting waitlist signup: ", err)
+		return fmt.Errorf("error getting waitlist signup: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("signup not found")
+	}
+
+	// sort keys of the signups that will end up right before and after it
+	neighboursQuery := `
+		WITH others AS (
+			SELECT sort_key, row_number() OVER (ORDER BY sort_key, id) AS n
+			FROM waitlist_signups
+			WHERE waitlist_id = $1 AND id <> $2
+		)
+		SELECT (SELECT sort_key FROM others WHERE n = $3 - 1), (SELECT sort_key FROM others WHERE n = $3)
+	`
+	var before, after *float64
+	if err := tx.QueryRow(ctx, neighboursQuery, waitlistID, signupID, position).Scan(&before, &after); err != nil {
+		s.log.Error("Error getting waitlist neighbours: ", err)
+		return fmt.Errorf("error getting waitlist neighbours: %w", err)
+	}
+
+	var sortKey float64
+	switch {
+	case before == nil && after == nil:
+		// alone on the waitlist
+		return tx.Commit(ctx)
+	case before == nil:
+		sortKey = *after - 1
+	case after == nil:
+		sortKey = *before + 1
+	default:
+		sortKey = *before + (*after-*before)/2
+	}
+
+	// repeated moves into the same gap eventually run out of float precision,
+	// respace the rest of the waitlist as 1, 2, 3... and slot in between
+	if before != nil && after != nil && (sortKey <= *before || sortKey >= *after) {
+		respace := `
+			UPDATE waitlist_signups s
+			SET sort_key = ordered.n
+			FROM (
+				SELECT id, row_number() OVER (ORDER BY sort_key, id) AS n
+				FROM waitlist_signups WHERE waitlist_id = $1 AND id <> $2
+			) ordered
+			WHERE s.id = ordered.id
+		`
+		if _, err := tx.Exec(ctx, respace, waitlistID, signupID); err != nil {
+			s.log.Error("Error respacing waitlist: ", err)
+			return fmt.Errorf("error respacing waitlist: %w", err)
+		}
+		sortKey = float64(position) - 0.5
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE waitlist_signups SET sort_key = $1 WHERE id = $2`, sortKey, signupID); err != nil {
+		s.log.Error("Error moving waitlist signup: ", err)
+		return fmt.Errorf("error moving waitlist signup: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// Attribution breakdowns of the stats, as SQL expressions over waitlist_signups.
+// A signup's source is its utm_source, else "referral" when it came through a
+// referral link, else the referring site's host, else "direct".
+const (
+	signupSource = `CASE
+		WHEN utm_source <> '' THEN lower(utm_source)
+		WHEN referred_by IS NOT NULL THEN 'referral'
+		WHEN referrer <> '' THEN coalesce(substring(lower(referrer) from '^https?://(?:www\.)?([^/:]+)'), 'direct')
+		ELSE 'direct'
+	END`
+	signupMedium   = `CASE WHEN utm_medium <> '' THEN lower(utm_medium) ELSE 'none' END`
+	signupCampaign = `CASE WHEN utm_campaign <> '' THEN utm_campaign ELSE 'none' END`
+	signupDevice   = `CASE WHEN device <> '' THEN device ELSE 'unknown' END`
+)
+
+// GetWaitlistStats aggregates the signups of a waitlist created in the query's
+// range. Everything is read from one snapshot so the numbers add up.
+func (s *PostgresDB) GetWaitlistStats(ctx context.Context, waitlistID int64, query models.StatsQuery) (*models.WaitlistStats, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetWaitlistStats")
+	defer done()
+
+	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	stats := &models.WaitlistStats{}
+	if stats.Series, err = s.signupSeries(ctx, tx, waitlistID, query); err != nil {
+		return nil, err
+	}
+
+	funnelQuery := `
+		SELECT count(*),
+			count(*) FILTER (WHERE status = 'queued'),
+			count(*) FILTER (WHERE verified_at IS NOT NULL),
+			count(*) FILTER (WHERE invited_at IS NOT NULL OR status = 'accepted'),
+			count(*) FILTER (WHERE status = 'accepted')
+		FROM waitlist_signups
+		WHERE waitlist_id = $1 AND created_at >= $2 AND created_at < $3
+	`
+	funnel := &stats.Funnel
+	err = tx.QueryRow(ctx, funnelQuery, waitlistID, query.From, query.To).
+		Scan(&funnel.Signups, &funnel.Queued, &funnel.Verified, &funnel.Invited, &funnel.Accepted)
+	if err != nil {
+		s.log.Error("Error counting signup funnel: ", err)
+		return nil, fmt.Errorf("error counting signup funnel: %w", err)
+	}
+
+	viewsQuery := `
+		SELECT to_char(day, 'YYYY-MM-DD'), views, visitors
+		FROM waitlist_views
+		WHERE waitlist_id = $1 AND day BETWEEN $2::date AND $3::date
+		ORDER BY day
+	`
+	lastDay := query.To.Add(-time.Nanosecond).UTC().Format("2006-01-02")
+	rows, err := tx.Query(ctx, viewsQuery, waitlistID, query.From.UTC().Format("2006-01-02"), lastDay)
+	if err != nil {
+		s.log.Error("Error querying waitlist views: ", err)
+		return nil, fmt.Errorf("error querying waitlist views: %w", err)
+	}
+	stats.Views.Daily, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.DailyViews, error) {
+		var daily models.DailyViews
+		err := row.Scan(&daily.Day, &daily.Views, &daily.Visitors)
+		return daily, err
+	})
+	if err != nil {
+		s.log.Error("Error scanning waitlist views: ", err)
+		return nil, fmt.Errorf("error scanning waitlist views: %w", err)
+	}
+	if stats.Views.Daily == nil {
+		stats.Views.Daily = []models.DailyViews{}
+	}
+	for _, daily := range stats.Views.Daily {
+		stats.Views.Views += daily.Views
+		stats.Views.Visitors += daily.Visitors
+	}
+
+	referrersQuery := `
+		SELECT r.id, r.email, r.name, r.referral_code, count(*) AS referrals
+		FROM waitlist_signups s
+		JOIN waitlist_signups r ON r.id = s.referred_by
+		WHERE s.waitlist_id = $1 AND s.created_at >= $2 AND s.created_at < $3
+		GROUP BY r.id
+		ORDER BY referrals DESC, r.id
+		LIMIT $4
+	`
+	rows, err = tx.Query(ctx, referrersQuery, waitlistID, query.From, query.To, query.Limit)
+	if err != nil {
+		s.log.Error("Error querying referral leaderboard: ", err)
+		return nil, fmt.Errorf("error querying referral leaderboard: %w", err)
+	}
+	stats.Referrers, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.ReferrerStats, error) {
+		var referrer models.ReferrerStats
+		err := row.Scan(&referrer.SignupID, &referrer.Email, &referrer.Name, &referrer.ReferralCode, &referrer.Referrals)
+		return referrer, err
+	})
+	if err != nil {
+		s.log.Error("Error scanning referral leaderboard: ", err)
+		return nil, fmt.Errorf("error scanning referral leaderboard: %w", err)
+	}
+
+	for _, breakdown := range []struct {
+		value  string
+		target *[]models.BreakdownStats
+	}{
+		{signupSource, &stats.Sources},
+		{signupMedium, &stats.Mediums},
+		{signupCampaign, &stats.Campaigns},
+		{signupDevice, &stats.Devices},
+	} {
+		if *breakdown.target, err = s.signupBreakdown(ctx, tx, waitlistID, query, breakdown.value); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// signupSeries counts signups per hour or day in the query's time zone. With
+// rollups, hours before the rollup cutoff come from the rollup table and only
+// the rest is counted from the signups. Empty buckets are filled in here, where
+// stepping through local days handles daylight saving changes.
+func (s *PostgresDB) signupSeries(ctx context.Context, tx pgx.Tx, waitlistID int64, query models.StatsQuery) ([]models.StatsBucket, error) {
+	cutoff := query.From
+	if query.UseRollups {
+		var rolledUpTo *time.Time
+		if err := tx.QueryRow(ctx, `SELECT rolled_up_to FROM waitlist_signup_rollup_state`).Scan(&rolledUpTo); err != nil {
+			s.log.Error("Error getting signup rollup state: ", err)
+			return nil, fmt.Errorf("error getting signup rollup state: %w", err)
+		}
+		if rolledUpTo != nil && rolledUpTo.After(cutoff) {
+			cutoff = *rolledUpTo
+		}
+	}
+
+	seriesQuery := `
+		SELECT date_trunc($4, hour AT TIME ZONE $5) AT TIME ZONE $5 AS bucket, sum(signups)::bigint
+		FROM waitlist_signup_rollups
+		WHERE waitlist_id = $1 AND hour >= $2 AND hour < least($3, $6)
+		GROUP BY bucket
+		UNION ALL
+		SELECT date_trunc($4, created_at AT TIME ZONE $5) AT TIME ZONE $5 AS bucket, count(*)
+		FROM waitlist_signups
+		WHERE waitlist_id = $1 AND created_at >= greatest($2, $6) AND created_at < $3
+		GROUP BY bucket
+	`
+	rows, err := tx.Query(ctx, seriesQuery, waitlistID, query.From, query.To, query.Interval, query.Location.String(), cutoff)
+	if err != nil {
+		s.log.Error("Error querying signup series: ", err)
+		return nil, fmt.Errorf("error querying signup series: %w", err)
+	}
+	defer rows.Close()
+
+	// a bucket can come back twice, once from each side of the cutoff
+	counts := map[int64]int64{}
+	for rows.Next() {
+		var bucket time.Time
+		var signups int64
+		if err := rows.Scan(&bucket, &signups); err != nil {
+			s.log.Error("Error scanning signup series row: ", err)
+			return nil, fmt.Errorf("error scanning signup series: %w", err)
+		}
+		counts[bucket.Unix()] += signups
+	}
+	if err := rows.Err(); err != nil {
+		s.log.Error("Error iterating signup series rows: ", err)
+		return nil, fmt.Errorf("error iterating signup series: %w", err)
+	}
+
+	series := []models.StatsBucket{}
+	for start := query.From.In(query.Location); start.Before(query.To); {
+		series = append(series, models.StatsBucket{Start: start, Signups: counts[start.Unix()]})
+		if query.Interval == models.StatsIntervalDay {
+			start = start.AddDate(0, 0, 1)
+		} else {
+			start = start.Add(time.Hour)
+		}
+	}
+	return series, nil
+}
+
+// RefreshSignupRollups recounts the hourly signup rollups of every finished hour
+// since the last refresh, going back lookback further to pick up signups deleted
+// since. The first refresh counts every signup.
+func (s *PostgresDB) RefreshSignupRollups(ctx context.Context, now time.Time, lookback time.Duration) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RefreshSignupRollups")
+	defer done()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var rolledUpTo *time.Time
+	if err := tx.QueryRow(ctx, `SELECT rolled_up_to FROM waitlist_signup_rollup_state FOR UPDATE`).Scan(&rolledUpTo); err != nil {
+		s.log.Error("Error getting signup rollup state: ", err)
+		return fmt.Errorf("error getting signup rollup state: %w", err)
+	}
+
+	to := now.UTC().Truncate(time.Hour)
+	var from *time.Time // nil recounts everything
+	if rolledUpTo != nil {
+		start := rolledUpTo.Add(-lookback).Truncate(time.Hour)
+		if start.After(to) {
+			start = to
+		}
+		from = &start
+	}
+
+	deleteQuery := `
+		DELETE FROM waitlist_signup_rollups
+		WHERE ($1::timestamptz IS NULL OR hour >= $1) AND hour < $2
+	`
+	if _, err := tx.Exec(ctx, deleteQuery, from, to); err != nil {
+		s.log.Error("Error deleting signup rollups: ", err)
+		return fmt.Errorf("error deleting signup rollups: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO waitlist_signup_rollups (waitlist_id, hour, signups)
+		SELECT waitlist_id, date_trunc('hour', created_at AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' AS hour, count(*)
+		FROM waitlist_signups
+		WHERE ($1::timestamptz IS NULL OR created_at >= $1) AND created_at < $2
+		GROUP BY waitlist_id, hour
+	`
+	if _, err := tx.Exec(ctx, insertQuery, from, to); err != nil {
+		s.log.Error("Error inserting signup rollups: ", err)
+		return fmt.Errorf("error inserting signup rollups: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE waitlist_signup_rollup_state SET rolled_up_to = $1`, to); err != nil {
+		s.log.Error("Error updating signup rollup state: ", err)
+		return fmt.Errorf("error updating signup rollup state: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing signup rollups: ", err)
+		return fmt.Errorf("error committing signup rollups: %w", err)
+	}
+	return nil
+}
+
+// signupBreakdown counts the signups in range per value of an attribution expression
+func (s *PostgresDB) signupBreakdown(ctx context.Context, tx pgx.Tx, waitlistID int64, query models.StatsQuery, value string) ([]models.BreakdownStats, error) {
+	breakdownQuery := `
+		SELECT ` + value + ` AS value, count(*) AS signups
+		FROM waitlist_signups
+		WHERE waitlist_id = $1 AND created_at >= $2 AND created_at < $3
+		GROUP BY value
+		ORDER BY signups DESC, value
+		LIMIT $4
+	`
+	rows, err := tx.Query(ctx, breakdownQuery, waitlistID, query.From, query.To, query.Limit)
+	if err != nil {
+		s.log.Error("Error querying signup breakdown: ", err)
+		return nil, fmt.Errorf("error querying signup breakdown: %w", err)
+	}
+	breakdown, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.BreakdownStats, error) {
+		var stats models.BreakdownStats
+		err := row.Scan(&stats.Value, &stats.Signups)
+		return stats, err
+	})
+	if err != nil {
+		s.log.Error("Error scanning signup breakdown: ", err)
+		return nil, fmt.Errorf("error scanning signup breakdown: %w", err)
+	}
+	if breakdown == nil {
+		breakdown = []models.BreakdownStats{}
+	}
+	return breakdown, nil
+}
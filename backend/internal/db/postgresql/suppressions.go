@@ -0,0 +1,103 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// SuppressEmail adds an address to the suppression list. An existing entry is
+// only replaced by a reason that outranks it, so a later unsubscribe doesn't
+// hide a bounce.
+func (s *PostgresDB) SuppressEmail(ctx context.Context, suppression *models.EmailSuppression) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "SuppressEmail")
+	defer done()
+
+	_, err := s.conn.Exec(ctx, `
+		INSERT INTO email_suppressions (email, reason, detail)
+		VALUES (lower($1), $2, $3)
+		ON CONFLICT (email) DO UPDATE
+		SET reason = EXCLUDED.reason, detail = EXCLUDED.detail, created_at = now()
+		WHERE email_suppressions.reason = 'unsubscribed' AND EXCLUDED.reason <> 'unsubscribed'
+			OR email_suppressions.reason = 'bounced' AND EXCLUDED.reason = 'complained'
+	`, suppression.Email, suppression.Reason, suppression.Detail)
+	if err != nil {
+		s.log.Error("Error suppressing email: ", err)
+		return fmt.Errorf("error suppressing email: %w", err)
+	}
+	return nil
+}
+
+// RemoveEmailSuppression takes an address off the suppression list when it was
+// suppressed for reason, reporting whether it was
+func (s *PostgresDB) RemoveEmailSuppression(ctx context.Context, email, reason string) (bool, error) {
+	if s.conn == nil {
+		return false, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RemoveEmailSuppression")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `
+		DELETE FROM email_suppressions WHERE email = lower($1) AND reason = $2
+	`, email, reason)
+	if err != nil {
+		s.log.Error("Error removing email suppression: ", err)
+		return false, fmt.Errorf("error removing email suppression: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetEmailSuppression returns why an address is suppressed, or a "suppression
+// not found" error when it isn't
+func (s *PostgresDB) GetEmailSuppression(ctx context.Context, email string) (*models.EmailSuppression, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetEmailSuppression")
+	defer done()
+
+	var suppression models.EmailSuppression
+	err := s.conn.QueryRow(ctx, `
+		SELECT email, reason, detail, created_at FROM email_suppressions WHERE email = lower($1)
+	`, email).Scan(&suppression.Email, &suppression.Reason, &suppression.Detail, &suppression.CreatedAt)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("suppression not found")
+		}
+		s.log.Error("Error getting email suppression: ", err)
+		return nil, fmt.Errorf("error getting email suppression: %w", err)
+	}
+	return &suppression, nil
+}
+
+// UpdateSignupSubscription subscribes a signup to its waitlist's updates or
+// unsubscribes it, and turns its marketing opt-in off unless marketing is true.
+// Marketing can't be turned on here since opting in needs the consent text. The
+// signup must belong to email, otherwise a "signup not found" error is returned.
+func (s *PostgresDB) UpdateSignupSubscription(ctx context.Context, signupID int64, email string, subscribed, marketing bool) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "UpdateSignupSubscription")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `
+		UPDATE waitlist_signups
+		SET unsubscribed_at = CASE WHEN $3 THEN NULL ELSE coalesce(unsubscribed_at, now()) END,
+			marketing_opt_in = marketing_opt_in AND $4
+		WHERE id = $1 AND lower(email) = lower($2)
+	`, signupID, email, subscribed, marketing)
+	if err != nil {
+		s.log.Error("Error updating signup subscription: ", err)
+		return fmt.Errorf("error updating signup subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("signup not found")
+	}
+	return nil
+}
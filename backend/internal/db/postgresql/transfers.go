@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/jackc/pgx/v5"
+)
+
+// OfferWaitlistTransfer offers an active waitlist of fromUserID to toUserID,
+// replacing any offer pending for it. Returns a "waitlist not found" error when
+// fromUserID doesn't own the waitlist or it is archived.
+func (s *PostgresDB) OfferWaitlistTransfer(ctx context.Context, waitlistID, fromUserID, toUserID int64) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "OfferWaitlistTransfer")
+	defer done()
+
+	query := `
+		INSERT INTO waitlist_transfers (waitlist_id, from_user_id, to_user_id)
+		SELECT id, owner_user_id, $3 FROM waitlists
+		WHERE id = $1 AND owner_user_id = $2 AND archived_at IS NULL
+		ON CONFLICT (waitlist_id) DO UPDATE
+		SET from_user_id = excluded.from_user_id, to_user_id = excluded.to_user_id, created_at = now()
+	`
+	tag, err := s.conn.Exec(ctx, query, waitlistID, fromUserID, toUserID)
+	if err != nil {
+		s.log.Error("Error offering waitlist transfer: ", err)
+		return fmt.Errorf("error offering waitlist transfer: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("waitlist not found")
+	}
+	return nil
+}
+
+// CancelWaitlistTransfer withdraws the offer pending for a waitlist, returning
+// a "transfer not found" error when there is none
+func (s *PostgresDB) CancelWaitlistTransfer(ctx context.Context, waitlistID int64) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "CancelWaitlistTransfer")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `DELETE FROM waitlist_transfers WHERE waitlist_id = $1`, waitlistID)
+	if err != nil {
+		s.log.Error("Error cancelling waitlist transfer: ", err)
+		return fmt.Errorf("error cancelling waitlist transfer: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("transfer not found")
+	}
+	return nil
+}
+
+// ListWaitlistTransfers returns the waitlists offered to a user, newest first
+func (s *PostgresDB) ListWaitlistTransfers(ctx context.Context, toUserID int64) ([]*models.WaitlistTransfer, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "ListWaitlistTransfers")
+	defer done()
+
+	query := `
+		SELECT t.id, t.waitlist_id, w.slug, w.name, t.from_user_id, u.email, t.to_user_id, t.created_at
+		FROM waitlist_transfers t
+		JOIN waitlists w ON w.id = t.waitlist_id
+		JOIN users u ON u.id = t.from_user_id
+		WHERE t.to_user_id = $1
+		ORDER BY t.created_at DESC, t.id DESC
+	`
+	rows, err := s.conn.Query(ctx, query, toUserID)
+	if err != nil {
+		s.log.Error("Error querying waitlist transfers: ", err)
+		return nil, fmt.Errorf("error querying waitlist transfers: %w", err)
+	}
+	transfers, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (*models.WaitlistTransfer, error) {
+		var transfer models.WaitlistTransfer
+		err := row.Scan(&transfer.ID, &transfer.WaitlistID, &transfer.WaitlistSlug, &transfer.WaitlistName,
+			&transfer.FromUserID, &transfer.FromEmail, &transfer.ToUserID, &transfer.CreatedAt)
+		return &transfer, err
+	})
+	if err != nil {
+		s.log.Error("Error scanning waitlist transfers: ", err)
+		return nil, fmt.Errorf("error scanning waitlist transfers: %w", err)
+	}
+	return transfers, nil
+}
+
+// AcceptWaitlistTransfer makes toUserID the owner of the waitlist offered to
+// them and returns it. Returns a "transfer not found" error when there is no
+// such offer to toUserID, or the waitlist changed owner or was archived since.
+func (s *PostgresDB) AcceptWaitlistTransfer(ctx context.Context, transferID, toUserID int64) (*models.Waitlist, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "AcceptWaitlistTransfer")
+	defer done()
+
+	tx, err := s.conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var waitlistID, fromUserID int64
+	err = tx.QueryRow(ctx, `
+		DELETE FROM waitlist_transfers WHERE id = $1 AND to_user_id = $2
+		RETURNING waitlist_id, from_user_id
+	`, transferID, toUserID).Scan(&waitlistID, &fromUserID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("transfer not found")
+		}
+		s.log.Error("Error claiming waitlist transfer: ", err)
+		return nil, fmt.Errorf("error claiming waitlist transfer: %w", err)
+	}
+
+	waitlist, err := scanWaitlist(tx.QueryRow(ctx, `
+		UPDATE waitlists SET owner_user_id = $3
+		WHERE id = $1 AND owner_user_id = $2 AND archived_at IS NULL
+		RETURNING `+waitlistColumns,
+		waitlistID, fromUserID, toUserID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, fmt.Errorf("transfer not found")
+		}
+		s.log.Error("Error transferring waitlist: ", err)
+		return nil, fmt.Errorf("error transferring waitlist: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		s.log.Error("Error committing waitlist transfer: ", err)
+		return nil, fmt.Errorf("error committing waitlist transfer: %w", err)
+	}
+	return waitlist, nil
+}
+
+// DeclineWaitlistTransfer drops an offer made to toUserID, returning a
+// "transfer not found" error when there is no such offer
+func (s *PostgresDB) DeclineWaitlistTransfer(ctx context.Context, transferID, toUserID int64) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "DeclineWaitlistTransfer")
+	defer done()
+
+	tag, err := s.conn.Exec(ctx, `DELETE FROM waitlist_transfers WHERE id = $1 AND to_user_id = $2`, transferID, toUserID)
+	if err != nil {
+		s.log.Error("Error declining waitlist transfer: ", err)
+		return fmt.Errorf("error declining waitlist transfer: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("transfer not found")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetViewSalt returns the visitor hash salt of a UTC day, storing salt as the
+// day's salt unless another replica got there first
+func (s *PostgresDB) GetViewSalt(ctx context.Context, day time.Time, salt []byte) ([]byte, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "GetViewSalt")
+	defer done()
+
+	// the outer SELECT can't see the row the CTE inserts, hence the UNION. Neither
+	// sees a row another replica committed after the query's snapshot was taken,
+	// so finding nothing means it just got there first and a fresh SELECT finds it.
+	query := `
+		WITH inserted AS (
+			INSERT INTO view_salts (day, salt) VALUES ($1::date, $2)
+			ON CONFLICT (day) DO NOTHING
+			RETURNING salt
+		)
+		SELECT salt FROM inserted
+		UNION ALL
+		SELECT salt FROM view_salts WHERE day = $1::date
+		LIMIT 1
+	`
+	date := day.UTC().Format("2006-01-02")
+	var stored []byte
+	err := s.conn.QueryRow(ctx, query, date, salt).Scan(&stored)
+	if err == pgx.ErrNoRows {
+		err = s.conn.QueryRow(ctx, `SELECT salt FROM view_salts WHERE day = $1::date`, date).Scan(&stored)
+	}
+	if err != nil {
+		s.log.Error("Error getting view salt: ", err)
+		return nil, fmt.Errorf("error getting view salt: %w", err)
+	}
+	return stored, nil
+}
+
+// RecordWaitlistView counts a view of a waitlist on a UTC day, and a visitor
+// when the day hasn't seen visitorHash yet
+func (s *PostgresDB) RecordWaitlistView(ctx context.Context, waitlistID int64, day time.Time, visitorHash []byte) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "RecordWaitlistView")
+	defer done()
+
+	query := `
+		WITH visitor AS (
+			INSERT INTO waitlist_view_visitors (waitlist_id, day, visitor_hash) VALUES ($1, $2::date, $3)
+			ON CONFLICT DO NOTHING
+			RETURNING 1
+		)
+		INSERT INTO waitlist_views (waitlist_id, day, views, visitors)
+		VALUES ($1, $2::date, 1, (SELECT count(*) FROM visitor))
+		ON CONFLICT (waitlist_id, day) DO UPDATE
+		SET views = waitlist_views.views + 1, visitors = waitlist_views.visitors + excluded.visitors
+	`
+	if _, err := s.conn.Exec(ctx, query, waitlistID, day.UTC().Format("2006-01-02"), visitorHash); err != nil {
+		s.log.Error("Error recording waitlist view: ", err)
+		return fmt.Errorf("error recording waitlist view: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredViewVisitors forgets the visitor hashes and salts of the UTC
+// days before day, leaving only their counts
+func (s *PostgresDB) DeleteExpiredViewVisitors(ctx context.Context, day time.Time) error {
+	if s.conn == nil {
+		return fmt.Errorf("database connection is not established")
+	}
+	ctx, done := s.instrument(ctx, "DeleteExpiredViewVisitors")
+	defer done()
+
+	before := day.UTC().Format("2006-01-02")
+	tag, err := s.conn.Exec(ctx, `DELETE FROM waitlist_view_visitors WHERE day < $1::date`, before)
+	if err != nil {
+		s.log.Error("Error deleting view visitors: ", err)
+		return fmt.Errorf("error deleting view visitors: %w", err)
+	}
+	if _, err := s.conn.Exec(ctx, `DELETE FROM view_salts WHERE day < $1::date`, before); err != nil {
+		s.log.Error("Error deleting view salts: ", err)
+		return fmt.Errorf("error deleting view salts: %w", err)
+	}
+
+	s.log.Debug(fmt.Sprintf("Deleted %d expired view visitors", tag.RowsAffected()))
+	return nil
+}
@@ -0,0 +1,130 @@
+package emailcheck
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+)
+
+// disposableDomains is the built-in list of throwaway mail providers, one domain
+// per line. Deployments can extend it without a rebuild, see LoadFile.
+//
+//go:embed disposable_domains.txt
+var disposableDomains string
+
+// Blocklist is a set of disposable email domains, safe for concurrent use
+type Blocklist struct {
+	mu       sync.RWMutex
+	builtin  map[string]bool
+	extra    map[string]bool
+	modified time.Time // mtime of the extra file when it was last loaded
+}
+
+// NewBlocklist returns a blocklist holding the embedded disposable domains
+func NewBlocklist() *Blocklist {
+	builtin, _ := parseDomainList(strings.NewReader(disposableDomains))
+	return &Blocklist{builtin: builtin, extra: map[string]bool{}}
+}
+
+// parseDomainList reads one domain per line, ignoring blanks and # comments
+func parseDomainList(r io.Reader) (map[string]bool, error) {
+	domains := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if hash := strings.IndexByte(line, '#'); hash >= 0 {
+			line = line[:hash]
+		}
+		if domain := strings.ToLower(strings.TrimSpace(line)); domain != "" {
+			domains[domain] = true
+		}
+	}
+	return domains, scanner.Err()
+}
+
+// Contains reports whether domain or one of its parent domains is blocked
+func (b *Blocklist) Contains(domain string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for {
+		if b.builtin[domain] || b.extra[domain] {
+			return true
+		}
+		dot := strings.IndexByte(domain, '.')
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// Len returns the number of blocked domains
+func (b *Blocklist) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.builtin) + len(b.extra)
+}
+
+// LoadFile replaces the extra domains with the contents of path, on top of the
+// embedded list. Returns false without reading when the file is unchanged since
+// the last load.
+func (b *Blocklist) LoadFile(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat disposable domains file: %w", err)
+	}
+	b.mu.RLock()
+	unchanged := info.ModTime().Equal(b.modified)
+	b.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open disposable domains file: %w", err)
+	}
+	defer file.Close()
+
+	extra, err := parseDomainList(file)
+	if err != nil {
+		return false, fmt.Errorf("failed to read disposable domains file: %w", err)
+	}
+
+	b.mu.Lock()
+	b.extra = extra
+	b.modified = info.ModTime()
+	b.mu.Unlock()
+	return true, nil
+}
+
+// RunReload reloads path every interval until ctx is done, so the list can be
+// updated by replacing the file
+func RunReload(ctx context.Context, blocklist *Blocklist, path string, interval time.Duration, log *logger.ServiceLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := blocklist.LoadFile(path)
+			if err != nil {
+				log.Error("Failed to reload disposable domains: ", err)
+				continue
+			}
+			if reloaded {
+				log.Info(fmt.Sprintf("Reloaded disposable domains, %d blocked", blocklist.Len()))
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package emailcheck
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBlocklistContains(t *testing.T) {
+	blocklist := NewBlocklist()
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{domain: "mailinator.com", want: true},
+		{domain: "a.b.mailinator.com", want: true},
+		{domain: "notmailinator.com", want: false},
+		{domain: "example.com", want: false},
+		{domain: "com", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := blocklist.Contains(tt.domain); got != tt.want {
+			t.Errorf("Contains(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestBlocklistLoadFile(t *testing.T) {
+	blocklist := NewBlocklist()
+	builtin := blocklist.Len()
+	path := filepath.Join(t.TempDir(), "domains.txt")
+
+	if err := os.WriteFile(path, []byte("# extra\nSpam.example # trailing comment\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := blocklist.LoadFile(path); err != nil || !reloaded {
+		t.Fatalf("LoadFile = %v, %v, want a reload", reloaded, err)
+	}
+	if !blocklist.Contains("spam.example") || blocklist.Len() != builtin+1 {
+		t.Errorf("extra domain wasn't loaded, %d domains", blocklist.Len())
+	}
+	if reloaded, err := blocklist.LoadFile(path); err != nil || reloaded {
+		t.Errorf("LoadFile of an unchanged file = %v, %v, want no reload", reloaded, err)
+	}
+
+	// replacing the file drops domains no longer listed but keeps the builtin ones
+	if err := os.WriteFile(path, []byte("other.example\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := blocklist.LoadFile(path); err != nil || !reloaded {
+		t.Fatalf("LoadFile = %v, %v, want a reload", reloaded, err)
+	}
+	if blocklist.Contains("spam.example") || !blocklist.Contains("other.example") || !blocklist.Contains("mailinator.com") {
+		t.Error("reload didn't replace the extra domains")
+	}
+
+	if _, err := blocklist.LoadFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadFile of a missing file succeeded")
+	}
+}
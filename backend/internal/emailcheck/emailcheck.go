@@ -0,0 +1,203 @@
+package emailcheck
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// Rejection codes returned to clients when an address is refused
+const (
+	CodeInvalid      = "invalid_email"
+	CodeDisposable   = "disposable_email"
+	CodeDomainDenied = "email_domain_not_allowed"
+	CodeNoMailServer = "email_domain_has_no_mail_server"
+)
+
+// RFC 5321 length limits
+const (
+	maxLocalLength   = 64
+	maxDomainLength  = 253
+	maxAddressLength = 254
+)
+
+// Address is a parsed email address. Domain is lowercased, Local keeps its case
+// since it is technically case sensitive.
+type Address struct {
+	Local  string
+	Domain string
+}
+
+func (a Address) String() string {
+	return a.Local + "@" + a.Domain
+}
+
+// Invalid explains why an address was refused
+type Invalid struct {
+	Code    string
+	Message string
+}
+
+func (e *Invalid) Error() string {
+	return fmt.Sprintf("email rejected (%s): %s", e.Code, e.Message)
+}
+
+func invalid(message string) *Invalid {
+	return &Invalid{Code: CodeInvalid, Message: message}
+}
+
+// Parse parses a bare RFC 5322 address such as "jane@example.com". Display names
+// ("Jane <jane@example.com>"), comments and IP literal domains are refused since
+// signup forms only ever need the plain address.
+func Parse(address string) (Address, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return Address{}, invalid("email is required")
+	}
+	if len(address) > maxAddressLength {
+		return Address{}, invalid("email is too long")
+	}
+
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Name != "" || parsed.Address != address {
+		return Address{}, invalid("invalid email format")
+	}
+
+	at := strings.LastIndexByte(parsed.Address, '@')
+	local, domain := parsed.Address[:at], strings.ToLower(parsed.Address[at+1:])
+	if len(local) > maxLocalLength {
+		return Address{}, invalid("invalid email format")
+	}
+	if !validDomain(domain) {
+		return Address{}, invalid("invalid email domain")
+	}
+	return Address{Local: local, Domain: domain}, nil
+}
+
+// validDomain checks domain is a dotted hostname made of LDH labels. Non-ASCII
+// labels are accepted as-is since they are valid once IDNA encoded.
+func validDomain(domain string) bool {
+	if len(domain) > maxDomainLength || !strings.Contains(domain, ".") {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if r < 0x80 && !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// gmailDomains ignore dots in the local part and route user+tag to user
+var gmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// Normalize returns the key used to detect the same mailbox signing up twice.
+// Addresses are lowercased, with gmailAliases Gmail dots and +tags are dropped.
+func Normalize(address Address, gmailAliases bool) string {
+	local, domain := strings.ToLower(address.Local), address.Domain
+	if gmailAliases && gmailDomains[domain] {
+		if plus := strings.IndexByte(local, '+'); plus >= 0 {
+			local = local[:plus]
+		}
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// Policy selects the checks that apply to an address
+type Policy struct {
+	GmailAliases    bool     // normalize Gmail dots and +tags
+	BlockDisposable bool     // refuse domains on the disposable blocklist
+	CheckMX         bool     // refuse domains that can't receive mail
+	AllowDomains    []string // when set, only these domains (and subdomains) may sign up
+	DenyDomains     []string // refused domains, including subdomains
+}
+
+// Result is an accepted address
+type Result struct {
+	Address    Address
+	Normalized string
+}
+
+// Validator checks addresses against a policy
+type Validator struct {
+	blocklist *Blocklist
+	resolver  Resolver // nil disables MX lookups
+}
+
+// NewValidator creates a validator. resolver may be nil, MX checks are then skipped.
+func NewValidator(blocklist *Blocklist, resolver Resolver) *Validator {
+	return &Validator{blocklist: blocklist, resolver: resolver}
+}
+
+// Validate parses and checks address. It returns an *Invalid error when the address
+// is refused, or another error when a check itself failed.
+func (v *Validator) Validate(ctx context.Context, address string, policy Policy) (*Result, error) {
+	parsed, err := Parse(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if matchesDomain(parsed.Domain, policy.DenyDomains) {
+		return nil, &Invalid{Code: CodeDomainDenied, Message: "emails from this domain are not accepted"}
+	}
+	allowed := matchesDomain(parsed.Domain, policy.AllowDomains)
+	if len(policy.AllowDomains) > 0 && !allowed {
+		return nil, &Invalid{Code: CodeDomainDenied, Message: "emails from this domain are not accepted"}
+	}
+	// explicitly allowed domains skip the blocklist
+	if policy.BlockDisposable && !allowed && v.blocklist != nil && v.blocklist.Contains(parsed.Domain) {
+		return nil, &Invalid{Code: CodeDisposable, Message: "disposable email addresses are not accepted"}
+	}
+	if policy.CheckMX && v.resolver != nil {
+		ok, err := acceptsMail(ctx, v.resolver, parsed.Domain)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, &Invalid{Code: CodeNoMailServer, Message: "this email domain can't receive mail"}
+		}
+	}
+
+	return &Result{Address: parsed, Normalized: Normalize(parsed, policy.GmailAliases)}, nil
+}
+
+// matchesDomain reports whether domain or one of its parents is in domains
+func matchesDomain(domain string, domains []string) bool {
+	for _, candidate := range domains {
+		candidate = strings.ToLower(strings.TrimSpace(candidate))
+		if candidate != "" && (domain == candidate || strings.HasSuffix(domain, "."+candidate)) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeDomains lowercases and validates a domain list entered by a user,
+// dropping blanks and duplicates
+func NormalizeDomains(domains []string) ([]string, error) {
+	seen := make(map[string]bool, len(domains))
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+		if domain == "" || seen[domain] {
+			continue
+		}
+		if !validDomain(domain) {
+			return nil, fmt.Errorf("%q is not a valid domain", domain)
+		}
+		seen[domain] = true
+		normalized = append(normalized, domain)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,161 @@
+package emailcheck
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		address string
+		want    Address
+		wantErr bool
+	}{
+		{address: "jane@example.com", want: Address{Local: "jane", Domain: "example.com"}},
+		{address: " Jane.Doe@Example.COM ", want: Address{Local: "Jane.Doe", Domain: "example.com"}},
+		{address: "jane+tag@mail.example.co.uk", want: Address{Local: "jane+tag", Domain: "mail.example.co.uk"}},
+		{address: "", wantErr: true},
+		{address: "jane", wantErr: true},
+		{address: "jane@", wantErr: true},
+		{address: "@example.com", wantErr: true},
+		{address: "jane@localhost", wantErr: true},
+		{address: "jane@[192.0.2.1]", wantErr: true},
+		{address: "jane@-example.com", wantErr: true},
+		{address: "jane@example..com", wantErr: true},
+		{address: "jane@exa_mple.com", wantErr: true},
+		{address: "Jane <jane@example.com>", wantErr: true},
+		{address: "jane@example.com (Jane)", wantErr: true},
+		{address: strings.Repeat("a", 65) + "@example.com", wantErr: true},
+		{address: "jane@" + strings.Repeat("a", 250) + ".com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := Parse(tt.address)
+			if tt.wantErr {
+				var invalid *Invalid
+				if !errors.As(err, &invalid) || invalid.Code != CodeInvalid {
+					t.Fatalf("Parse(%q) error = %v, want %q", tt.address, err, CodeInvalid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.address, err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.address, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		address      Address
+		gmailAliases bool
+		want         string
+	}{
+		{address: Address{Local: "Jane.Doe", Domain: "example.com"}, want: "jane.doe@example.com"},
+		{address: Address{Local: "Jane.Doe+news", Domain: "example.com"}, gmailAliases: true, want: "jane.doe+news@example.com"},
+		{address: Address{Local: "Jane.Doe+news", Domain: "gmail.com"}, want: "jane.doe+news@gmail.com"},
+		{address: Address{Local: "Jane.Doe+news", Domain: "gmail.com"}, gmailAliases: true, want: "janedoe@gmail.com"},
+		{address: Address{Local: "jane.doe", Domain: "googlemail.com"}, gmailAliases: true, want: "janedoe@gmail.com"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.address, tt.gmailAliases); got != tt.want {
+			t.Errorf("Normalize(%s, %v) = %q, want %q", tt.address, tt.gmailAliases, got, tt.want)
+		}
+	}
+}
+
+// failingResolver fails every lookup like an unreachable DNS server
+type failingResolver struct{}
+
+func (failingResolver) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	return nil, &net.DNSError{Err: "server misbehaving", Name: domain, IsTemporary: true}
+}
+
+func (failingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+}
+
+func TestValidate(t *testing.T) {
+	resolver := StaticResolver{
+		MX: map[string][]*net.MX{
+			"example.com":    {{Host: "mx.example.com.", Pref: 10}},
+			"nomail.com":     {{Host: ".", Pref: 0}},
+			"mailinator.com": {{Host: "mx.mailinator.com.", Pref: 10}},
+		},
+		Hosts: map[string][]string{
+			"implicit.com": {"192.0.2.1"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		resolver Resolver
+		address  string
+		policy   Policy
+		want     string // normalized address, or the rejection code
+		wantErr  bool   // the check itself failed
+	}{
+		{name: "plain", address: "Jane@Example.com", want: "jane@example.com"},
+		{name: "invalid", address: "jane@", want: CodeInvalid},
+		{name: "gmail alias", address: "j.ane+x@gmail.com", policy: Policy{GmailAliases: true}, want: "jane@gmail.com"},
+		{name: "disposable", address: "jane@mailinator.com", policy: Policy{BlockDisposable: true}, want: CodeDisposable},
+		{name: "disposable subdomain", address: "jane@eu.mailinator.com", policy: Policy{BlockDisposable: true}, want: CodeDisposable},
+		{name: "disposable allowed when not blocking", address: "jane@mailinator.com", want: "jane@mailinator.com"},
+		{name: "disposable explicitly allowed", address: "jane@mailinator.com", policy: Policy{BlockDisposable: true, AllowDomains: []string{"mailinator.com"}}, want: "jane@mailinator.com"},
+		{name: "denied domain", address: "jane@corp.example.com", policy: Policy{DenyDomains: []string{" Example.com "}}, want: CodeDomainDenied},
+		{name: "not an allowed domain", address: "jane@other.com", policy: Policy{AllowDomains: []string{"example.com"}}, want: CodeDomainDenied},
+		{name: "allowed subdomain", address: "jane@eu.example.com", policy: Policy{AllowDomains: []string{"example.com"}}, want: "jane@eu.example.com"},
+		{name: "suffix isn't a subdomain", address: "jane@badexample.com", policy: Policy{AllowDomains: []string{"example.com"}}, want: CodeDomainDenied},
+		{name: "mx record", resolver: resolver, address: "jane@example.com", policy: Policy{CheckMX: true}, want: "jane@example.com"},
+		{name: "null mx", resolver: resolver, address: "jane@nomail.com", policy: Policy{CheckMX: true}, want: CodeNoMailServer},
+		{name: "implicit mx", resolver: resolver, address: "jane@implicit.com", policy: Policy{CheckMX: true}, want: "jane@implicit.com"},
+		{name: "unknown domain", resolver: resolver, address: "jane@unknown.com", policy: Policy{CheckMX: true}, want: CodeNoMailServer},
+		{name: "mx check without resolver", address: "jane@unknown.com", policy: Policy{CheckMX: true}, want: "jane@unknown.com"},
+		{name: "resolver failure", resolver: failingResolver{}, address: "jane@example.com", policy: Policy{CheckMX: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewValidator(NewBlocklist(), tt.resolver)
+			result, err := validator.Validate(context.Background(), tt.address, tt.policy)
+
+			var invalid *Invalid
+			switch {
+			case tt.wantErr:
+				if err == nil || errors.As(err, &invalid) {
+					t.Fatalf("Validate error = %v, want a lookup failure", err)
+				}
+			case errors.As(err, &invalid):
+				if invalid.Code != tt.want {
+					t.Errorf("Validate rejected with %q, want %q", invalid.Code, tt.want)
+				}
+			case err != nil:
+				t.Fatalf("Validate failed: %v", err)
+			case result.Normalized != tt.want:
+				t.Errorf("Validate = %q, want %q", result.Normalized, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeDomains(t *testing.T) {
+	got, err := NormalizeDomains([]string{" Example.com", "@example.com", "", "eu.example.org"})
+	if err != nil {
+		t.Fatalf("NormalizeDomains failed: %v", err)
+	}
+	if want := []string{"example.com", "eu.example.org"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("NormalizeDomains = %v, want %v", got, want)
+	}
+
+	if _, err := NormalizeDomains([]string{"not a domain"}); err == nil {
+		t.Error("NormalizeDomains accepted an invalid domain")
+	}
+}
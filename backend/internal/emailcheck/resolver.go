@@ -0,0 +1,76 @@
+package emailcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Resolver looks up mail servers. *net.Resolver satisfies it, StaticResolver can
+// stand in for it offline.
+type Resolver interface {
+	LookupMX(ctx context.Context, domain string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// lookupTimeout bounds each DNS check so a slow resolver doesn't stall signups
+const lookupTimeout = 3 * time.Second
+
+// acceptsMail reports whether domain can receive mail: it has MX records that
+// aren't a null MX (RFC 7505), or no MX records but an address record (RFC 5321
+// implicit MX). Resolver failures other than "not found" are returned as errors.
+func acceptsMail(ctx context.Context, resolver Resolver, domain string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	records, err := resolver.LookupMX(ctx, domain)
+	if err != nil && !isNotFound(err) {
+		return false, fmt.Errorf("failed to look up MX records for %s: %w", domain, err)
+	}
+	if len(records) > 0 {
+		for _, record := range records {
+			if record.Host != "." && record.Host != "" {
+				return true, nil
+			}
+		}
+		// null MX, the domain explicitly doesn't accept mail
+		return false, nil
+	}
+
+	hosts, err := resolver.LookupHost(ctx, domain)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to look up address records for %s: %w", domain, err)
+	}
+	return len(hosts) > 0, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// StaticResolver answers from fixed tables, for tests and offline deployments.
+// Unknown domains are reported as not found.
+type StaticResolver struct {
+	MX    map[string][]*net.MX
+	Hosts map[string][]string
+}
+
+func (r StaticResolver) LookupMX(ctx context.Context, domain string) ([]*net.MX, error) {
+	if records, ok := r.MX[domain]; ok {
+		return records, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: domain, IsNotFound: true}
+}
+
+func (r StaticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if hosts, ok := r.Hosts[host]; ok {
+		return hosts, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
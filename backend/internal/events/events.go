@@ -0,0 +1,63 @@
+// Package events delivers waitlist lifecycle events to whoever listens for them
+package events
+
+import (
+	"context"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+)
+
+// Event types. Events about a signup carry its "signup_id" and "email" in their
+// data, which is how data subject requests find and scrub them.
+const (
+	WaitlistOpened = "waitlist.opened"
+	WaitlistClosed = "waitlist.closed"
+	WaitlistFull   = "waitlist.full"
+	SignupCreated  = "signup.created"
+	InviteRedeemed = "invite.redeemed"
+)
+
+// SignupData is the payload of events about a signup. It carries the signup's
+// consent so receivers only email people who opted in.
+func SignupData(signup *models.WaitlistSignup) map[string]interface{} {
+	data := map[string]interface{}{
+		"signup_id":     signup.ID,
+		"email":         signup.Email,
+		"status":        signup.Status,
+		"position":      signup.Position,
+		"referral_code": signup.ReferralCode,
+		"consent":       signup.Consent,
+	}
+	if signup.Name != nil {
+		data["name"] = *signup.Name
+	}
+	return data
+}
+
+// Publisher delivers recorded events
+type Publisher interface {
+	Publish(ctx context.Context, waitlist *models.Waitlist, event *models.WaitlistEvent) error
+}
+
+// LogPublisher writes events to the log
+type LogPublisher struct {
+	Log *logger.ServiceLogger
+}
+
+func (p LogPublisher) Publish(ctx context.Context, waitlist *models.Waitlist, event *models.WaitlistEvent) error {
+	fields := map[string]interface{}{
+		"event":       event.Type,
+		"waitlist_id": waitlist.ID,
+		"waitlist":    waitlist.Slug,
+	}
+	for key, value := range event.Data {
+		// personal data stays out of the log
+		if key == "email" || key == "name" {
+			continue
+		}
+		fields[key] = value
+	}
+	p.Log.Info("Waitlist event", fields)
+	return nil
+}
@@ -0,0 +1,350 @@
+package formfields
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Field types a signup form can ask for
+const (
+	TypeText     = "text"
+	TypeSelect   = "select"
+	TypeCheckbox = "checkbox"
+	TypeNumber   = "number"
+	TypeURL      = "url"
+)
+
+// Schema limits, keep forms short and answers small
+const (
+	MaxFields        = 20
+	maxLabelLength   = 200
+	maxOptions       = 50
+	maxOptionLength  = 200
+	maxPatternLength = 500
+	maxTextLength    = 2000 // upper bound for text answers when the field sets none
+	maxURLLength     = 2048
+)
+
+// keyPattern restricts field keys to identifiers usable as CSV headers and JSON keys
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,39}$`)
+
+// reservedKeys collide with the built-in signup columns in exports and the
+// consent checkboxes' error keys
+var reservedKeys = map[string]bool{
+	"id": true, "email": true, "name": true, "position": true, "created_at": true,
+	"accept_terms": true, "marketing_opt_in": true,
+}
+
+// Field is one question on a waitlist's signup form
+type Field struct {
+	Key         string   `json:"key"`
+	Label       string   `json:"label"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	HelpText    string   `json:"help_text,omitempty"`
+	Options     []string `json:"options,omitempty"` // select only
+
+	// Validation rules, which apply depends on the type
+	MinLength *int     `json:"min_length,omitempty"` // text
+	MaxLength *int     `json:"max_length,omitempty"` // text
+	Pattern   string   `json:"pattern,omitempty"`    // text, RE2 syntax matched against the whole answer
+	Min       *float64 `json:"min,omitempty"`        // number
+	Max       *float64 `json:"max,omitempty"`        // number
+	Integer   bool     `json:"integer,omitempty"`    // number
+}
+
+// Schema is the ordered list of custom fields on a signup form
+type Schema []Field
+
+// Validate checks the schema itself, called before it is saved
+func (s Schema) Validate() error {
+	if len(s) > MaxFields {
+		return fmt.Errorf("a form can have at most %d fields", MaxFields)
+	}
+
+	seen := make(map[string]bool, len(s))
+	for i, field := range s {
+		if !keyPattern.MatchString(field.Key) {
+			return fmt.Errorf("field %d: key must start with a letter and contain only lowercase letters, digits and underscores", i+1)
+		}
+		if reservedKeys[field.Key] {
+			return fmt.Errorf("field %q: key is reserved", field.Key)
+		}
+		if seen[field.Key] {
+			return fmt.Errorf("field %q: key is used more than once", field.Key)
+		}
+		seen[field.Key] = true
+
+		if strings.TrimSpace(field.Label) == "" || utf8.RuneCountInString(field.Label) > maxLabelLength {
+			return fmt.Errorf("field %q: label is required and must be at most %d characters", field.Key, maxLabelLength)
+		}
+		if err := field.validateRules(); err != nil {
+			return fmt.Errorf("field %q: %w", field.Key, err)
+		}
+	}
+	return nil
+}
+
+func (f Field) validateRules() error {
+	switch f.Type {
+	case TypeText:
+		if f.MinLength != nil && *f.MinLength < 0 {
+			return fmt.Errorf("min_length must not be negative")
+		}
+		if f.MaxLength != nil && (*f.MaxLength <= 0 || *f.MaxLength > maxTextLength) {
+			return fmt.Errorf("max_length must be between 1 and %d", maxTextLength)
+		}
+		if f.MinLength != nil && f.MaxLength != nil && *f.MinLength > *f.MaxLength {
+			return fmt.Errorf("min_length must not exceed max_length")
+		}
+		if len(f.Pattern) > maxPatternLength {
+			return fmt.Errorf("pattern must be at most %d characters", maxPatternLength)
+		}
+		if f.Pattern != "" {
+			if _, err := regexp.Compile(f.Pattern); err != nil {
+				return fmt.Errorf("pattern is not a valid regular expression")
+			}
+		}
+	case TypeSelect:
+		if len(f.Options) == 0 || len(f.Options) > maxOptions {
+			return fmt.Errorf("select fields need between 1 and %d options", maxOptions)
+		}
+		seen := make(map[string]bool, len(f.Options))
+		for _, option := range f.Options {
+			if strings.TrimSpace(option) == "" || utf8.RuneCountInString(option) > maxOptionLength {
+				return fmt.Errorf("options must be non-empty and at most %d characters", maxOptionLength)
+			}
+			if seen[option] {
+				return fmt.Errorf("option %q is listed more than once", option)
+			}
+			seen[option] = true
+		}
+	case TypeNumber:
+		if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+			return fmt.Errorf("min must not exceed max")
+		}
+	case TypeCheckbox, TypeURL:
+	default:
+		return fmt.Errorf("unknown type %q, must be one of text, select, checkbox, number or url", f.Type)
+	}
+	return nil
+}
+
+// Errors maps field keys to what is wrong with their answer
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	return fmt.Sprintf("%d form field(s) are invalid", len(e))
+}
+
+// ValidateAnswers checks submitted answers against the schema and returns them
+// converted to their JSON types (string, bool or number). Answers to unknown
+// fields are dropped, empty optional answers are left out. Values may be sent as
+// strings since HTML forms can't send anything else.
+func (s Schema) ValidateAnswers(answers map[string]interface{}) (map[string]interface{}, error) {
+	cleaned := make(map[string]interface{}, len(s))
+	errs := Errors{}
+
+	for _, field := range s {
+		value, err := field.parse(answers[field.Key])
+		if err != nil {
+			errs[field.Key] = err.Error()
+			continue
+		}
+		if value == nil {
+			if field.Required {
+				errs[field.Key] = "this field is required"
+			}
+			continue
+		}
+		cleaned[field.Key] = value
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return cleaned, nil
+}
+
+// parse converts one raw answer, returning nil for an empty answer
+func (f Field) parse(raw interface{}) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	switch f.Type {
+	case TypeCheckbox:
+		checked, err := parseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		if !checked {
+			// an unchecked box counts as no answer, so required means "must be checked"
+			return nil, nil
+		}
+		return true, nil
+
+	case TypeNumber:
+		number, err := parseNumber(raw)
+		if err != nil || number == nil {
+			return nil, err
+		}
+		if f.Integer && *number != float64(int64(*number)) {
+			return nil, fmt.Errorf("must be a whole number")
+		}
+		if f.Min != nil && *number < *f.Min {
+			return nil, fmt.Errorf("must be at least %s", formatNumber(*f.Min))
+		}
+		if f.Max != nil && *number > *f.Max {
+			return nil, fmt.Errorf("must be at most %s", formatNumber(*f.Max))
+		}
+		return *number, nil
+	}
+
+	text, ok := raw.(string)
+	if !ok {
+		return nil, fmt.Errorf("must be text")
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+
+	switch f.Type {
+	case TypeSelect:
+		for _, option := range f.Options {
+			if text == option {
+				return text, nil
+			}
+		}
+		return nil, fmt.Errorf("is not one of the available options")
+
+	case TypeURL:
+		u, err := url.Parse(text)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(text) > maxURLLength {
+			return nil, fmt.Errorf("must be a valid http(s) URL")
+		}
+		return text, nil
+
+	default: // TypeText
+		length := utf8.RuneCountInString(text)
+		maxLength := maxTextLength
+		if f.MaxLength != nil {
+			maxLength = *f.MaxLength
+		}
+		if length > maxLength {
+			return nil, fmt.Errorf("must be at most %d characters", maxLength)
+		}
+		if f.MinLength != nil && length < *f.MinLength {
+			return nil, fmt.Errorf("must be at least %d characters", *f.MinLength)
+		}
+		if f.Pattern != "" {
+			// anchored so the pattern describes the whole answer, checked at save time
+			if pattern, err := regexp.Compile(`^(?:` + f.Pattern + `)$`); err != nil || !pattern.MatchString(text) {
+				return nil, fmt.Errorf("is not in the expected format")
+			}
+		}
+		return text, nil
+	}
+}
+
+func parseBool(raw interface{}) (bool, error) {
+	switch value := raw.(type) {
+	case bool:
+		return value, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "", "false", "off", "0", "no":
+			return false, nil
+		case "true", "on", "1", "yes":
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("must be checked or unchecked")
+}
+
+func parseNumber(raw interface{}) (*float64, error) {
+	switch value := raw.(type) {
+	case float64:
+		return &value, nil
+	case json.Number:
+		number, err := value.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return &number, nil
+	case string:
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return nil, nil
+		}
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return &number, nil
+	}
+	return nil, fmt.Errorf("must be a number")
+}
+
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// Field returns the field with key
+func (s Schema) Field(key string) (Field, bool) {
+	for _, field := range s {
+		if field.Key == key {
+			return field, true
+		}
+	}
+	return Field{}, false
+}
+
+// FilterValue converts a filter given as text (e.g. a query parameter) to the
+// JSON type answers to field key are stored as
+func (s Schema) FilterValue(key, text string) (interface{}, error) {
+	field, ok := s.Field(key)
+	if !ok {
+		return nil, fmt.Errorf("unknown form field %q", key)
+	}
+	switch field.Type {
+	case TypeCheckbox:
+		checked, err := parseBool(text)
+		if err != nil || !checked {
+			return nil, fmt.Errorf("form field %q can only be filtered on true", key)
+		}
+		return true, nil
+	case TypeNumber:
+		number, err := parseNumber(text)
+		if err != nil || number == nil {
+			return nil, fmt.Errorf("form field %q must be filtered on a number", key)
+		}
+		return *number, nil
+	default:
+		return strings.TrimSpace(text), nil
+	}
+}
+
+// FormatAnswer renders a stored answer for CSV exports
+func FormatAnswer(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return formatNumber(v)
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+	"github.com/go-pkgz/auth/v2/avatar"
+	"github.com/go-pkgz/auth/v2/token"
+)
+
+// storedAvatarID matches the names the avatar store gives avatars
+var storedAvatarID = regexp.MustCompile(`^[a-f0-9]{40}\.image$`)
+
+// maxDeleteAccountBytes bounds account deletion bodies
+const maxDeleteAccountBytes = 16 * 1024
+
+// DeleteAccountRequest confirms deleting the signed in account
+type DeleteAccountRequest struct {
+	Password string `json:"password,omitempty"` // required for local accounts
+}
+
+// DeleteAccountResponse answers account deletion
+type DeleteAccountResponse struct {
+	Success   bool     `json:"success"`
+	Message   string   `json:"message"`
+	Waitlists []string `json:"waitlists,omitempty"` // slugs of the active waitlists blocking deletion
+}
+
+// AccountExport is the account.json file of an account export
+type AccountExport struct {
+	ID           int64               `json:"id"`
+	Email        string              `json:"email"`
+	DisplayName  *string             `json:"display_name"`
+	AuthProvider models.AuthProvider `json:"auth_provider"`
+	CreatedAt    time.Time           `json:"created_at"`
+	UpdatedAt    time.Time           `json:"updated_at"`
+	ExportedAt   time.Time           `json:"exported_at"`
+}
+
+// avatarID is the name the avatar store saves a token user's avatar under
+func avatarID(tokenUserID string) string {
+	return token.HashID(sha1.New(), tokenUserID) + ".image"
+}
+
+// userAvatarIDs returns the names a user's avatar may be stored under. The auth
+// service keys avatars by the token's user ID, which for local logins hashes the
+// email as it was typed, so the one in the request's token is checked as well.
+func userAvatarIDs(r *http.Request, user *models.User) []string {
+	ids := []string{avatarID(string(user.AuthProvider) + "_" + token.HashID(sha1.New(), user.Email))}
+	if tokenUser, err := token.GetUserInfo(r); err == nil {
+		ids = append(ids, avatarID(tokenUser.ID))
+		if name := path.Base(tokenUser.Picture); storedAvatarID.MatchString(name) {
+			ids = append(ids, name)
+		}
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids)
+}
+
+// getAccountUser returns the signed in user, writing the error response when
+// there isn't one
+func getAccountUser(w http.ResponseWriter, r *http.Request, database db.Database) (*models.User, bool) {
+	log := logger.FromContext(r.Context())
+
+	userID, err := getUserIDFromRequest(r, database)
+	if err != nil {
+		log.Error("Failed to get user ID: ", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	user, err := database.GetUserByID(r.Context(), userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return nil, false
+		}
+		log.Error("Failed to get user: ", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
+
+// AccountExportHandler downloads everything held about the signed in user as a
+// zip: their account, every waitlist they own with its signups, their login
+// history and their avatar
+func AccountExportHandler(database db.Database, avatars avatar.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		user, ok := getAccountUser(w, r, database)
+		if !ok {
+			return
+		}
+		data, err := database.GetAccountData(r.Context(), user.ID)
+		if err != nil {
+			log.Error("Failed to get account data: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		signups := make([][]*models.WaitlistSignup, len(data.Waitlists))
+		for i, waitlist := range data.Waitlists {
+			signups[i], _, err = database.ListWaitlistSignups(r.Context(), waitlist.ID, models.SignupFilter{})
+			if err != nil {
+				log.Error("Failed to list waitlist signups: ", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		filename := fmt.Sprintf("openwaitlist-account-%s.zip", time.Now().UTC().Format("20060102"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.Header().Set("Cache-Control", "no-store")
+
+		// the status is sent with the first file, so later failures can only be logged
+		if err := writeAccountExport(w, r, data, signups, avatars); err != nil {
+			log.Error("Failed to write account export: ", err)
+		}
+	}
+}
+
+// writeAccountExport writes the account export zip
+func writeAccountExport(w io.Writer, r *http.Request, data *models.AccountData, signups [][]*models.WaitlistSignup, avatars avatar.Store) error {
+	archive := zip.NewWriter(w)
+
+	writeFile := func(name string, write func(io.Writer) error) error {
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		return write(file)
+	}
+	writeJSONFile := func(name string, value interface{}) error {
+		return writeFile(name, func(file io.Writer) error {
+			encoder := json.NewEncoder(file)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(value)
+		})
+	}
+
+	account := AccountExport{
+		ID:           data.User.ID,
+		Email:        data.User.Email,
+		DisplayName:  data.User.DisplayName,
+		AuthProvider: data.User.AuthProvider,
+		CreatedAt:    data.User.CreatedAt,
+		UpdatedAt:    data.User.UpdatedAt,
+		ExportedAt:   time.Now().UTC(),
+	}
+	if err := writeJSONFile("account.json", account); err != nil {
+		return err
+	}
+
+	waitlists := make([]WaitlistResponse, len(data.Waitlists))
+	for i, waitlist := range data.Waitlists {
+		waitlists[i] = newWaitlistResponse(waitlist)
+	}
+	if err := writeJSONFile("waitlists.json", waitlists); err != nil {
+		return err
+	}
+	for i, waitlist := range data.Waitlists {
+		err := writeFile("waitlists/"+waitlist.Slug+"/signups.csv", func(file io.Writer) error {
+			return writeSignupsCSV(file, waitlist.FormFields, signups[i])
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := writeFile("login_history.csv", func(file io.Writer) error {
+		writer := csv.NewWriter(file)
+		writer.Write([]string{"attempted_at", "email", "ip", "succeeded", "blocked"})
+		for _, attempt := range data.LoginAttempts {
+			writer.Write([]string{
+				attempt.AttemptedAt.UTC().Format(time.RFC3339),
+				csvSafe(attempt.Email),
+				attempt.IP,
+				strconv.FormatBool(attempt.Succeeded),
+				strconv.FormatBool(attempt.Blocked),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range userAvatarIDs(r, data.User) {
+		reader, _, err := avatars.Get(id)
+		if err != nil {
+			continue
+		}
+		err = writeFile("avatar.image", func(file io.Writer) error {
+			_, err := io.Copy(file, reader)
+			return err
+		})
+		reader.Close()
+		if err != nil {
+			return err
+		}
+		break
+	}
+
+	return archive.Close()
+}
+
+// DeleteAccountHandler deletes the signed in user. Local accounts confirm with
+// their password. Waitlists can't outlive their owner, so active ones have to be
+// archived first or transferred to an account that accepts them; archived ones
+// are deleted with their signups. The avatar is removed from the avatar store.
+func DeleteAccountHandler(database db.Database, avatars avatar.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		user, ok := getAccountUser(w, r, database)
+		if !ok {
+			return
+		}
+
+		var req DeleteAccountRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDeleteAccountBytes)).Decode(&req); err != nil && err != io.EOF {
+			writeJSON(w, r, DeleteAccountResponse{Message: "Invalid request body"}, http.StatusBadRequest)
+			return
+		}
+
+		if user.PasswordHash != nil {
+			valid, err := utils.VerifyPassword(r.Context(), req.Password, *user.PasswordHash)
+			if err != nil {
+				log.Error("Failed to verify password: ", err)
+				writeJSON(w, r, DeleteAccountResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+				return
+			}
+			if !valid {
+				writeJSON(w, r, DeleteAccountResponse{Message: "Password is incorrect"}, http.StatusForbidden)
+				return
+			}
+		}
+
+		if err := database.DeleteUser(r.Context(), user.ID); err != nil {
+			switch err.Error() {
+			case "user owns active waitlists":
+				response := DeleteAccountResponse{
+					Message: "Archive your waitlists or transfer them to another account before deleting it",
+				}
+				if active, err := database.GetWaitlistsByUserID(r.Context(), user.ID, ""); err == nil {
+					for _, waitlist := range active {
+						response.Waitlists = append(response.Waitlists, waitlist.Slug)
+					}
+				}
+				writeJSON(w, r, response, http.StatusConflict)
+			case "user not found":
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			default:
+				log.Error("Failed to delete user: ", err)
+				writeJSON(w, r, DeleteAccountResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			}
+			return
+		}
+
+		for _, id := range userAvatarIDs(r, user) {
+			if err := avatars.Remove(id); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				log.Warn("Failed to remove avatar", map[string]interface{}{"avatar": id, "error": err.Error()})
+			}
+		}
+
+		log.Info("Account deleted", map[string]interface{}{"user_id": user.ID})
+		writeJSON(w, r, DeleteAccountResponse{Success: true, Message: "Account deleted"}, http.StatusOK)
+	}
+}
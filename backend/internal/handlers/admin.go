@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/mailer"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// RequireAdmin lets through signed in users whose ID is one of the admin user
+// IDs. Emails aren't used, local signups don't prove owning the address. Everyone
+// else gets a 403, and without admin user IDs nobody gets in.
+func RequireAdmin(database db.Database, adminUserIDs []int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, ok := getAccountUser(w, r, database)
+			if !ok {
+				return
+			}
+			if !slices.Contains(adminUserIDs, user.ID) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// JobsResponse is a page of background jobs
+type JobsResponse struct {
+	Jobs   []*models.Job      `json:"jobs"`
+	Total  int64              `json:"total"`
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+	Counts []*models.JobCount `json:"counts"` // every job by kind and status, whatever the filter
+}
+
+// RetryJobsResponse answers retrying dead jobs
+type RetryJobsResponse struct {
+	Retried int64 `json:"retried"`
+}
+
+// privateJobKinds are the job kinds whose payloads admins don't get to see,
+// emails carry addresses and single use unlock and data request links
+var privateJobKinds = []string{mailer.SendJob.Name}
+
+// redactJob drops the payload of private job kinds
+func redactJob(job *models.Job) *models.Job {
+	if slices.Contains(privateJobKinds, job.Kind) {
+		job.Payload = nil
+	}
+	return job
+}
+
+// getJobFromRequest returns the job with the ID in the URL, writing the error
+// response when there isn't one
+func getJobFromRequest(w http.ResponseWriter, r *http.Request, database db.Database) (*models.Job, bool) {
+	jobID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	job, err := database.GetJob(r.Context(), jobID)
+	if err != nil {
+		if err.Error() == "job not found" {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return nil, false
+		}
+		logger.FromContext(r.Context()).Error("Failed to get job: ", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return job, true
+}
+
+// ListJobsHandler lists background jobs, optionally filtered by status and kind,
+// most recently updated first
+func ListJobsHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		query := r.URL.Query()
+		filter := models.JobFilter{Status: models.JobStatus(query.Get("status")), Kind: query.Get("kind")}
+		switch filter.Status {
+		case "", models.JobPending, models.JobRunning, models.JobDead:
+		default:
+			http.Error(w, "status must be pending, running or dead", http.StatusBadRequest)
+			return
+		}
+		var err error
+		filter.Limit, filter.Offset, err = parsePaging(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		jobs, total, err := database.ListJobs(r.Context(), filter)
+		if err != nil {
+			log.Error("Failed to list jobs: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, job := range jobs {
+			redactJob(job)
+		}
+		counts, err := database.CountJobs(r.Context())
+		if err != nil {
+			log.Error("Failed to count jobs: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, JobsResponse{
+			Jobs:   jobs,
+			Total:  total,
+			Limit:  filter.Limit,
+			Offset: filter.Offset,
+			Counts: counts,
+		}, http.StatusOK)
+	}
+}
+
+// GetJobHandler returns one background job with its payload, unless its kind
+// is private, and last error
+func GetJobHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, ok := getJobFromRequest(w, r, database)
+		if !ok {
+			return
+		}
+		writeJSON(w, r, redactJob(job), http.StatusOK)
+	}
+}
+
+// RetryJobHandler queues a dead job again with fresh attempts
+func RetryJobHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		jobID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid job ID", http.StatusBadRequest)
+			return
+		}
+
+		job, err := database.RetryJob(r.Context(), jobID)
+		if err != nil {
+			switch err.Error() {
+			case "job not found":
+				http.Error(w, "Dead job not found", http.StatusNotFound)
+			case "job already queued":
+				http.Error(w, "A job with the same unique key is already queued", http.StatusConflict)
+			default:
+				log.Error("Failed to retry job: ", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		log.Info("Dead job retried", map[string]interface{}{"job_id": job.ID, "job_kind": job.Kind})
+		writeJSON(w, r, redactJob(job), http.StatusOK)
+	}
+}
+
+// RetryDeadJobsHandler queues every dead job again, or those of the kind query
+// parameter
+func RetryDeadJobsHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		kind := r.URL.Query().Get("kind")
+		retried, err := database.RetryDeadJobs(r.Context(), kind)
+		if err != nil {
+			log.Error("Failed to retry dead jobs: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("Dead jobs retried", map[string]interface{}{"job_kind": kind, "retried": retried})
+		writeJSON(w, r, RetryJobsResponse{Retried: retried}, http.StatusOK)
+	}
+}
+
+// DeleteJobHandler discards a dead job
+func DeleteJobHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		jobID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid job ID", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.DeleteJob(r.Context(), jobID); err != nil {
+			if err.Error() == "job not found" {
+				http.Error(w, "Dead job not found", http.StatusNotFound)
+				return
+			}
+			log.Error("Failed to delete job: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -3,36 +3,59 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/emailcheck"
 	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/metrics"
 	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/tracing"
 	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
 )
 
-// HandleLogin validates user credentials for the local auth provider
-func HandleLogin(database db.Database, email, password string) (bool, error) {
-	// Get user by email
-	user, err := database.GetUserByEmail(context.Background(), email)
+// dummyPasswordHash is verified against when a login can't be checked against a
+// real hash, so unknown emails take as long as wrong passwords. Set by
+// InitDummyPasswordHash before the server starts.
+var dummyPasswordHash string
+
+// InitDummyPasswordHash computes the hash HandleLogin verifies logins without a
+// real hash against. Startup has to fail when it can't: verifying against no
+// hash returns at once and would tell unknown emails apart.
+func InitDummyPasswordHash(ctx context.Context) error {
+	hash, err := utils.HashPassword(ctx, utils.GenerateRandomString(32))
 	if err != nil {
-		return false, fmt.Errorf("failed to get user: %w", err)
+		return fmt.Errorf("failed to hash the dummy password: %w", err)
 	}
+	dummyPasswordHash = hash
+	return nil
+}
+
+// HandleLogin validates user credentials for the local auth provider. Every
+// rejected login costs one argon2 verification, whether or not the email exists,
+// and is reported as a plain mismatch so responses don't reveal which accounts exist.
+func HandleLogin(database db.Database, email, password string) (bool, error) {
+	// the auth library does not pass the request context to credential checkers
+	ctx, span := tracing.StartSpan(context.Background(), "auth.HandleLogin")
+	defer span.End()
 
-	// Check if user uses local auth provider
-	if user.AuthProvider != "local" {
-		return false, fmt.Errorf("user does not use local authentication")
+	// Get user by email
+	user, err := database.GetUserByEmail(ctx, email)
+	if err != nil && err.Error() != "user not found" {
+		return false, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	// Check if password hash exists
-	if user.PasswordHash == nil {
-		return false, fmt.Errorf("user has no password set")
+	// Unknown users, users of other providers and users without a password still
+	// pay for a verification before being rejected
+	if user == nil || user.AuthProvider != "local" || user.PasswordHash == nil {
+		utils.VerifyPassword(ctx, password, dummyPasswordHash)
+		return false, nil
 	}
 
 	// Verify password
-	isValid, err := utils.VerifyPassword(password, *user.PasswordHash)
+	isValid, err := utils.VerifyPassword(ctx, password, *user.PasswordHash)
 	if err != nil {
 		return false, fmt.Errorf("password verification error: %w", err)
 	}
@@ -52,9 +75,15 @@ type SignupResponse struct {
 	UserID  int64  `json:"user_id,omitempty"`
 }
 
+// accountEmailPolicy applies to dashboard accounts, MX lookups only run when the
+// validator has a resolver
+var accountEmailPolicy = emailcheck.Policy{BlockDisposable: true, CheckMX: true}
+
 // SignupHandler handles user signup requests
-func SignupHandler(database db.Database, log logger.ServiceLogger) http.HandlerFunc {
+func SignupHandler(database db.Database, emails *emailcheck.Validator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
 		// Parse request body
 		var req SignupRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -69,21 +98,27 @@ func SignupHandler(database db.Database, log logger.ServiceLogger) http.HandlerF
 			return
 		}
 
-		// Validate email format (basic validation)
-		if !strings.Contains(req.Email, "@") {
-			writeErrorResponse(w, "Invalid email format", http.StatusBadRequest)
+		// Validate email format and domain
+		if _, err := emails.Validate(r.Context(), req.Email, accountEmailPolicy); err != nil {
+			var invalid *emailcheck.Invalid
+			if errors.As(err, &invalid) {
+				writeErrorResponse(w, invalid.Message, http.StatusBadRequest)
+				return
+			}
+			log.Error("Failed to validate email: ", err)
+			writeErrorResponse(w, "Could not verify the email address, please try again", http.StatusServiceUnavailable)
 			return
 		}
 
 		// Check if user already exists
-		existingUser, err := database.GetUserByEmail(context.Background(), req.Email)
+		existingUser, err := database.GetUserByEmail(r.Context(), req.Email)
 		if err == nil && existingUser != nil {
 			writeErrorResponse(w, "User with this email already exists", http.StatusConflict)
 			return
 		}
 
 		// Hash password
-		hashedPasswordStr, err := utils.HashPassword(req.Password)
+		hashedPasswordStr, err := utils.HashPassword(r.Context(), req.Password)
 		if err != nil {
 			log.Error("Failed to hash password: ", err)
 			writeErrorResponse(w, "Internal server error", http.StatusInternalServerError)
@@ -101,12 +136,14 @@ func SignupHandler(database db.Database, log logger.ServiceLogger) http.HandlerF
 			user.DisplayName = &req.DisplayName
 		}
 
-		if err := database.CreateUser(context.Background(), user); err != nil {
+		if err := database.CreateUser(r.Context(), user); err != nil {
 			log.Error("Failed to create user: ", err)
 			writeErrorResponse(w, "Failed to create user", http.StatusInternalServerError)
 			return
 		}
 
+		metrics.IncUserSignups()
+
 		// Return success response
 		response := SignupResponse{
 			Success: true,
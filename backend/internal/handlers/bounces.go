@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+)
+
+// maxBounceWebhookBytes bounds bounce webhook bodies
+const maxBounceWebhookBytes = 1 << 20
+
+// maxBounceDetail bounds the provider message kept with a suppression
+const maxBounceDetail = 500
+
+// BounceWebhookRequest is a batch of delivery problems reported by the email
+// provider, usually relayed from its own webhook format
+type BounceWebhookRequest struct {
+	Events []BounceEvent `json:"events"`
+}
+
+// BounceEvent is one delivery problem
+type BounceEvent struct {
+	Email      string `json:"email"`
+	Type       string `json:"type"`                  // bounce or complaint
+	BounceType string `json:"bounce_type,omitempty"` // hard (the default) or soft, for bounces
+	Detail     string `json:"detail,omitempty"`      // the provider's message
+}
+
+// BounceWebhookResponse answers the bounce webhook
+type BounceWebhookResponse struct {
+	Success    bool   `json:"success"`
+	Message    string `json:"message,omitempty"`
+	Processed  int    `json:"processed"`
+	Suppressed int    `json:"suppressed"` // addresses put on the suppression list
+}
+
+// BounceWebhookHandler takes bounces and spam complaints from the email
+// provider and suppresses the addresses they were about. Soft bounces are
+// temporary, so they're ignored. Requests authenticate with the configured
+// secret as a bearer token.
+func BounceWebhookHandler(database db.Database, secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			writeJSON(w, r, BounceWebhookResponse{Message: "Unauthorized"}, http.StatusUnauthorized)
+			return
+		}
+
+		var req BounceWebhookRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBounceWebhookBytes)).Decode(&req); err != nil {
+			writeJSON(w, r, BounceWebhookResponse{Message: "Invalid request body"}, http.StatusBadRequest)
+			return
+		}
+
+		response := BounceWebhookResponse{Success: true}
+		for _, event := range req.Events {
+			email, ok := parseDataRequestEmail(event.Email)
+			if !ok {
+				continue
+			}
+			response.Processed++
+
+			var reason string
+			switch {
+			case event.Type == "complaint":
+				reason = models.SuppressionComplained
+			case event.Type == "bounce" && event.BounceType != "soft":
+				reason = models.SuppressionBounced
+			default:
+				continue
+			}
+
+			detail := event.Detail
+			if len(detail) > maxBounceDetail {
+				detail = strings.ToValidUTF8(detail[:maxBounceDetail], "")
+			}
+			err := database.SuppressEmail(r.Context(), &models.EmailSuppression{Email: email, Reason: reason, Detail: detail})
+			if err != nil {
+				log.Error("Failed to suppress email: ", err)
+				writeJSON(w, r, BounceWebhookResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+				return
+			}
+			response.Suppressed++
+		}
+
+		log.Info("Bounce webhook processed", map[string]interface{}{"processed": response.Processed, "suppressed": response.Suppressed})
+		writeJSON(w, r, response, http.StatusOK)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/widget"
+)
+
+// EmbedFrameHandler serves the iframe version of a waitlist's signup form. The
+// query string may override the theme the same way the script's data attributes do.
+func EmbedFrameHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		waitlist, ok := getPublicWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		query := r.URL.Query()
+		theme := widget.Theme{
+			Mode:            query.Get("theme"),
+			AccentColor:     query.Get("accent_color"),
+			BackgroundColor: query.Get("background_color"),
+			TextColor:       query.Get("text_color"),
+			ButtonText:      query.Get("button_text"),
+		}
+		if radius := query.Get("border_radius"); radius != "" {
+			value, err := strconv.Atoi(radius)
+			if err != nil {
+				http.Error(w, "border_radius must be a number", http.StatusBadRequest)
+				return
+			}
+			theme.BorderRadius = &value
+		}
+		if err := theme.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "frame-ancestors "+widget.FrameAncestors(waitlist.EmbedAllowedOrigins))
+		err := widget.RenderFrame(w, widget.FrameData{
+			Slug:      waitlist.Slug,
+			Name:      waitlist.Name,
+			ScriptURL: "/embed/widget.js",
+			Theme:     theme,
+			ShowName:  query.Get("show_name") == "true",
+		})
+		if err != nil {
+			logger.FromContext(r.Context()).Error("Failed to render embed frame: ", err)
+		}
+	}
+}
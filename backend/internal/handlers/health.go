@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+)
+
+// readinessTimeout bounds how long a readiness probe may wait on the database
+const readinessTimeout = 2 * time.Second
+
+type HealthResponse struct {
+	Status            string            `json:"status"`
+	Checks            map[string]string `json:"checks,omitempty"`
+	PendingMigrations []string          `json:"pending_migrations,omitempty"`
+}
+
+// HealthzHandler reports that the process is alive. It never touches dependencies
+// so a slow database does not get the pod restarted.
+func HealthzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeHealthResponse(w, HealthResponse{Status: "ok"}, http.StatusOK)
+	}
+}
+
+// ReadyzHandler reports whether the instance can serve traffic: the database must
+// answer a ping and every embedded migration must have been applied.
+func ReadyzHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		response := HealthResponse{
+			Status: "ok",
+			Checks: map[string]string{"database": "ok", "migrations": "ok"},
+		}
+
+		if err := database.Ping(ctx); err != nil {
+			log.Warn("Readiness check failed: database ping", map[string]interface{}{"error": err.Error()})
+			response.Status = "unavailable"
+			response.Checks["database"] = "unreachable"
+			response.Checks["migrations"] = "unknown"
+			writeHealthResponse(w, response, http.StatusServiceUnavailable)
+			return
+		}
+
+		pending, err := database.PendingMigrations(ctx)
+		if err != nil {
+			log.Warn("Readiness check failed: migration status", map[string]interface{}{"error": err.Error()})
+			response.Status = "unavailable"
+			response.Checks["migrations"] = "unknown"
+			writeHealthResponse(w, response, http.StatusServiceUnavailable)
+			return
+		}
+		if len(pending) > 0 {
+			response.Status = "unavailable"
+			response.Checks["migrations"] = "pending"
+			response.PendingMigrations = pending
+			writeHealthResponse(w, response, http.StatusServiceUnavailable)
+			return
+		}
+
+		writeHealthResponse(w, response, http.StatusOK)
+	}
+}
+
+// writeHealthResponse writes a probe response in JSON format
+func writeHealthResponse(w http.ResponseWriter, response HealthResponse, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
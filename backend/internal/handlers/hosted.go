@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/botcheck"
+	"github.com/anish-chanda/openwaitlist/backend/internal/branding"
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/emailcheck"
+	"github.com/anish-chanda/openwaitlist/backend/internal/events"
+	"github.com/anish-chanda/openwaitlist/backend/internal/hosted"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/schedule"
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+	"github.com/anish-chanda/openwaitlist/backend/internal/views"
+	"github.com/go-chi/chi/v5"
+)
+
+// joinedTokenPurpose binds the links to a signup's result page
+const joinedTokenPurpose = "hosted-signup"
+
+// joinedLinkTTL is how long the result page link keeps working
+const joinedLinkTTL = 90 * 24 * time.Hour
+
+// maxHostedFormBytes caps the size of a hosted form submission
+const maxHostedFormBytes = 64 << 10
+
+// captchaResponseFields are the form fields captcha widgets put their token in
+var captchaResponseFields = []string{"cf-turnstile-response", "h-captcha-response", "g-recaptcha-response"}
+
+// shareText prefills posts sharing a referral link
+func shareText(waitlist *models.Waitlist) string {
+	if waitlist.ShareText != "" {
+		return waitlist.ShareText
+	}
+	return "I just joined the " + waitlist.Name + " waitlist, join me!"
+}
+
+// HostedPageConfig configures the hosted waitlist pages
+type HostedPageConfig struct {
+	BaseURL          string // public URL the pages are served on, for links and previews
+	Secret           []byte // signs the result page links
+	CaptchaScriptURL string // captcha provider script, needed on waitlists requiring a captcha
+}
+
+// pageURL returns the absolute URL of a path on the hosted pages
+func (c HostedPageConfig) pageURL(path string) string {
+	return strings.TrimRight(c.BaseURL, "/") + path
+}
+
+// newHostedPage fills in the parts of a hosted page every view shares
+func (c HostedPageConfig) newHostedPage(waitlist *models.Waitlist) hosted.Page {
+	page := hosted.Page{
+		Slug:         waitlist.Slug,
+		Name:         waitlist.Name,
+		Description:  branding.RenderMarkdown(waitlist.Description),
+		Summary:      branding.PlainText(waitlist.Description),
+		URL:          c.pageURL("/w/" + url.PathEscape(waitlist.Slug)),
+		Colors:       waitlist.BrandColors,
+		ShowBranding: waitlist.ShowVendorBranding,
+	}
+	if waitlist.Logo != nil {
+		page.LogoURL = c.pageURL(branding.LogoPath(*waitlist.Logo))
+	}
+	return page
+}
+
+// getHostedWaitlist loads the waitlist named in the URL, rendering the not found
+// page when it doesn't exist or isn't public
+func getHostedWaitlist(w http.ResponseWriter, r *http.Request, database db.Database) (*models.Waitlist, bool) {
+	waitlist, err := database.GetWaitlistBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil && err.Error() != "waitlist not found" {
+		logger.FromContext(r.Context()).Error("Failed to get waitlist: ", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if err != nil || !waitlist.IsPublic {
+		if err := hosted.RenderNotFound(w); err != nil {
+			logger.FromContext(r.Context()).Error("Failed to render page: ", err)
+		}
+		return nil, false
+	}
+	return waitlist, true
+}
+
+// renderHostedForm shows the join form, with a fresh bot challenge
+func renderHostedForm(w http.ResponseWriter, r *http.Request, verifier *botcheck.Verifier, config HostedPageConfig,
+	waitlist *models.Waitlist, form *hosted.Form, status int) {
+	log := logger.FromContext(r.Context())
+
+	challenge, err := verifier.NewChallenge(botSettings(waitlist))
+	if err != nil {
+		log.Error("Failed to create bot challenge: ", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	form.Action = "/w/" + url.PathEscape(waitlist.Slug)
+	form.Challenge = challenge
+	form.CaptchaScriptURL = config.CaptchaScriptURL
+	form.Consent = waitlist.Consent
+	if form.Fields == nil {
+		form.Fields = hosted.NewFields(waitlist.FormFields, nil, nil)
+	}
+
+	page := config.newHostedPage(waitlist)
+	page.Notice = form.Notice
+	page.Form = form
+	w.Header().Set("Cache-Control", "no-store")
+	if err := hosted.Render(w, status, page); err != nil {
+		log.Error("Failed to render page: ", err)
+	}
+}
+
+// HostedPageHandler renders a public waitlist's hosted page with its join form
+// and counts the view
+func HostedPageHandler(database db.Database, verifier *botcheck.Verifier, config HostedPageConfig, counter *views.Counter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		waitlist, ok := getHostedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		recordView(r, counter, waitlist)
+		state, _, err := waitlistState(r.Context(), database, waitlist, time.Now())
+		if err != nil {
+			logger.FromContext(r.Context()).Error("Failed to get waitlist state: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		form := &hosted.Form{Ref: strings.TrimSpace(r.URL.Query().Get("ref"))}
+		if waitlist.CaptureAttribution {
+			// kept in the form, the submission's Referer would be this page
+			form.LandingURL = config.pageURL(r.URL.RequestURI())
+			form.Referrer = r.Referer()
+		}
+		if state != schedule.Open {
+			unavailable, _ := unavailableResponse(waitlist, state)
+			if waitlist.OverflowMode != models.OverflowQueue {
+				// nothing to fill in, only say when or why signups are closed
+				page := config.newHostedPage(waitlist)
+				page.Notice = unavailable.Message
+				w.Header().Set("Cache-Control", "no-store")
+				if err := hosted.Render(w, http.StatusOK, page); err != nil {
+					logger.FromContext(r.Context()).Error("Failed to render page: ", err)
+				}
+				return
+			}
+			form.Notice = unavailable.Message + ", you can still join the queue"
+		}
+		renderHostedForm(w, r, verifier, config, waitlist, form, http.StatusOK)
+	}
+}
+
+// HostedJoinHandler takes the hosted page's form submission. Failed submissions
+// show the form again with the errors, successful ones redirect to the result page.
+func HostedJoinHandler(database db.Database, verifier *botcheck.Verifier, emails *emailcheck.Validator, publisher events.Publisher,
+	config HostedPageConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getHostedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxHostedFormBytes)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form submission", http.StatusBadRequest)
+			return
+		}
+
+		values := map[string]string{}
+		answers := map[string]interface{}{}
+		for _, field := range waitlist.FormFields {
+			if value := r.PostForm.Get("answers." + field.Key); value != "" {
+				values[field.Key] = value
+				answers[field.Key] = value
+			}
+		}
+		req := JoinWaitlistRequest{
+			Email:        r.PostForm.Get("email"),
+			Name:         r.PostForm.Get("name"),
+			Answers:      answers,
+			Ref:          r.PostForm.Get("ref"),
+			LandingURL:   r.PostForm.Get("landing_url"),
+			Referrer:     r.PostForm.Get("referrer"),
+			Website:      r.PostForm.Get(botcheck.HoneypotField),
+			FormToken:    r.PostForm.Get("form_token"),
+			PowChallenge: r.PostForm.Get("pow_challenge"),
+			PowNonce:     r.PostForm.Get("pow_nonce"),
+
+			AcceptTerms:    r.PostForm.Get("accept_terms") == "true",
+			MarketingOptIn: r.PostForm.Get("marketing_opt_in") == "true",
+		}
+		req.TermsVersion, _ = strconv.Atoi(r.PostForm.Get("terms_version"))
+		req.MarketingVersion, _ = strconv.Atoi(r.PostForm.Get("marketing_version"))
+		for _, field := range captchaResponseFields {
+			if token := r.PostForm.Get(field); token != "" {
+				req.CaptchaToken = token
+				break
+			}
+		}
+
+		signup, response, status := joinWaitlist(r, database, verifier, emails, publisher, waitlist, &req)
+		if !response.Success {
+			form := &hosted.Form{
+				Email:      req.Email,
+				Name:       req.Name,
+				Ref:        req.Ref,
+				LandingURL: req.LandingURL,
+				Referrer:   req.Referrer,
+				Fields:     hosted.NewFields(waitlist.FormFields, values, response.FieldErrors),
+
+				AcceptTerms:    req.AcceptTerms,
+				MarketingOptIn: req.MarketingOptIn,
+				TermsError:     response.FieldErrors["accept_terms"],
+			}
+			if response.Code == "consent_changed" {
+				// the new text has to be agreed to afresh
+				form.AcceptTerms, form.MarketingOptIn = false, false
+			}
+			switch {
+			case response.FieldErrors != nil:
+				form.Message = response.Message
+			case strings.Contains(response.Code, "email"):
+				form.EmailError = response.Message
+			default:
+				form.Message = response.Message
+			}
+			renderHostedForm(w, r, verifier, config, waitlist, form, status)
+			return
+		}
+
+		if signup == nil {
+			// silently rejected as a bot, it gets a result page without details
+			if waitlist.RedirectURL != "" {
+				http.Redirect(w, r, waitlist.RedirectURL, http.StatusSeeOther)
+				return
+			}
+			page := config.newHostedPage(waitlist)
+			page.Joined = &hosted.Joined{Message: response.Message}
+			if err := hosted.Render(w, http.StatusOK, page); err != nil {
+				log.Error("Failed to render page: ", err)
+			}
+			return
+		}
+
+		if waitlist.RedirectURL != "" {
+			http.Redirect(w, r, waitlist.RedirectURL, http.StatusSeeOther)
+			return
+		}
+
+		// redirect so reloading the result doesn't submit the form again
+		token, err := utils.SignToken(config.Secret, joinedTokenPurpose, map[string]string{
+			"waitlist_id": strconv.FormatInt(waitlist.ID, 10),
+			"signup_id":   strconv.FormatInt(signup.ID, 10),
+		}, time.Now().Add(joinedLinkTTL))
+		if err != nil {
+			log.Error("Failed to sign result link: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/w/"+url.PathEscape(waitlist.Slug)+"/joined?token="+url.QueryEscape(token), http.StatusSeeOther)
+	}
+}
+
+// HostedJoinedHandler shows a signup their current place in line and referral link
+func HostedJoinedHandler(database db.Database, config HostedPageConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getHostedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		claims, err := utils.VerifyToken(config.Secret, joinedTokenPurpose, r.URL.Query().Get("token"), time.Now())
+		if err != nil || claims["waitlist_id"] != strconv.FormatInt(waitlist.ID, 10) {
+			http.Redirect(w, r, "/w/"+url.PathEscape(waitlist.Slug), http.StatusSeeOther)
+			return
+		}
+		signupID, err := strconv.ParseInt(claims["signup_id"], 10, 64)
+		if err != nil {
+			http.Redirect(w, r, "/w/"+url.PathEscape(waitlist.Slug), http.StatusSeeOther)
+			return
+		}
+
+		signup, err := database.GetWaitlistSignup(r.Context(), waitlist.ID, signupID)
+		if err != nil {
+			if err.Error() == "signup not found" {
+				http.Redirect(w, r, "/w/"+url.PathEscape(waitlist.Slug), http.StatusSeeOther)
+				return
+			}
+			log.Error("Failed to get waitlist signup: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		page := config.newHostedPage(waitlist)
+		page.Joined = &hosted.Joined{
+			Message:     successMessage(waitlist),
+			Position:    signup.Position,
+			ReferralURL: page.URL + "?ref=" + url.QueryEscape(signup.ReferralCode),
+			ShareText:   shareText(waitlist),
+		}
+		// the link in the address bar identifies the signup, keep it out of caches and referrers
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		if err := hosted.Render(w, http.StatusOK, page); err != nil {
+			log.Error("Failed to render page: ", err)
+		}
+	}
+}
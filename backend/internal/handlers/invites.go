@@ -0,0 +1,592 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/events"
+	"github.com/anish-chanda/openwaitlist/backend/internal/hosted"
+	"github.com/anish-chanda/openwaitlist/backend/internal/invites"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/mailer"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/unsubscribe"
+	"github.com/go-chi/chi/v5"
+)
+
+// Invite limits
+const (
+	maxInviteUses       = 1_000_000
+	maxInviteCodeLength = 64
+	maxRedeemBytes      = 4 * 1024
+)
+
+// invalidInviteMessage doesn't say whether a code exists, was used up or expired
+const invalidInviteMessage = "This invite code is invalid, used up or expired"
+
+// InviteConfig configures invite emails and access tokens
+type InviteConfig struct {
+	BaseURL string // public URL invite links point at, also the issuer of access tokens
+	Mailer  *mailer.Mailer
+}
+
+// redeemURL returns the hosted page redeeming a code
+func (c InviteConfig) redeemURL(waitlist *models.Waitlist, code string) string {
+	return strings.TrimRight(c.BaseURL, "/") + "/w/" + url.PathEscape(waitlist.Slug) + "/invite?code=" + url.QueryEscape(code)
+}
+
+// CreateInvitesRequest makes one code for each signup, or one shared code
+// without signup IDs
+type CreateInvitesRequest struct {
+	SignupIDs []int64 `json:"signup_ids"`
+	MaxUses   *int    `json:"max_uses,omitempty"`   // redemptions per code, 1 by default and 0 for unlimited
+	ExpiresAt *string `json:"expires_at,omitempty"` // RFC 3339, codes don't expire without it
+	Send      bool    `json:"send"`                 // email each signup its code
+}
+
+// CreatedInvite is a new invite code. The code is only ever shown here.
+type CreatedInvite struct {
+	*models.InviteCode
+	Code      string `json:"code"`
+	RedeemURL string `json:"redeem_url"`
+	Sent      bool   `json:"sent"` // queued for emailing
+}
+
+// CreateInvitesResponse lists the codes made by a CreateInvitesRequest
+type CreateInvitesResponse struct {
+	Invites []CreatedInvite `json:"invites"`
+}
+
+// InvitesResponse is a page of a waitlist's invite codes
+type InvitesResponse struct {
+	Invites []*models.InviteCode `json:"invites"`
+	Total   int64                `json:"total"`
+	Limit   int                  `json:"limit"`
+	Offset  int                  `json:"offset"`
+}
+
+// InviteKeyResponse is what the product needs to verify a waitlist's access tokens
+type InviteKeyResponse struct {
+	Algorithm string `json:"algorithm"`
+	Key       string `json:"key"` // base64url without padding
+	KeyID     string `json:"key_id"`
+	Issuer    string `json:"issuer"`
+	Audience  string `json:"audience"`
+}
+
+// RedeemInviteRequest redeems an invite code
+type RedeemInviteRequest struct {
+	Code string `json:"code"`
+}
+
+// RedeemInviteResponse carries the access token of a redeemed invite
+type RedeemInviteResponse struct {
+	Success     bool       `json:"success"`
+	Message     string     `json:"message,omitempty"`
+	Token       string     `json:"token,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RedirectURL string     `json:"redirect_url,omitempty"` // the waitlist's callback URL with the token
+}
+
+// inviteRedemption is a redeemed invite's access token and where to send its holder
+type inviteRedemption struct {
+	Token       string
+	ExpiresAt   time.Time
+	RedirectURL string
+}
+
+// ListInvitesHandler lists a waitlist's invite codes, newest first, optionally
+// only the ones for ?signup_id=
+func ListInvitesHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		query := r.URL.Query()
+		var filter models.InviteCodeFilter
+		if value := query.Get("signup_id"); value != "" {
+			signupID, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, "signup_id must be a signup ID", http.StatusBadRequest)
+				return
+			}
+			filter.SignupID = &signupID
+		}
+		var err error
+		if filter.Limit, filter.Offset, err = parsePaging(query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		codes, total, err := database.ListInviteCodes(r.Context(), waitlist.ID, filter)
+		if err != nil {
+			log.Error("Failed to list invite codes: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, r, InvitesResponse{Invites: codes, Total: total, Limit: filter.Limit, Offset: filter.Offset}, http.StatusOK)
+	}
+}
+
+// CreateInvitesHandler makes invite codes for signups, marking waiting ones
+// invited and optionally emailing them their code, or one shared code
+func CreateInvitesHandler(database db.Database, config InviteConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		var req CreateInvitesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if len(req.SignupIDs) > maxBulkSignups {
+			http.Error(w, fmt.Sprintf("signup_ids can hold at most %d signup IDs", maxBulkSignups), http.StatusBadRequest)
+			return
+		}
+		if req.Send && len(req.SignupIDs) == 0 {
+			http.Error(w, "send needs signup_ids, shared codes have nobody to email", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		base := models.InviteCode{WaitlistID: waitlist.ID}
+		maxUses := 1
+		if req.MaxUses != nil {
+			maxUses = *req.MaxUses
+		}
+		if maxUses < 0 || maxUses > maxInviteUses {
+			http.Error(w, fmt.Sprintf("max_uses must be between 0 and %d", maxInviteUses), http.StatusBadRequest)
+			return
+		}
+		if maxUses > 0 {
+			base.MaxUses = &maxUses
+		}
+		if req.ExpiresAt != nil && strings.TrimSpace(*req.ExpiresAt) != "" {
+			expiresAt, err := time.Parse(time.RFC3339, strings.TrimSpace(*req.ExpiresAt))
+			if err != nil {
+				http.Error(w, "expires_at must be an RFC 3339 time like 2025-01-31T09:00:00Z", http.StatusBadRequest)
+				return
+			}
+			if !expiresAt.After(now) {
+				http.Error(w, "expires_at must be in the future", http.StatusBadRequest)
+				return
+			}
+			base.ExpiresAt = &expiresAt
+		}
+
+		// every signup gets its own code, queued signups have to be admitted first
+		signups := make([]*models.WaitlistSignup, 0, len(req.SignupIDs))
+		for _, signupID := range req.SignupIDs {
+			signup, err := database.GetWaitlistSignup(r.Context(), waitlist.ID, signupID)
+			if err != nil {
+				if err.Error() == "signup not found" {
+					http.Error(w, fmt.Sprintf("Signup %d not found", signupID), http.StatusBadRequest)
+					return
+				}
+				log.Error("Failed to get waitlist signup: ", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if signup.Status == models.SignupStatusQueued {
+				http.Error(w, fmt.Sprintf("Signup %d is queued, admit it before inviting it", signupID), http.StatusBadRequest)
+				return
+			}
+			signups = append(signups, signup)
+		}
+
+		var created []CreatedInvite
+		var codes []*models.InviteCode
+		newInvite := func(signup *models.WaitlistSignup) {
+			code := invites.NewCode()
+			invite := base
+			invite.CodeHash = invites.Hash(code)
+			invite.CodeHint = invites.Hint(code)
+			if signup != nil {
+				invite.SignupID = &signup.ID
+			}
+			codes = append(codes, &invite)
+			created = append(created, CreatedInvite{InviteCode: &invite, Code: code, RedeemURL: config.redeemURL(waitlist, code)})
+		}
+		if len(signups) == 0 {
+			newInvite(nil)
+		}
+		for _, signup := range signups {
+			newInvite(signup)
+		}
+
+		// the codes and the waiting signups moving to invited are written together, so
+		// a failed request can be retried without leaving a first set of live codes
+		if err := database.CreateInviteCodes(r.Context(), codes, now); err != nil {
+			log.Error("Failed to create invite codes: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// a code that couldn't be queued for emailing can still be handed out
+		if req.Send {
+			for i, signup := range signups {
+				err := config.Mailer.Send(r.Context(), inviteEmail(waitlist, signup, &created[i]))
+				if err != nil {
+					log.Error("Failed to queue invite email: ", err, map[string]interface{}{"signup_id": signup.ID})
+					continue
+				}
+				created[i].Sent = true
+			}
+		}
+
+		log.Info(fmt.Sprintf("Created %d invite codes for waitlist %s", len(created), waitlist.Slug))
+		writeJSON(w, r, CreateInvitesResponse{Invites: created}, http.StatusCreated)
+	}
+}
+
+// inviteEmail is the email telling a signup its invite code
+func inviteEmail(waitlist *models.Waitlist, signup *models.WaitlistSignup, invite *CreatedInvite) mailer.Email {
+	text := "Good news, you're invited to " + waitlist.Name + ".\n\n" +
+		"Your invite code: " + invite.Code + "\n" +
+		"Redeem it here: " + invite.RedeemURL + "\n"
+	if invite.ExpiresAt != nil {
+		text += "\nThe code works until " + invite.ExpiresAt.UTC().Format("2 Jan 2006 15:04 MST") + ".\n"
+	}
+	return mailer.Email{
+		Kind:       unsubscribe.Updates,
+		To:         signup.Email,
+		Subject:    "You're invited to " + waitlist.Name,
+		Text:       text,
+		WaitlistID: waitlist.ID,
+		SignupID:   signup.ID,
+	}
+}
+
+// RevokeInviteHandler stops an invite code from being redeemed, redemptions
+// already made keep their access
+func RevokeInviteHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		inviteID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid invite ID", http.StatusBadRequest)
+			return
+		}
+
+		invite, err := database.RevokeInviteCode(r.Context(), waitlist.ID, inviteID, time.Now())
+		if err != nil {
+			if err.Error() == "invite not found" {
+				http.Error(w, "Invite not found", http.StatusNotFound)
+				return
+			}
+			log.Error("Failed to revoke invite code: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info(fmt.Sprintf("Invite code %d of waitlist %s revoked", invite.ID, waitlist.Slug))
+		writeJSON(w, r, invite, http.StatusOK)
+	}
+}
+
+// newInviteKeyResponse describes a waitlist's signing key
+func newInviteKeyResponse(waitlist *models.Waitlist, key []byte, config InviteConfig) InviteKeyResponse {
+	return InviteKeyResponse{
+		Algorithm: "HS256",
+		Key:       base64.RawURLEncoding.EncodeToString(key),
+		KeyID:     invites.KeyID(key),
+		Issuer:    config.BaseURL,
+		Audience:  invites.Audience(waitlist.ID),
+	}
+}
+
+// InviteKeyHandler returns the key the product verifies the waitlist's access
+// tokens with, creating it on first use
+func InviteKeyHandler(database db.Database, config InviteConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		key, err := database.GetInviteSigningKey(r.Context(), waitlist.ID, invites.NewKey())
+		if err != nil {
+			logger.FromContext(r.Context()).Error("Failed to get invite signing key: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, newInviteKeyResponse(waitlist, key, config), http.StatusOK)
+	}
+}
+
+// RotateInviteKeyHandler replaces the waitlist's signing key. Tokens signed with
+// the old key stop verifying once the product has the new one.
+func RotateInviteKeyHandler(database db.Database, config InviteConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		key := invites.NewKey()
+		if err := database.RotateInviteSigningKey(r.Context(), waitlist.ID, key); err != nil {
+			log.Error("Failed to rotate invite signing key: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info(fmt.Sprintf("Invite signing key of waitlist %s rotated", waitlist.Slug))
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, newInviteKeyResponse(waitlist, key, config), http.StatusOK)
+	}
+}
+
+// getRedeemWaitlist loads the waitlist named in the URL for redeeming an
+// invite, nil when there's no such waitlist. Private waitlists take invites
+// too, the code is what lets people in.
+func getRedeemWaitlist(r *http.Request, database db.Database) (*models.Waitlist, error) {
+	waitlist, err := database.GetWaitlistBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		if err.Error() == "waitlist not found" {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return waitlist, nil
+}
+
+// redeemInvite signs the access token for a code and then uses up one
+// redemption of it. Codes that can't be redeemed return an "invite not found" error.
+func redeemInvite(r *http.Request, database db.Database, publisher events.Publisher, config InviteConfig,
+	waitlist *models.Waitlist, code string) (*inviteRedemption, error) {
+	ctx := r.Context()
+	code = invites.Normalize(code)
+	if code == "" || len(code) > maxInviteCodeLength {
+		return nil, fmt.Errorf("invite not found")
+	}
+
+	// everything that can fail runs before the redemption so a failure doesn't
+	// burn a one-use code
+	key, err := database.GetInviteSigningKey(ctx, waitlist.ID, invites.NewKey())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	hash := invites.Hash(code)
+	invite, err := database.GetRedeemableInviteCode(ctx, waitlist.ID, hash, now)
+	if err != nil {
+		return nil, err
+	}
+
+	var signup *models.WaitlistSignup
+	if invite.SignupID != nil {
+		signup, err = database.GetWaitlistSignup(ctx, waitlist.ID, *invite.SignupID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	token, expiresAt, err := invites.Sign(key, config.BaseURL, waitlist, invite, signup, now)
+	if err != nil {
+		return nil, err
+	}
+
+	redemption := &inviteRedemption{Token: token, ExpiresAt: expiresAt}
+	if waitlist.InviteCallbackURL != "" {
+		if redemption.RedirectURL, err = invites.CallbackURL(waitlist.InviteCallbackURL, token); err != nil {
+			return nil, err
+		}
+	}
+
+	// the code can still have been used up or revoked since it was loaded
+	if invite, err = database.RedeemInviteCode(ctx, waitlist.ID, hash, now); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("Invite redeemed", map[string]interface{}{"waitlist": waitlist.Slug, "invite_id": invite.ID, "uses": invite.Uses})
+	publishInviteRedeemed(r, database, publisher, waitlist, invite, signup)
+	return redemption, nil
+}
+
+// publishInviteRedeemed records and publishes the invite.redeemed event, failing
+// only costs the event
+func publishInviteRedeemed(r *http.Request, database db.Database, publisher events.Publisher, waitlist *models.Waitlist,
+	invite *models.InviteCode, signup *models.WaitlistSignup) {
+	log := logger.FromContext(r.Context())
+
+	data := map[string]interface{}{}
+	if signup != nil {
+		data = events.SignupData(signup)
+	}
+	data["invite_id"] = invite.ID
+	data["uses"] = invite.Uses
+
+	event := &models.WaitlistEvent{
+		WaitlistID: waitlist.ID,
+		Type:       events.InviteRedeemed,
+		DedupKey:   events.InviteRedeemed + ":" + strconv.FormatInt(invite.ID, 10) + ":" + strconv.Itoa(invite.Uses),
+		Data:       data,
+	}
+	if _, err := database.RecordWaitlistEvent(r.Context(), event); err != nil {
+		log.Error("Failed to record invite event: ", err)
+		return
+	}
+	if err := publisher.Publish(r.Context(), waitlist, event); err != nil {
+		// the event stays recorded, publishers are expected to retry on their own
+		log.Error("Failed to publish invite event: ", err)
+	}
+}
+
+// writeRedeemResponse writes a RedeemInviteResponse with the given status
+func writeRedeemResponse(w http.ResponseWriter, response RedeemInviteResponse, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// RedeemInviteHandler redeems an invite code for the product's own frontend,
+// returning the access token and the callback URL carrying it
+func RedeemInviteHandler(database db.Database, publisher events.Publisher, config InviteConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, err := getRedeemWaitlist(r, database)
+		if err != nil {
+			log.Error("Failed to get waitlist: ", err)
+			writeRedeemResponse(w, RedeemInviteResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		if waitlist == nil {
+			writeRedeemResponse(w, RedeemInviteResponse{Message: "Waitlist not found"}, http.StatusNotFound)
+			return
+		}
+		if !allowCrossOrigin(w, r, waitlist) {
+			writeRedeemResponse(w, RedeemInviteResponse{Message: "This site may not redeem invites of this waitlist"}, http.StatusForbidden)
+			return
+		}
+
+		var req RedeemInviteRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRedeemBytes)).Decode(&req); err != nil {
+			writeRedeemResponse(w, RedeemInviteResponse{Message: "Invalid request format"}, http.StatusBadRequest)
+			return
+		}
+
+		redemption, err := redeemInvite(r, database, publisher, config, waitlist, req.Code)
+		if err != nil {
+			if err.Error() == "invite not found" {
+				writeRedeemResponse(w, RedeemInviteResponse{Message: invalidInviteMessage}, http.StatusBadRequest)
+				return
+			}
+			log.Error("Failed to redeem invite: ", err)
+			writeRedeemResponse(w, RedeemInviteResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		writeRedeemResponse(w, RedeemInviteResponse{
+			Success:     true,
+			Token:       redemption.Token,
+			ExpiresAt:   &redemption.ExpiresAt,
+			RedirectURL: redemption.RedirectURL,
+		}, http.StatusOK)
+	}
+}
+
+// renderInvite writes the invite page, logging a failed render
+func renderInvite(w http.ResponseWriter, r *http.Request, status int, page hosted.InvitePage) {
+	if err := hosted.RenderInvite(w, status, page); err != nil {
+		logger.FromContext(r.Context()).Error("Failed to render page: ", err)
+	}
+}
+
+// getHostedRedeemWaitlist loads the waitlist for the hosted invite page,
+// rendering the not found page when there's none
+func getHostedRedeemWaitlist(w http.ResponseWriter, r *http.Request, database db.Database) (*models.Waitlist, bool) {
+	waitlist, err := getRedeemWaitlist(r, database)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Failed to get waitlist: ", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if waitlist == nil {
+		if err := hosted.RenderNotFound(w); err != nil {
+			logger.FromContext(r.Context()).Error("Failed to render page: ", err)
+		}
+		return nil, false
+	}
+	return waitlist, true
+}
+
+// HostedInvitePageHandler shows the form redeeming an invite, filled in with
+// ?code= from the emailed link. Opening the link doesn't redeem anything.
+func HostedInvitePageHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		waitlist, ok := getHostedRedeemWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		renderInvite(w, r, http.StatusOK, hosted.InvitePage{
+			Step: hosted.InviteRedeem,
+			Slug: waitlist.Slug,
+			Name: waitlist.Name,
+			Code: r.URL.Query().Get("code"),
+		})
+	}
+}
+
+// HostedRedeemInviteHandler redeems the invite page's code and sends the
+// visitor to the waitlist's callback URL with the access token, or shows that
+// they're in when the waitlist has none
+func HostedRedeemInviteHandler(database db.Database, publisher events.Publisher, config InviteConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getHostedRedeemWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRedeemBytes)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form submission", http.StatusBadRequest)
+			return
+		}
+
+		page := hosted.InvitePage{Step: hosted.InviteRedeem, Slug: waitlist.Slug, Name: waitlist.Name, Code: r.PostForm.Get("code")}
+		redemption, err := redeemInvite(r, database, publisher, config, waitlist, page.Code)
+		if err != nil {
+			if err.Error() == "invite not found" {
+				page.Message = invalidInviteMessage
+				renderInvite(w, r, http.StatusBadRequest, page)
+				return
+			}
+			log.Error("Failed to redeem invite: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if redemption.RedirectURL != "" {
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, redemption.RedirectURL, http.StatusSeeOther)
+			return
+		}
+		page.Step = hosted.InviteGranted
+		renderInvite(w, r, http.StatusOK, page)
+	}
+}
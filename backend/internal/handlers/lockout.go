@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/mailer"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/unsubscribe"
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// unlockTokenPurpose binds unlock tokens so they can't be used as other signed links
+const unlockTokenPurpose = "account-unlock"
+
+// LockoutPolicy configures per-account login lockouts
+type LockoutPolicy struct {
+	Threshold    int           // failed logins before locking, 0 disables lockouts
+	BaseDuration time.Duration // first lock, doubled for each consecutive lock
+	MaxDuration  time.Duration
+	UnlockSecret []byte // signs unlock links
+	BaseURL      string // public URL unlock links point at
+}
+
+// LockoutNotifier tells a user their account was locked and how to unlock it
+type LockoutNotifier interface {
+	NotifyAccountLocked(ctx context.Context, user *models.User, lockedUntil time.Time, unlockURL string) error
+}
+
+// MailLockoutNotifier emails the user that their account was locked, with the
+// unlock link
+type MailLockoutNotifier struct {
+	Mailer *mailer.Mailer
+}
+
+func (n MailLockoutNotifier) NotifyAccountLocked(ctx context.Context, user *models.User, lockedUntil time.Time, unlockURL string) error {
+	logger.FromContext(ctx).Warn("Account locked after repeated failed logins", map[string]interface{}{
+		"user_id":      user.ID,
+		"locked_until": lockedUntil.Format(time.RFC3339),
+	})
+	return n.Mailer.Send(ctx, mailer.Email{
+		Kind:    unsubscribe.Transactional,
+		To:      user.Email,
+		Subject: "Your account has been locked",
+		Text: "There were too many failed attempts to sign in to your account, so it is locked until " +
+			lockedUntil.UTC().Format("2 Jan 2006 15:04 MST") + ".\n\n" +
+			"If this was you, you can unlock it now: " + unlockURL + "\n\n" +
+			"If it wasn't, someone may be guessing your password. Consider changing it once you're back in.\n",
+	})
+}
+
+// LoginLockoutMiddleware wraps the local login endpoint. It rejects logins for
+// locked accounts before any password is checked, records every attempt with the
+// client IP, locks accounts after policy.Threshold failures and notifies the user.
+func LoginLockoutMiddleware(database db.Database, policy LockoutPolicy, notifier LockoutNotifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if policy.Threshold <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			// read where the auth library reads the user, and refuse requests it
+			// could read differently rather than letting them past the lockout
+			email, err := utils.RequestField(r, "user")
+			if err != nil {
+				writeErrorResponse(w, "Invalid login request", utils.RequestFieldStatus(err))
+				return
+			}
+			email = strings.TrimSpace(email)
+			if email == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log := logger.FromContext(r.Context())
+			ctx := r.Context()
+			attempt := &models.LoginAttempt{Email: email, IP: clientIP(r)}
+
+			lockout, err := database.GetAccountLockout(ctx, email)
+			if err != nil {
+				// fail open, the rate limiter still bounds attempts
+				log.Error("Failed to get account lockout: ", err)
+			} else if lockout.IsLocked(time.Now()) {
+				attempt.Blocked = true
+				if err := database.RecordLoginAttempt(ctx, attempt); err != nil {
+					log.Error("Failed to record login attempt: ", err)
+				}
+				retryAfter := int(math.Ceil(time.Until(*lockout.LockedUntil).Seconds()))
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				writeErrorResponse(w, "Too many failed login attempts. Try again later or use the unlock link sent to your email.", http.StatusTooManyRequests)
+				return
+			}
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			// the auth library answers 200 on success and 403 on bad credentials,
+			// anything else (bad request, server error) isn't a credential check
+			switch ww.Status() {
+			case http.StatusOK:
+				attempt.Succeeded = true
+				if err := database.ClearAccountLockout(ctx, email); err != nil {
+					log.Error("Failed to clear account lockout: ", err)
+				}
+			case http.StatusForbidden:
+				lockout, locked, err := database.RecordFailedLogin(ctx, email, policy.Threshold, policy.BaseDuration, policy.MaxDuration)
+				if err != nil {
+					log.Error("Failed to record failed login: ", err)
+				} else if locked {
+					notifyLocked(ctx, database, policy, notifier, lockout)
+				}
+			default:
+				return
+			}
+
+			if user, err := database.GetUserByEmail(ctx, email); err == nil {
+				attempt.UserID = &user.ID
+			}
+			if err := database.RecordLoginAttempt(ctx, attempt); err != nil {
+				log.Error("Failed to record login attempt: ", err)
+			}
+		})
+	}
+}
+
+// notifyLocked sends the unlock link to the owner of a locked account, emails
+// without a user are locked the same way but nobody is notified
+func notifyLocked(ctx context.Context, database db.Database, policy LockoutPolicy, notifier LockoutNotifier, lockout *models.AccountLockout) {
+	log := logger.FromContext(ctx)
+
+	user, err := database.GetUserByEmail(ctx, lockout.Email)
+	if err != nil {
+		return
+	}
+
+	token, err := utils.SignToken(policy.UnlockSecret, unlockTokenPurpose, map[string]string{
+		"email":        lockout.Email,
+		"user_id":      strconv.FormatInt(user.ID, 10), // logged instead of the email
+		"locked_until": strconv.FormatInt(lockout.LockedUntil.Unix(), 10),
+	}, *lockout.LockedUntil)
+	if err != nil {
+		log.Error("Failed to sign unlock token: ", err)
+		return
+	}
+	unlockURL := strings.TrimRight(policy.BaseURL, "/") + "/auth/unlock?token=" + url.QueryEscape(token)
+
+	if err := notifier.NotifyAccountLocked(ctx, user, *lockout.LockedUntil, unlockURL); err != nil {
+		log.Error("Failed to notify user about account lockout: ", err)
+	}
+}
+
+// UnlockAccountHandler clears a lockout from a signed unlock link and sends the
+// user to the login page. A link only works for the lock it was issued for.
+func UnlockAccountHandler(database db.Database, policy LockoutPolicy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		claims, err := utils.VerifyToken(policy.UnlockSecret, unlockTokenPurpose, r.URL.Query().Get("token"), time.Now())
+		if err != nil {
+			http.Error(w, "Invalid or expired unlock link", http.StatusBadRequest)
+			return
+		}
+
+		lockout, err := database.GetAccountLockout(r.Context(), claims["email"])
+		if err != nil {
+			log.Error("Failed to get account lockout: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if lockout.LockedUntil == nil || strconv.FormatInt(lockout.LockedUntil.Unix(), 10) != claims["locked_until"] {
+			http.Error(w, "Invalid or expired unlock link", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.ClearAccountLockout(r.Context(), claims["email"]); err != nil {
+			log.Error("Failed to clear account lockout: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		userID, _ := strconv.ParseInt(claims["user_id"], 10, 64)
+		log.Info("Account unlocked via unlock link", map[string]interface{}{"user_id": userID})
+		http.Redirect(w, r, "/login?unlocked=1", http.StatusSeeOther)
+	}
+}
+
+// clientIP returns the IP part of RemoteAddr, which RealIP rewrites behind trusted proxies
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
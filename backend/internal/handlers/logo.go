@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/branding"
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-pkgz/auth/v2/avatar"
+)
+
+// UploadLogoHandler replaces a waitlist's logo with the image in the "logo"
+// field of a multipart form
+func UploadLogoHandler(database db.Database, store avatar.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		// room for the multipart framing around the image
+		r.Body = http.MaxBytesReader(w, r.Body, branding.MaxLogoBytes+64<<10)
+		file, _, err := r.FormFile("logo")
+		if err != nil {
+			http.Error(w, "A logo image is required in the logo field", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		data, err := branding.ReadLogo(file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// a new name for every upload, so cached copies of the old logo don't linger
+		key := "waitlist-" + strconv.FormatInt(waitlist.ID, 10) + "-" + utils.GenerateRandomString(8)
+		name, err := store.Put(key, bytes.NewReader(data))
+		if err != nil {
+			log.Error("Failed to store logo: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		previous := waitlist.Logo
+		waitlist.Logo = &name
+		if err := database.UpdateWaitlist(r.Context(), waitlist); err != nil {
+			log.Error("Failed to update waitlist: ", err)
+			store.Remove(name)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if previous != nil {
+			if err := store.Remove(*previous); err != nil {
+				log.Warn("Failed to remove previous logo", map[string]interface{}{"logo": *previous, "error": err.Error()})
+			}
+		}
+
+		writeJSON(w, r, newWaitlistResponse(waitlist), http.StatusOK)
+	}
+}
+
+// DeleteLogoHandler removes a waitlist's logo
+func DeleteLogoHandler(database db.Database, store avatar.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		if waitlist.Logo == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		previous := *waitlist.Logo
+		waitlist.Logo = nil
+		if err := database.UpdateWaitlist(r.Context(), waitlist); err != nil {
+			log.Error("Failed to update waitlist: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := store.Remove(previous); err != nil {
+			log.Warn("Failed to remove logo", map[string]interface{}{"logo": previous, "error": err.Error()})
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// LogoHandler serves stored logos. Names change with every upload, so the
+// files can be cached for good.
+func LogoHandler(store avatar.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "logo")
+		if !branding.ValidLogoName(name) {
+			http.NotFound(w, r)
+			return
+		}
+
+		reader, _, err := store.Get(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer reader.Close()
+
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			logger.FromContext(r.Context()).Error("Failed to read logo: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", http.DetectContentType(data))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'")
+		w.Write(data)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/mailer"
+	"github.com/go-chi/chi/v5"
+)
+
+// OutboxResponse lists the emails in the local outbox
+type OutboxResponse struct {
+	Emails []mailer.OutboxEmail `json:"emails"`
+}
+
+// OutboxListHandler lists the emails the outbox provider has written, newest
+// first. Only routed outside production.
+func OutboxListHandler(outbox *mailer.Outbox) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		emails, err := outbox.List()
+		if err != nil {
+			logger.FromContext(r.Context()).Error("Failed to list outbox: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, r, OutboxResponse{Emails: emails}, http.StatusOK)
+	}
+}
+
+// OutboxMessageHandler returns one email from the outbox as it would have been
+// sent. Only routed outside production.
+func OutboxMessageHandler(outbox *mailer.Outbox) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data, err := outbox.Read(chi.URLParam(r, "name"))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				http.Error(w, "Email not found", http.StatusNotFound)
+				return
+			}
+			logger.FromContext(r.Context()).Error("Failed to read outbox email: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(data)
+	}
+}
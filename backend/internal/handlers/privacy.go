@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/hosted"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/mailer"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/unsubscribe"
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+)
+
+// dataRequestTokenPurpose binds data request links so they can't be used as other signed links
+const dataRequestTokenPurpose = "data-request"
+
+// dataRequestLinkTTL is how long an emailed data request link works
+const dataRequestLinkTTL = 24 * time.Hour
+
+// maxDataRequestBytes bounds data request bodies
+const maxDataRequestBytes = 16 * 1024
+
+// dataRequestSentMessage doesn't say whether the address is on any waitlist
+const dataRequestSentMessage = "If we hold data about that address, we've emailed it a link"
+
+// DataRequestNotifier emails a data subject the link to their data
+type DataRequestNotifier interface {
+	SendDataRequestLink(ctx context.Context, email, link string, expiresAt time.Time) error
+}
+
+// MailDataRequestNotifier emails data request links
+type MailDataRequestNotifier struct {
+	Mailer *mailer.Mailer
+}
+
+func (n MailDataRequestNotifier) SendDataRequestLink(ctx context.Context, email, link string, expiresAt time.Time) error {
+	return n.Mailer.Send(ctx, mailer.Email{
+		Kind:    unsubscribe.Transactional,
+		To:      email,
+		Subject: "Your data request",
+		Text: "Someone asked to see or erase the data we hold about this email address. " +
+			"Use this link to review, download or erase it: " + link + "\n\n" +
+			"The link works until " + expiresAt.UTC().Format("2 Jan 2006 15:04 MST") + ". " +
+			"If you didn't ask for it, you can ignore this email.\n",
+	})
+}
+
+// PrivacyConfig configures the data subject request endpoints
+type PrivacyConfig struct {
+	BaseURL  string // public URL the emailed links point at
+	Secret   []byte // signs the links and keys the audit trail's subject hashes
+	Notifier DataRequestNotifier
+}
+
+// subjectHash identifies an email in the audit trail without storing it
+func (c PrivacyConfig) subjectHash(email string) []byte {
+	mac := hmac.New(sha256.New, c.Secret)
+	mac.Write([]byte("data-subject:" + strings.ToLower(strings.TrimSpace(email))))
+	return mac.Sum(nil)
+}
+
+// exportURL is where the subject of a link token downloads their data
+func (c PrivacyConfig) exportURL(token string) string {
+	return "/public/v1/privacy/export?token=" + url.QueryEscape(token)
+}
+
+// DataRequestLinkRequest asks for a data request link to be emailed
+type DataRequestLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// DataErasureRequest erases the data of a link token's subject
+type DataErasureRequest struct {
+	Token string `json:"token"`
+	Mode  string `json:"mode,omitempty"` // delete (default) or anonymize
+}
+
+// DataRequestResponse answers data subject requests
+type DataRequestResponse struct {
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	Code      string `json:"code,omitempty"`
+	Erased    int64  `json:"erased,omitempty"`    // signups erased
+	Waitlists int    `json:"waitlists,omitempty"` // waitlists they were on
+}
+
+// DataExport is the download of everything held about a data subject
+type DataExport struct {
+	Email      string    `json:"email"`
+	ExportedAt time.Time `json:"exported_at"`
+	*models.SubscriberData
+}
+
+// sendDataRequestLink emails a signed link to an address that is on at least
+// one waitlist. Addresses without signups or that bounced get nothing, and the
+// caller answers the same either way.
+func sendDataRequestLink(ctx context.Context, database db.Database, config PrivacyConfig, email string) error {
+	data, err := database.GetSubscriberData(ctx, email)
+	if err != nil {
+		return err
+	}
+	if len(data.Signups) == 0 {
+		return nil
+	}
+	allowed, err := unsubscribe.Allowed(ctx, database, email, nil, unsubscribe.Transactional)
+	if err != nil || !allowed {
+		return err
+	}
+
+	expiresAt := time.Now().Add(dataRequestLinkTTL)
+	token, err := utils.SignToken(config.Secret, dataRequestTokenPurpose, map[string]string{"email": email}, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to sign data request link: %w", err)
+	}
+	link := strings.TrimRight(config.BaseURL, "/") + "/privacy?token=" + url.QueryEscape(token)
+	if err := config.Notifier.SendDataRequestLink(ctx, email, link, expiresAt); err != nil {
+		return fmt.Errorf("failed to send data request link: %w", err)
+	}
+
+	return database.RecordDataRequest(ctx, &models.DataRequest{
+		Kind:        models.DataRequestLink,
+		SubjectHash: config.subjectHash(email),
+		Signups:     len(data.Signups),
+		WaitlistIDs: subscriberWaitlistIDs(data),
+	})
+}
+
+// eraseSubscriber erases a link token's subject and records it in the audit trail
+func eraseSubscriber(ctx context.Context, database db.Database, config PrivacyConfig, email, mode string) (int64, []int64, error) {
+	erased, waitlistIDs, err := database.EraseSubscriber(ctx, email, mode)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = database.RecordDataRequest(ctx, &models.DataRequest{
+		Kind:        models.DataRequestErasure,
+		SubjectHash: config.subjectHash(email),
+		Mode:        &mode,
+		Signups:     int(erased),
+		WaitlistIDs: waitlistIDs,
+	})
+	return erased, waitlistIDs, err
+}
+
+// subscriberWaitlistIDs lists the waitlists a subject's signups are on
+func subscriberWaitlistIDs(data *models.SubscriberData) []int64 {
+	ids := []int64{}
+	for _, signup := range data.Signups {
+		if len(ids) == 0 || ids[len(ids)-1] != signup.WaitlistID {
+			ids = append(ids, signup.WaitlistID)
+		}
+	}
+	return ids
+}
+
+// parseDataRequestEmail lowercases an email address, reporting false when it
+// isn't one
+func parseDataRequestEmail(value string) (string, bool) {
+	address, err := mail.ParseAddress(strings.TrimSpace(value))
+	if err != nil || address.Name != "" {
+		return "", false
+	}
+	return strings.ToLower(address.Address), true
+}
+
+// verifyDataRequestToken returns the email a data request link was issued for
+func verifyDataRequestToken(config PrivacyConfig, token string) (string, bool) {
+	claims, err := utils.VerifyToken(config.Secret, dataRequestTokenPurpose, token, time.Now())
+	if err != nil || claims["email"] == "" {
+		return "", false
+	}
+	return claims["email"], true
+}
+
+// validErasureMode defaults an empty mode to deleting
+func validErasureMode(mode string) (string, bool) {
+	switch mode {
+	case "":
+		return models.ErasureDelete, true
+	case models.ErasureDelete, models.ErasureAnonymize:
+		return mode, true
+	}
+	return "", false
+}
+
+// DataRequestLinkHandler emails a subscriber a signed link to download or erase
+// their data. It answers the same whether or not the address is on a waitlist.
+func DataRequestLinkHandler(database db.Database, config PrivacyConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		var req DataRequestLinkRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDataRequestBytes)).Decode(&req); err != nil {
+			writeJSON(w, r, DataRequestResponse{Message: "Invalid request body"}, http.StatusBadRequest)
+			return
+		}
+		email, ok := parseDataRequestEmail(req.Email)
+		if !ok {
+			writeJSON(w, r, DataRequestResponse{Message: "Enter a valid email address", Code: "invalid_email"}, http.StatusBadRequest)
+			return
+		}
+
+		if err := sendDataRequestLink(r.Context(), database, config, email); err != nil {
+			log.Error("Failed to send data request link: ", err)
+			writeJSON(w, r, DataRequestResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, r, DataRequestResponse{Success: true, Message: dataRequestSentMessage}, http.StatusAccepted)
+	}
+}
+
+// DataExportHandler downloads everything held about the subject of a data
+// request link as JSON
+func DataExportHandler(database db.Database, config PrivacyConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		email, ok := verifyDataRequestToken(config, r.URL.Query().Get("token"))
+		if !ok {
+			writeJSON(w, r, DataRequestResponse{Message: "Invalid or expired link", Code: "invalid_token"}, http.StatusUnauthorized)
+			return
+		}
+
+		data, err := database.GetSubscriberData(r.Context(), email)
+		if err != nil {
+			log.Error("Failed to get subscriber data: ", err)
+			writeJSON(w, r, DataRequestResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		err = database.RecordDataRequest(r.Context(), &models.DataRequest{
+			Kind:        models.DataRequestExport,
+			SubjectHash: config.subjectHash(email),
+			Signups:     len(data.Signups),
+			WaitlistIDs: subscriberWaitlistIDs(data),
+		})
+		if err != nil {
+			log.Error("Failed to record data export: ", err)
+			writeJSON(w, r, DataRequestResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="my-waitlist-data.json"`)
+		w.Header().Set("Cache-Control", "no-store")
+		writeJSON(w, r, DataExport{Email: email, ExportedAt: time.Now().UTC(), SubscriberData: data}, http.StatusOK)
+	}
+}
+
+// DataErasureHandler erases every signup of the subject of a data request link
+func DataErasureHandler(database db.Database, config PrivacyConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		var req DataErasureRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDataRequestBytes)).Decode(&req); err != nil {
+			writeJSON(w, r, DataRequestResponse{Message: "Invalid request body"}, http.StatusBadRequest)
+			return
+		}
+		email, ok := verifyDataRequestToken(config, req.Token)
+		if !ok {
+			writeJSON(w, r, DataRequestResponse{Message: "Invalid or expired link", Code: "invalid_token"}, http.StatusUnauthorized)
+			return
+		}
+		mode, ok := validErasureMode(req.Mode)
+		if !ok {
+			writeJSON(w, r, DataRequestResponse{Message: "mode must be delete or anonymize", Code: "invalid_mode"}, http.StatusBadRequest)
+			return
+		}
+
+		erased, waitlistIDs, err := eraseSubscriber(r.Context(), database, config, email, mode)
+		if err != nil {
+			log.Error("Failed to erase subscriber: ", err)
+			writeJSON(w, r, DataRequestResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, r, DataRequestResponse{
+			Success:   true,
+			Message:   "Your data was erased",
+			Erased:    erased,
+			Waitlists: len(waitlistIDs),
+		}, http.StatusOK)
+	}
+}
+
+// PrivacyPageHandler renders the self-service privacy page: a form asking for
+// the email to send a link to, or with a link's token the download and erase
+// options
+func PrivacyPageHandler(database db.Database, config PrivacyConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			if err := hosted.RenderPrivacy(w, http.StatusOK, hosted.PrivacyPage{Step: hosted.PrivacyRequest}); err != nil {
+				log.Error("Failed to render page: ", err)
+			}
+			return
+		}
+
+		email, ok := verifyDataRequestToken(config, token)
+		if !ok {
+			if err := hosted.RenderPrivacy(w, http.StatusBadRequest, hosted.PrivacyPage{Step: hosted.PrivacyInvalid}); err != nil {
+				log.Error("Failed to render page: ", err)
+			}
+			return
+		}
+		data, err := database.GetSubscriberData(r.Context(), email)
+		if err != nil {
+			log.Error("Failed to get subscriber data: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		page := hosted.PrivacyPage{Step: hosted.PrivacyManage, Token: token, ExportURL: config.exportURL(token)}
+		for _, signup := range data.Signups {
+			page.Waitlists = append(page.Waitlists, signup.WaitlistName)
+		}
+		if err := hosted.RenderPrivacy(w, http.StatusOK, page); err != nil {
+			log.Error("Failed to render page: ", err)
+		}
+	}
+}
+
+// PrivacyRequestHandler takes the privacy page's email form
+func PrivacyRequestHandler(database db.Database, config PrivacyConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxDataRequestBytes)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form submission", http.StatusBadRequest)
+			return
+		}
+		email, ok := parseDataRequestEmail(r.PostForm.Get("email"))
+		if !ok {
+			page := hosted.PrivacyPage{Step: hosted.PrivacyRequest, Message: "Enter a valid email address"}
+			if err := hosted.RenderPrivacy(w, http.StatusBadRequest, page); err != nil {
+				log.Error("Failed to render page: ", err)
+			}
+			return
+		}
+
+		if err := sendDataRequestLink(r.Context(), database, config, email); err != nil {
+			log.Error("Failed to send data request link: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := hosted.RenderPrivacy(w, http.StatusOK, hosted.PrivacyPage{Step: hosted.PrivacySent}); err != nil {
+			log.Error("Failed to render page: ", err)
+		}
+	}
+}
+
+// PrivacyEraseHandler takes the privacy page's erase form
+func PrivacyEraseHandler(database db.Database, config PrivacyConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxDataRequestBytes)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form submission", http.StatusBadRequest)
+			return
+		}
+		token := r.PostForm.Get("token")
+		email, ok := verifyDataRequestToken(config, token)
+		if !ok {
+			if err := hosted.RenderPrivacy(w, http.StatusBadRequest, hosted.PrivacyPage{Step: hosted.PrivacyInvalid}); err != nil {
+				log.Error("Failed to render page: ", err)
+			}
+			return
+		}
+		mode, ok := validErasureMode(r.PostForm.Get("mode"))
+		if !ok || r.PostForm.Get("confirm") != "yes" {
+			page := hosted.PrivacyPage{
+				Step:      hosted.PrivacyManage,
+				Message:   "Choose what to erase and confirm it",
+				Token:     token,
+				ExportURL: config.exportURL(token),
+			}
+			if err := hosted.RenderPrivacy(w, http.StatusBadRequest, page); err != nil {
+				log.Error("Failed to render page: ", err)
+			}
+			return
+		}
+
+		erased, _, err := eraseSubscriber(r.Context(), database, config, email, mode)
+		if err != nil {
+			log.Error("Failed to erase subscriber: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := hosted.RenderPrivacy(w, http.StatusOK, hosted.PrivacyPage{Step: hosted.PrivacyErased, Erased: erased}); err != nil {
+			log.Error("Failed to render page: ", err)
+		}
+	}
+}
@@ -0,0 +1,556 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/attribution"
+	"github.com/anish-chanda/openwaitlist/backend/internal/botcheck"
+	"github.com/anish-chanda/openwaitlist/backend/internal/branding"
+	"github.com/anish-chanda/openwaitlist/backend/internal/consent"
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/emailcheck"
+	"github.com/anish-chanda/openwaitlist/backend/internal/events"
+	"github.com/anish-chanda/openwaitlist/backend/internal/formfields"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/metrics"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/schedule"
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+	"github.com/anish-chanda/openwaitlist/backend/internal/views"
+	"github.com/anish-chanda/openwaitlist/backend/internal/widget"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultSuccessMessage is shown after joining a waitlist without its own message
+const defaultSuccessMessage = "You're on the waitlist!"
+
+// referralCodeLength is the length of the code in signups' referral links
+const referralCodeLength = 10
+
+// JoinWaitlistRequest is the body of a public waitlist signup
+type JoinWaitlistRequest struct {
+	Email   string                 `json:"email"`
+	Name    string                 `json:"name,omitempty"`
+	Answers map[string]interface{} `json:"answers,omitempty"` // custom form fields by key
+	Ref     string                 `json:"ref,omitempty"`     // referral code from the link the visitor followed
+
+	// Consent checkboxes, see PublicWaitlistResponse.Consent. The versions are
+	// the ones of the text shown, signups showing outdated text are refused.
+	AcceptTerms      bool `json:"accept_terms,omitempty"`      // required when the waitlist has terms
+	TermsVersion     int  `json:"terms_version,omitempty"`     // required when the waitlist has terms
+	MarketingOptIn   bool `json:"marketing_opt_in,omitempty"`  // ignored without a marketing checkbox
+	MarketingVersion int  `json:"marketing_version,omitempty"` // required when the waitlist has a marketing checkbox
+
+	// Attribution, utm_* values missing here are read from the landing URL
+	LandingURL  string `json:"landing_url,omitempty"` // page the form is on, defaults to the Referer header
+	Referrer    string `json:"referrer,omitempty"`    // document.referrer of that page
+	UTMSource   string `json:"utm_source,omitempty"`
+	UTMMedium   string `json:"utm_medium,omitempty"`
+	UTMCampaign string `json:"utm_campaign,omitempty"`
+	UTMTerm     string `json:"utm_term,omitempty"`
+	UTMContent  string `json:"utm_content,omitempty"`
+
+	// Bot protection fields, see ChallengeHandler
+	Website      string `json:"website,omitempty"` // honeypot, must stay empty
+	FormToken    string `json:"form_token,omitempty"`
+	PowChallenge string `json:"pow_challenge,omitempty"`
+	PowNonce     string `json:"pow_nonce,omitempty"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
+}
+
+// JoinWaitlistResponse is returned after a public waitlist signup
+type JoinWaitlistResponse struct {
+	Success  bool   `json:"success"`
+	Message  string `json:"message"`
+	Code     string `json:"code,omitempty"`
+	Position int64  `json:"position,omitempty"`
+
+	ReferralCode string `json:"referral_code,omitempty"` // share as ?ref= on the waitlist's page
+	RedirectURL  string `json:"redirect_url,omitempty"`  // where the form should send the visitor next
+
+	FieldErrors formfields.Errors `json:"field_errors,omitempty"`
+}
+
+// PublicWaitlistResponse is what a signup form needs to render
+type PublicWaitlistResponse struct {
+	Slug               string            `json:"slug"`
+	Name               string            `json:"name"`
+	ShowVendorBranding bool              `json:"show_vendor_branding"`
+	FormFields         formfields.Schema `json:"form_fields"`
+	Consent            consent.Settings  `json:"consent"` // checkboxes shown after the form fields
+	Theme              widget.Theme      `json:"theme"`
+
+	DescriptionHTML string `json:"description_html"` // rendered and sanitized markdown
+	LogoURL         string `json:"logo_url,omitempty"`
+
+	// Whether the form takes signups, signups are queued when it doesn't and queue_signups is set
+	State        schedule.State `json:"state"`
+	QueueSignups bool           `json:"queue_signups"`
+	StateMessage string         `json:"state_message,omitempty"`
+	OpensAt      *time.Time     `json:"opens_at,omitempty"`
+	ClosesAt     *time.Time     `json:"closes_at,omitempty"`
+	SpotsLeft    *int64         `json:"spots_left,omitempty"`
+}
+
+// botSettings returns the bot protection configured for a waitlist
+func botSettings(waitlist *models.Waitlist) botcheck.Settings {
+	return botcheck.Settings{
+		Honeypot:       waitlist.BotHoneypot,
+		MinSubmitTime:  time.Duration(waitlist.BotMinSubmitSeconds) * time.Second,
+		PowDifficulty:  waitlist.BotPowDifficulty,
+		CaptchaEnabled: waitlist.BotCaptcha,
+	}
+}
+
+// emailPolicy returns the email rules configured for a waitlist
+func emailPolicy(waitlist *models.Waitlist) emailcheck.Policy {
+	return emailcheck.Policy{
+		GmailAliases:    waitlist.EmailGmailAliases,
+		BlockDisposable: waitlist.EmailBlockDisposable,
+		CheckMX:         waitlist.EmailCheckMX,
+		AllowDomains:    waitlist.EmailAllowDomains,
+		DenyDomains:     waitlist.EmailDenyDomains,
+	}
+}
+
+// widgetTheme returns a waitlist's widget theme, with colors it leaves
+// unset taken from the brand colors
+func widgetTheme(waitlist *models.Waitlist) widget.Theme {
+	theme := waitlist.WidgetTheme
+	if theme.AccentColor == "" {
+		theme.AccentColor = waitlist.BrandColors.Primary
+	}
+	if theme.BackgroundColor == "" {
+		theme.BackgroundColor = waitlist.BrandColors.Background
+	}
+	if theme.TextColor == "" {
+		theme.TextColor = waitlist.BrandColors.Text
+	}
+	return theme
+}
+
+// successMessage is shown to people who joined a waitlist
+func successMessage(waitlist *models.Waitlist) string {
+	if waitlist.SuccessMessage != "" {
+		return waitlist.SuccessMessage
+	}
+	return defaultSuccessMessage
+}
+
+// getPublicWaitlist loads the waitlist named in the URL, writing a 404 when it
+// doesn't exist or isn't public
+func getPublicWaitlist(w http.ResponseWriter, r *http.Request, database db.Database) (*models.Waitlist, bool) {
+	waitlist, err := database.GetWaitlistBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		if err.Error() != "waitlist not found" {
+			logger.FromContext(r.Context()).Error("Failed to get waitlist: ", err)
+			writeJoinResponse(w, JoinWaitlistResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return nil, false
+		}
+		writeJoinResponse(w, JoinWaitlistResponse{Message: "Waitlist not found"}, http.StatusNotFound)
+		return nil, false
+	}
+	if !waitlist.IsPublic {
+		writeJoinResponse(w, JoinWaitlistResponse{Message: "Waitlist not found"}, http.StatusNotFound)
+		return nil, false
+	}
+	if !allowCrossOrigin(w, r, waitlist) {
+		writeJoinResponse(w, JoinWaitlistResponse{Message: "This site may not embed this waitlist", Code: "origin_not_allowed"}, http.StatusForbidden)
+		return nil, false
+	}
+	return waitlist, true
+}
+
+// allowCrossOrigin sets the CORS headers for a request from an embedded widget,
+// reporting false when the page's origin isn't in the waitlist's allowlist.
+// Same-origin requests, such as from the iframe form, always pass.
+func allowCrossOrigin(w http.ResponseWriter, r *http.Request, waitlist *models.Waitlist) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if !widget.OriginAllowed(waitlist.EmbedAllowedOrigins, origin) {
+		return false
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Add("Vary", "Origin")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	w.Header().Set("Access-Control-Max-Age", "600")
+	return true
+}
+
+// PublicPreflightHandler answers CORS preflight requests from embedded widgets
+func PublicPreflightHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := getPublicWaitlist(w, r, database); !ok {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// PublicWaitlistHandler describes a public waitlist's signup form. Widgets load
+// it when they render, so it counts as a view of the waitlist.
+func PublicWaitlistHandler(database db.Database, counter *views.Counter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		waitlist, ok := getPublicWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		recordView(r, counter, waitlist)
+
+		state, spotsLeft, err := waitlistState(r.Context(), database, waitlist, time.Now())
+		if err != nil {
+			logger.FromContext(r.Context()).Error("Failed to get waitlist state: ", err)
+			writeJoinResponse(w, JoinWaitlistResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+
+		response := PublicWaitlistResponse{
+			Slug:               waitlist.Slug,
+			Name:               waitlist.Name,
+			ShowVendorBranding: waitlist.ShowVendorBranding,
+			FormFields:         nonNilFields(waitlist.FormFields),
+			Consent:            waitlist.Consent,
+			Theme:              widgetTheme(waitlist),
+			DescriptionHTML:    string(branding.RenderMarkdown(waitlist.Description)),
+			LogoURL:            logoURL(waitlist),
+
+			State:        state,
+			QueueSignups: waitlist.OverflowMode == models.OverflowQueue,
+			OpensAt:      waitlist.OpensAt,
+			ClosesAt:     waitlist.ClosesAt,
+			SpotsLeft:    spotsLeft,
+		}
+		if state != schedule.Open {
+			unavailable, _ := unavailableResponse(waitlist, state)
+			response.StateMessage = unavailable.Message
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logger.FromContext(r.Context()).Error("Failed to encode response: ", err)
+		}
+	}
+}
+
+// ChallengeHandler issues the bot protection tokens a signup form must submit
+// with a join request. Forms fetch a fresh challenge each time they render.
+func ChallengeHandler(database db.Database, verifier *botcheck.Verifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getPublicWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		challenge, err := verifier.NewChallenge(botSettings(waitlist))
+		if err != nil {
+			log.Error("Failed to create bot challenge: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(challenge); err != nil {
+			log.Error("Failed to encode response: ", err)
+		}
+	}
+}
+
+// JoinWaitlistHandler signs an email up to a public waitlist after it passes
+// the waitlist's bot protection and email rules
+func JoinWaitlistHandler(database db.Database, verifier *botcheck.Verifier, emails *emailcheck.Validator, publisher events.Publisher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		waitlist, ok := getPublicWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		var req JoinWaitlistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJoinResponse(w, JoinWaitlistResponse{Message: "Invalid request format"}, http.StatusBadRequest)
+			return
+		}
+
+		_, response, status := joinWaitlist(r, database, verifier, emails, publisher, waitlist, &req)
+		writeJoinResponse(w, response, status)
+	}
+}
+
+// joinWaitlist runs a signup through the waitlist's form, bot and email checks
+// and stores it. The returned signup is nil unless it was stored, which includes
+// bots that are silently told they succeeded.
+func joinWaitlist(r *http.Request, database db.Database, verifier *botcheck.Verifier, emails *emailcheck.Validator,
+	publisher events.Publisher, waitlist *models.Waitlist, req *JoinWaitlistRequest) (*models.WaitlistSignup, JoinWaitlistResponse, int) {
+	log := logger.FromContext(r.Context())
+
+	// outside the signup window signups are rejected, or queued for the owner to admit
+	queued := false
+	if state := schedule.WindowState(waitlist, time.Now()); state != schedule.Open {
+		if waitlist.OverflowMode != models.OverflowQueue {
+			response, status := unavailableResponse(waitlist, state)
+			return nil, response, status
+		}
+		queued = true
+	}
+
+	// cheap syntax check first, domain checks run once the bot checks passed
+	email := strings.TrimSpace(req.Email)
+	if _, err := emailcheck.Parse(email); err != nil {
+		response, status := emailRejection(err)
+		return nil, response, status
+	}
+
+	answers, err := waitlist.FormFields.ValidateAnswers(req.Answers)
+	if err != nil {
+		var fieldErrors formfields.Errors
+		errors.As(err, &fieldErrors)
+		return nil, JoinWaitlistResponse{
+			Message:     "Please check the highlighted fields",
+			Code:        "invalid_fields",
+			FieldErrors: fieldErrors,
+		}, http.StatusBadRequest
+	}
+
+	agreed, err := waitlist.Consent.Accept(consent.Answers{
+		Terms:            req.AcceptTerms,
+		TermsVersion:     req.TermsVersion,
+		Marketing:        req.MarketingOptIn,
+		MarketingVersion: req.MarketingVersion,
+	}, clientIP(r), time.Now())
+	switch {
+	case errors.Is(err, consent.ErrChanged):
+		return nil, JoinWaitlistResponse{
+			Message: "The terms of this waitlist have changed, please review them and try again",
+			Code:    "consent_changed",
+		}, http.StatusConflict
+	case err != nil:
+		return nil, JoinWaitlistResponse{
+			Message:     "Please accept the terms to join",
+			Code:        "terms_required",
+			FieldErrors: formfields.Errors{"accept_terms": "Required"},
+		}, http.StatusBadRequest
+	}
+
+	submission := &botcheck.Submission{
+		Email:        email,
+		RemoteIP:     clientIP(r),
+		Honeypot:     req.Website,
+		FormToken:    req.FormToken,
+		PowChallenge: req.PowChallenge,
+		PowNonce:     req.PowNonce,
+		CaptchaToken: req.CaptchaToken,
+	}
+	if err := verifier.Verify(r.Context(), botSettings(waitlist), submission); err != nil {
+		var rejection *botcheck.Rejection
+		if !errors.As(err, &rejection) {
+			log.Error("Failed to run bot checks: ", err)
+			return nil, JoinWaitlistResponse{Message: "Internal server error"}, http.StatusInternalServerError
+		}
+
+		log.Info("Rejected waitlist signup", map[string]interface{}{"waitlist": waitlist.Slug, "code": rejection.Code})
+		if rejection.Silent {
+			// pretend it worked so the bot moves on
+			return nil, JoinWaitlistResponse{Success: true, Message: successMessage(waitlist), RedirectURL: waitlist.RedirectURL}, http.StatusCreated
+		}
+		status := http.StatusBadRequest
+		if rejection.Code == botcheck.CodeCaptchaOffline {
+			status = http.StatusServiceUnavailable
+		}
+		return nil, JoinWaitlistResponse{Message: rejection.Message, Code: rejection.Code}, status
+	}
+
+	result, err := emails.Validate(r.Context(), email, emailPolicy(waitlist))
+	if err != nil {
+		var invalid *emailcheck.Invalid
+		if !errors.As(err, &invalid) {
+			log.Error("Failed to validate email: ", err)
+		}
+		response, status := emailRejection(err)
+		return nil, response, status
+	}
+
+	signup := &models.WaitlistSignup{
+		WaitlistID:      waitlist.ID,
+		Email:           result.Address.String(),
+		EmailNormalized: result.Normalized,
+		Answers:         answers,
+		ReferralCode:    utils.GenerateRandomString(referralCodeLength),
+		Consent:         agreed,
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		signup.Name = &name
+	}
+	if waitlist.CaptureAttribution {
+		signup.Attribution = captureAttribution(r, req)
+	}
+	if ref := strings.TrimSpace(req.Ref); ref != "" {
+		// an unknown code shouldn't cost the visitor their signup
+		referrer, err := database.GetWaitlistSignupByReferralCode(r.Context(), waitlist.ID, ref)
+		if err == nil {
+			signup.ReferredBy = &referrer.ID
+		} else if err.Error() != "signup not found" {
+			log.Error("Failed to look up referrer: ", err)
+		}
+	}
+
+	if queued {
+		signup.Status = models.SignupStatusQueued
+	}
+	err = database.CreateWaitlistSignup(r.Context(), signup)
+	if err != nil && err.Error() == "waitlist is full" && waitlist.OverflowMode == models.OverflowQueue {
+		queued = true
+		signup.Status = models.SignupStatusQueued
+		err = database.CreateWaitlistSignup(r.Context(), signup)
+	}
+	if err != nil {
+		switch err.Error() {
+		case "signup already exists":
+			return nil, JoinWaitlistResponse{Message: "This email is already on the waitlist", Code: "already_joined"}, http.StatusConflict
+		case "waitlist is full":
+			response, status := unavailableResponse(waitlist, schedule.Full)
+			return nil, response, status
+		}
+		log.Error("Failed to create waitlist signup: ", err)
+		return nil, JoinWaitlistResponse{Message: "Internal server error"}, http.StatusInternalServerError
+	}
+
+	metrics.IncWaitlistSignups()
+	publishSignupCreated(r, database, publisher, waitlist, signup)
+	if queued {
+		return signup, JoinWaitlistResponse{
+			Success:      true,
+			Message:      "The waitlist isn't taking signups right now, we saved your spot in the queue",
+			Code:         "queued",
+			Position:     signup.Position,
+			ReferralCode: signup.ReferralCode,
+			RedirectURL:  waitlist.RedirectURL,
+		}, http.StatusAccepted
+	}
+	return signup, JoinWaitlistResponse{
+		Success:      true,
+		Message:      successMessage(waitlist),
+		Position:     signup.Position,
+		ReferralCode: signup.ReferralCode,
+		RedirectURL:  waitlist.RedirectURL,
+	}, http.StatusCreated
+}
+
+// publishSignupCreated records and publishes the signup.created event, failing
+// only costs the event
+func publishSignupCreated(r *http.Request, database db.Database, publisher events.Publisher, waitlist *models.Waitlist, signup *models.WaitlistSignup) {
+	log := logger.FromContext(r.Context())
+
+	event := &models.WaitlistEvent{
+		WaitlistID: waitlist.ID,
+		Type:       events.SignupCreated,
+		DedupKey:   events.SignupCreated + ":" + strconv.FormatInt(signup.ID, 10),
+		Data:       events.SignupData(signup),
+	}
+	if _, err := database.RecordWaitlistEvent(r.Context(), event); err != nil {
+		log.Error("Failed to record signup event: ", err)
+		return
+	}
+	if err := publisher.Publish(r.Context(), waitlist, event); err != nil {
+		// the event stays recorded, publishers are expected to retry on their own
+		log.Error("Failed to publish signup event: ", err)
+	}
+}
+
+// recordView counts a view of a public waitlist, failing only costs the count
+func recordView(r *http.Request, counter *views.Counter, waitlist *models.Waitlist) {
+	if err := counter.Record(r.Context(), waitlist.ID, clientIP(r), r.UserAgent(), time.Now()); err != nil {
+		logger.FromContext(r.Context()).Warn("Failed to record waitlist view", map[string]interface{}{
+			"waitlist": waitlist.Slug,
+			"error":    err.Error(),
+		})
+	}
+}
+
+// captureAttribution records where a public signup came from
+func captureAttribution(r *http.Request, req *JoinWaitlistRequest) attribution.Attribution {
+	landingURL := req.LandingURL
+	if landingURL == "" {
+		landingURL = r.Referer()
+	}
+	return attribution.Capture(attribution.Input{
+		LandingURL: landingURL,
+		Referrer:   req.Referrer,
+		UserAgent:  r.UserAgent(),
+		UTM: map[string]string{
+			"utm_source":   req.UTMSource,
+			"utm_medium":   req.UTMMedium,
+			"utm_campaign": req.UTMCampaign,
+			"utm_term":     req.UTMTerm,
+			"utm_content":  req.UTMContent,
+		},
+	})
+}
+
+// unavailableResponse answers a join request for a waitlist that isn't taking signups
+func unavailableResponse(waitlist *models.Waitlist, state schedule.State) (JoinWaitlistResponse, int) {
+	switch state {
+	case schedule.Scheduled:
+		return JoinWaitlistResponse{
+			Message: "This waitlist opens on " + waitlist.OpensAt.UTC().Format("January 2, 2006 at 15:04 MST"),
+			Code:    "waitlist_not_open",
+		}, http.StatusForbidden
+	case schedule.Full:
+		return JoinWaitlistResponse{Message: "This waitlist is full", Code: "waitlist_full"}, http.StatusConflict
+	default:
+		return JoinWaitlistResponse{Message: "This waitlist is closed", Code: "waitlist_closed"}, http.StatusForbidden
+	}
+}
+
+// waitlistState returns whether a waitlist takes signups and, for capped
+// waitlists, how many spots are left
+func waitlistState(ctx context.Context, database db.Database, waitlist *models.Waitlist, now time.Time) (schedule.State, *int64, error) {
+	state := schedule.WindowState(waitlist, now)
+	if waitlist.MaxSignups == nil {
+		return state, nil, nil
+	}
+	count, err := database.CountAdmittedSignups(ctx, waitlist.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	spotsLeft := int64(*waitlist.MaxSignups) - count
+	if spotsLeft <= 0 {
+		spotsLeft = 0
+		if state == schedule.Open {
+			state = schedule.Full
+		}
+	}
+	return state, &spotsLeft, nil
+}
+
+// emailRejection is the answer to a join request whose email failed validation
+func emailRejection(err error) (JoinWaitlistResponse, int) {
+	var invalid *emailcheck.Invalid
+	if errors.As(err, &invalid) {
+		return JoinWaitlistResponse{Message: invalid.Message, Code: invalid.Code}, http.StatusBadRequest
+	}
+	// the DNS lookup failed, the address may well be fine
+	return JoinWaitlistResponse{Message: "Could not verify the email address, please try again"}, http.StatusServiceUnavailable
+}
+
+// writeJoinResponse writes a JoinWaitlistResponse with the given status
+func writeJoinResponse(w http.ResponseWriter, response JoinWaitlistResponse, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
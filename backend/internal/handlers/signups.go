@@ -0,0 +1,642 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/formfields"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// answerFilterPrefix marks query parameters filtering on form answers, e.g.
+// ?answers.company=Acme
+const answerFilterPrefix = "answers."
+
+// getOwnedWaitlist loads the waitlist named in the URL and checks the
+// authenticated user owns it, writing the error response when not
+func getOwnedWaitlist(w http.ResponseWriter, r *http.Request, database db.Database) (*models.Waitlist, bool) {
+	log := logger.FromContext(r.Context())
+
+	userID, err := getUserIDFromRequest(r, database)
+	if err != nil {
+		log.Error("Failed to get user ID: ", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	slug := chi.URLParam(r, "slug")
+	if slug == "" {
+		http.Error(w, "Slug is required", http.StatusBadRequest)
+		return nil, false
+	}
+
+	waitlist, err := database.GetWaitlistBySlug(r.Context(), slug)
+	if err != nil {
+		if err.Error() == "waitlist not found" {
+			http.Error(w, "Waitlist not found", http.StatusNotFound)
+			return nil, false
+		}
+		log.Error("Failed to get waitlist: ", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if waitlist.OwnerUserID != userID {
+		http.Error(w, "Forbidden: You don't own this waitlist", http.StatusForbidden)
+		return nil, false
+	}
+	return waitlist, true
+}
+
+// parseAnswerFilters reads answers.<key>=<value> query parameters into a
+// containment filter, typed according to the waitlist's form fields
+func parseAnswerFilters(query url.Values, schema formfields.Schema) (map[string]interface{}, error) {
+	filters := map[string]interface{}{}
+	for param, values := range query {
+		key, ok := strings.CutPrefix(param, answerFilterPrefix)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		value, err := schema.FilterValue(key, values[0])
+		if err != nil {
+			return nil, err
+		}
+		filters[key] = value
+	}
+	return filters, nil
+}
+
+// Signup management limits
+const (
+	defaultSignupPageSize = 50
+	maxSignupPageSize     = 200
+	maxBulkSignups        = 1000
+	maxSignupTags         = 20
+	maxSignupTagLength    = 50
+	maxSignupNotesLength  = 10000
+)
+
+// SignupsResponse is one page of a waitlist's signups
+type SignupsResponse struct {
+	Signups []*models.WaitlistSignup `json:"signups"`
+	Total   int64                    `json:"total"`
+	Limit   int                      `json:"limit"`
+	Offset  int                      `json:"offset"`
+}
+
+// UpdateSignupRequest edits a signup, omitted fields are left unchanged
+type UpdateSignupRequest struct {
+	Status *models.SignupStatus `json:"status,omitempty"`
+	Tags   *[]string            `json:"tags,omitempty"`
+	Notes  *string              `json:"notes,omitempty"` // empty clears the notes
+}
+
+// MoveSignupRequest places a signup at a 1-based position in the queue
+type MoveSignupRequest struct {
+	Position int64 `json:"position"`
+}
+
+// Bulk actions on signups
+const (
+	BulkActionDelete      = "delete"
+	BulkActionMarkInvited = "mark_invited"
+	BulkActionMoveToTop   = "move_to_top"
+)
+
+// BulkSignupsRequest applies one action to many signups
+type BulkSignupsRequest struct {
+	Action string  `json:"action"`
+	IDs    []int64 `json:"ids"`
+}
+
+// BulkSignupsResponse reports how many signups an action changed
+type BulkSignupsResponse struct {
+	Affected int64 `json:"affected"`
+}
+
+// parseSignupFilter reads the list filters from the query string. Filters on
+// form answers are typed according to the waitlist's form fields.
+func parseSignupFilter(query url.Values, waitlist *models.Waitlist) (models.SignupFilter, error) {
+	filter := models.SignupFilter{
+		Search: strings.TrimSpace(query.Get("search")),
+		Tag:    strings.ToLower(strings.TrimSpace(query.Get("tag"))),
+		Sort:   query.Get("sort"),
+	}
+
+	if status := query.Get("status"); status != "" {
+		if !validSignupStatus(models.SignupStatus(status)) {
+			return filter, fmt.Errorf("status must be queued, waiting, invited or accepted")
+		}
+		filter.Status = models.SignupStatus(status)
+	}
+	for name, target := range map[string]**bool{"verified": &filter.Verified, "invited": &filter.Invited} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be true or false", name)
+			}
+			*target = &parsed
+		}
+	}
+	for name, target := range map[string]**int{"min_referrals": &filter.MinReferrals, "max_referrals": &filter.MaxReferrals} {
+		if value := query.Get(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return filter, fmt.Errorf("%s must be a non-negative number", name)
+			}
+			*target = &parsed
+		}
+	}
+	for name, target := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		if value := query.Get(name); value != "" {
+			parsed, err := parseDateParam(value)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be a date (2006-01-02) or RFC 3339 timestamp", name)
+			}
+			*target = &parsed
+		}
+	}
+	if filter.Sort != "" && !slices.Contains(models.SignupSorts, filter.Sort) {
+		return filter, fmt.Errorf("sort must be one of %s", strings.Join(models.SignupSorts, ", "))
+	}
+
+	answers, err := parseAnswerFilters(query, waitlist.FormFields)
+	if err != nil {
+		return filter, err
+	}
+	filter.Answers = answers
+	return filter, nil
+}
+
+// parseDateParam accepts a date or an RFC 3339 timestamp
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func validSignupStatus(status models.SignupStatus) bool {
+	switch status {
+	case models.SignupStatusQueued, models.SignupStatusWaiting, models.SignupStatusInvited, models.SignupStatusAccepted:
+		return true
+	}
+	return false
+}
+
+// parsePaging reads limit and offset from the query string
+func parsePaging(query url.Values) (limit, offset int, err error) {
+	limit = defaultSignupPageSize
+	if value := query.Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxSignupPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxSignupPageSize)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative number")
+		}
+	}
+	return limit, offset, nil
+}
+
+// normalizeTags trims, lowercases and deduplicates tags
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxSignupTagLength {
+			return nil, fmt.Errorf("tags must be at most %d characters", maxSignupTagLength)
+		}
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxSignupTags {
+		return nil, fmt.Errorf("a signup can have at most %d tags", maxSignupTags)
+	}
+	return normalized, nil
+}
+
+// getSignupFromRequest loads the signup named in the URL from waitlist, writing
+// the error response when it can't
+func getSignupFromRequest(w http.ResponseWriter, r *http.Request, database db.Database, waitlist *models.Waitlist) (*models.WaitlistSignup, bool) {
+	signupID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid signup ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	signup, err := database.GetWaitlistSignup(r.Context(), waitlist.ID, signupID)
+	if err != nil {
+		if err.Error() == "signup not found" {
+			http.Error(w, "Signup not found", http.StatusNotFound)
+			return nil, false
+		}
+		logger.FromContext(r.Context()).Error("Failed to get waitlist signup: ", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return signup, true
+}
+
+// writeJSON writes response as JSON with the given status
+func writeJSON(w http.ResponseWriter, r *http.Request, response interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.FromContext(r.Context()).Error("Failed to encode response: ", err)
+	}
+}
+
+// ListSignupsHandler returns a page of a waitlist's signups, with full-text
+// search and filters on status, verification, invites, referrals, dates, tags
+// and form answers
+func ListSignupsHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		filter, err := parseSignupFilter(r.URL.Query(), waitlist)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Limit, filter.Offset, err = parsePaging(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		signups, total, err := database.ListWaitlistSignups(r.Context(), waitlist.ID, filter)
+		if err != nil {
+			log.Error("Failed to list waitlist signups: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if signups == nil {
+			signups = []*models.WaitlistSignup{}
+		}
+
+		writeJSON(w, r, SignupsResponse{
+			Signups: signups,
+			Total:   total,
+			Limit:   filter.Limit,
+			Offset:  filter.Offset,
+		}, http.StatusOK)
+	}
+}
+
+// GetSignupHandler returns one signup of a waitlist
+func GetSignupHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		signup, ok := getSignupFromRequest(w, r, database, waitlist)
+		if !ok {
+			return
+		}
+		writeJSON(w, r, signup, http.StatusOK)
+	}
+}
+
+// UpdateSignupHandler changes a signup's status, tags or notes
+func UpdateSignupHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		signup, ok := getSignupFromRequest(w, r, database, waitlist)
+		if !ok {
+			return
+		}
+
+		var req UpdateSignupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		if req.Status != nil {
+			if !validSignupStatus(*req.Status) {
+				http.Error(w, "status must be queued, waiting, invited or accepted", http.StatusBadRequest)
+				return
+			}
+			signup.Status = *req.Status
+			if signup.Status == models.SignupStatusQueued || signup.Status == models.SignupStatusWaiting {
+				signup.InvitedAt = nil
+			} else if signup.InvitedAt == nil {
+				now := time.Now()
+				signup.InvitedAt = &now
+			}
+		}
+		if req.Tags != nil {
+			tags, err := normalizeTags(*req.Tags)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			signup.Tags = tags
+		}
+		if req.Notes != nil {
+			notes := strings.TrimSpace(*req.Notes)
+			if utf8.RuneCountInString(notes) > maxSignupNotesLength {
+				http.Error(w, fmt.Sprintf("notes must be at most %d characters", maxSignupNotesLength), http.StatusBadRequest)
+				return
+			}
+			signup.Notes = &notes
+			if notes == "" {
+				signup.Notes = nil
+			}
+		}
+
+		if err := database.UpdateWaitlistSignup(r.Context(), signup); err != nil {
+			if err.Error() == "signup not found" {
+				http.Error(w, "Signup not found", http.StatusNotFound)
+				return
+			}
+			log.Error("Failed to update waitlist signup: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, signup, http.StatusOK)
+	}
+}
+
+// DeleteSignupHandler removes a signup from a waitlist
+func DeleteSignupHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		signup, ok := getSignupFromRequest(w, r, database, waitlist)
+		if !ok {
+			return
+		}
+
+		if _, err := database.DeleteWaitlistSignups(r.Context(), waitlist.ID, []int64{signup.ID}); err != nil {
+			log.Error("Failed to delete waitlist signup: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// MoveSignupHandler places a signup at a position in the queue
+func MoveSignupHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		signup, ok := getSignupFromRequest(w, r, database, waitlist)
+		if !ok {
+			return
+		}
+
+		var req MoveSignupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Position < 1 {
+			http.Error(w, "position must be at least 1", http.StatusBadRequest)
+			return
+		}
+
+		if err := database.MoveWaitlistSignup(r.Context(), waitlist.ID, signup.ID, req.Position); err != nil {
+			if err.Error() == "signup not found" {
+				http.Error(w, "Signup not found", http.StatusNotFound)
+				return
+			}
+			log.Error("Failed to move waitlist signup: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// reload for the new position
+		moved, ok := getSignupFromRequest(w, r, database, waitlist)
+		if !ok {
+			return
+		}
+		writeJSON(w, r, moved, http.StatusOK)
+	}
+}
+
+// BulkSignupsHandler deletes, marks invited or moves to the top many signups at once
+func BulkSignupsHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		var req BulkSignupsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if len(req.IDs) == 0 || len(req.IDs) > maxBulkSignups {
+			http.Error(w, fmt.Sprintf("ids must contain between 1 and %d signup IDs", maxBulkSignups), http.StatusBadRequest)
+			return
+		}
+
+		var affected int64
+		var err error
+		switch req.Action {
+		case BulkActionDelete:
+			affected, err = database.DeleteWaitlistSignups(r.Context(), waitlist.ID, req.IDs)
+		case BulkActionMarkInvited:
+			affected, err = database.MarkWaitlistSignupsInvited(r.Context(), waitlist.ID, req.IDs, time.Now())
+		case BulkActionMoveToTop:
+			affected, err = database.MoveWaitlistSignupsToTop(r.Context(), waitlist.ID, req.IDs)
+		default:
+			http.Error(w, "action must be delete, mark_invited or move_to_top", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error("Failed to apply bulk signup action: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info(fmt.Sprintf("Bulk %s on %d signups of waitlist %s", req.Action, affected, waitlist.Slug))
+		writeJSON(w, r, BulkSignupsResponse{Affected: affected}, http.StatusOK)
+	}
+}
+
+// ExportSignupsHandler downloads a waitlist's signups as CSV (default) or JSON,
+// with one column per custom form field. Accepts the same filters as the
+// signup list, without paging.
+func ExportSignupsHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "csv"
+		}
+		if format != "csv" && format != "json" {
+			http.Error(w, "format must be csv or json", http.StatusBadRequest)
+			return
+		}
+
+		filter, err := parseSignupFilter(r.URL.Query(), waitlist)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		signups, _, err := database.ListWaitlistSignups(r.Context(), waitlist.ID, filter)
+		if err != nil {
+			log.Error("Failed to list waitlist signups: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		filename := fmt.Sprintf("%s-signups-%s.%s", waitlist.Slug, time.Now().UTC().Format("20060102"), format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+		if format == "json" {
+			if signups == nil {
+				signups = []*models.WaitlistSignup{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(signups); err != nil {
+				log.Error("Failed to encode response: ", err)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		if err := writeSignupsCSV(w, waitlist.FormFields, signups); err != nil {
+			log.Error("Failed to write signups CSV: ", err)
+		}
+	}
+}
+
+// writeSignupsCSV writes the built-in signup, attribution and consent columns
+// followed by one column per form field
+func writeSignupsCSV(w io.Writer, schema formfields.Schema, signups []*models.WaitlistSignup) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"position", "email", "name", "status", "verified_at", "invited_at", "referral_count", "tags", "notes", "created_at",
+		"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content", "referrer", "landing_url", "device",
+		"terms_version", "marketing_opt_in", "marketing_version", "consent_at", "consent_ip", "unsubscribed_at"}
+	for _, field := range schema {
+		header = append(header, field.Key)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, signup := range signups {
+		name := ""
+		if signup.Name != nil {
+			name = *signup.Name
+		}
+		notes := ""
+		if signup.Notes != nil {
+			notes = *signup.Notes
+		}
+		record := []string{
+			strconv.FormatInt(signup.Position, 10),
+			csvSafe(signup.Email),
+			csvSafe(name),
+			string(signup.Status),
+			formatOptionalTime(signup.VerifiedAt),
+			formatOptionalTime(signup.InvitedAt),
+			strconv.FormatInt(signup.ReferralCount, 10),
+			csvSafe(strings.Join(signup.Tags, ";")),
+			csvSafe(notes),
+			signup.CreatedAt.UTC().Format(time.RFC3339),
+			csvSafe(signup.Attribution.UTMSource),
+			csvSafe(signup.Attribution.UTMMedium),
+			csvSafe(signup.Attribution.UTMCampaign),
+			csvSafe(signup.Attribution.UTMTerm),
+			csvSafe(signup.Attribution.UTMContent),
+			csvSafe(signup.Attribution.Referrer),
+			csvSafe(signup.Attribution.LandingURL),
+			signup.Attribution.Device,
+			formatOptionalInt(signup.Consent.TermsVersion),
+			strconv.FormatBool(signup.Consent.Marketing),
+			formatOptionalInt(signup.Consent.MarketingVersion),
+			formatOptionalTime(signup.Consent.At),
+			signup.Consent.IP,
+			formatOptionalTime(signup.UnsubscribedAt),
+		}
+		for _, field := range schema {
+			record = append(record, csvSafe(formfields.FormatAnswer(signup.Answers[field.Key])))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatOptionalInt formats a nullable number for CSV exports
+func formatOptionalInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+// formatOptionalTime formats a nullable timestamp for CSV exports
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// csvSafe defuses values spreadsheets would run as formulas, answers come from
+// anonymous visitors
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
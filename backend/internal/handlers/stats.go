@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/stats"
+)
+
+// Stats limits
+const (
+	defaultStatsDays    = 30
+	defaultStatsHours   = 48
+	maxStatsHourBuckets = 31 * 24 // a month of hours
+	maxStatsDayBuckets  = 2 * 366
+	defaultStatsLimit   = 10
+	maxStatsLimit       = 100
+)
+
+// StatsResponse is a waitlist's signup stats over a date range
+type StatsResponse struct {
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	Interval   string     `json:"interval"`
+	Timezone   string     `json:"timezone"`
+	Conversion Conversion `json:"conversion"`
+	*models.WaitlistStats
+}
+
+// Conversion is the share of signups making it through each funnel step, from 0 to 1
+type Conversion struct {
+	Verification float64 `json:"verification"` // verified / signups
+	Invite       float64 `json:"invite"`       // invited / signups
+	Acceptance   float64 `json:"acceptance"`   // accepted / invited
+	View         float64 `json:"view"`         // signups / visitors
+}
+
+// parseStatsQuery reads the stats range from the query string. The range is
+// widened to whole buckets in the requested time zone, a date as `to` includes
+// that day.
+func parseStatsQuery(query url.Values, now time.Time) (models.StatsQuery, error) {
+	statsQuery := models.StatsQuery{Interval: models.StatsIntervalDay, Limit: defaultStatsLimit}
+
+	loc := time.UTC
+	if tz := query.Get("tz"); tz != "" {
+		parsed, err := time.LoadLocation(tz)
+		if err != nil || tz == "Local" {
+			return statsQuery, fmt.Errorf("tz must be an IANA time zone like Europe/Berlin")
+		}
+		loc = parsed
+	}
+	statsQuery.Location = loc
+
+	switch interval := query.Get("interval"); interval {
+	case "":
+	case models.StatsIntervalHour, models.StatsIntervalDay:
+		statsQuery.Interval = interval
+	default:
+		return statsQuery, fmt.Errorf("interval must be hour or day")
+	}
+
+	statsQuery.To = now
+	if value := query.Get("to"); value != "" {
+		to, err := parseStatsTime(value, loc, true)
+		if err != nil {
+			return statsQuery, fmt.Errorf("to must be a date (2006-01-02) or RFC 3339 timestamp")
+		}
+		statsQuery.To = to
+	}
+	if value := query.Get("from"); value != "" {
+		from, err := parseStatsTime(value, loc, false)
+		if err != nil {
+			return statsQuery, fmt.Errorf("from must be a date (2006-01-02) or RFC 3339 timestamp")
+		}
+		statsQuery.From = from
+	} else if statsQuery.Interval == models.StatsIntervalHour {
+		statsQuery.From = statsQuery.To.Add(-defaultStatsHours * time.Hour)
+	} else {
+		statsQuery.From = statsQuery.To.AddDate(0, 0, -defaultStatsDays)
+	}
+
+	statsQuery.From = bucketStart(statsQuery.From, statsQuery.Interval, loc)
+	if start := bucketStart(statsQuery.To, statsQuery.Interval, loc); start.Before(statsQuery.To) {
+		statsQuery.To = nextBucket(start, statsQuery.Interval)
+	}
+	if !statsQuery.From.Before(statsQuery.To) {
+		return statsQuery, fmt.Errorf("from must be before to")
+	}
+
+	buckets := 0
+	for start := statsQuery.From; start.Before(statsQuery.To); start = nextBucket(start, statsQuery.Interval) {
+		buckets++
+		if (statsQuery.Interval == models.StatsIntervalHour && buckets > maxStatsHourBuckets) ||
+			(statsQuery.Interval == models.StatsIntervalDay && buckets > maxStatsDayBuckets) {
+			return statsQuery, fmt.Errorf("the range can cover at most %d hours or %d days", maxStatsHourBuckets, maxStatsDayBuckets)
+		}
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxStatsLimit {
+			return statsQuery, fmt.Errorf("limit must be between 1 and %d", maxStatsLimit)
+		}
+		statsQuery.Limit = limit
+	}
+	return statsQuery, nil
+}
+
+// parseStatsTime accepts an RFC 3339 timestamp or a date in loc. As the end of a
+// range a date means the end of that day.
+func parseStatsTime(value string, loc *time.Location, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return t, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// bucketStart returns the start of the hour or day t falls in, in loc
+func bucketStart(t time.Time, interval string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	if interval == models.StatsIntervalDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+}
+
+func nextBucket(start time.Time, interval string) time.Time {
+	if interval == models.StatsIntervalDay {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.Add(time.Hour)
+}
+
+// ratio divides without failing on empty funnels
+func ratio(part, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
+
+// WaitlistStatsHandler returns a waitlist's signups per hour or day in a time
+// zone, its views, verification and invite funnel, referral leaderboard and
+// breakdowns by source, medium, campaign and device. With rollups enabled
+// finished hours are read from the rollup table, unless the time zone's hours
+// don't line up with UTC hours.
+func WaitlistStatsHandler(database db.Database, rollups bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		query, err := parseStatsQuery(r.URL.Query(), time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.UseRollups = rollups && stats.WholeHourOffsets(query.Location, query.From, query.To)
+
+		result, err := database.GetWaitlistStats(r.Context(), waitlist.ID, query)
+		if err != nil {
+			log.Error("Failed to get waitlist stats: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if result.Referrers == nil {
+			result.Referrers = []models.ReferrerStats{}
+		}
+
+		funnel := result.Funnel
+		writeJSON(w, r, StatsResponse{
+			From:     query.From,
+			To:       query.To,
+			Interval: query.Interval,
+			Timezone: query.Location.String(),
+			Conversion: Conversion{
+				Verification: ratio(funnel.Verified, funnel.Signups),
+				Invite:       ratio(funnel.Invited, funnel.Signups),
+				Acceptance:   ratio(funnel.Accepted, funnel.Invited),
+				View:         ratio(funnel.Signups, result.Views.Visitors),
+			},
+			WaitlistStats: result,
+		}, http.StatusOK)
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/mailer"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/unsubscribe"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxTransferBytes bounds transfer offer bodies
+const maxTransferBytes = 4 * 1024
+
+// transferOfferedMessage answers every offer the same way, so offers can't be
+// used to find out which emails have an account
+const transferOfferedMessage = "If this email belongs to another account, the waitlist has been offered to it. It moves once they accept."
+
+// TransferNotifier tells an account a waitlist was offered to it
+type TransferNotifier interface {
+	NotifyTransferOffered(ctx context.Context, recipient, sender *models.User, waitlist *models.Waitlist) error
+}
+
+// MailTransferNotifier emails transfer offers
+type MailTransferNotifier struct {
+	Mailer *mailer.Mailer
+}
+
+func (n MailTransferNotifier) NotifyTransferOffered(ctx context.Context, recipient, sender *models.User, waitlist *models.Waitlist) error {
+	return n.Mailer.Send(ctx, mailer.Email{
+		Kind:    unsubscribe.Transactional,
+		To:      recipient.Email,
+		Subject: "A waitlist was offered to you",
+		Text: sender.Email + " would like to hand you the waitlist \"" + waitlist.Name + "\" (" + waitlist.Slug + "), " +
+			"along with its signups.\n\n" +
+			"Nothing changes until you accept. Sign in to accept or decline the offer.\n",
+	})
+}
+
+// TransferWaitlistRequest offers a waitlist to the account with an email
+type TransferWaitlistRequest struct {
+	Email string `json:"email"`
+}
+
+// TransferResponse answers a transfer request
+type TransferResponse struct {
+	Success  bool             `json:"success"`
+	Message  string           `json:"message"`
+	Waitlist *models.Waitlist `json:"waitlist,omitempty"` // the waitlist once accepted
+}
+
+// TransfersResponse lists the waitlists offered to the signed in user
+type TransfersResponse struct {
+	Transfers []*models.WaitlistTransfer `json:"transfers"`
+}
+
+// TransferWaitlistHandler offers an active waitlist to another account, which
+// is emailed and has to accept before it becomes the owner. A later offer
+// replaces a pending one. The answer doesn't say whether the email has an
+// account.
+func TransferWaitlistHandler(database db.Database, notifier TransferNotifier) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		sender, ok := getAccountUser(w, r, database)
+		if !ok {
+			return
+		}
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+		if waitlist.ArchivedAt != nil {
+			writeJSON(w, r, TransferResponse{Message: "Archived waitlists can't be transferred"}, http.StatusConflict)
+			return
+		}
+
+		var req TransferWaitlistRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTransferBytes)).Decode(&req); err != nil {
+			writeJSON(w, r, TransferResponse{Message: "Invalid request body"}, http.StatusBadRequest)
+			return
+		}
+		email := strings.TrimSpace(req.Email)
+		if email == "" {
+			writeJSON(w, r, TransferResponse{Message: "email is required"}, http.StatusBadRequest)
+			return
+		}
+
+		recipient, err := database.GetUserByEmail(r.Context(), email)
+		if err != nil && err.Error() != "user not found" {
+			log.Error("Failed to get user: ", err)
+			writeJSON(w, r, TransferResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+
+		// unknown emails and the owner's own get the same answer as an offer
+		if recipient != nil && recipient.ID != sender.ID {
+			if err := database.OfferWaitlistTransfer(r.Context(), waitlist.ID, sender.ID, recipient.ID); err != nil {
+				if err.Error() == "waitlist not found" {
+					http.Error(w, "Waitlist not found", http.StatusNotFound)
+					return
+				}
+				log.Error("Failed to offer waitlist transfer: ", err)
+				writeJSON(w, r, TransferResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+				return
+			}
+			// the offer also shows on the recipient's dashboard, a failed email
+			// doesn't undo it
+			if err := notifier.NotifyTransferOffered(r.Context(), recipient, sender, waitlist); err != nil {
+				log.Warn("Failed to send transfer offer email", map[string]interface{}{"waitlist": waitlist.Slug, "error": err.Error()})
+			}
+			log.Info("Waitlist transfer offered", map[string]interface{}{"waitlist": waitlist.Slug, "to_user_id": recipient.ID})
+		}
+
+		writeJSON(w, r, TransferResponse{Success: true, Message: transferOfferedMessage}, http.StatusAccepted)
+	}
+}
+
+// CancelTransferHandler withdraws the offer pending for a waitlist
+func CancelTransferHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		if err := database.CancelWaitlistTransfer(r.Context(), waitlist.ID); err != nil {
+			if err.Error() == "transfer not found" {
+				writeJSON(w, r, TransferResponse{Message: "No transfer is pending for this waitlist"}, http.StatusNotFound)
+				return
+			}
+			log.Error("Failed to cancel waitlist transfer: ", err)
+			writeJSON(w, r, TransferResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("Waitlist transfer cancelled", map[string]interface{}{"waitlist": waitlist.Slug})
+		writeJSON(w, r, TransferResponse{Success: true, Message: "Transfer cancelled"}, http.StatusOK)
+	}
+}
+
+// ListTransfersHandler returns the waitlists offered to the signed in user
+func ListTransfersHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		userID, err := getUserIDFromRequest(r, database)
+		if err != nil {
+			log.Error("Failed to get user ID: ", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		transfers, err := database.ListWaitlistTransfers(r.Context(), userID)
+		if err != nil {
+			log.Error("Failed to list waitlist transfers: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if transfers == nil {
+			transfers = []*models.WaitlistTransfer{}
+		}
+		writeJSON(w, r, TransfersResponse{Transfers: transfers}, http.StatusOK)
+	}
+}
+
+// AcceptTransferHandler makes the signed in user the owner of a waitlist
+// offered to them
+func AcceptTransferHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		userID, transferID, ok := getTransferRequest(w, r, database)
+		if !ok {
+			return
+		}
+
+		waitlist, err := database.AcceptWaitlistTransfer(r.Context(), transferID, userID)
+		if err != nil {
+			if err.Error() == "transfer not found" {
+				writeJSON(w, r, TransferResponse{Message: "This transfer is no longer available"}, http.StatusNotFound)
+				return
+			}
+			log.Error("Failed to accept waitlist transfer: ", err)
+			writeJSON(w, r, TransferResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("Waitlist transfer accepted", map[string]interface{}{"waitlist": waitlist.Slug, "user_id": userID})
+		writeJSON(w, r, TransferResponse{Success: true, Message: "Waitlist transferred", Waitlist: waitlist}, http.StatusOK)
+	}
+}
+
+// DeclineTransferHandler drops a waitlist offered to the signed in user
+func DeclineTransferHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		userID, transferID, ok := getTransferRequest(w, r, database)
+		if !ok {
+			return
+		}
+
+		if err := database.DeclineWaitlistTransfer(r.Context(), transferID, userID); err != nil {
+			if err.Error() == "transfer not found" {
+				writeJSON(w, r, TransferResponse{Message: "This transfer is no longer available"}, http.StatusNotFound)
+				return
+			}
+			log.Error("Failed to decline waitlist transfer: ", err)
+			writeJSON(w, r, TransferResponse{Message: "Internal server error"}, http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("Waitlist transfer declined", map[string]interface{}{"transfer_id": transferID, "user_id": userID})
+		writeJSON(w, r, TransferResponse{Success: true, Message: "Transfer declined"}, http.StatusOK)
+	}
+}
+
+// getTransferRequest returns the signed in user and the transfer named in the
+// URL, writing the error response when either is missing
+func getTransferRequest(w http.ResponseWriter, r *http.Request, database db.Database) (userID, transferID int64, ok bool) {
+	userID, err := getUserIDFromRequest(r, database)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("Failed to get user ID: ", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+	transferID, err = strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return userID, transferID, true
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/hosted"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/unsubscribe"
+)
+
+// maxPreferencesBytes bounds preference form and one-click unsubscribe bodies
+const maxPreferencesBytes = 64 * 1024
+
+// preferencesPage builds the preference page of an unsubscribe link's subscriber
+func preferencesPage(ctx context.Context, database db.Database, subscriber unsubscribe.Subscriber, token string) (hosted.PreferencesPage, error) {
+	page := hosted.PreferencesPage{Step: hosted.PreferencesManage, Token: token, Email: subscriber.Email}
+
+	data, err := database.GetSubscriberData(ctx, subscriber.Email)
+	if err != nil {
+		return page, err
+	}
+	for _, signup := range data.Signups {
+		page.Waitlists = append(page.Waitlists, hosted.PreferencesWaitlist{
+			SignupID:  signup.ID,
+			Name:      signup.WaitlistName,
+			Updates:   signup.UnsubscribedAt == nil,
+			Marketing: signup.Consent.Marketing,
+			Linked:    signup.ID == subscriber.SignupID,
+		})
+	}
+
+	suppression, err := database.GetEmailSuppression(ctx, subscriber.Email)
+	if err != nil && err.Error() != "suppression not found" {
+		return page, err
+	}
+	if suppression != nil {
+		if suppression.Reason == models.SuppressionUnsubscribed {
+			page.All = true
+		} else {
+			page.Suppressed = suppression.Reason
+		}
+	}
+	return page, nil
+}
+
+// renderInvalidUnsubscribe shows the preference page for a bad or expired link
+func renderInvalidUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	page := hosted.PreferencesPage{Step: hosted.PreferencesInvalid}
+	if err := hosted.RenderPreferences(w, http.StatusBadRequest, page); err != nil {
+		logger.FromContext(r.Context()).Error("Failed to render page: ", err)
+	}
+}
+
+// UnsubscribePageHandler shows the email preferences of an unsubscribe link's
+// subscriber. Opening the link changes nothing, since mail scanners follow links;
+// unsubscribing takes the form or a one-click POST.
+func UnsubscribePageHandler(database db.Database, links unsubscribe.Links) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		token := r.URL.Query().Get("token")
+		subscriber, err := links.Verify(token, time.Now())
+		if err != nil {
+			renderInvalidUnsubscribe(w, r)
+			return
+		}
+
+		page, err := preferencesPage(r.Context(), database, subscriber, token)
+		if err != nil {
+			log.Error("Failed to get email preferences: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := hosted.RenderPreferences(w, http.StatusOK, page); err != nil {
+			log.Error("Failed to render page: ", err)
+		}
+	}
+}
+
+// OneClickUnsubscribeHandler takes the POST mail clients send to the
+// List-Unsubscribe URL (RFC 8058), unsubscribing the link's signup from its
+// waitlist's emails and its marketing opt-in
+func OneClickUnsubscribeHandler(database db.Database, links unsubscribe.Links) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		subscriber, err := links.Verify(r.URL.Query().Get("token"), time.Now())
+		if err != nil {
+			http.Error(w, "Invalid or expired link", http.StatusBadRequest)
+			return
+		}
+
+		err = database.UpdateSignupSubscription(r.Context(), subscriber.SignupID, subscriber.Email, false, false)
+		if err != nil && err.Error() != "signup not found" {
+			log.Error("Failed to unsubscribe signup: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Info("Signup unsubscribed", map[string]interface{}{"signup_id": subscriber.SignupID, "one_click": true})
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("You have been unsubscribed\n"))
+	}
+}
+
+// UnsubscribePreferencesHandler saves the preference page's form. Each waitlist's
+// updates can be turned on or off and marketing turned off; unsubscribing from
+// all emails puts the address on the suppression list.
+func UnsubscribePreferencesHandler(database db.Database, links unsubscribe.Links) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxPreferencesBytes)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form submission", http.StatusBadRequest)
+			return
+		}
+		token := r.PostForm.Get("token")
+		subscriber, err := links.Verify(token, time.Now())
+		if err != nil {
+			renderInvalidUnsubscribe(w, r)
+			return
+		}
+
+		current, err := preferencesPage(r.Context(), database, subscriber, token)
+		if err != nil {
+			log.Error("Failed to get email preferences: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		for _, waitlist := range current.Waitlists {
+			id := strconv.FormatInt(waitlist.SignupID, 10)
+			updates := r.PostForm.Get("updates_"+id) == "on"
+			marketing := r.PostForm.Get("marketing_"+id) == "on"
+			if updates == waitlist.Updates && marketing == waitlist.Marketing {
+				continue
+			}
+			err := database.UpdateSignupSubscription(r.Context(), waitlist.SignupID, subscriber.Email, updates, marketing)
+			if err != nil && err.Error() != "signup not found" {
+				log.Error("Failed to update signup subscription: ", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		if all := r.PostForm.Get("all") == "on"; all && !current.All {
+			err = database.SuppressEmail(r.Context(), &models.EmailSuppression{
+				Email:  subscriber.Email,
+				Reason: models.SuppressionUnsubscribed,
+			})
+		} else if !all && current.All {
+			_, err = database.RemoveEmailSuppression(r.Context(), subscriber.Email, models.SuppressionUnsubscribed)
+		}
+		if err != nil {
+			log.Error("Failed to update email suppression: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		page, err := preferencesPage(r.Context(), database, subscriber, token)
+		if err != nil {
+			log.Error("Failed to get email preferences: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		page.Step = hosted.PreferencesSaved
+		if err := hosted.RenderPreferences(w, http.StatusOK, page); err != nil {
+			log.Error("Failed to render page: ", err)
+		}
+	}
+}
@@ -1,17 +1,24 @@
 package handlers
 
 import (
-	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/anish-chanda/openwaitlist/backend/internal/branding"
+	"github.com/anish-chanda/openwaitlist/backend/internal/consent"
 	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/emailcheck"
+	"github.com/anish-chanda/openwaitlist/backend/internal/formfields"
 	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
 	"github.com/anish-chanda/openwaitlist/backend/internal/models"
 	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+	"github.com/anish-chanda/openwaitlist/backend/internal/widget"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-pkgz/auth/v2/token"
 )
@@ -20,16 +27,411 @@ type WaitlistResponse struct {
 	ID                 int64  `json:"id"`
 	Slug               string `json:"slug"`
 	Name               string `json:"name"`
+	Description        string `json:"description"`
 	OwnerUserID        int64  `json:"owner_user_id"`
 	IsPublic           bool   `json:"is_public"`
 	ShowVendorBranding bool   `json:"show_vendor_branding"`
 	CreatedAt          string `json:"created_at"`
+
+	BotHoneypot         bool `json:"bot_honeypot"`
+	BotMinSubmitSeconds int  `json:"bot_min_submit_seconds"`
+	BotPowDifficulty    int  `json:"bot_pow_difficulty"`
+	BotCaptcha          bool `json:"bot_captcha"`
+
+	EmailGmailAliases    bool     `json:"email_gmail_aliases"`
+	EmailBlockDisposable bool     `json:"email_block_disposable"`
+	EmailCheckMX         bool     `json:"email_check_mx"`
+	EmailAllowDomains    []string `json:"email_allow_domains"`
+	EmailDenyDomains     []string `json:"email_deny_domains"`
+
+	FormFields formfields.Schema `json:"form_fields"`
+
+	EmbedAllowedOrigins []string     `json:"embed_allowed_origins"`
+	WidgetTheme         widget.Theme `json:"widget_theme"`
+
+	LogoURL        string          `json:"logo_url,omitempty"`
+	BrandColors    branding.Colors `json:"brand_colors"`
+	SuccessMessage string          `json:"success_message"`
+	RedirectURL    string          `json:"redirect_url"`
+	ShareText      string          `json:"share_text"`
+
+	OpensAt      *time.Time          `json:"opens_at"`
+	ClosesAt     *time.Time          `json:"closes_at"`
+	MaxSignups   *int                `json:"max_signups"`
+	OverflowMode models.OverflowMode `json:"overflow_mode"`
+
+	CaptureAttribution bool             `json:"capture_attribution"`
+	Consent            consent.Settings `json:"consent"`
+
+	InviteCallbackURL string `json:"invite_callback_url"`
 }
 
 type CreateWaitlistRequest struct {
 	Name               string `json:"name"`
 	IsPublic           bool   `json:"is_public"`
 	ShowVendorBranding bool   `json:"show_vendor_branding"`
+
+	WaitlistSettings
+}
+
+// UpdateWaitlistRequest changes the fields present in it and leaves the rest as they are
+type UpdateWaitlistRequest struct {
+	Name               *string `json:"name,omitempty"`
+	IsPublic           *bool   `json:"is_public,omitempty"`
+	ShowVendorBranding *bool   `json:"show_vendor_branding,omitempty"`
+
+	WaitlistSettings
+}
+
+// WaitlistSettings are the optional waitlist settings, left unchanged (or
+// defaulted on create) when omitted
+type WaitlistSettings struct {
+	// Bot protection
+	BotHoneypot         *bool `json:"bot_honeypot,omitempty"`
+	BotMinSubmitSeconds *int  `json:"bot_min_submit_seconds,omitempty"`
+	BotPowDifficulty    *int  `json:"bot_pow_difficulty,omitempty"`
+	BotCaptcha          *bool `json:"bot_captcha,omitempty"`
+
+	// Email rules
+	EmailGmailAliases    *bool     `json:"email_gmail_aliases,omitempty"`
+	EmailBlockDisposable *bool     `json:"email_block_disposable,omitempty"`
+	EmailCheckMX         *bool     `json:"email_check_mx,omitempty"`
+	EmailAllowDomains    *[]string `json:"email_allow_domains,omitempty"`
+	EmailDenyDomains     *[]string `json:"email_deny_domains,omitempty"`
+
+	// Custom signup form fields
+	FormFields *formfields.Schema `json:"form_fields,omitempty"`
+
+	// Embeddable widget
+	EmbedAllowedOrigins *[]string     `json:"embed_allowed_origins,omitempty"`
+	WidgetTheme         *widget.Theme `json:"widget_theme,omitempty"`
+
+	// Branding and content, the logo has its own endpoint
+	Description    *string          `json:"description,omitempty"` // markdown
+	BrandColors    *branding.Colors `json:"brand_colors,omitempty"`
+	SuccessMessage *string          `json:"success_message,omitempty"`
+	RedirectURL    *string          `json:"redirect_url,omitempty"` // empty clears it
+	ShareText      *string          `json:"share_text,omitempty"`
+
+	// Signup window and capacity, empty times and a max of 0 remove the limit
+	OpensAt      *string `json:"opens_at,omitempty"`  // RFC 3339
+	ClosesAt     *string `json:"closes_at,omitempty"` // RFC 3339
+	MaxSignups   *int    `json:"max_signups,omitempty"`
+	OverflowMode *string `json:"overflow_mode,omitempty"` // reject or queue
+
+	// Privacy
+	CaptureAttribution *bool             `json:"capture_attribution,omitempty"`
+	Consent            *consent.Settings `json:"consent,omitempty"` // replaces both checkboxes, versions are assigned on save
+
+	// Invites, redeemed codes are sent to the callback URL with an access token
+	InviteCallbackURL *string `json:"invite_callback_url,omitempty"` // empty clears it
+}
+
+// Bot protection bounds, difficulty above ~24 bits takes browsers too long to solve
+const (
+	maxBotMinSubmitSeconds = 60
+	maxBotPowDifficulty    = 24
+)
+
+// applyBotSettings copies the bot protection settings present in req onto waitlist
+func applyBotSettings(waitlist *models.Waitlist, req *WaitlistSettings) error {
+	if req.BotMinSubmitSeconds != nil && (*req.BotMinSubmitSeconds < 0 || *req.BotMinSubmitSeconds > maxBotMinSubmitSeconds) {
+		return fmt.Errorf("bot_min_submit_seconds must be between 0 and %d", maxBotMinSubmitSeconds)
+	}
+	if req.BotPowDifficulty != nil && (*req.BotPowDifficulty < 0 || *req.BotPowDifficulty > maxBotPowDifficulty) {
+		return fmt.Errorf("bot_pow_difficulty must be between 0 and %d", maxBotPowDifficulty)
+	}
+
+	if req.BotHoneypot != nil {
+		waitlist.BotHoneypot = *req.BotHoneypot
+	}
+	if req.BotMinSubmitSeconds != nil {
+		waitlist.BotMinSubmitSeconds = *req.BotMinSubmitSeconds
+	}
+	if req.BotPowDifficulty != nil {
+		waitlist.BotPowDifficulty = *req.BotPowDifficulty
+	}
+	if req.BotCaptcha != nil {
+		waitlist.BotCaptcha = *req.BotCaptcha
+	}
+	return nil
+}
+
+// maxEmailDomains caps each allow and deny list
+const maxEmailDomains = 500
+
+// applyEmailRules copies the email rules present in req onto waitlist
+func applyEmailRules(waitlist *models.Waitlist, req *WaitlistSettings) error {
+	for _, list := range []struct {
+		name   string
+		values *[]string
+		target *[]string
+	}{
+		{"email_allow_domains", req.EmailAllowDomains, &waitlist.EmailAllowDomains},
+		{"email_deny_domains", req.EmailDenyDomains, &waitlist.EmailDenyDomains},
+	} {
+		if list.values == nil {
+			continue
+		}
+		domains, err := emailcheck.NormalizeDomains(*list.values)
+		if err != nil {
+			return fmt.Errorf("%s: %w", list.name, err)
+		}
+		if len(domains) > maxEmailDomains {
+			return fmt.Errorf("%s can hold at most %d domains", list.name, maxEmailDomains)
+		}
+		*list.target = domains
+	}
+
+	if req.EmailGmailAliases != nil {
+		waitlist.EmailGmailAliases = *req.EmailGmailAliases
+	}
+	if req.EmailBlockDisposable != nil {
+		waitlist.EmailBlockDisposable = *req.EmailBlockDisposable
+	}
+	if req.EmailCheckMX != nil {
+		waitlist.EmailCheckMX = *req.EmailCheckMX
+	}
+	return nil
+}
+
+// Content limits
+const (
+	maxDescriptionChars    = 5000
+	maxSuccessMessageChars = 500
+	maxShareTextChars      = 280
+	maxRedirectURLLength   = 2000
+)
+
+// maxEmbedOrigins caps the origins allowed to embed a waitlist's widget
+const maxEmbedOrigins = 50
+
+// applyWaitlistSettings copies the optional settings present in req onto waitlist
+func applyWaitlistSettings(waitlist *models.Waitlist, req *WaitlistSettings) error {
+	if err := applyBotSettings(waitlist, req); err != nil {
+		return err
+	}
+	if err := applyEmailRules(waitlist, req); err != nil {
+		return err
+	}
+	if req.FormFields != nil {
+		if err := req.FormFields.Validate(); err != nil {
+			return fmt.Errorf("form_fields: %w", err)
+		}
+		waitlist.FormFields = *req.FormFields
+	}
+	if req.EmbedAllowedOrigins != nil {
+		origins, err := widget.NormalizeOrigins(*req.EmbedAllowedOrigins)
+		if err != nil {
+			return fmt.Errorf("embed_allowed_origins: %w", err)
+		}
+		if len(origins) > maxEmbedOrigins {
+			return fmt.Errorf("embed_allowed_origins can hold at most %d origins", maxEmbedOrigins)
+		}
+		waitlist.EmbedAllowedOrigins = origins
+	}
+	if req.WidgetTheme != nil {
+		if err := req.WidgetTheme.Validate(); err != nil {
+			return fmt.Errorf("widget_theme: %w", err)
+		}
+		waitlist.WidgetTheme = *req.WidgetTheme
+	}
+	if err := applyContent(waitlist, req); err != nil {
+		return err
+	}
+	if err := applySchedule(waitlist, req); err != nil {
+		return err
+	}
+	if req.CaptureAttribution != nil {
+		waitlist.CaptureAttribution = *req.CaptureAttribution
+	}
+	if req.Consent != nil {
+		if err := req.Consent.Validate(); err != nil {
+			return fmt.Errorf("consent: %w", err)
+		}
+		waitlist.Consent = *req.Consent
+	}
+	if req.InviteCallbackURL != nil {
+		callbackURL, err := parseRedirectURL("invite_callback_url", *req.InviteCallbackURL)
+		if err != nil {
+			return err
+		}
+		waitlist.InviteCallbackURL = callbackURL
+	}
+	return nil
+}
+
+// maxMaxSignups keeps max_signups to a sane number
+const maxMaxSignups = 10_000_000
+
+// applySchedule copies the signup window and capacity settings present in req onto waitlist
+func applySchedule(waitlist *models.Waitlist, req *WaitlistSettings) error {
+	for _, setting := range []struct {
+		name   string
+		value  *string
+		target **time.Time
+	}{
+		{"opens_at", req.OpensAt, &waitlist.OpensAt},
+		{"closes_at", req.ClosesAt, &waitlist.ClosesAt},
+	} {
+		if setting.value == nil {
+			continue
+		}
+		if strings.TrimSpace(*setting.value) == "" {
+			*setting.target = nil
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, strings.TrimSpace(*setting.value))
+		if err != nil {
+			return fmt.Errorf("%s must be an RFC 3339 time like 2025-01-31T09:00:00Z", setting.name)
+		}
+		*setting.target = &at
+	}
+	if waitlist.OpensAt != nil && waitlist.ClosesAt != nil && !waitlist.ClosesAt.After(*waitlist.OpensAt) {
+		return fmt.Errorf("closes_at must be after opens_at")
+	}
+
+	if req.MaxSignups != nil {
+		switch {
+		case *req.MaxSignups < 0 || *req.MaxSignups > maxMaxSignups:
+			return fmt.Errorf("max_signups must be between 0 and %d", maxMaxSignups)
+		case *req.MaxSignups == 0:
+			waitlist.MaxSignups = nil
+		default:
+			maxSignups := *req.MaxSignups
+			waitlist.MaxSignups = &maxSignups
+		}
+	}
+	if req.OverflowMode != nil {
+		switch mode := models.OverflowMode(*req.OverflowMode); mode {
+		case models.OverflowReject, models.OverflowQueue:
+			waitlist.OverflowMode = mode
+		default:
+			return fmt.Errorf("overflow_mode must be reject or queue")
+		}
+	}
+	return nil
+}
+
+// applyContent copies the branding and content settings present in req onto waitlist
+func applyContent(waitlist *models.Waitlist, req *WaitlistSettings) error {
+	for _, text := range []struct {
+		name     string
+		value    *string
+		maxChars int
+		target   *string
+	}{
+		{"description", req.Description, maxDescriptionChars, &waitlist.Description},
+		{"success_message", req.SuccessMessage, maxSuccessMessageChars, &waitlist.SuccessMessage},
+		{"share_text", req.ShareText, maxShareTextChars, &waitlist.ShareText},
+	} {
+		if text.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*text.value)
+		if utf8.RuneCountInString(value) > text.maxChars {
+			return fmt.Errorf("%s must be at most %d characters", text.name, text.maxChars)
+		}
+		*text.target = value
+	}
+
+	if req.RedirectURL != nil {
+		redirectURL, err := parseRedirectURL("redirect_url", *req.RedirectURL)
+		if err != nil {
+			return err
+		}
+		waitlist.RedirectURL = redirectURL
+	}
+	if req.BrandColors != nil {
+		if err := req.BrandColors.Validate(); err != nil {
+			return fmt.Errorf("brand_colors: %w", err)
+		}
+		waitlist.BrandColors = *req.BrandColors
+	}
+	return nil
+}
+
+// parseRedirectURL checks a URL people are sent to is an absolute http(s) URL,
+// empty clears it
+func parseRedirectURL(name, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(value) > maxRedirectURLLength {
+		return "", fmt.Errorf("%s must be an absolute http(s) URL", name)
+	}
+	return value, nil
+}
+
+// nonNilStrings keeps empty lists as [] instead of null in responses
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// nonNilFields keeps an empty form as [] instead of null in responses
+func nonNilFields(fields formfields.Schema) formfields.Schema {
+	if fields == nil {
+		return formfields.Schema{}
+	}
+	return fields
+}
+
+// newWaitlistResponse converts a waitlist to its API representation
+func newWaitlistResponse(waitlist *models.Waitlist) WaitlistResponse {
+	return WaitlistResponse{
+		ID:                  waitlist.ID,
+		Slug:                waitlist.Slug,
+		Name:                waitlist.Name,
+		Description:         waitlist.Description,
+		OwnerUserID:         waitlist.OwnerUserID,
+		IsPublic:            waitlist.IsPublic,
+		ShowVendorBranding:  waitlist.ShowVendorBranding,
+		CreatedAt:           waitlist.CreatedAt.Format("2006-01-02 15:04:05"),
+		BotHoneypot:         waitlist.BotHoneypot,
+		BotMinSubmitSeconds: waitlist.BotMinSubmitSeconds,
+		BotPowDifficulty:    waitlist.BotPowDifficulty,
+		BotCaptcha:          waitlist.BotCaptcha,
+
+		EmailGmailAliases:    waitlist.EmailGmailAliases,
+		EmailBlockDisposable: waitlist.EmailBlockDisposable,
+		EmailCheckMX:         waitlist.EmailCheckMX,
+		EmailAllowDomains:    nonNilStrings(waitlist.EmailAllowDomains),
+		EmailDenyDomains:     nonNilStrings(waitlist.EmailDenyDomains),
+
+		FormFields: nonNilFields(waitlist.FormFields),
+
+		EmbedAllowedOrigins: nonNilStrings(waitlist.EmbedAllowedOrigins),
+		WidgetTheme:         waitlist.WidgetTheme,
+
+		LogoURL:        logoURL(waitlist),
+		BrandColors:    waitlist.BrandColors,
+		SuccessMessage: waitlist.SuccessMessage,
+		RedirectURL:    waitlist.RedirectURL,
+		ShareText:      waitlist.ShareText,
+
+		OpensAt:      waitlist.OpensAt,
+		ClosesAt:     waitlist.ClosesAt,
+		MaxSignups:   waitlist.MaxSignups,
+		OverflowMode: waitlist.OverflowMode,
+
+		CaptureAttribution: waitlist.CaptureAttribution,
+		Consent:            waitlist.Consent,
+
+		InviteCallbackURL: waitlist.InviteCallbackURL,
+	}
+}
+
+// logoURL returns the path of a waitlist's logo, empty when it has none
+func logoURL(waitlist *models.Waitlist) string {
+	if waitlist.Logo == nil {
+		return ""
+	}
+	return branding.LogoPath(*waitlist.Logo)
 }
 
 type WaitlistsResponse struct {
@@ -38,7 +440,8 @@ type WaitlistsResponse struct {
 }
 
 // getUserIDFromRequest extracts the database user ID from the authenticated request
-func getUserIDFromRequest(r *http.Request, database db.Database, log logger.ServiceLogger) (int64, error) {
+// and records it on the request logger
+func getUserIDFromRequest(r *http.Request, database db.Database) (int64, error) {
 	tokenUser, err := token.GetUserInfo(r)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get user info from token: %w", err)
@@ -47,6 +450,7 @@ func getUserIDFromRequest(r *http.Request, database db.Database, log logger.Serv
 	// Check if user ID is stored in user attributes
 	if userIDStr := tokenUser.StrAttr("user_id"); userIDStr != "" {
 		if userID, err := strconv.ParseInt(userIDStr, 10, 64); err == nil {
+			logger.SetUserID(r.Context(), userIDStr)
 			return userID, nil
 		}
 	}
@@ -58,19 +462,22 @@ func getUserIDFromRequest(r *http.Request, database db.Database, log logger.Serv
 	}
 
 	// Get user from database using email
-	dbUser, err := database.GetUserByEmail(context.Background(), email)
+	dbUser, err := database.GetUserByEmail(r.Context(), email)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get user from database: %w", err)
 	}
 
+	logger.SetUserID(r.Context(), strconv.FormatInt(dbUser.ID, 10))
 	return dbUser.ID, nil
 }
 
 // GetWaitlistsHandler returns all waitlists for the authenticated user with optional search
-func GetWaitlistsHandler(database db.Database, log logger.ServiceLogger) http.HandlerFunc {
+func GetWaitlistsHandler(database db.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
 		// Get authenticated user ID
-		userID, err := getUserIDFromRequest(r, database, log)
+		userID, err := getUserIDFromRequest(r, database)
 		if err != nil {
 			log.Error("Failed to get user ID: ", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -81,7 +488,7 @@ func GetWaitlistsHandler(database db.Database, log logger.ServiceLogger) http.Ha
 		searchName := strings.TrimSpace(r.URL.Query().Get("search"))
 
 		// Get waitlists from database
-		waitlists, err := database.GetWaitlistsByUserID(context.Background(), userID, searchName)
+		waitlists, err := database.GetWaitlistsByUserID(r.Context(), userID, searchName)
 		if err != nil {
 			log.Error("Failed to get waitlists: ", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -91,15 +498,7 @@ func GetWaitlistsHandler(database db.Database, log logger.ServiceLogger) http.Ha
 		// Convert to response format
 		var waitlistResponses []WaitlistResponse
 		for _, wl := range waitlists {
-			waitlistResponses = append(waitlistResponses, WaitlistResponse{
-				ID:                 wl.ID,
-				Slug:               wl.Slug,
-				Name:               wl.Name,
-				OwnerUserID:        wl.OwnerUserID,
-				IsPublic:           wl.IsPublic,
-				ShowVendorBranding: wl.ShowVendorBranding,
-				CreatedAt:          wl.CreatedAt.Format("2006-01-02 15:04:05"),
-			})
+			waitlistResponses = append(waitlistResponses, newWaitlistResponse(wl))
 		}
 
 		response := WaitlistsResponse{
@@ -118,10 +517,12 @@ func GetWaitlistsHandler(database db.Database, log logger.ServiceLogger) http.Ha
 }
 
 // CreateWaitlistHandler creates a new waitlist for the authenticated user
-func CreateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.HandlerFunc {
+func CreateWaitlistHandler(database db.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
 		// Get authenticated user ID
-		userID, err := getUserIDFromRequest(r, database, log)
+		userID, err := getUserIDFromRequest(r, database)
 		if err != nil {
 			log.Error("Failed to get user ID: ", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -144,11 +545,21 @@ func CreateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.
 
 		// Create waitlist
 		waitlist := &models.Waitlist{
-			Slug:               utils.GenerateSlugFromName(strings.TrimSpace(req.Name)),
-			Name:               strings.TrimSpace(req.Name),
-			OwnerUserID:        userID,
-			IsPublic:           req.IsPublic,
-			ShowVendorBranding: req.ShowVendorBranding,
+			Slug:                utils.GenerateSlugFromName(strings.TrimSpace(req.Name)),
+			Name:                strings.TrimSpace(req.Name),
+			OwnerUserID:         userID,
+			IsPublic:            req.IsPublic,
+			ShowVendorBranding:  req.ShowVendorBranding,
+			BotHoneypot:         true,
+			BotMinSubmitSeconds: 3,
+
+			EmailBlockDisposable: true,
+			OverflowMode:         models.OverflowReject,
+			CaptureAttribution:   true,
+		}
+		if err := applyWaitlistSettings(waitlist, &req.WaitlistSettings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
 		if err := database.CreateWaitlist(r.Context(), waitlist); err != nil {
@@ -156,15 +567,7 @@ func CreateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		} // Return created waitlist
-		response := WaitlistResponse{
-			ID:                 waitlist.ID,
-			Slug:               waitlist.Slug,
-			Name:               waitlist.Name,
-			OwnerUserID:        waitlist.OwnerUserID,
-			IsPublic:           waitlist.IsPublic,
-			ShowVendorBranding: waitlist.ShowVendorBranding,
-			CreatedAt:          waitlist.CreatedAt.Format("2006-01-02 15:04:05"),
-		}
+		response := newWaitlistResponse(waitlist)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -175,10 +578,12 @@ func CreateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.
 }
 
 // GetWaitlistHandler returns a specific waitlist by slug
-func GetWaitlistHandler(database db.Database, log logger.ServiceLogger) http.HandlerFunc {
+func GetWaitlistHandler(database db.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
 		// Get authenticated user ID
-		userID, err := getUserIDFromRequest(r, database, log)
+		userID, err := getUserIDFromRequest(r, database)
 		if err != nil {
 			log.Error("Failed to get user ID: ", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -191,7 +596,7 @@ func GetWaitlistHandler(database db.Database, log logger.ServiceLogger) http.Han
 			return
 		}
 
-		waitlist, err := database.GetWaitlistBySlug(context.Background(), slug)
+		waitlist, err := database.GetWaitlistBySlug(r.Context(), slug)
 		if err != nil {
 			if strings.Contains(err.Error(), "not found") {
 				http.Error(w, "Waitlist not found", http.StatusNotFound)
@@ -208,15 +613,7 @@ func GetWaitlistHandler(database db.Database, log logger.ServiceLogger) http.Han
 			return
 		}
 
-		response := WaitlistResponse{
-			ID:                 waitlist.ID,
-			Slug:               waitlist.Slug,
-			Name:               waitlist.Name,
-			OwnerUserID:        waitlist.OwnerUserID,
-			IsPublic:           waitlist.IsPublic,
-			ShowVendorBranding: waitlist.ShowVendorBranding,
-			CreatedAt:          waitlist.CreatedAt.Format("2006-01-02 15:04:05"),
-		}
+		response := newWaitlistResponse(waitlist)
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -226,10 +623,12 @@ func GetWaitlistHandler(database db.Database, log logger.ServiceLogger) http.Han
 	}
 }
 
-// UpdateWaitlistHandler updates a waitlist by slug
-func UpdateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.HandlerFunc {
+// UpdateWaitlistHandler partially updates a waitlist by slug, see UpdateWaitlistRequest
+func UpdateWaitlistHandler(database db.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := getUserIDFromRequest(r, database, log)
+		log := logger.FromContext(r.Context())
+
+		userID, err := getUserIDFromRequest(r, database)
 		if err != nil {
 			log.Error("Failed to get user ID: ", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -242,15 +641,15 @@ func UpdateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.
 			return
 		}
 
-		// Parse request body
-		var req CreateWaitlistRequest
+		// Parse request body, fields left out keep their current values
+		var req UpdateWaitlistRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid JSON", http.StatusBadRequest)
 			return
 		}
 
 		// Validate input
-		if strings.TrimSpace(req.Name) == "" {
+		if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
 			http.Error(w, "Name is required", http.StatusBadRequest)
 			return
 		}
@@ -273,11 +672,21 @@ func UpdateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.
 			return
 		}
 
-		// Update the waitlist fields
-		waitlist.Name = strings.TrimSpace(req.Name)
-		waitlist.Slug = utils.GenerateSlugFromName(strings.TrimSpace(req.Name))
-		waitlist.IsPublic = req.IsPublic
-		waitlist.ShowVendorBranding = req.ShowVendorBranding
+		// Update the fields present in the request, the slug follows the name
+		if req.Name != nil && strings.TrimSpace(*req.Name) != waitlist.Name {
+			waitlist.Name = strings.TrimSpace(*req.Name)
+			waitlist.Slug = utils.GenerateSlugFromName(waitlist.Name)
+		}
+		if req.IsPublic != nil {
+			waitlist.IsPublic = *req.IsPublic
+		}
+		if req.ShowVendorBranding != nil {
+			waitlist.ShowVendorBranding = *req.ShowVendorBranding
+		}
+		if err := applyWaitlistSettings(waitlist, &req.WaitlistSettings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		// Update in database
 		if err := database.UpdateWaitlist(r.Context(), waitlist); err != nil {
@@ -287,15 +696,7 @@ func UpdateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.
 		}
 
 		// Create response
-		response := WaitlistResponse{
-			ID:                 waitlist.ID,
-			Slug:               waitlist.Slug,
-			Name:               waitlist.Name,
-			OwnerUserID:        waitlist.OwnerUserID,
-			IsPublic:           waitlist.IsPublic,
-			ShowVendorBranding: waitlist.ShowVendorBranding,
-			CreatedAt:          waitlist.CreatedAt.Format("2006-01-02T15:04:05Z"),
-		}
+		response := newWaitlistResponse(waitlist)
 
 		log.Info(fmt.Sprintf("Waitlist updated successfully: %s by user %d", slug, userID))
 		w.Header().Set("Content-Type", "application/json")
@@ -307,9 +708,11 @@ func UpdateWaitlistHandler(database db.Database, log logger.ServiceLogger) http.
 }
 
 // DeleteWaitlistHandler deletes a waitlist by slug
-func DeleteWaitlistHandler(database db.Database, log logger.ServiceLogger) http.HandlerFunc {
+func DeleteWaitlistHandler(database db.Database) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		userID, err := getUserIDFromRequest(r, database, log)
+		log := logger.FromContext(r.Context())
+
+		userID, err := getUserIDFromRequest(r, database)
 		if err != nil {
 			log.Error("Failed to get user ID: ", err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -351,3 +754,27 @@ func DeleteWaitlistHandler(database db.Database, log logger.ServiceLogger) http.
 		w.WriteHeader(http.StatusNoContent)
 	}
 }
+
+// ConsentVersionsHandler lists every version of a waitlist's consent text, so
+// the version stored with a signup shows what they agreed to
+func ConsentVersionsHandler(database db.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := logger.FromContext(r.Context())
+
+		waitlist, ok := getOwnedWaitlist(w, r, database)
+		if !ok {
+			return
+		}
+
+		versions, err := database.ListConsentVersions(r.Context(), waitlist.ID)
+		if err != nil {
+			log.Error("Failed to list consent versions: ", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if versions == nil {
+			versions = []*consent.Version{}
+		}
+		writeJSON(w, r, versions, http.StatusOK)
+	}
+}
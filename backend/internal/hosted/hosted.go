@@ -0,0 +1,228 @@
+package hosted
+
+import (
+	"embed"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/botcheck"
+	"github.com/anish-chanda/openwaitlist/backend/internal/branding"
+	"github.com/anish-chanda/openwaitlist/backend/internal/consent"
+	"github.com/anish-chanda/openwaitlist/backend/internal/formfields"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	"summary": summary,
+}).ParseFS(templateFS, "templates/*.html"))
+
+// maxSummaryChars keeps link preview descriptions to what sites display
+const maxSummaryChars = 200
+
+// Page is a waitlist's hosted page, showing either the join form or the
+// result of joining
+type Page struct {
+	Slug         string
+	Name         string
+	Description  template.HTML // sanitized, see branding.RenderMarkdown
+	Summary      string        // plain text description for link previews
+	URL          string        // canonical absolute URL, for link previews
+	LogoURL      string        // absolute, empty without a logo
+	Colors       branding.Colors
+	ShowBranding bool
+	Notice       string // why signups are closed or queued, shown above the form
+
+	Form   *Form
+	Joined *Joined
+}
+
+// Form is the join form with the visitor's input when it is shown again after
+// a failed submission
+type Form struct {
+	Action     string
+	Email      string
+	Name       string
+	Ref        string // referral code from the link the visitor followed
+	LandingURL string // page URL with its utm_* parameters, empty without attribution
+	Referrer   string // page that linked to the hosted page
+	Fields     []Field
+	Message    string // error for the whole form
+	EmailError string
+	Notice     string // shown as the page notice, e.g. that signups are queued
+
+	Consent        consent.Settings
+	AcceptTerms    bool
+	MarketingOptIn bool
+	TermsError     string
+
+	Challenge        *botcheck.Challenge
+	CaptchaScriptURL string // provider script rendering the captcha widget
+}
+
+// Field is a custom form field with the visitor's answer
+type Field struct {
+	formfields.Field
+	Value string
+	Error string
+}
+
+// NeedsScript reports whether the form can only be submitted with JavaScript
+func (f *Form) NeedsScript() bool {
+	return f.Challenge != nil && (f.Challenge.PowChallenge != "" || f.Challenge.CaptchaSiteKey != "")
+}
+
+// Joined is shown after signing up
+type Joined struct {
+	Message     string
+	Position    int64  // 0 when unknown
+	ReferralURL string // empty when unknown
+	ShareText   string
+}
+
+// ShareLink opens a site's share dialog with a referral link
+type ShareLink struct {
+	Label string
+	URL   string
+}
+
+// ShareLinks returns the links for sharing the referral link, prefilled with the share text
+func (j *Joined) ShareLinks() []ShareLink {
+	if j.ReferralURL == "" {
+		return nil
+	}
+	text := j.ShareText
+	withURL := strings.TrimSpace(text + " " + j.ReferralURL)
+	return []ShareLink{
+		{"Share on X", "https://twitter.com/intent/tweet?" + url.Values{"text": {text}, "url": {j.ReferralURL}}.Encode()},
+		{"Share on LinkedIn", "https://www.linkedin.com/sharing/share-offsite/?" + url.Values{"url": {j.ReferralURL}}.Encode()},
+		{"Share on WhatsApp", "https://wa.me/?" + url.Values{"text": {withURL}}.Encode()},
+		{"Share by email", "mailto:?" + strings.ReplaceAll(url.Values{"body": {withURL}}.Encode(), "+", "%20")},
+	}
+}
+
+// NewFields pairs a form's fields with submitted values and their errors
+func NewFields(schema formfields.Schema, values map[string]string, errors formfields.Errors) []Field {
+	fields := make([]Field, len(schema))
+	for i, field := range schema {
+		fields[i] = Field{Field: field, Value: values[field.Key], Error: errors[field.Key]}
+	}
+	return fields
+}
+
+// Render writes page with the given status
+func Render(w http.ResponseWriter, status int, page Page) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'self'")
+	w.WriteHeader(status)
+	return templates.ExecuteTemplate(w, "page.html", page)
+}
+
+// RenderNotFound writes the page shown for missing and private waitlists
+func RenderNotFound(w http.ResponseWriter) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	return templates.ExecuteTemplate(w, "notfound.html", nil)
+}
+
+// Privacy page steps
+const (
+	PrivacyRequest = "request" // ask for the email to send a link to
+	PrivacySent    = "sent"
+	PrivacyManage  = "manage" // opened from the link: download or erase
+	PrivacyErased  = "erased"
+	PrivacyInvalid = "invalid" // bad or expired link
+)
+
+// PrivacyPage is the self-service page for people whose email is on a waitlist
+type PrivacyPage struct {
+	Step      string
+	Message   string   // error to show
+	Token     string   // signed link token, for the erase form
+	ExportURL string   // download of the data as JSON
+	Waitlists []string // names of the waitlists the email is on
+	Erased    int64
+}
+
+// RenderPrivacy writes the privacy page with the given status
+func RenderPrivacy(w http.ResponseWriter, status int, page PrivacyPage) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	return templates.ExecuteTemplate(w, "privacy.html", page)
+}
+
+// Preference page steps
+const (
+	PreferencesManage  = "manage"
+	PreferencesSaved   = "saved"
+	PreferencesInvalid = "invalid" // bad or expired link
+)
+
+// PreferencesPage is the email preference page opened from an unsubscribe link
+type PreferencesPage struct {
+	Step       string
+	Token      string // signed unsubscribe link token, for the form
+	Email      string
+	Suppressed string // bounced or complained when no email can be sent to the address
+	All        bool   // unsubscribed from every email
+	Waitlists  []PreferencesWaitlist
+}
+
+// PreferencesWaitlist is one waitlist on the preference page
+type PreferencesWaitlist struct {
+	SignupID  int64
+	Name      string
+	Updates   bool // gets the waitlist's emails
+	Marketing bool // opted in to marketing, which can only be turned off here
+	Linked    bool // the waitlist the link was sent for
+}
+
+// RenderPreferences writes the email preference page with the given status
+func RenderPreferences(w http.ResponseWriter, status int, page PreferencesPage) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	return templates.ExecuteTemplate(w, "preferences.html", page)
+}
+
+// Invite page steps
+const (
+	InviteRedeem  = "redeem"  // enter or confirm the code
+	InviteGranted = "granted" // redeemed and the waitlist has no callback URL to send them to
+)
+
+// InvitePage is where invited people redeem their code. Emailed links only fill
+// in the code, since mail scanners follow links and would use it up.
+type InvitePage struct {
+	Step    string
+	Slug    string
+	Name    string // of the waitlist
+	Code    string
+	Message string // error to show
+}
+
+// RenderInvite writes the invite page with the given status
+func RenderInvite(w http.ResponseWriter, status int, page InvitePage) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	return templates.ExecuteTemplate(w, "invite.html", page)
+}
+
+// summary collapses text to a single line short enough for link previews
+func summary(text string) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxSummaryChars {
+		return text
+	}
+	runes := []rune(text)[:maxSummaryChars-1]
+	return strings.TrimSpace(string(runes)) + "…"
+}
@@ -0,0 +1,171 @@
+// Package invites makes the codes invited people redeem and the access tokens
+// redeeming one earns. A token is a JWT signed with the waitlist's own key, so
+// the product behind the waitlist can check it was issued for its waitlist
+// without calling back, and a leaked key only affects that waitlist.
+package invites
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// codeAlphabet leaves out characters that are easily mistaken for each other
+const codeAlphabet = "ABCDEFGHJKMNPQRSTVWXYZ23456789"
+
+// Code shape: 12 characters, about 59 bits, shown in groups of 4
+const (
+	codeLength = 12
+	codeGroup  = 4
+	hintLength = 4
+)
+
+// KeySize is the size of a waitlist's signing key in bytes
+const KeySize = 32
+
+// TokenTTL is how long an access token is valid. It only has to survive the
+// redirect to the product.
+const TokenTTL = 10 * time.Minute
+
+// NewCode returns a random invite code, formatted like ABCD-EFGH-JKMN
+func NewCode() string {
+	code := make([]byte, 0, codeLength)
+	buf := make([]byte, codeLength)
+	// bytes at or above the largest multiple of the alphabet are skipped so every
+	// character is equally likely
+	limit := byte(256 - 256%len(codeAlphabet))
+	for len(code) < codeLength {
+		rand.Read(buf)
+		for _, b := range buf {
+			if b < limit && len(code) < codeLength {
+				code = append(code, codeAlphabet[int(b)%len(codeAlphabet)])
+			}
+		}
+	}
+
+	var formatted strings.Builder
+	for i, c := range code {
+		if i > 0 && i%codeGroup == 0 {
+			formatted.WriteByte('-')
+		}
+		formatted.WriteByte(c)
+	}
+	return formatted.String()
+}
+
+// Normalize uppercases a code and drops the separators people type or paste with it
+func Normalize(code string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', ' ', '\t':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(code)))
+}
+
+// Hash is what is stored of a code, codes are looked up by it
+func Hash(code string) []byte {
+	sum := sha256.Sum256([]byte(Normalize(code)))
+	return sum[:]
+}
+
+// Hint is the end of a code, enough to tell codes apart in a list
+func Hint(code string) string {
+	normalized := Normalize(code)
+	if len(normalized) <= hintLength {
+		return normalized
+	}
+	return normalized[len(normalized)-hintLength:]
+}
+
+// NewKey returns a random signing key for a waitlist
+func NewKey() []byte {
+	key := make([]byte, KeySize)
+	rand.Read(key)
+	return key
+}
+
+// KeyID identifies a signing key without revealing it, it is the "kid" header
+// of the tokens the key signs so a rotation can be told apart from a forgery
+func KeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Claims are the claims of an access token. Tokens from codes made for a
+// signup identify it, tokens from shared codes only the code.
+type Claims struct {
+	WaitlistID int64  `json:"waitlist_id"`
+	Waitlist   string `json:"waitlist"` // slug when the token was issued
+	InviteID   int64  `json:"invite_id"`
+	SignupID   int64  `json:"signup_id,omitempty"`
+	Email      string `json:"email,omitempty"`
+	Name       string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Audience is the "aud" of a waitlist's access tokens
+func Audience(waitlistID int64) string {
+	return "waitlist:" + strconv.FormatInt(waitlistID, 10)
+}
+
+// Sign issues an HS256 access token for a redeemed invite. signup is nil for
+// shared codes.
+func Sign(key []byte, issuer string, waitlist *models.Waitlist, invite *models.InviteCode, signup *models.WaitlistSignup, now time.Time) (string, time.Time, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	expiresAt := now.Add(TokenTTL)
+
+	claims := Claims{
+		WaitlistID: waitlist.ID,
+		Waitlist:   waitlist.Slug,
+		InviteID:   invite.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   "invite:" + strconv.FormatInt(invite.ID, 10),
+			Audience:  jwt.ClaimStrings{Audience(waitlist.ID)},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        hex.EncodeToString(id), // lets the product refuse a token it has seen
+		},
+	}
+	if signup != nil {
+		claims.Subject = "signup:" + strconv.FormatInt(signup.ID, 10)
+		claims.SignupID = signup.ID
+		claims.Email = signup.Email
+		if signup.Name != nil {
+			claims.Name = *signup.Name
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = KeyID(key)
+	signed, err := token.SignedString(key)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// CallbackURL adds an access token to the product's callback URL as the
+// "token" query parameter, keeping the parameters it already has
+func CallbackURL(callback, token string) (string, error) {
+	u, err := url.Parse(callback)
+	if err != nil {
+		return "", fmt.Errorf("invalid invite callback URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
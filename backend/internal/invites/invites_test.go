@@ -0,0 +1,130 @@
+package invites
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestNewCode(t *testing.T) {
+	shape := regexp.MustCompile(`^[` + codeAlphabet + `]{4}-[` + codeAlphabet + `]{4}-[` + codeAlphabet + `]{4}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		code := NewCode()
+		if !shape.MatchString(code) {
+			t.Fatalf("NewCode() = %q, want XXXX-XXXX-XXXX from %s", code, codeAlphabet)
+		}
+		if seen[code] {
+			t.Fatalf("NewCode() repeated %q", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "ABCD-EFGH-JKMN", want: "ABCDEFGHJKMN"},
+		{code: " abcd efgh\tjkmn ", want: "ABCDEFGHJKMN"},
+		{code: "abcd-efgh-jkmn", want: "ABCDEFGHJKMN"},
+		{code: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.code); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestHashAndHint(t *testing.T) {
+	code := NewCode()
+	if !bytes.Equal(Hash(code), Hash(strings.ToLower(strings.ReplaceAll(code, "-", " ")))) {
+		t.Error("Hash differs for the same code typed differently")
+	}
+	if bytes.Equal(Hash(code), Hash(NewCode())) {
+		t.Error("Hash is the same for two codes")
+	}
+
+	if got, want := Hint("abcd-efgh-jkmn"), "JKMN"; got != want {
+		t.Errorf("Hint = %q, want %q", got, want)
+	}
+	if got, want := Hint("ab"), "AB"; got != want {
+		t.Errorf("Hint of a short code = %q, want %q", got, want)
+	}
+}
+
+func TestSign(t *testing.T) {
+	key := NewKey()
+	now := time.Now().Truncate(time.Second)
+	waitlist := &models.Waitlist{ID: 7, Slug: "launch"}
+	invite := &models.InviteCode{ID: 3}
+	name := "Jane"
+
+	tests := []struct {
+		name        string
+		signup      *models.WaitlistSignup
+		wantSubject string
+		wantEmail   string
+	}{
+		{name: "shared code", wantSubject: "invite:3"},
+		{name: "personal code", signup: &models.WaitlistSignup{ID: 42, Email: "jane@example.com", Name: &name}, wantSubject: "signup:42", wantEmail: "jane@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, expiresAt, err := Sign(key, "https://waitlist.example", waitlist, invite, tt.signup, now)
+			if err != nil {
+				t.Fatalf("Sign failed: %v", err)
+			}
+			if !expiresAt.Equal(now.Add(TokenTTL)) {
+				t.Errorf("expires at %s, want %s", expiresAt, now.Add(TokenTTL))
+			}
+
+			var claims Claims
+			token, err := jwt.ParseWithClaims(signed, &claims, func(token *jwt.Token) (interface{}, error) {
+				if token.Header["kid"] != KeyID(key) {
+					t.Errorf("kid = %v, want %s", token.Header["kid"], KeyID(key))
+				}
+				return key, nil
+			}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithAudience(Audience(waitlist.ID)), jwt.WithIssuer("https://waitlist.example"))
+			if err != nil || !token.Valid {
+				t.Fatalf("token doesn't verify: %v", err)
+			}
+			if claims.Subject != tt.wantSubject || claims.Email != tt.wantEmail || claims.WaitlistID != 7 || claims.Waitlist != "launch" || claims.InviteID != 3 {
+				t.Errorf("claims = %+v", claims)
+			}
+
+			if _, err := jwt.Parse(signed, func(*jwt.Token) (interface{}, error) { return NewKey(), nil }); err == nil {
+				t.Error("token verifies with another waitlist's key")
+			}
+		})
+	}
+}
+
+func TestCallbackURL(t *testing.T) {
+	tests := []struct {
+		callback string
+		want     string
+		wantErr  bool
+	}{
+		{callback: "https://app.example/welcome", want: "https://app.example/welcome?token=abc"},
+		{callback: "https://app.example/welcome?ref=waitlist", want: "https://app.example/welcome?ref=waitlist&token=abc"},
+		{callback: "https://app.example/welcome?token=old", want: "https://app.example/welcome?token=abc"},
+		{callback: "://bad", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := CallbackURL(tt.callback, "abc")
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("CallbackURL(%q) = %q, %v, want %q", tt.callback, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+// Package jobs runs background work from a queue stored in postgres. Workers
+// claim due jobs with SELECT ... FOR UPDATE SKIP LOCKED, so any number of them
+// across replicas share the queue without running a job twice. Failed jobs are
+// retried with exponential backoff and kept as dead jobs once they run out of
+// attempts, until they are retried or deleted from the admin API.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/metrics"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Defaults of a Kind
+const (
+	DefaultMaxAttempts = 10
+	DefaultTimeout     = 5 * time.Minute
+)
+
+// Retry backoff, doubled for every attempt with up to 20% jitter
+const (
+	baseBackoff = 10 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+const (
+	// staleAfter is when a running job is handed to another worker, assuming its
+	// worker died. Kinds can't time out later than this.
+	staleAfter = 30 * time.Minute
+
+	// maintenanceInterval is how often stale jobs are released and the queue
+	// depth metrics updated
+	maintenanceInterval = time.Minute
+
+	// scheduleInterval is how often recurring jobs are checked, only jobs whose
+	// slot has passed reach the database
+	scheduleInterval = time.Second
+
+	// finishTimeout bounds recording a job's outcome, which also happens while
+	// shutting down
+	finishTimeout = 10 * time.Second
+)
+
+// Kind is a type of job whose payloads are a T, stored as JSON
+type Kind[T any] struct {
+	Name        string
+	MaxAttempts int           // 0 uses DefaultMaxAttempts
+	Timeout     time.Duration // of each attempt, 0 uses DefaultTimeout
+}
+
+func (k Kind[T]) maxAttempts() int {
+	if k.MaxAttempts > 0 {
+		return k.MaxAttempts
+	}
+	return DefaultMaxAttempts
+}
+
+func (k Kind[T]) timeout() time.Duration {
+	if k.Timeout > 0 {
+		return min(k.Timeout, staleAfter/2)
+	}
+	return DefaultTimeout
+}
+
+// EnqueueOptions are the optional settings of a job
+type EnqueueOptions struct {
+	RunAt     time.Time // zero runs it as soon as a worker is free
+	UniqueKey string    // while a job of the kind with this key is pending or running no other is added
+}
+
+// Enqueue adds a job of kind. It reports false when a job with the same unique
+// key was already queued, returning that job when it can still be read.
+func Enqueue[T any](ctx context.Context, database db.Database, kind Kind[T], payload T, options EnqueueOptions) (*models.Job, bool, error) {
+	job, err := newJob(kind, payload, options)
+	if err != nil {
+		return nil, false, err
+	}
+	enqueued, err := database.EnqueueJob(ctx, job)
+	if err != nil {
+		return nil, false, err
+	}
+	if !enqueued && job.ID == 0 {
+		return nil, false, nil
+	}
+	return job, enqueued, nil
+}
+
+// newJob builds the row of a job of kind
+func newJob[T any](kind Kind[T], payload T, options EnqueueOptions) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s job payload: %w", kind.Name, err)
+	}
+	job := &models.Job{Kind: kind.Name, Payload: data, MaxAttempts: kind.maxAttempts(), RunAt: options.RunAt}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+	if options.UniqueKey != "" {
+		job.UniqueKey = &options.UniqueKey
+	}
+	return job, nil
+}
+
+// permanentError is a failure retrying can't fix
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a handler's error as one retrying can't fix, such as an
+// invalid payload, so the job goes straight to the dead jobs
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// snoozeError asks for a job to run again later without counting the attempt
+type snoozeError struct {
+	after time.Duration
+}
+
+func (e snoozeError) Error() string { return fmt.Sprintf("snoozed for %s", e.after) }
+
+// Snooze puts a job back in the queue to run after d without using up an
+// attempt, for handlers that have to wait, e.g. for a rate limit, rather than
+// holding a worker while they do
+func Snooze(d time.Duration) error {
+	return snoozeError{after: d}
+}
+
+// Config configures a queue's workers
+type Config struct {
+	Workers      int           // jobs run at once by this process
+	PollInterval time.Duration // wait before looking again after finding no due job
+}
+
+// handler runs the jobs of a kind
+type handler struct {
+	run     func(ctx context.Context, payload json.RawMessage) error
+	timeout time.Duration
+}
+
+// schedule enqueues a job of a kind every time its spec matches
+type schedule struct {
+	name string
+	spec string
+	next func(time.Time) time.Time
+	job  func() *models.Job
+	due  time.Time // locally known next slot, the database decides which replica enqueues it
+}
+
+// Queue runs the jobs of the kinds it has handlers for
+type Queue struct {
+	database db.Database
+	log      *logger.ServiceLogger
+	config   Config
+	worker   string // locked_by of the jobs this process claims
+
+	handlers  map[string]handler
+	kinds     []string
+	schedules []*schedule
+}
+
+// NewQueue creates a queue. Handlers and schedules are added before Run.
+func NewQueue(database db.Database, log *logger.ServiceLogger, config Config) *Queue {
+	host, _ := os.Hostname()
+	return &Queue{
+		database: database,
+		log:      log,
+		config:   config,
+		worker:   host + ":" + strconv.Itoa(os.Getpid()),
+		handlers: map[string]handler{},
+	}
+}
+
+// Handle runs the jobs of kind with handle. A payload that doesn't decode fails
+// the job permanently.
+func Handle[T any](q *Queue, kind Kind[T], handle func(ctx context.Context, payload T) error) {
+	if _, ok := q.handlers[kind.Name]; !ok {
+		q.kinds = append(q.kinds, kind.Name)
+	}
+	q.handlers[kind.Name] = handler{
+		run: func(ctx context.Context, data json.RawMessage) error {
+			var payload T
+			if err := json.Unmarshal(data, &payload); err != nil {
+				return Permanent(fmt.Errorf("invalid payload: %w", err))
+			}
+			return handle(ctx, payload)
+		},
+		timeout: kind.timeout(),
+	}
+}
+
+// AddSchedule enqueues a job of kind with payload every time spec matches, see
+// Spec. The name identifies the schedule across replicas, each slot is enqueued
+// by one of them, and a slot is skipped while the previous job is still queued.
+func AddSchedule[T any](q *Queue, name, spec string, kind Kind[T], payload T) error {
+	parsed, err := ParseSpec(spec)
+	if err != nil {
+		return err
+	}
+	if parsed.Next(time.Now()).IsZero() {
+		return fmt.Errorf("invalid spec %q: it never matches", spec)
+	}
+	if _, err := json.Marshal(payload); err != nil {
+		return fmt.Errorf("failed to encode %s job payload: %w", kind.Name, err)
+	}
+	q.schedules = append(q.schedules, &schedule{
+		name: name,
+		spec: spec,
+		next: parsed.Next,
+		job: func() *models.Job {
+			job, _ := newJob(kind, payload, EnqueueOptions{UniqueKey: "schedule:" + name})
+			return job
+		},
+	})
+	return nil
+}
+
+// Run works through due jobs with the configured number of workers and
+// enqueues scheduled jobs until ctx is cancelled. It returns once the running
+// jobs have stopped; interrupted ones are retried right away by the next worker.
+func (q *Queue) Run(ctx context.Context) {
+	if len(q.kinds) == 0 || q.config.Workers <= 0 {
+		return
+	}
+	q.log.Info("Job workers started", map[string]interface{}{"workers": q.config.Workers, "kinds": q.kinds, "worker": q.worker})
+
+	var workers sync.WaitGroup
+	for range q.config.Workers {
+		workers.Go(func() {
+			q.work(ctx)
+		})
+	}
+	workers.Go(func() {
+		q.maintain(ctx)
+	})
+	workers.Wait()
+}
+
+// work claims and runs due jobs until ctx is cancelled
+func (q *Queue) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := q.database.ClaimJob(ctx, q.kinds, q.worker)
+		if err != nil && ctx.Err() == nil {
+			q.log.Warn("Claiming a job failed", map[string]interface{}{"error": err.Error()})
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(q.config.PollInterval):
+			}
+			continue
+		}
+		q.runJob(ctx, job)
+	}
+}
+
+// runJob runs one attempt of a claimed job and records how it went
+func (q *Queue) runJob(ctx context.Context, job *models.Job) {
+	log := q.log.WithFields(map[string]interface{}{"job_id": job.ID, "job_kind": job.Kind, "attempt": job.Attempts})
+	handler := q.handlers[job.Kind]
+
+	start := time.Now()
+	jobCtx, cancel := context.WithTimeout(ctx, handler.timeout)
+	jobCtx, span := tracing.StartSpan(jobCtx, "job."+job.Kind, trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.Int64("job.id", job.ID), attribute.Int("job.attempt", job.Attempts)))
+	err := runHandler(jobCtx, handler, job.Payload)
+	tracing.RecordError(span, err)
+	span.End()
+	cancel()
+
+	finishCtx, cancelFinish := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+	defer cancelFinish()
+
+	var permanent permanentError
+	var snooze snoozeError
+	switch {
+	case err == nil:
+		log.Debug("Job succeeded", map[string]interface{}{"duration_ms": time.Since(start).Milliseconds()})
+		err = q.database.CompleteJob(finishCtx, job.ID)
+	case errors.As(err, &snooze):
+		err = q.database.SnoozeJob(finishCtx, job.ID, time.Now().Add(snooze.after))
+	case ctx.Err() != nil:
+		log.Info("Job interrupted by shutdown, it will be retried")
+		now := time.Now()
+		err = q.database.FailJob(finishCtx, job.ID, "interrupted by shutdown: "+err.Error(), &now)
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		log.Error("Job failed for good, moved to the dead jobs: ", err)
+		err = q.database.FailJob(finishCtx, job.ID, err.Error(), nil)
+	default:
+		retryAt := time.Now().Add(backoff(job.Attempts))
+		log.Warn("Job failed, it will be retried", map[string]interface{}{"error": err.Error(), "retry_at": retryAt.Format(time.RFC3339)})
+		err = q.database.FailJob(finishCtx, job.ID, err.Error(), &retryAt)
+	}
+	if err != nil {
+		log.Error("Failed to record job outcome: ", err)
+	}
+}
+
+// runHandler runs a handler, turning a panic into a permanent failure
+func runHandler(ctx context.Context, handler handler, payload json.RawMessage) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = Permanent(fmt.Errorf("panic: %v\n%s", recovered, debug.Stack()))
+		}
+	}()
+	return handler.run(ctx, payload)
+}
+
+// backoff is the wait before retrying after the given number of attempts
+func backoff(attempts int) time.Duration {
+	wait := maxBackoff
+	if attempts < 32 {
+		wait = min(baseBackoff<<(attempts-1), maxBackoff)
+	}
+	return wait + rand.N(wait/5+1)
+}
+
+// maintain enqueues scheduled jobs, releases the jobs of dead workers and
+// updates the queue depth metrics until ctx is cancelled
+func (q *Queue) maintain(ctx context.Context) {
+	scheduleTicker := time.NewTicker(scheduleInterval)
+	defer scheduleTicker.Stop()
+	maintenanceTicker := time.NewTicker(maintenanceInterval)
+	defer maintenanceTicker.Stop()
+
+	q.enqueueScheduled(ctx, time.Now())
+	q.releaseStale(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-scheduleTicker.C:
+			q.enqueueScheduled(ctx, now)
+		case now := <-maintenanceTicker.C:
+			q.releaseStale(ctx, now)
+		}
+	}
+}
+
+// enqueueScheduled enqueues the scheduled jobs whose slot has passed
+func (q *Queue) enqueueScheduled(ctx context.Context, now time.Time) {
+	for _, schedule := range q.schedules {
+		if now.Before(schedule.due) {
+			continue
+		}
+		next := schedule.next(now)
+		enqueued, err := q.database.EnqueueScheduledJob(ctx, schedule.name, schedule.spec, now, next, schedule.job())
+		if err != nil {
+			if ctx.Err() == nil {
+				q.log.Warn("Enqueueing a scheduled job failed", map[string]interface{}{"schedule": schedule.name, "error": err.Error()})
+			}
+			continue
+		}
+		if enqueued {
+			q.log.Debug("Scheduled job enqueued", map[string]interface{}{"schedule": schedule.name})
+		}
+		schedule.due = next
+	}
+}
+
+// releaseStale hands back the jobs of workers that stopped and reports the
+// number of pending jobs per kind
+func (q *Queue) releaseStale(ctx context.Context, now time.Time) {
+	released, err := q.database.ReleaseStaleJobs(ctx, now.Add(-staleAfter))
+	if err != nil {
+		if ctx.Err() == nil {
+			q.log.Warn("Releasing stale jobs failed", map[string]interface{}{"error": err.Error()})
+		}
+		return
+	}
+	if released > 0 {
+		q.log.Warn("Released jobs of stopped workers", map[string]interface{}{"jobs": released})
+	}
+
+	counts, err := q.database.CountJobs(ctx)
+	if err != nil {
+		return
+	}
+	pending := map[string]int{}
+	for _, kind := range q.kinds {
+		pending[kind] = 0
+	}
+	for _, count := range counts {
+		if count.Status == models.JobPending {
+			pending[count.Kind] = int(count.Count)
+		}
+	}
+	for kind, depth := range pending {
+		metrics.SetJobQueueDepth(kind, depth)
+	}
+}
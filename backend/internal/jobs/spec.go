@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSpecYears bounds the search for the next time of a cron expression that
+// can never match, such as February 31st
+const maxSpecYears = 5
+
+// specMacros are the shorthands accepted for common cron expressions
+var specMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// Spec is when a recurring job runs: a five field cron expression (minute,
+// hour, day of month, month, day of week) evaluated in UTC, one of the @hourly
+// style macros, or "@every <duration>" for slots that are multiples of the
+// duration since the zero time
+type Spec struct {
+	every time.Duration
+
+	minutes, hours, days, months, weekdays uint64 // bit sets of the matching values
+	anyDay, anyWeekday                     bool   // the field was *, see dayMatches
+}
+
+// specField is the range of values of a cron field
+type specField struct {
+	name     string
+	min, max int
+}
+
+var specFields = []specField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // 0 and 7 are both Sunday
+}
+
+// ParseSpec parses a recurrence
+func ParseSpec(spec string) (Spec, error) {
+	spec = strings.TrimSpace(spec)
+	if expression, ok := specMacros[spec]; ok {
+		spec = expression
+	}
+
+	if duration, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil || every < time.Second {
+			return Spec{}, fmt.Errorf("invalid spec %q: @every needs a duration of at least 1s", spec)
+		}
+		return Spec{every: every}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(specFields) {
+		return Spec{}, fmt.Errorf("invalid spec %q: want 5 fields (minute hour day-of-month month day-of-week)", spec)
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseSpecField(field, specFields[i])
+		if err != nil {
+			return Spec{}, fmt.Errorf("invalid spec %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return Spec{
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weekdays:   sets[4],
+		anyDay:     fields[2] == "*",
+		anyWeekday: fields[4] == "*",
+	}, nil
+}
+
+// parseSpecField parses a comma separated list of *, values and ranges, each
+// optionally with a /step
+func parseSpecField(value string, field specField) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(value, ",") {
+		item, stepText, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("%s step %q must be a positive number", field.name, stepText)
+			}
+		}
+
+		low, high := field.min, field.max
+		if item != "*" {
+			lowText, highText, isRange := strings.Cut(item, "-")
+			var err error
+			if low, err = strconv.Atoi(lowText); err != nil {
+				return 0, fmt.Errorf("%s %q must be *, a number or a range", field.name, item)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(highText); err != nil {
+					return 0, fmt.Errorf("%s %q must be *, a number or a range", field.name, item)
+				}
+			} else if hasStep {
+				high = field.max
+			}
+			if low < field.min || high > field.max || low > high {
+				return 0, fmt.Errorf("%s %q must be within %d-%d", field.name, item, field.min, field.max)
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+// Next returns the first time the spec matches after t, or the zero time when
+// it never does
+func (s Spec) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Truncate(s.every).Add(s.every)
+	}
+
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSpecYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case s.months&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hours&(1<<t.Hour()) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minutes&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatches applies the cron rule for the two day fields: when both are
+// restricted a day matches either, otherwise it has to match the restricted one
+func (s Spec) dayMatches(t time.Time) bool {
+	day := s.days&(1<<t.Day()) != 0
+	weekday := s.weekdays&(1<<int(t.Weekday())) != 0
+	if !s.anyDay && !s.anyWeekday {
+		return day || weekday
+	}
+	return day && weekday
+}
@@ -0,0 +1,92 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr bool
+	}{
+		{spec: "* * * * *"},
+		{spec: " 0 3 * * 1-5 "},
+		{spec: "*/15 0,12 1 */3 0"},
+		{spec: "5/20 * * * 7"},
+		{spec: "@daily"},
+		{spec: "@every 90s"},
+		{spec: "", wantErr: true},
+		{spec: "* * * *", wantErr: true},
+		{spec: "* * * * * *", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "* 24 * * *", wantErr: true},
+		{spec: "* * 0 * *", wantErr: true},
+		{spec: "* * * 13 *", wantErr: true},
+		{spec: "* * * * 8", wantErr: true},
+		{spec: "5-1 * * * *", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+		{spec: "a * * * *", wantErr: true},
+		{spec: "@yearly", wantErr: true},
+		{spec: "@every 500ms", wantErr: true},
+		{spec: "@every soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			if _, err := ParseSpec(tt.spec); (err != nil) != tt.wantErr {
+				t.Errorf("ParseSpec(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSpecNext(t *testing.T) {
+	// a Wednesday
+	start := time.Date(2025, 1, 1, 10, 30, 15, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2025, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{spec: "* * * * *", from: start, want: at(1, 1, 10, 31)},
+		{spec: "* * * * *", from: at(1, 1, 10, 31), want: at(1, 1, 10, 32)},
+		{spec: "*/15 * * * *", from: start, want: at(1, 1, 10, 45)},
+		{spec: "5/20 * * * *", from: start, want: at(1, 1, 10, 45)},
+		{spec: "@hourly", from: start, want: at(1, 1, 11, 0)},
+		{spec: "@daily", from: start, want: at(1, 2, 0, 0)},
+		{spec: "0 9 * * *", from: time.Date(2024, 12, 31, 9, 0, 0, 0, time.UTC), want: at(1, 1, 9, 0)},
+		{spec: "0 3 * * 1-5", from: time.Date(2025, 1, 3, 4, 0, 0, 0, time.UTC), want: at(1, 6, 3, 0)},
+		{spec: "@weekly", from: start, want: at(1, 5, 0, 0)},
+		{spec: "0 0 * * 7", from: start, want: at(1, 5, 0, 0)},
+		{spec: "@monthly", from: start, want: at(2, 1, 0, 0)},
+		{spec: "0 0 1 */3 *", from: start, want: at(4, 1, 0, 0)},
+		{spec: "0 0 29 2 *", from: start, want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// both day fields restricted: the 15th or any Monday
+		{spec: "0 0 15 * 1", from: start, want: at(1, 6, 0, 0)},
+		{spec: "0 0 15 * 1", from: at(1, 13, 0, 0), want: at(1, 15, 0, 0)},
+		// only one restricted: the 15th, whatever weekday
+		{spec: "0 0 15 * *", from: start, want: at(1, 15, 0, 0)},
+		// evaluated in UTC
+		{spec: "0 12 * * *", from: time.Date(2025, 1, 1, 12, 30, 0, 0, time.FixedZone("EST", -5*3600)), want: at(1, 2, 12, 0)},
+		{spec: "0 0 31 2 *", from: start, want: time.Time{}},
+		{spec: "@every 1h", from: start, want: at(1, 1, 11, 0)},
+		{spec: "@every 90m", from: start, want: at(1, 1, 12, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			spec, err := ParseSpec(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSpec(%q) failed: %v", tt.spec, err)
+			}
+			if got := spec.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ServiceLogger wraps zerolog with service-specific context
@@ -14,6 +17,16 @@ type ServiceLogger struct {
 	logger zerolog.Logger
 }
 
+// fallback is the last logger built by New, used by FromContext outside of requests
+var fallback atomic.Pointer[ServiceLogger]
+
+func defaultLogger() *ServiceLogger {
+	if l := fallback.Load(); l != nil {
+		return l
+	}
+	return &ServiceLogger{logger: zerolog.Nop()}
+}
+
 // Config holds logger configuration
 type Config struct {
 	Level       string `json:"level" env:"LOG_LEVEL" envDefault:"info"`
@@ -83,9 +96,11 @@ func New(config Config) *ServiceLogger {
 		Str("service", config.ServiceName).
 		Logger()
 
-	return &ServiceLogger{
+	serviceLogger := &ServiceLogger{
 		logger: logger,
 	}
+	fallback.Store(serviceLogger)
+	return serviceLogger
 }
 
 // WithContext adds additional context to the logger
@@ -95,6 +110,21 @@ func (s *ServiceLogger) WithContext(key, value string) *ServiceLogger {
 	}
 }
 
+// WithTrace adds the trace and span IDs of the active span in ctx, if any,
+// so log lines can be correlated with traces
+func (s *ServiceLogger) WithTrace(ctx context.Context) *ServiceLogger {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.IsValid() {
+		return s
+	}
+	return &ServiceLogger{
+		logger: s.logger.With().
+			Str("trace_id", spanCtx.TraceID().String()).
+			Str("span_id", spanCtx.SpanID().String()).
+			Logger(),
+	}
+}
+
 // WithFields adds multiple fields to the logger
 func (s *ServiceLogger) WithFields(fields map[string]interface{}) *ServiceLogger {
 	event := s.logger.With()
@@ -0,0 +1,154 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestIDHeader is read from incoming requests and echoed back to clients
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen caps client supplied request IDs so they can't bloat log lines
+const maxRequestIDLen = 64
+
+type contextKey struct{}
+
+// requestState is shared by everything handling one request. It is mutable so
+// handlers deeper in the chain (e.g. after auth) can enrich the access log line.
+type requestState struct {
+	mu        sync.Mutex
+	log       *ServiceLogger
+	requestID string
+	userID    string
+}
+
+// quietPaths are polled constantly by probes and scrapers and logged at debug level
+var quietPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// RequestMiddleware attaches a request scoped logger carrying the request ID (and
+// trace IDs when tracing is enabled) to the request context, returns the ID in
+// the X-Request-ID header and writes one structured access log line per request.
+func RequestMiddleware(base *ServiceLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(RequestIDHeader)
+			if !validRequestID(requestID) {
+				requestID = newRequestID()
+			}
+			w.Header().Set(RequestIDHeader, requestID)
+
+			state := &requestState{
+				log:       base.WithTrace(r.Context()).WithContext("request_id", requestID),
+				requestID: requestID,
+			}
+			ctx := context.WithValue(r.Context(), contextKey{}, state)
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			route := ""
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				route = rctx.RoutePattern()
+			}
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			state.mu.Lock()
+			log := state.log
+			state.mu.Unlock()
+
+			fields := map[string]interface{}{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"route":       route,
+				"status":      status,
+				"bytes":       ww.BytesWritten(),
+				"latency_ms":  float64(time.Since(start).Microseconds()) / 1000,
+				"remote_addr": r.RemoteAddr,
+				"user_agent":  r.UserAgent(),
+			}
+
+			switch {
+			case status >= http.StatusInternalServerError:
+				log.Error("request completed", nil, fields)
+			case quietPaths[r.URL.Path]:
+				log.Debug("request completed", fields)
+			default:
+				log.Info("request completed", fields)
+			}
+		})
+	}
+}
+
+// FromContext returns the request scoped logger stored by RequestMiddleware,
+// or the most recently created service logger outside of a request.
+func FromContext(ctx context.Context) *ServiceLogger {
+	if state, ok := ctx.Value(contextKey{}).(*requestState); ok {
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		return state.log
+	}
+	return defaultLogger()
+}
+
+// SetUserID records the authenticated user on the request logger so it shows up
+// on every later log line for the request, including the access log line.
+func SetUserID(ctx context.Context, userID string) {
+	state, ok := ctx.Value(contextKey{}).(*requestState)
+	if !ok {
+		return
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.userID == userID {
+		return
+	}
+	state.userID = userID
+	state.log = state.log.WithContext("user_id", userID)
+}
+
+// RequestID returns the ID of the request in ctx, or an empty string
+func RequestID(ctx context.Context) string {
+	if state, ok := ctx.Value(contextKey{}).(*requestState); ok {
+		return state.requestID
+	}
+	return ""
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID accepts client supplied IDs made of safe characters only
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/tracing"
+)
+
+// httpProviderTimeout bounds one call to the email API
+const httpProviderTimeout = 30 * time.Second
+
+// maxHTTPErrorBytes is how much of an error response is kept in the job's error
+const maxHTTPErrorBytes = 512
+
+// HTTPProvider posts messages to an email API as JSON, the Message fields with
+// the API key as a bearer token. Most providers' APIs take this shape directly or
+// through a small relay.
+type HTTPProvider struct {
+	URL    string
+	APIKey string
+	Client *http.Client // nil uses a client with a 30 second timeout
+}
+
+func (p *HTTPProvider) Name() string { return "http" }
+
+// Send posts a message. 4xx responses other than 408 and 429 mean the API
+// refused it for good; anything else is retried.
+func (p *HTTPProvider) Send(ctx context.Context, message *Message) error {
+	if err := message.validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build email api request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+	tracing.InjectHeaders(ctx, req.Header)
+
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: httpProviderTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("email api request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, maxHTTPErrorBytes))
+	err = fmt.Errorf("email api responded %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	return err
+}
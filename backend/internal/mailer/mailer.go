@@ -0,0 +1,187 @@
+// Package mailer sends email through a pluggable provider: SMTP, an HTTP email
+// API or a local outbox of .eml files. Emails are queued as jobs and delivered
+// by the job workers no faster than the provider's rate limit. Every delivery
+// checks the suppression list first, and emails about a signup carry its
+// unsubscribe link, in the body and as List-Unsubscribe headers.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"net/mail"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/jobs"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/ratelimit"
+	"github.com/anish-chanda/openwaitlist/backend/internal/tracing"
+	"github.com/anish-chanda/openwaitlist/backend/internal/unsubscribe"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrRejected is wrapped by provider errors that retrying won't fix, such as an
+// address the provider refuses
+var ErrRejected = errors.New("rejected by the email provider")
+
+// Provider delivers messages
+type Provider interface {
+	Name() string // keys the provider's rate limit
+	Send(ctx context.Context, message *Message) error
+}
+
+// Email is an email to queue. Emails that aren't transactional are about a
+// signup, whose preferences decide whether it is sent and whose unsubscribe
+// link it carries.
+type Email struct {
+	Kind       string `json:"kind"` // unsubscribe.Transactional, Updates or Marketing
+	To         string `json:"to"`
+	Subject    string `json:"subject"`
+	Text       string `json:"text"`
+	HTML       string `json:"html,omitempty"`
+	WaitlistID int64  `json:"waitlist_id,omitempty"`
+	SignupID   int64  `json:"signup_id,omitempty"`
+}
+
+// SendJob delivers a queued email
+var SendJob = jobs.Kind[Email]{Name: "email.send", MaxAttempts: 8}
+
+// Config configures a mailer
+type Config struct {
+	From      string            // sender of every email, may include a display name
+	RateLimit ratelimit.Limit   // emails per window across replicas with a shared store, zero is unlimited
+	Links     unsubscribe.Links // unsubscribe links of emails about a signup
+}
+
+// Mailer queues and delivers emails
+type Mailer struct {
+	database db.Database
+	provider Provider
+	limiter  ratelimit.Store
+	config   Config
+}
+
+// New creates a mailer delivering through provider. The rate limit is kept in
+// limiter, so it is shared by the replicas when the store is.
+func New(database db.Database, provider Provider, limiter ratelimit.Store, config Config) *Mailer {
+	return &Mailer{database: database, provider: provider, limiter: limiter, config: config}
+}
+
+// Register adds the job handler delivering queued emails
+func (m *Mailer) Register(queue *jobs.Queue) {
+	jobs.Handle(queue, SendJob, m.deliver)
+}
+
+// Send queues an email
+func (m *Mailer) Send(ctx context.Context, email Email) error {
+	switch email.Kind {
+	case unsubscribe.Transactional:
+	case unsubscribe.Updates, unsubscribe.Marketing:
+		if email.SignupID == 0 {
+			return fmt.Errorf("%s emails need the signup they are about", email.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown email kind %q", email.Kind)
+	}
+	if _, err := mail.ParseAddress(email.To); err != nil {
+		return fmt.Errorf("invalid email address %q: %w", email.To, err)
+	}
+
+	_, _, err := jobs.Enqueue(ctx, m.database, SendJob, email, jobs.EnqueueOptions{})
+	return err
+}
+
+// deliver sends a queued email unless its address is suppressed or its signup
+// unsubscribed or was erased
+func (m *Mailer) deliver(ctx context.Context, email Email) error {
+	log := logger.FromContext(ctx)
+
+	var signup *models.WaitlistSignup
+	if email.SignupID != 0 {
+		var err error
+		signup, err = m.database.GetWaitlistSignup(ctx, email.WaitlistID, email.SignupID)
+		if err != nil && err.Error() != "signup not found" {
+			return err
+		}
+	}
+	allowed, err := unsubscribe.Allowed(ctx, m.database, email.To, signup, email.Kind)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		log.Debug("Email not sent, the address is suppressed or unsubscribed", map[string]interface{}{"kind": email.Kind, "signup_id": email.SignupID})
+		return nil
+	}
+
+	message := &Message{From: m.config.From, To: email.To, Subject: email.Subject, Text: email.Text, HTML: email.HTML}
+	if signup != nil {
+		if err := m.addUnsubscribe(message, signup); err != nil {
+			return err
+		}
+	}
+
+	if err := m.throttle(ctx); err != nil {
+		return err
+	}
+	if err := m.send(ctx, message); err != nil {
+		if errors.Is(err, ErrRejected) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+	log.Debug("Email sent", map[string]interface{}{"kind": email.Kind, "provider": m.provider.Name(), "signup_id": email.SignupID})
+	return nil
+}
+
+// send hands a message to the provider in a client span
+func (m *Mailer) send(ctx context.Context, message *Message) error {
+	ctx, span := tracing.StartSpan(ctx, "mail.Send", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("mail.provider", m.provider.Name())))
+	defer span.End()
+
+	err := m.provider.Send(ctx, message)
+	tracing.RecordError(span, err)
+	return err
+}
+
+// addUnsubscribe adds a signup's unsubscribe link to the headers and body of a message
+func (m *Mailer) addUnsubscribe(message *Message, signup *models.WaitlistSignup) error {
+	now := time.Now()
+	subscriber := unsubscribe.Subscriber{SignupID: signup.ID, Email: signup.Email}
+	headers, err := m.config.Links.Headers(subscriber, now)
+	if err != nil {
+		return err
+	}
+	link, err := m.config.Links.URL(subscriber, now)
+	if err != nil {
+		return err
+	}
+
+	message.Headers = headers
+	message.Text += "\n\n--\nUnsubscribe or change your email preferences: " + link + "\n"
+	if message.HTML != "" {
+		message.HTML += `<p style="font-size:12px;color:#6b7280"><a href="` + html.EscapeString(link) + `">Unsubscribe or change your email preferences</a></p>`
+	}
+	return nil
+}
+
+// throttle takes a slot of the provider's rate limit. When there is none the
+// job is snoozed until there will be, so a backlog of emails doesn't hold every
+// worker while other kinds of jobs wait.
+func (m *Mailer) throttle(ctx context.Context) error {
+	if !m.config.RateLimit.Enabled() {
+		return nil
+	}
+	result, err := m.limiter.Take(ctx, "mailer:"+m.provider.Name(), m.config.RateLimit)
+	if err != nil {
+		return err
+	}
+	if !result.Allowed {
+		return jobs.Snooze(result.RetryAfter)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Message is an email ready for a provider
+type Message struct {
+	From    string            `json:"from"` // may include a display name
+	To      string            `json:"to"`
+	Subject string            `json:"subject"`
+	Text    string            `json:"text"`
+	HTML    string            `json:"html,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"` // extra headers, such as List-Unsubscribe
+}
+
+// validate checks the addresses and that no header can smuggle in another one
+func (m *Message) validate() error {
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return fmt.Errorf("invalid from address %q: %w", m.From, err)
+	}
+	if _, err := mail.ParseAddress(m.To); err != nil {
+		return fmt.Errorf("invalid to address %q: %w", m.To, err)
+	}
+	if strings.ContainsAny(m.Subject, "\r\n") {
+		return fmt.Errorf("subject must be a single line")
+	}
+	for name, value := range m.Headers {
+		if name == "" || strings.ContainsAny(name, ": \r\n") || strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid header %q", name)
+		}
+	}
+	return nil
+}
+
+// addresses parses the from and to addresses, whose Address is the bare one
+// for the SMTP envelope
+func (m *Message) addresses() (from, to *mail.Address, err error) {
+	if from, err = mail.ParseAddress(m.From); err != nil {
+		return nil, nil, err
+	}
+	if to, err = mail.ParseAddress(m.To); err != nil {
+		return nil, nil, err
+	}
+	return from, to, nil
+}
+
+// Build encodes the message as an RFC 5322 email, with a text and an HTML
+// alternative when it has HTML
+func (m *Message) Build(now time.Time) ([]byte, error) {
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	from, to, err := m.addresses()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeHeader := func(name, value string) {
+		buf.WriteString(name + ": " + value + "\r\n")
+	}
+	writeHeader("From", from.String())
+	writeHeader("To", to.String())
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	writeHeader("Date", now.Format(time.RFC1123Z))
+	writeHeader("Message-ID", newMessageID(from.Address))
+	writeHeader("MIME-Version", "1.0")
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		writeHeader(textproto.CanonicalMIMEHeaderKey(name), m.Headers[name])
+	}
+
+	if m.HTML == "" {
+		writeHeader("Content-Type", "text/plain; charset=utf-8")
+		writeHeader("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, m.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	writeHeader("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(writer, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable writes content with CRLF line endings, quoted-printable encoded
+func writeQuotedPrintable(w io.Writer, content string) error {
+	content = strings.ReplaceAll(strings.ReplaceAll(content, "\r\n", "\n"), "\n", "\r\n")
+	encoder := quotedprintable.NewWriter(w)
+	if _, err := encoder.Write([]byte(content)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// newMessageID returns a unique Message-ID on the domain of the from address
+func newMessageID(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return "<" + hex.EncodeToString(id) + "@" + domain + ">"
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// outboxName matches the names of the files the outbox writes
+var outboxName = regexp.MustCompile(`^\d{8}T\d{6}\.\d{9}Z-[a-f0-9]{8}\.eml$`)
+
+// Outbox writes messages as .eml files to a directory instead of sending them,
+// so the email flow can be tried out without a mail server
+type Outbox struct {
+	Dir string
+}
+
+// OutboxEmail describes a message in the outbox
+type OutboxEmail struct {
+	Name    string    `json:"name"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject"`
+	Size    int64     `json:"size"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+func (o *Outbox) Name() string { return "outbox" }
+
+// Send writes a message to the outbox
+func (o *Outbox) Send(ctx context.Context, message *Message) error {
+	now := time.Now().UTC()
+	data, err := message.Build(now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	if err := os.MkdirAll(o.Dir, 0o750); err != nil {
+		return fmt.Errorf("failed to create outbox: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := now.Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix) + ".eml"
+	temp := filepath.Join(o.Dir, "."+name+".tmp")
+	if err := os.WriteFile(temp, data, 0o640); err != nil {
+		return fmt.Errorf("failed to write outbox email: %w", err)
+	}
+	if err := os.Rename(temp, filepath.Join(o.Dir, name)); err != nil {
+		os.Remove(temp)
+		return fmt.Errorf("failed to write outbox email: %w", err)
+	}
+	return nil
+}
+
+// List returns the messages in the outbox, newest first
+func (o *Outbox) List() ([]OutboxEmail, error) {
+	entries, err := os.ReadDir(o.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []OutboxEmail{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	emails := []OutboxEmail{}
+	for _, entry := range entries {
+		if !outboxName.MatchString(entry.Name()) {
+			continue
+		}
+		data, err := o.Read(entry.Name())
+		if err != nil {
+			continue
+		}
+		email := OutboxEmail{Name: entry.Name(), Size: int64(len(data))}
+		if message, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+			decoder := new(mime.WordDecoder)
+			email.From = message.Header.Get("From")
+			email.To = message.Header.Get("To")
+			email.Subject, err = decoder.DecodeHeader(message.Header.Get("Subject"))
+			if err != nil {
+				email.Subject = message.Header.Get("Subject")
+			}
+			email.SavedAt, _ = message.Header.Date()
+		}
+		emails = append(emails, email)
+	}
+	slices.Reverse(emails)
+	return emails, nil
+}
+
+// Read returns a message in the outbox by name, or fs.ErrNotExist
+func (o *Outbox) Read(name string) ([]byte, error) {
+	if !outboxName.MatchString(name) {
+		return nil, fs.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(o.Dir, name))
+}
@@ -0,0 +1,111 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// SMTP transport security modes
+const (
+	SMTPStartTLS = "starttls" // plain connection upgraded with STARTTLS, which is required
+	SMTPTLS      = "tls"      // implicit TLS, usually port 465
+	SMTPNone     = "none"     // no encryption, for local relays only
+)
+
+// smtpDialTimeout bounds connecting to the SMTP server
+const smtpDialTimeout = 30 * time.Second
+
+// SMTPProvider sends through an SMTP server, authenticating with PLAIN when a
+// username is set
+type SMTPProvider struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Security string // SMTPStartTLS, SMTPTLS or SMTPNone
+}
+
+func (p *SMTPProvider) Name() string { return "smtp" }
+
+// Send delivers a message in one SMTP session
+func (p *SMTPProvider) Send(ctx context.Context, message *Message) error {
+	data, err := message.Build(time.Now())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+	from, to, err := message.addresses()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+
+	addr := net.JoinHostPort(p.Host, strconv.Itoa(p.Port))
+	tlsConfig := &tls.Config{ServerName: p.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+	var conn net.Conn
+	if p.Security == SMTPTLS {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, p.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start smtp session: %w", err)
+	}
+	defer client.Close()
+
+	if p.Security == SMTPStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %s doesn't support STARTTLS", p.Host)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("smtp STARTTLS failed: %w", err)
+		}
+	}
+	if p.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", p.Username, p.Password, p.Host)); err != nil {
+			return fmt.Errorf("smtp authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return smtpError("MAIL FROM", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return smtpError("RCPT TO", err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return smtpError("DATA", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		return smtpError("DATA", err)
+	}
+	if err := writer.Close(); err != nil {
+		return smtpError("DATA", err)
+	}
+	return client.Quit()
+}
+
+// smtpError wraps a failed SMTP command, marking permanent (5xx) replies as rejected
+func smtpError(command string, err error) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) && reply.Code >= 500 {
+		return fmt.Errorf("%w: smtp %s: %v", ErrRejected, command, err)
+	}
+	return fmt.Errorf("smtp %s failed: %w", command, err)
+}
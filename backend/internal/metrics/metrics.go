@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "openwaitlist"
+
+var (
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total number of HTTP requests by method, chi route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and chi route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by operation.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation"})
+
+	userSignupsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "user_signups_total",
+		Help:      "Total number of dashboard user accounts created.",
+	})
+
+	// not labelled by waitlist, slugs of private waitlists would leak and the
+	// number of series would grow with every waitlist
+	waitlistSignupsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "waitlist_signups_total",
+		Help:      "Total number of signups across all waitlists.",
+	})
+
+	jobQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_queue_depth",
+		Help:      "Number of background jobs waiting to run per queue.",
+	}, []string{"queue"})
+)
+
+// Handler returns the http handler serving metrics in the prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Middleware records request counts and latencies labelled by chi route pattern.
+// The pattern is read after the request is served since chi fills it while routing.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			if pattern := rctx.RoutePattern(); pattern != "" {
+				route = pattern
+			}
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		httpRequestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		httpRequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ObserveDBQuery records the latency of a database operation that started at start.
+// Meant to be deferred: defer metrics.ObserveDBQuery("GetUserByEmail", time.Now())
+func ObserveDBQuery(operation string, start time.Time) {
+	dbQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// IncUserSignups counts a newly created dashboard user
+func IncUserSignups() {
+	userSignupsTotal.Inc()
+}
+
+// IncWaitlistSignups counts a new waitlist signup
+func IncWaitlistSignups() {
+	waitlistSignupsTotal.Inc()
+}
+
+// SetJobQueueDepth reports the number of pending jobs in a background queue
+func SetJobQueueDepth(queue string, depth int) {
+	jobQueueDepth.WithLabelValues(queue).Set(float64(depth))
+}
@@ -1,6 +1,15 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/attribution"
+	"github.com/anish-chanda/openwaitlist/backend/internal/branding"
+	"github.com/anish-chanda/openwaitlist/backend/internal/consent"
+	"github.com/anish-chanda/openwaitlist/backend/internal/formfields"
+	"github.com/anish-chanda/openwaitlist/backend/internal/widget"
+)
 
 type AuthProvider string
 
@@ -15,12 +24,363 @@ type User struct {
 }
 
 type Waitlist struct {
-	ID                 int64     `json:"id" db:"id"`
-	Slug               string    `json:"slug" db:"slug"`
-	Name               string    `json:"name" db:"name"`
-	OwnerUserID        int64     `json:"owner_user_id" db:"owner_user_id"`
-	IsPublic           bool      `json:"is_public" db:"is_public"`
-	ShowVendorBranding bool      `json:"show_vendor_branding" db:"show_vendor_branding"`
-	CreatedAt          time.Time `json:"created_at" db:"created_at"`
+	ID                 int64      `json:"id" db:"id"`
+	Slug               string     `json:"slug" db:"slug"`
+	Name               string     `json:"name" db:"name"`
+	OwnerUserID        int64      `json:"owner_user_id" db:"owner_user_id"`
+	IsPublic           bool       `json:"is_public" db:"is_public"`
+	ShowVendorBranding bool       `json:"show_vendor_branding" db:"show_vendor_branding"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
 	ArchivedAt         *time.Time `json:"archived_at,omitempty" db:"archived_at"`
+	Description        string     `json:"description" db:"description"` // markdown, shown on the hosted page
+
+	// Bot protection for the public signup form
+	BotHoneypot         bool `json:"bot_honeypot" db:"bot_honeypot"`
+	BotMinSubmitSeconds int  `json:"bot_min_submit_seconds" db:"bot_min_submit_seconds"` // 0 disables the timing check
+	BotPowDifficulty    int  `json:"bot_pow_difficulty" db:"bot_pow_difficulty"`         // leading zero bits, 0 disables
+	BotCaptcha          bool `json:"bot_captcha" db:"bot_captcha"`
+
+	// Email rules for the public signup form
+	EmailGmailAliases    bool     `json:"email_gmail_aliases" db:"email_gmail_aliases"` // Gmail dots and +tags count as the same address
+	EmailBlockDisposable bool     `json:"email_block_disposable" db:"email_block_disposable"`
+	EmailCheckMX         bool     `json:"email_check_mx" db:"email_check_mx"`
+	EmailAllowDomains    []string `json:"email_allow_domains" db:"email_allow_domains"` // empty allows every domain
+	EmailDenyDomains     []string `json:"email_deny_domains" db:"email_deny_domains"`
+
+	// Custom questions on the signup form
+	FormFields formfields.Schema `json:"form_fields" db:"form_fields"`
+
+	// Embeddable widget
+	EmbedAllowedOrigins []string     `json:"embed_allowed_origins" db:"embed_allowed_origins"` // empty allows every origin
+	WidgetTheme         widget.Theme `json:"widget_theme" db:"widget_theme"`
+
+	// Branding and content of the public pages
+	Logo           *string         `json:"logo,omitempty" db:"logo"` // file name in the logo store
+	BrandColors    branding.Colors `json:"brand_colors" db:"brand_colors"`
+	SuccessMessage string          `json:"success_message" db:"success_message"` // empty uses the default
+	RedirectURL    string          `json:"redirect_url" db:"redirect_url"`       // where to send people after they join
+	ShareText      string          `json:"share_text" db:"share_text"`           // prefilled when sharing a referral link
+
+	// Signup window and capacity
+	OpensAt      *time.Time   `json:"opens_at,omitempty" db:"opens_at"`
+	ClosesAt     *time.Time   `json:"closes_at,omitempty" db:"closes_at"`
+	MaxSignups   *int         `json:"max_signups,omitempty" db:"max_signups"` // counts every signup that isn't queued
+	OverflowMode OverflowMode `json:"overflow_mode" db:"overflow_mode"`
+
+	// Privacy
+	CaptureAttribution bool             `json:"capture_attribution" db:"capture_attribution"` // store UTM, referrer, landing page and device per signup
+	Consent            consent.Settings `json:"consent" db:"consent"`                         // terms and marketing checkboxes on the form
+
+	// Invites
+	InviteCallbackURL string `json:"invite_callback_url" db:"invite_callback_url"` // where redeemed invites are sent with an access token
+}
+
+// OverflowMode is what happens to signups outside a waitlist's window or past its capacity
+type OverflowMode string
+
+const (
+	OverflowReject OverflowMode = "reject"
+	OverflowQueue  OverflowMode = "queue" // stored as queued signups for the owner to admit
+)
+
+// WaitlistEvent is something that happened to a waitlist, such as it opening
+type WaitlistEvent struct {
+	ID         int64                  `json:"id" db:"id"`
+	WaitlistID int64                  `json:"waitlist_id" db:"waitlist_id"`
+	Type       string                 `json:"type" db:"type"`
+	DedupKey   string                 `json:"-" db:"dedup_key"` // an event with the same key fires once per waitlist
+	Data       map[string]interface{} `json:"data" db:"data"`
+	CreatedAt  time.Time              `json:"created_at" db:"created_at"`
+}
+
+// SubscriberData is everything held about one email address across waitlists
+type SubscriberData struct {
+	Signups []*SubscriberSignup `json:"signups"`
+	Events  []*WaitlistEvent    `json:"events"` // event payloads about their signups
+}
+
+// SubscriberSignup is a signup with the waitlist it belongs to
+type SubscriberSignup struct {
+	WaitlistSlug string `json:"waitlist_slug"`
+	WaitlistName string `json:"waitlist_name"`
+	*WaitlistSignup
+}
+
+// Data request kinds
+const (
+	DataRequestLink    = "link" // a signed link was emailed
+	DataRequestExport  = "export"
+	DataRequestErasure = "erasure"
+)
+
+// Erasure modes
+const (
+	ErasureDelete    = "delete"    // signups are deleted
+	ErasureAnonymize = "anonymize" // signups keep their place and status, everything personal is cleared
+)
+
+// DataRequest is an entry in the audit trail of data subject requests. It never
+// holds the email, only a keyed hash of it.
+type DataRequest struct {
+	ID          int64     `json:"id" db:"id"`
+	Kind        string    `json:"kind" db:"kind"`
+	SubjectHash []byte    `json:"-" db:"subject_hash"`
+	Mode        *string   `json:"mode,omitempty" db:"mode"`
+	Signups     int       `json:"signups" db:"signups"`
+	WaitlistIDs []int64   `json:"waitlist_ids" db:"waitlist_ids"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// Email suppression reasons, later ones outrank earlier ones
+const (
+	SuppressionUnsubscribed = "unsubscribed" // opted out of every email
+	SuppressionBounced      = "bounced"      // hard bounce reported by the email provider
+	SuppressionComplained   = "complained"   // marked as spam
+)
+
+// EmailSuppression is an address no email is sent to
+type EmailSuppression struct {
+	Email     string    `json:"email" db:"email"`
+	Reason    string    `json:"reason" db:"reason"`
+	Detail    string    `json:"detail,omitempty" db:"detail"` // e.g. the provider's bounce message
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// SignupStatus is where a signup is in the invite process
+type SignupStatus string
+
+const (
+	SignupStatusQueued   SignupStatus = "queued" // taken while the waitlist was closed or full
+	SignupStatusWaiting  SignupStatus = "waiting"
+	SignupStatusInvited  SignupStatus = "invited"
+	SignupStatusAccepted SignupStatus = "accepted"
+)
+
+// WaitlistSignup is a person who joined a waitlist through its public form
+type WaitlistSignup struct {
+	ID              int64                   `json:"id" db:"id"`
+	WaitlistID      int64                   `json:"waitlist_id" db:"waitlist_id"`
+	Email           string                  `json:"email" db:"email"`
+	EmailNormalized string                  `json:"-" db:"email_normalized"` // dedup key, see emailcheck.Normalize
+	Name            *string                 `json:"name,omitempty" db:"name"`
+	Answers         map[string]interface{}  `json:"answers" db:"answers"` // custom form field answers by field key
+	Status          SignupStatus            `json:"status" db:"status"`
+	VerifiedAt      *time.Time              `json:"verified_at,omitempty" db:"verified_at"`
+	InvitedAt       *time.Time              `json:"invited_at,omitempty" db:"invited_at"`
+	ReferredBy      *int64                  `json:"referred_by,omitempty" db:"referred_by"`         // signup ID of the referrer
+	ReferralCode    string                  `json:"referral_code" db:"referral_code"`               // identifies the signup's referral link
+	Attribution     attribution.Attribution `json:"attribution"`                                    // stored as utm_*, referrer, landing_url and device
+	Consent         consent.Record          `json:"consent"`                                        // stored as terms_version, marketing_*, consent_at and consent_ip
+	UnsubscribedAt  *time.Time              `json:"unsubscribed_at,omitempty" db:"unsubscribed_at"` // stopped the waitlist's updates
+	Tags            []string                `json:"tags" db:"tags"`
+	Notes           *string                 `json:"notes,omitempty" db:"notes"` // owner's private notes
+	CreatedAt       time.Time               `json:"created_at" db:"created_at"`
+	Position        int64                   `json:"position" db:"-"`       // 1-based place in the queue, computed
+	ReferralCount   int64                   `json:"referral_count" db:"-"` // computed
+}
+
+// SignupFilter narrows down and pages a waitlist's signups. Zero values don't filter.
+type SignupFilter struct {
+	Search        string // full-text search on email, name and answers
+	Status        SignupStatus
+	Verified      *bool
+	Invited       *bool
+	MinReferrals  *int
+	MaxReferrals  *int
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+	Tag           string
+	Answers       map[string]interface{} // only signups whose answers contain every key/value pair
+	Sort          string                 // one of SignupSorts, position by default
+	Limit         int                    // 0 returns every match
+	Offset        int
+}
+
+// SignupSorts are the orders signups can be listed in
+var SignupSorts = []string{"position", "-position", "created_at", "-created_at", "referrals", "-referrals"}
+
+// Stats bucket sizes
+const (
+	StatsIntervalHour = "hour"
+	StatsIntervalDay  = "day"
+)
+
+// StatsQuery selects the signups a waitlist's stats cover and how they are bucketed
+type StatsQuery struct {
+	From       time.Time      // inclusive
+	To         time.Time      // exclusive
+	Interval   string         // StatsIntervalHour or StatsIntervalDay
+	Location   *time.Location // buckets start on the hour or at midnight in this zone
+	UseRollups bool           // read finished hours from the rollup table
+	Limit      int            // length of the referrer list and breakdowns
+}
+
+// WaitlistStats summarizes the signups of a waitlist over a StatsQuery's range
+type WaitlistStats struct {
+	Series    []StatsBucket   `json:"series"`
+	Funnel    SignupFunnel    `json:"funnel"`
+	Views     ViewStats       `json:"views"`
+	Referrers []ReferrerStats `json:"referrers"`
+
+	// Attribution breakdowns, most signups first
+	Sources   []BreakdownStats `json:"sources"` // utm_source, then referral, then referring site
+	Mediums   []BreakdownStats `json:"mediums"`
+	Campaigns []BreakdownStats `json:"campaigns"`
+	Devices   []BreakdownStats `json:"devices"`
+}
+
+// StatsBucket counts the signups in one hour or day, empty buckets included
+type StatsBucket struct {
+	Start   time.Time `json:"start"`
+	Signups int64     `json:"signups"`
+}
+
+// SignupFunnel counts the signups in range that reached each step
+type SignupFunnel struct {
+	Signups  int64 `json:"signups"`
+	Queued   int64 `json:"queued"`
+	Verified int64 `json:"verified"`
+	Invited  int64 `json:"invited"` // invited at some point, accepted signups included
+	Accepted int64 `json:"accepted"`
+}
+
+// ViewStats counts the views of a waitlist's public page and widgets. Views are
+// kept per UTC day, so they cover every UTC day the range touches.
+type ViewStats struct {
+	Views    int64        `json:"views"`
+	Visitors int64        `json:"visitors"` // summed per day, a visitor returning the next day counts again
+	Daily    []DailyViews `json:"daily"`
+}
+
+// DailyViews counts the views of one UTC day
+type DailyViews struct {
+	Day      string `json:"day"` // 2006-01-02
+	Views    int64  `json:"views"`
+	Visitors int64  `json:"visitors"`
+}
+
+// ReferrerStats is a signup on the referral leaderboard
+type ReferrerStats struct {
+	SignupID     int64   `json:"signup_id"`
+	Email        string  `json:"email"`
+	Name         *string `json:"name,omitempty"`
+	ReferralCode string  `json:"referral_code"`
+	Referrals    int64   `json:"referrals"` // signups in range they referred
+}
+
+// BreakdownStats counts the signups in range with one value of an attribution field
+type BreakdownStats struct {
+	Value   string `json:"value"`
+	Signups int64  `json:"signups"`
+}
+
+// LoginAttempt is one call to the local login endpoint, kept for auditing lockouts
+type LoginAttempt struct {
+	ID          int64     `db:"id"`
+	Email       string    `db:"email"`
+	UserID      *int64    `db:"user_id"` // nullable when no user has the email
+	IP          string    `db:"ip"`
+	Succeeded   bool      `db:"succeeded"`
+	Blocked     bool      `db:"blocked"` // rejected because the account was locked
+	AttemptedAt time.Time `db:"attempted_at"`
+}
+
+// WaitlistTransfer is a waitlist offered to another account. Ownership only
+// moves when the recipient accepts.
+type WaitlistTransfer struct {
+	ID           int64     `json:"id" db:"id"`
+	WaitlistID   int64     `json:"waitlist_id" db:"waitlist_id"`
+	WaitlistSlug string    `json:"waitlist_slug" db:"slug"`
+	WaitlistName string    `json:"waitlist_name" db:"name"`
+	FromUserID   int64     `json:"from_user_id" db:"from_user_id"`
+	FromEmail    string    `json:"from_email" db:"from_email"` // so the recipient knows who is offering it
+	ToUserID     int64     `json:"to_user_id" db:"to_user_id"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// AccountData is everything held about a dashboard user, for their account export
+type AccountData struct {
+	User          *User
+	Waitlists     []*Waitlist // every waitlist they own, archived ones included
+	LoginAttempts []*LoginAttempt
+}
+
+// AccountLockout tracks failed logins per email, whether or not a user exists for
+// it, so locked and unknown accounts look the same from the outside
+type AccountLockout struct {
+	Email        string     `db:"email"`
+	FailedCount  int        `db:"failed_count"`  // failures since the last lock or success
+	LockoutCount int        `db:"lockout_count"` // consecutive locks, drives the backoff
+	LockedUntil  *time.Time `db:"locked_until"`
+	UpdatedAt    time.Time  `db:"updated_at"`
+}
+
+// IsLocked reports whether the account is locked at now
+func (l *AccountLockout) IsLocked(now time.Time) bool {
+	return l.LockedUntil != nil && l.LockedUntil.After(now)
+}
+
+// JobStatus is where a background job is in its life. Succeeded jobs are deleted.
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending" // waiting for run_at, including retries
+	JobRunning JobStatus = "running" // claimed by a worker
+	JobDead    JobStatus = "dead"    // out of attempts or failed permanently, kept for inspection
+)
+
+// Job is a unit of background work run by the job queue
+type Job struct {
+	ID          int64           `json:"id" db:"id"`
+	Kind        string          `json:"kind" db:"kind"` // picks the handler
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	Status      JobStatus       `json:"status" db:"status"`
+	Attempts    int             `json:"attempts" db:"attempts"` // runs started so far
+	MaxAttempts int             `json:"max_attempts" db:"max_attempts"`
+	RunAt       time.Time       `json:"run_at" db:"run_at"`                   // not run before then
+	UniqueKey   *string         `json:"unique_key,omitempty" db:"unique_key"` // dedups pending and running jobs of the kind
+	LockedBy    *string         `json:"locked_by,omitempty" db:"locked_by"`   // worker running it
+	LockedAt    *time.Time      `json:"locked_at,omitempty" db:"locked_at"`
+	LastError   *string         `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at" db:"updated_at"`
+}
+
+// JobFilter narrows down and pages jobs. Zero values don't filter.
+type JobFilter struct {
+	Status JobStatus
+	Kind   string
+	Limit  int // 0 returns every match
+	Offset int
+}
+
+// JobCount is the number of jobs of a kind with a status
+type JobCount struct {
+	Kind   string    `json:"kind"`
+	Status JobStatus `json:"status"`
+	Count  int64     `json:"count"`
+}
+
+// InviteCode lets people into the product. Codes for a signup accept it when
+// redeemed, shared codes have no signup. The code itself is only known when
+// it's created.
+type InviteCode struct {
+	ID         int64      `json:"id" db:"id"`
+	WaitlistID int64      `json:"waitlist_id" db:"waitlist_id"`
+	SignupID   *int64     `json:"signup_id,omitempty" db:"signup_id"`
+	CodeHash   []byte     `json:"-" db:"code_hash"`
+	CodeHint   string     `json:"code_hint" db:"code_hint"`         // last characters of the code
+	MaxUses    *int       `json:"max_uses,omitempty" db:"max_uses"` // nil is unlimited
+	Uses       int        `json:"uses" db:"uses"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// InviteCodeFilter narrows down and pages a waitlist's invite codes
+type InviteCodeFilter struct {
+	SignupID *int64
+	Limit    int // 0 returns every code
+	Offset   int
 }
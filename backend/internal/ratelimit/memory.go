@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	expiresAt time.Time
+}
+
+// MemoryStore keeps buckets in process memory. It is only correct for a single
+// replica; use the postgres store when running several.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), updatedAt: now}
+		s.buckets[key] = b
+	}
+
+	// refill for the time passed since the last take, capped at the burst size
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	b.tokens = min(float64(limit.Requests), b.tokens+elapsed*limit.refillPerSecond())
+	b.updatedAt = now
+	b.expiresAt = now.Add(limit.Window)
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return resultFromTokens(limit, allowed, b.tokens), nil
+}
+
+func (s *MemoryStore) Cleanup(ctx context.Context) error {
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if now.After(b.expiresAt) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// fakeClock is a MemoryStore clock moved by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestStore() (*MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	store.now = clock.Now
+	return store, clock
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	limit := Limit{Requests: 3, Window: 3 * time.Second} // one token back per second
+	steps := []struct {
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{wantAllowed: true, wantRemaining: 2},
+		{wantAllowed: true, wantRemaining: 1},
+		{wantAllowed: true, wantRemaining: 0},
+		{wantAllowed: false, wantRetry: time.Second},
+		{advance: 500 * time.Millisecond, wantAllowed: false, wantRetry: 500 * time.Millisecond},
+		{advance: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+		// a long pause refills no more than the burst
+		{advance: time.Hour, wantAllowed: true, wantRemaining: 2},
+	}
+
+	store, clock := newTestStore()
+	for i, step := range steps {
+		clock.now = clock.now.Add(step.advance)
+		result, err := store.Take(context.Background(), "key", limit)
+		if err != nil {
+			t.Fatalf("step %d: Take failed: %v", i, err)
+		}
+		if result.Allowed != step.wantAllowed || result.Remaining != step.wantRemaining {
+			t.Errorf("step %d: got allowed %v remaining %d, want %v and %d",
+				i, result.Allowed, result.Remaining, step.wantAllowed, step.wantRemaining)
+		}
+		if diff := result.RetryAfter - step.wantRetry; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("step %d: RetryAfter = %s, want %s", i, result.RetryAfter, step.wantRetry)
+		}
+	}
+}
+
+func TestMemoryStoreKeysAreSeparate(t *testing.T) {
+	limit := Limit{Requests: 1, Window: time.Minute}
+	store, _ := newTestStore()
+
+	for _, key := range []string{"a", "b"} {
+		if result, _ := store.Take(context.Background(), key, limit); !result.Allowed {
+			t.Errorf("first take of %q was refused", key)
+		}
+	}
+	if result, _ := store.Take(context.Background(), "a", limit); result.Allowed {
+		t.Error("second take of \"a\" was allowed")
+	}
+}
+
+func TestMemoryStoreCleanup(t *testing.T) {
+	limit := Limit{Requests: 1, Window: time.Minute}
+	store, clock := newTestStore()
+
+	store.Take(context.Background(), "old", limit)
+	clock.now = clock.now.Add(45 * time.Second)
+	store.Take(context.Background(), "recent", limit)
+	clock.now = clock.now.Add(30 * time.Second)
+
+	if err := store.Cleanup(context.Background()); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if _, ok := store.buckets["old"]; ok {
+		t.Error("bucket idle for longer than its window was kept")
+	}
+	if _, ok := store.buckets["recent"]; !ok {
+		t.Error("bucket still refilling was dropped")
+	}
+}
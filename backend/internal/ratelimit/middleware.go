@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+)
+
+// KeyFunc extracts the identity a bucket is kept for. An empty key skips the
+// limit, which is only right when the handler rejects such requests anyway; a
+// key that can't be read is an error and rejects the request.
+type KeyFunc func(r *http.Request) (string, error)
+
+// Rule is one bucket dimension of a policy, e.g. per IP or per account
+type Rule struct {
+	Name  string
+	Limit Limit
+	Key   KeyFunc
+}
+
+// Policy is a named set of rules applied to a route group. A request must pass
+// every rule; the first exhausted bucket rejects it.
+type Policy struct {
+	Name  string
+	Rules []Rule
+}
+
+// Middleware enforces policy using store and answers 429 with Retry-After when a
+// bucket is empty. Store errors fail open so an outage doesn't lock everyone out.
+func Middleware(store Store, policy Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, rule := range policy.Rules {
+				if !rule.Limit.Enabled() {
+					continue
+				}
+				key, err := rule.Key(r)
+				if err != nil {
+					logger.FromContext(r.Context()).Warn("Rate limit key unreadable, rejecting request", map[string]interface{}{
+						"policy": policy.Name,
+						"rule":   rule.Name,
+						"error":  err.Error(),
+					})
+					http.Error(w, "Invalid request", utils.RequestFieldStatus(err))
+					return
+				}
+				if key == "" {
+					continue
+				}
+
+				result, err := store.Take(r.Context(), policy.Name+":"+rule.Name+":"+key, rule.Limit)
+				if err != nil {
+					logger.FromContext(r.Context()).Warn("Rate limit store failed, allowing request", map[string]interface{}{
+						"policy": policy.Name,
+						"rule":   rule.Name,
+						"error":  err.Error(),
+					})
+					continue
+				}
+
+				if !result.Allowed {
+					retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+					if retryAfter < 1 {
+						retryAfter = 1
+					}
+					logger.FromContext(r.Context()).Warn("Rate limit exceeded", map[string]interface{}{
+						"policy":      policy.Name,
+						"rule":        rule.Name,
+						"retry_after": retryAfter,
+					})
+					w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+					http.Error(w, "Too many requests", http.StatusTooManyRequests)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ByIP keys buckets on the client IP. Put chi's RealIP middleware in front when
+// running behind a trusted proxy so RemoteAddr holds the real client address.
+func ByIP(r *http.Request) (string, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr, nil
+	}
+	return host, nil
+}
+
+// ByField keys buckets on an account identifier sent by the client, read from
+// the body the way the handlers read it (see utils.RequestField). Oversized
+// bodies and query strings naming another account are rejected rather than
+// skipped. The value is normalised and hashed so stored keys don't contain emails.
+func ByField(names ...string) KeyFunc {
+	return func(r *http.Request) (string, error) {
+		value, err := utils.RequestField(r, names...)
+		if err != nil || strings.TrimSpace(value) == "" {
+			return "", err
+		}
+		sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(value))))
+		return hex.EncodeToString(sum[:16]), nil
+	}
+}
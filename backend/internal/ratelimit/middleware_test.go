@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	policy := Policy{
+		Name:  "test",
+		Rules: []Rule{{Name: "account", Limit: Limit{Requests: 1, Window: time.Minute}, Key: ByField("email")}},
+	}
+	handler := Middleware(NewMemoryStore(), policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name        string
+		target      string
+		body        string
+		contentType string
+		want        int
+	}{
+		{name: "first request", body: `{"email":"a@example.com"}`, want: http.StatusNoContent},
+		{name: "same account", body: `{"email":"A@Example.com "}`, want: http.StatusTooManyRequests},
+		{name: "same account in a form", body: "email=a%40example.com", contentType: "application/x-www-form-urlencoded", want: http.StatusTooManyRequests},
+		{name: "same account as text", body: `{"email":"a@example.com"}`, contentType: "text/plain", want: http.StatusTooManyRequests},
+		{name: "other account", body: `{"email":"b@example.com"}`, want: http.StatusNoContent},
+		{name: "query naming another account", target: "/?email=c@example.com", body: `{"email":"a@example.com"}`, want: http.StatusBadRequest},
+		{name: "query naming the same account", target: "/?email=a@example.com", body: `{"email":"a@example.com"}`, want: http.StatusTooManyRequests},
+		{name: "keys differing in case", body: `{"email":"d@example.com","EMAIL":"a@example.com"}`, want: http.StatusBadRequest},
+		{name: "trailing data", body: `{"email":"a@example.com"} {"email":"e@example.com"}`, want: http.StatusTooManyRequests},
+		{name: "oversized body", body: `{"email":"a@example.com","pad":"` + strings.Repeat("x", 70*1024) + `"}`, want: http.StatusRequestEntityTooLarge},
+		{name: "no account", body: `{}`, want: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/"
+			}
+			req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.want)
+			}
+			if rec.Code == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+				t.Error("429 without a Retry-After header")
+			}
+		})
+	}
+}
+
+func TestMiddlewareSkipsDisabledLimits(t *testing.T) {
+	policy := Policy{Name: "test", Rules: []Rule{{Name: "ip", Limit: Limit{}, Key: ByIP}}}
+	handler := Middleware(NewMemoryStore(), policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i := 0; i < 5; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d with the limit off", i, rec.Code)
+		}
+	}
+}
+
+func TestByIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		want       string
+	}{
+		{remoteAddr: "192.0.2.1:1234", want: "192.0.2.1"},
+		{remoteAddr: "[2001:db8::1]:443", want: "2001:db8::1"},
+		{remoteAddr: "192.0.2.1", want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if got, err := ByIP(req); got != tt.want || err != nil {
+			t.Errorf("ByIP(%q) = %q, %v, want %q", tt.remoteAddr, got, err, tt.want)
+		}
+	}
+}
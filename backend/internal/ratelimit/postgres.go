@@ -0,0 +1,30 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every replica
+// shares the same view of a client
+type PostgresStore struct {
+	database db.Database
+}
+
+func NewPostgresStore(database db.Database) *PostgresStore {
+	return &PostgresStore{database: database}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	allowed, tokens, err := s.database.TakeRateLimitToken(ctx, key, limit.Requests, limit.Window)
+	if err != nil {
+		return Result{}, err
+	}
+	return resultFromTokens(limit, allowed, tokens), nil
+}
+
+func (s *PostgresStore) Cleanup(ctx context.Context) error {
+	return s.database.DeleteExpiredRateLimits(ctx, time.Now())
+}
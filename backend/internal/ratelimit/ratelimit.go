@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+)
+
+// Limit is a token bucket allowing Requests per Window with bursts up to Requests
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// Enabled reports whether the limit should be enforced, a zero limit disables it
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Window > 0
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// MarshalText lets limits be printed in config dumps in the same form they are parsed from
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText parses limits from config files
+func (l *Limit) UnmarshalText(text []byte) error {
+	parsed, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = parsed
+	return nil
+}
+
+// ParseLimit parses "<requests>/<window>" such as "10/1m" or "100/1h". "off" or
+// an empty string disables the limit.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "off" || value == "0" {
+		return Limit{}, nil
+	}
+	requests, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<window> like 10/1m", value)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, requests must be a positive integer", value)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q, window must be a positive duration like 30s or 1m", value)
+	}
+	return Limit{Requests: n, Window: d}, nil
+}
+
+// refillPerSecond is how many tokens flow back into the bucket each second
+func (l Limit) refillPerSecond() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// resultFromTokens builds a Result from the tokens left in a bucket after a take
+func resultFromTokens(limit Limit, allowed bool, tokens float64) Result {
+	result := Result{Allowed: allowed, Remaining: int(math.Max(0, math.Floor(tokens)))}
+	if !allowed {
+		missing := 1 - tokens
+		result.RetryAfter = time.Duration(missing / limit.refillPerSecond() * float64(time.Second))
+	}
+	return result
+}
+
+// Store keeps token buckets. Take must be atomic per key so concurrent requests,
+// including ones served by other replicas for shared stores, can't overspend.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// Cleanup drops buckets that have fully refilled and carry no state worth keeping
+	Cleanup(ctx context.Context) error
+}
+
+// RunCleanup periodically removes idle buckets from store until ctx is cancelled
+func RunCleanup(ctx context.Context, store Store, interval time.Duration, log *logger.ServiceLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := store.Cleanup(ctx); err != nil && ctx.Err() == nil {
+				log.Warn("Rate limit cleanup failed", map[string]interface{}{"error": err.Error()})
+			}
+		}
+	}
+}
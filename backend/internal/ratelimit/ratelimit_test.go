@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "10/1m", want: Limit{Requests: 10, Window: time.Minute}},
+		{value: " 100/1h ", want: Limit{Requests: 100, Window: time.Hour}},
+		{value: "5/30s", want: Limit{Requests: 5, Window: 30 * time.Second}},
+		{value: "", want: Limit{}},
+		{value: "off", want: Limit{}},
+		{value: "0", want: Limit{}},
+		{value: "10", wantErr: true},
+		{value: "ten/1m", wantErr: true},
+		{value: "0/1m", wantErr: true},
+		{value: "-1/1m", wantErr: true},
+		{value: "10/minute", wantErr: true},
+		{value: "10/0s", wantErr: true},
+		{value: "10/-1m", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseLimit(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLimit(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseLimit(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitText(t *testing.T) {
+	tests := []struct {
+		limit Limit
+		want  string
+	}{
+		{limit: Limit{Requests: 10, Window: time.Minute}, want: "10/1m0s"},
+		{limit: Limit{}, want: "off"},
+		{limit: Limit{Requests: 10}, want: "off"},
+	}
+
+	for _, tt := range tests {
+		text, err := tt.limit.MarshalText()
+		if err != nil || string(text) != tt.want {
+			t.Errorf("%+v.MarshalText() = %q, %v, want %q", tt.limit, text, err, tt.want)
+			continue
+		}
+		var parsed Limit
+		if err := parsed.UnmarshalText(text); err != nil || parsed.Enabled() != tt.limit.Enabled() ||
+			(parsed.Enabled() && parsed != tt.limit) {
+			t.Errorf("UnmarshalText(%q) = %+v, %v, want %+v", text, parsed, err, tt.limit)
+		}
+	}
+}
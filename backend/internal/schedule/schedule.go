@@ -0,0 +1,174 @@
+// Package schedule decides whether a waitlist takes signups and fires events
+// when its signup window opens or closes and when it fills up
+package schedule
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/events"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+)
+
+// State is whether a waitlist takes signups
+type State string
+
+const (
+	Scheduled State = "scheduled" // before opens_at
+	Open      State = "open"
+	Closed    State = "closed" // after closes_at
+	Full      State = "full"   // max_signups reached
+)
+
+// WindowState returns where now falls in a waitlist's signup window, capacity
+// is left to the caller since it needs a count
+func WindowState(waitlist *models.Waitlist, now time.Time) State {
+	if waitlist.ClosesAt != nil && !now.Before(*waitlist.ClosesAt) {
+		return Closed
+	}
+	if waitlist.OpensAt != nil && now.Before(*waitlist.OpensAt) {
+		return Scheduled
+	}
+	return Open
+}
+
+// Scheduler fires the lifecycle events of waitlists with a window or capacity
+type Scheduler struct {
+	database  db.Database
+	publisher events.Publisher
+	log       *logger.ServiceLogger
+}
+
+// NewScheduler creates a scheduler publishing to publisher
+func NewScheduler(database db.Database, publisher events.Publisher, log *logger.ServiceLogger) *Scheduler {
+	return &Scheduler{database: database, publisher: publisher, log: log}
+}
+
+// Run checks right away, so events that came due while the process was down
+// fire without waiting for the first tick, then every interval until ctx is
+// cancelled
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.runCheck(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runCheck(ctx, now)
+		}
+	}
+}
+
+// runCheck runs Check and logs its failure
+func (s *Scheduler) runCheck(ctx context.Context, now time.Time) {
+	if err := s.Check(ctx, now); err != nil && ctx.Err() == nil {
+		s.log.Warn("Waitlist schedule check failed", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// Check fires the events that are due at now. Each event is recorded before
+// it is published, so replicas running the same check don't fire it twice. A
+// waitlist that fails is logged and retried on the next check without holding
+// up the others.
+func (s *Scheduler) Check(ctx context.Context, now time.Time) error {
+	waitlists, err := s.database.ListScheduledWaitlists(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, waitlist := range waitlists {
+		if err := s.checkWaitlist(ctx, waitlist, now); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.log.Warn("Waitlist schedule check failed", map[string]interface{}{
+				"waitlist": waitlist.Slug,
+				"error":    err.Error(),
+			})
+		}
+	}
+	return nil
+}
+
+// checkWaitlist fires the events of one waitlist that are due at now
+func (s *Scheduler) checkWaitlist(ctx context.Context, waitlist *models.Waitlist, now time.Time) error {
+	if waitlist.OpensAt != nil && !now.Before(*waitlist.OpensAt) {
+		opensAt := waitlist.OpensAt.UTC()
+		if _, err := s.fire(ctx, waitlist, events.WaitlistOpened, "opened:"+opensAt.Format(time.RFC3339),
+			map[string]interface{}{"opens_at": opensAt.Format(time.RFC3339)}); err != nil {
+			return err
+		}
+		// admitting is a no-op once the early signups are in, so it runs on
+		// every check rather than only when the event fires, and a failed
+		// admission is retried next time
+		if waitlist.OverflowMode == models.OverflowQueue && WindowState(waitlist, now) == Open {
+			if err := s.admitEarlySignups(ctx, waitlist); err != nil {
+				return err
+			}
+		}
+	}
+
+	if waitlist.ClosesAt != nil && !now.Before(*waitlist.ClosesAt) {
+		closesAt := waitlist.ClosesAt.UTC()
+		if _, err := s.fire(ctx, waitlist, events.WaitlistClosed, "closed:"+closesAt.Format(time.RFC3339),
+			map[string]interface{}{"closes_at": closesAt.Format(time.RFC3339)}); err != nil {
+			return err
+		}
+	}
+
+	if waitlist.MaxSignups != nil {
+		count, err := s.database.CountAdmittedSignups(ctx, waitlist.ID)
+		if err != nil {
+			return err
+		}
+		if count >= int64(*waitlist.MaxSignups) {
+			if _, err := s.fire(ctx, waitlist, events.WaitlistFull, "full:"+strconv.Itoa(*waitlist.MaxSignups),
+				map[string]interface{}{"max_signups": *waitlist.MaxSignups}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// admitEarlySignups lets the signups queued before a waitlist opened in, as far
+// as its capacity allows
+func (s *Scheduler) admitEarlySignups(ctx context.Context, waitlist *models.Waitlist) error {
+	admitted, err := s.database.AdmitQueuedSignups(ctx, waitlist.ID, *waitlist.OpensAt)
+	if err != nil {
+		return err
+	}
+	if admitted > 0 {
+		s.log.Info("Admitted signups queued before the waitlist opened", map[string]interface{}{
+			"waitlist": waitlist.Slug,
+			"admitted": admitted,
+		})
+	}
+	return nil
+}
+
+// fire records an event and publishes it, reporting false when it had already fired
+func (s *Scheduler) fire(ctx context.Context, waitlist *models.Waitlist, eventType, dedupKey string, data map[string]interface{}) (bool, error) {
+	event := &models.WaitlistEvent{
+		WaitlistID: waitlist.ID,
+		Type:       eventType,
+		DedupKey:   dedupKey,
+		Data:       data,
+	}
+	recorded, err := s.database.RecordWaitlistEvent(ctx, event)
+	if err != nil || !recorded {
+		return false, err
+	}
+
+	if err := s.publisher.Publish(ctx, waitlist, event); err != nil {
+		// the event stays recorded, publishers are expected to retry on their own
+		s.log.Error("Failed to publish waitlist event: ", err)
+	}
+	return true, nil
+}
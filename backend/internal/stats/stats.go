@@ -0,0 +1,38 @@
+// Package stats keeps the hourly signup rollups the waitlist stats read from
+package stats
+
+import (
+	"context"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/jobs"
+)
+
+// RollupLookback is how far before the last refresh the rollups are recounted,
+// so hours whose signups were deleted since are corrected
+const RollupLookback = 24 * time.Hour
+
+// RollupJob refreshes the signup rollups
+var RollupJob = jobs.Kind[struct{}]{Name: "stats.rollup", MaxAttempts: 3}
+
+// ScheduleRollups refreshes the signup rollups from the job queue every
+// interval, once per interval across replicas
+func ScheduleRollups(queue *jobs.Queue, database db.Database, interval time.Duration) error {
+	jobs.Handle(queue, RollupJob, func(ctx context.Context, _ struct{}) error {
+		return database.RefreshSignupRollups(ctx, time.Now(), RollupLookback)
+	})
+	return jobs.AddSchedule(queue, RollupJob.Name, "@every "+interval.String(), RollupJob, struct{}{})
+}
+
+// WholeHourOffsets reports whether loc is a whole number of hours from UTC at
+// both from and to. Only then do the UTC hours of the rollups line up with the
+// zone's hours and days.
+func WholeHourOffsets(loc *time.Location, from, to time.Time) bool {
+	for _, t := range []time.Time{from, to} {
+		if _, offset := t.In(loc).Zone(); offset%3600 != 0 {
+			return false
+		}
+	}
+	return true
+}
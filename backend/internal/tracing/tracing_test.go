@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// recordSpans installs a tracer provider keeping every ended span in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		exporter string
+		wantErr  bool
+	}{
+		{exporter: "", wantErr: false},
+		{exporter: "none", wantErr: false},
+		{exporter: "stdout", wantErr: false},
+		{exporter: "STDOUT", wantErr: false},
+		{exporter: "zipkin", wantErr: true},
+	}
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	for _, tt := range tests {
+		t.Run(tt.exporter, func(t *testing.T) {
+			shutdown, err := Setup(context.Background(), Config{
+				Exporter:    tt.exporter,
+				SampleRatio: 1,
+				ServiceName: "test",
+				Environment: "test",
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup(%q) error = %v, want error %v", tt.exporter, err, tt.wantErr)
+			}
+			if err == nil {
+				if err := shutdown(context.Background()); err != nil {
+					t.Errorf("shutdown failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordError(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, ok := StartSpan(context.Background(), "ok")
+	RecordError(ok, nil)
+	ok.End()
+	_, failed := StartSpan(context.Background(), "failed")
+	RecordError(failed, errors.New("boom"))
+	failed.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if got := spans[0].Status().Code; got != codes.Unset {
+		t.Errorf("span without error has status %v, want unset", got)
+	}
+	if got := spans[1].Status(); got.Code != codes.Error || got.Description != "boom" {
+		t.Errorf("span with error has status %v, want error boom", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		status     int
+		wantName   string
+		wantStatus codes.Code
+	}{
+		{name: "route pattern", path: "/waitlists/abc", status: http.StatusOK, wantName: "GET /waitlists/{slug}", wantStatus: codes.Unset},
+		{name: "client error", path: "/waitlists/xyz", status: http.StatusNotFound, wantName: "GET /waitlists/{slug}", wantStatus: codes.Unset},
+		{name: "server error", path: "/waitlists/abc", status: http.StatusInternalServerError, wantName: "GET /waitlists/{slug}", wantStatus: codes.Error},
+		{name: "unmatched", path: "/nothing", status: http.StatusNotFound, wantName: "GET", wantStatus: codes.Unset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			router := chi.NewRouter()
+			router.Use(Middleware)
+			router.Get("/waitlists/{slug}", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			})
+
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.wantName {
+				t.Errorf("span name = %q, want %q", span.Name(), tt.wantName)
+			}
+			if span.Status().Code != tt.wantStatus {
+				t.Errorf("span status = %v, want %v", span.Status().Code, tt.wantStatus)
+			}
+			var status int64
+			for _, attr := range span.Attributes() {
+				if attr.Key == semconv.HTTPResponseStatusCodeKey {
+					status = attr.Value.AsInt64()
+				}
+			}
+			if status != int64(tt.status) {
+				t.Errorf("status code attribute = %d, want %d", status, tt.status)
+			}
+		})
+	}
+}
+
+func TestInjectHeaders(t *testing.T) {
+	recordSpans(t)
+	if _, err := Setup(context.Background(), Config{Exporter: "none"}); err != nil {
+		t.Fatalf("Setup failed: %v", err)
+	}
+
+	header := http.Header{}
+	InjectHeaders(context.Background(), header)
+	if got := header.Get("traceparent"); got != "" {
+		t.Errorf("traceparent without a span = %q, want none", got)
+	}
+
+	ctx, span := StartSpan(context.Background(), "outbound")
+	defer span.End()
+	InjectHeaders(ctx, header)
+	traceID := span.SpanContext().TraceID().String()
+	if got := header.Get("traceparent"); len(got) != 55 || got[3:35] != traceID {
+		t.Errorf("traceparent = %q, want one carrying trace %s", got, traceID)
+	}
+}
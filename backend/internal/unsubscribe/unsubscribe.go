@@ -0,0 +1,112 @@
+// Package unsubscribe signs the unsubscribe links put in every email sent to
+// subscribers and decides whether an address may be emailed at all. A link
+// identifies one signup, so opening it manages that waitlist's emails, and the
+// preference page it leads to covers every waitlist the address is on.
+package unsubscribe
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/models"
+	"github.com/anish-chanda/openwaitlist/backend/internal/utils"
+)
+
+// tokenPurpose binds unsubscribe links so they can't be used as other signed links
+const tokenPurpose = "unsubscribe"
+
+// LinkTTL is how long an unsubscribe link works. Old emails are read for a long
+// time, so it's long enough that nobody meets an expired one in practice.
+const LinkTTL = 5 * 365 * 24 * time.Hour
+
+// OneClickBody is the form body mail clients POST to the List-Unsubscribe URL
+// for one-click unsubscribes (RFC 8058)
+const OneClickBody = "List-Unsubscribe=One-Click"
+
+// Email kinds, which decide what an unsubscribe stops
+const (
+	Transactional = "transactional" // requested by the subscriber, e.g. a data request link
+	Updates       = "updates"       // about the waitlist they joined, e.g. their invite
+	Marketing     = "marketing"     // needs their marketing opt-in
+)
+
+// Subscriber is who an unsubscribe link was issued for
+type Subscriber struct {
+	SignupID int64
+	Email    string
+}
+
+// Links signs and verifies unsubscribe links
+type Links struct {
+	BaseURL string // public URL the links point at
+	Secret  []byte
+}
+
+// URL returns the unsubscribe link for a signup. Opening it shows the preference
+// page, and POSTing to it unsubscribes in one click.
+func (l Links) URL(subscriber Subscriber, now time.Time) (string, error) {
+	claims := map[string]string{
+		"signup_id": strconv.FormatInt(subscriber.SignupID, 10),
+		"email":     strings.ToLower(subscriber.Email),
+	}
+	token, err := utils.SignToken(l.Secret, tokenPurpose, claims, now.Add(LinkTTL))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign unsubscribe link: %w", err)
+	}
+	return strings.TrimRight(l.BaseURL, "/") + "/unsubscribe?token=" + url.QueryEscape(token), nil
+}
+
+// Headers returns the List-Unsubscribe and List-Unsubscribe-Post headers for an
+// email to a signup
+func (l Links) Headers(subscriber Subscriber, now time.Time) (map[string]string, error) {
+	link, err := l.URL(subscriber, now)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"List-Unsubscribe":      "<" + link + ">",
+		"List-Unsubscribe-Post": OneClickBody,
+	}, nil
+}
+
+// Verify returns who an unsubscribe link's token was issued for
+func (l Links) Verify(token string, now time.Time) (Subscriber, error) {
+	claims, err := utils.VerifyToken(l.Secret, tokenPurpose, token, now)
+	if err != nil {
+		return Subscriber{}, err
+	}
+	signupID, err := strconv.ParseInt(claims["signup_id"], 10, 64)
+	if err != nil || claims["email"] == "" {
+		return Subscriber{}, fmt.Errorf("malformed unsubscribe token")
+	}
+	return Subscriber{SignupID: signupID, Email: claims["email"]}, nil
+}
+
+// Allowed reports whether an email of the given kind may be sent to email.
+// Bounced and complained addresses get nothing; an address that unsubscribed
+// from everything still gets the transactional emails it asks for. signup is
+// the signup the email is about and may be nil for transactional emails.
+func Allowed(ctx context.Context, database db.Database, email string, signup *models.WaitlistSignup, kind string) (bool, error) {
+	suppression, err := database.GetEmailSuppression(ctx, email)
+	if err != nil && err.Error() != "suppression not found" {
+		return false, err
+	}
+	if suppression != nil && (suppression.Reason != models.SuppressionUnsubscribed || kind != Transactional) {
+		return false, nil
+	}
+
+	switch kind {
+	case Transactional:
+		return true, nil
+	case Updates:
+		return signup != nil && signup.UnsubscribedAt == nil, nil
+	case Marketing:
+		return signup != nil && signup.UnsubscribedAt == nil && signup.Consent.Marketing, nil
+	}
+	return false, fmt.Errorf("unknown email kind %q", kind)
+}
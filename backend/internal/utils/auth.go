@@ -1,12 +1,14 @@
 package utils
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
 	"strings"
 
+	"github.com/anish-chanda/openwaitlist/backend/internal/tracing"
 	"golang.org/x/crypto/argon2"
 )
 
@@ -19,7 +21,11 @@ const (
 	argonKeyLen  = 32
 )
 
-func HashPassword(password string) (string, error) {
+// HashPassword hashes password with argon2id, traced since it dominates signup latency
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.StartSpan(ctx, "utils.HashPassword")
+	defer span.End()
+
 	salt := make([]byte, argonSaltLen)
 	if _, err := rand.Read(salt); err != nil {
 		return "", err
@@ -44,7 +50,11 @@ func HashPassword(password string) (string, error) {
 	return "$" + strings.Join(parts, "$"), nil
 }
 
-func VerifyPassword(password, encoded string) (bool, error) {
+// VerifyPassword checks password against an encoded argon2id hash in constant time
+func VerifyPassword(ctx context.Context, password, encoded string) (bool, error) {
+	_, span := tracing.StartSpan(ctx, "utils.VerifyPassword")
+	defer span.End()
+
 	// encoded: $argon2id$v=19$m=...,t=...,p=...$<salt>$<hash>
 	fields := strings.Split(encoded, "$")
 	if len(fields) != 6 || fields[1] != "argon2id" {
@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxPeekBody bounds how much of a request body is buffered by RequestField
+const maxPeekBody = 64 * 1024
+
+// RequestField errors
+var (
+	ErrBodyTooLarge  = errors.New("request body too large")
+	ErrFieldConflict = errors.New("request fields conflict")
+)
+
+// RequestField returns the first of names sent with a request, read where the
+// handlers read it: a form body, a JSON body (whatever the content type, the
+// JSON handlers don't check it), and the query string when the body doesn't
+// have it. A value sent in both the query string and the body has to match, so a
+// limit keyed on it can't be pointed at a different account than the one the
+// handler checks. The body is buffered and restored so handlers can still read it.
+//
+// ErrBodyTooLarge is returned for bodies over 64 KiB and ErrFieldConflict for
+// ambiguous requests; a missing field is an empty value without an error.
+func RequestField(r *http.Request, names ...string) (string, error) {
+	fromQuery := firstValue(r.URL.Query(), names)
+
+	fromBody, err := bodyField(r, names)
+	if err != nil {
+		return "", err
+	}
+	if fromBody == "" {
+		return fromQuery, nil
+	}
+	if fromQuery != "" && !strings.EqualFold(strings.TrimSpace(fromQuery), strings.TrimSpace(fromBody)) {
+		return "", ErrFieldConflict
+	}
+	return fromBody, nil
+}
+
+// RequestFieldStatus is the status to answer a RequestField error with
+func RequestFieldStatus(err error) int {
+	if errors.Is(err, ErrBodyTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// bodyField looks names up in a JSON or form body
+func bodyField(r *http.Request, names []string) (string, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return "", nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody+1))
+	r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+	if err != nil {
+		return "", err
+	}
+	if len(body) > maxPeekBody {
+		return "", ErrBodyTooLarge
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return "", nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "", nil
+		}
+		return firstValue(form, names), nil
+	default:
+		// the JSON handlers don't check the content type, so any other body is
+		// read as JSON. Decoding into a struct matches keys case-insensitively, so
+		// a body with both "user" and "USER" could be read differently by the handler.
+		// a decoder like the handlers', which ignore anything after the first value
+		var fields map[string]json.RawMessage
+		if err := json.NewDecoder(bytes.NewReader(body)).Decode(&fields); err != nil {
+			return "", nil
+		}
+		for _, name := range names {
+			var value string
+			matches := 0
+			for key, raw := range fields {
+				if !strings.EqualFold(key, name) {
+					continue
+				}
+				matches++
+				if err := json.Unmarshal(raw, &value); err != nil {
+					value = ""
+				}
+			}
+			if matches > 1 {
+				return "", ErrFieldConflict
+			}
+			if value != "" {
+				return value, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// firstValue returns the value of the first of names present in values
+func firstValue(values url.Values, names []string) string {
+	for _, name := range names {
+		if value := values.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
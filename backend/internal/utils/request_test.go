@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestField(t *testing.T) {
+	form := "application/x-www-form-urlencoded"
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		contentType string
+		want        string
+		wantErr     error
+	}{
+		{name: "json body", body: `{"user":"a@example.com","passwd":"x"}`, contentType: "application/json", want: "a@example.com"},
+		{name: "json without content type", body: `{"user":"a@example.com"}`, want: "a@example.com"},
+		{name: "json key in other case", body: `{"USER":"a@example.com"}`, want: "a@example.com"},
+		{name: "form body", body: "user=a%40example.com&passwd=x", contentType: form, want: "a@example.com"},
+		{name: "query only", method: http.MethodGet, target: "/?user=a@example.com", want: "a@example.com"},
+		{name: "query with body lacking the field", target: "/?user=a@example.com", body: `{"passwd":"x"}`, want: "a@example.com"},
+		{name: "query matching body", target: "/?user=A@example.com", body: `{"user":"a@example.com"}`, want: "a@example.com"},
+		{name: "query naming another account", target: "/?user=decoy@example.com", body: `{"user":"a@example.com"}`, wantErr: ErrFieldConflict},
+		{name: "form and query disagree", target: "/?user=decoy@example.com", body: "user=a%40example.com", contentType: form, wantErr: ErrFieldConflict},
+		{name: "keys differing in case", body: `{"user":"decoy@example.com","User":"a@example.com"}`, wantErr: ErrFieldConflict},
+		{name: "oversized body", body: `{"user":"a@example.com","pad":"` + strings.Repeat("x", maxPeekBody) + `"}`, wantErr: ErrBodyTooLarge},
+		{name: "not a string", body: `{"user":42}`, want: ""},
+		{name: "invalid json", body: `{"user":`, want: ""},
+		{name: "empty body", body: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, target := tt.method, tt.target
+			if method == "" {
+				method = http.MethodPost
+			}
+			if target == "" {
+				target = "/"
+			}
+			req := httptest.NewRequest(method, target, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			got, err := RequestField(req, "user")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RequestField error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RequestField = %q, want %q", got, tt.want)
+			}
+
+			// the handler still gets the whole body
+			rest, _ := io.ReadAll(req.Body)
+			if string(rest) != tt.body {
+				t.Errorf("body after RequestField has %d bytes, want %d", len(rest), len(tt.body))
+			}
+		})
+	}
+}
+
+func TestRequestFieldStatus(t *testing.T) {
+	if got := RequestFieldStatus(ErrBodyTooLarge); got != http.StatusRequestEntityTooLarge {
+		t.Errorf("RequestFieldStatus(ErrBodyTooLarge) = %d, want 413", got)
+	}
+	if got := RequestFieldStatus(ErrFieldConflict); got != http.StatusBadRequest {
+		t.Errorf("RequestFieldStatus(ErrFieldConflict) = %d, want 400", got)
+	}
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignToken(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	claims := map[string]string{"email": "a@example.com", "signup_id": "42"}
+
+	token, err := SignToken(secret, "unsubscribe", claims, now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("SignToken failed: %v", err)
+	}
+	tampered := []byte(token)
+	tampered[0] ^= 1
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		purpose string
+		token   string
+		now     time.Time
+		wantErr string
+	}{
+		{name: "valid", secret: secret, purpose: "unsubscribe", token: token, now: now},
+		{name: "valid until expiry", secret: secret, purpose: "unsubscribe", token: token, now: now.Add(time.Hour)},
+		{name: "expired", secret: secret, purpose: "unsubscribe", token: token, now: now.Add(time.Hour + time.Second), wantErr: "token expired"},
+		{name: "other purpose", secret: secret, purpose: "account-unlock", token: token, now: now, wantErr: "not valid for account-unlock"},
+		{name: "other secret", secret: []byte("other-secret"), purpose: "unsubscribe", token: token, now: now, wantErr: "invalid token signature"},
+		{name: "tampered payload", secret: secret, purpose: "unsubscribe", token: string(tampered), now: now, wantErr: "invalid token signature"},
+		{name: "no signature", secret: secret, purpose: "unsubscribe", token: strings.Split(token, ".")[0], now: now, wantErr: "malformed token"},
+		{name: "empty", secret: secret, purpose: "unsubscribe", token: "", now: now, wantErr: "malformed token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyToken(tt.secret, tt.purpose, tt.token, tt.now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("VerifyToken error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyToken failed: %v", err)
+			}
+			if !maps.Equal(got, claims) {
+				t.Errorf("VerifyToken claims = %v, want %v", got, claims)
+			}
+		})
+	}
+}
+
+func TestSignTokenWithoutClaims(t *testing.T) {
+	secret := []byte("test-secret")
+	now := time.Now()
+
+	token, err := SignToken(secret, "joined", nil, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("SignToken failed: %v", err)
+	}
+	claims, err := VerifyToken(secret, "joined", token, now)
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %v", err)
+	}
+	if claims == nil || len(claims) != 0 {
+		t.Errorf("VerifyToken claims = %#v, want an empty map", claims)
+	}
+	if strings.ContainsAny(token, "+/= ") {
+		t.Errorf("token %q isn't URL safe", token)
+	}
+}
@@ -23,13 +23,13 @@ func GenerateSlugFromName(name string) string {
 	slug = strings.Trim(slug, "-")
 
 	// Generate 6-character alphanumeric suffix
-	suffix := generateRandomString(6)
+	suffix := GenerateRandomString(6)
 
 	return slug + "-" + suffix
 }
 
-// generateRandomString generates a random alphanumeric string of given length
-func generateRandomString(length int) string {
+// GenerateRandomString generates a random alphanumeric string of given length
+func GenerateRandomString(length int) string {
 	const charset = "0123456789abcdefghijklmnopqrstuvwxyz"
 	result := make([]byte, length)
 
@@ -0,0 +1,104 @@
+// Package views counts visits to public waitlist pages and widgets without
+// cookies or stored IPs. A visitor is a hash of the IP and user agent salted
+// with a random salt that changes every UTC day and is deleted afterwards, so
+// visitors can be counted per day but not followed across days or identified.
+package views
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/attribution"
+	"github.com/anish-chanda/openwaitlist/backend/internal/db"
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+)
+
+// Hash sizes in bytes
+const (
+	saltSize    = 32
+	visitorSize = 16
+)
+
+// Counter records page views, caching the current day's salt
+type Counter struct {
+	database db.Database
+
+	mu   sync.Mutex
+	day  time.Time
+	salt []byte
+}
+
+// NewCounter creates a counter storing views in database
+func NewCounter(database db.Database) *Counter {
+	return &Counter{database: database}
+}
+
+// Record counts a view of a waitlist by the visitor at ip with userAgent.
+// Crawlers and scripts aren't counted.
+func (c *Counter) Record(ctx context.Context, waitlistID int64, ip, userAgent string, now time.Time) error {
+	if attribution.ClassifyUserAgent(userAgent) == attribution.DeviceBot {
+		return nil
+	}
+
+	day := utcDay(now)
+	salt, err := c.daySalt(ctx, day)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	hash.Write(salt)
+	binary.Write(hash, binary.BigEndian, waitlistID)
+	hash.Write([]byte(ip))
+	hash.Write([]byte{0})
+	hash.Write([]byte(userAgent))
+	return c.database.RecordWaitlistView(ctx, waitlistID, day, hash.Sum(nil)[:visitorSize])
+}
+
+// daySalt returns the salt of day, creating it when this is the day's first view
+func (c *Counter) daySalt(ctx context.Context, day time.Time) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.salt != nil && c.day.Equal(day) {
+		return c.salt, nil
+	}
+	candidate := make([]byte, saltSize)
+	if _, err := rand.Read(candidate); err != nil {
+		return nil, err
+	}
+	salt, err := c.database.GetViewSalt(ctx, day, candidate)
+	if err != nil {
+		return nil, err
+	}
+	c.day, c.salt = day, salt
+	return salt, nil
+}
+
+// utcDay returns the UTC midnight starting t's day
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// RunCleanup deletes the visitor hashes and salts of past days every interval
+// until ctx is cancelled
+func RunCleanup(ctx context.Context, database db.Database, interval time.Duration, log *logger.ServiceLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := database.DeleteExpiredViewVisitors(ctx, utcDay(now)); err != nil && ctx.Err() == nil {
+				log.Warn("View visitor cleanup failed", map[string]interface{}{"error": err.Error()})
+			}
+		}
+	}
+}
@@ -0,0 +1,440 @@
+/*
+ * OpenWaitlist signup widget.
+ *
+ * Inline form, rendered next to the script tag (or into data-target):
+ *   <script src="https://waitlist.example.com/embed/widget.js" data-waitlist="my-launch" async></script>
+ *
+ * Iframe form, isolated from the page's styles and auto-resized:
+ *   <script src="https://waitlist.example.com/embed/widget.js" data-waitlist="my-launch" data-mode="iframe" async></script>
+ *
+ * Theme attributes override the waitlist's saved theme: data-theme (auto, light,
+ * dark), data-accent-color, data-background-color, data-text-color,
+ * data-border-radius, data-button-text. data-show-name="true" adds a name field.
+ *
+ * The inline form calls the public API cross-origin, so the page's origin must
+ * be in the waitlist's allowed origins when that list is set.
+ */
+(function () {
+  "use strict";
+
+  var script = document.currentScript;
+  if (!script || !script.getAttribute("data-waitlist")) {
+    return;
+  }
+  var base = new URL(script.src).origin;
+  var slug = script.getAttribute("data-waitlist");
+  var colorPattern = /^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$/;
+
+  function attr(name) {
+    var value = script.getAttribute("data-" + name);
+    return value === null || value === "" ? undefined : value;
+  }
+
+  function el(tag, props, children) {
+    var node = document.createElement(tag);
+    Object.keys(props || {}).forEach(function (key) {
+      if (key === "className") node.className = props[key];
+      else if (key === "text") node.textContent = props[key];
+      else node.setAttribute(key, props[key]);
+    });
+    (children || []).forEach(function (child) {
+      if (child) node.appendChild(child);
+    });
+    return node;
+  }
+
+  function api(path, options) {
+    return fetch(base + "/public/v1/waitlists/" + encodeURIComponent(slug) + path, options).then(function (response) {
+      return response.json().catch(function () {
+        return { success: false, message: "Something went wrong, please try again" };
+      });
+    });
+  }
+
+  // mountTarget returns the element the form or iframe goes into
+  function mountTarget() {
+    var selector = attr("target");
+    var target = selector && document.querySelector(selector);
+    if (!target) {
+      target = document.createElement("div");
+      script.parentNode.insertBefore(target, script.nextSibling);
+    }
+    return target;
+  }
+
+  if (attr("mode") === "iframe") {
+    mountIframe(mountTarget());
+  } else {
+    mountForm(mountTarget());
+  }
+
+  function mountIframe(target) {
+    var params = new URLSearchParams();
+    ["theme", "accent-color", "background-color", "text-color", "border-radius", "button-text", "show-name"].forEach(function (name) {
+      if (attr(name) !== undefined) params.set(name.replace(/-/g, "_"), attr(name));
+    });
+    if (referralCode()) params.set("ref", referralCode());
+    params.set("landing_url", window.location.href);
+    if (document.referrer) params.set("referrer", document.referrer);
+    var frame = el("iframe", {
+      src: base + "/embed/" + encodeURIComponent(slug) + (params.toString() ? "?" + params.toString() : ""),
+      title: "Join the waitlist",
+      loading: "lazy",
+      style: "width:100%;border:0;overflow:hidden;height:320px",
+    });
+    window.addEventListener("message", function (event) {
+      if (event.origin === base && event.source === frame.contentWindow && event.data && event.data.type === "openwaitlist:resize") {
+        frame.style.height = Math.ceil(event.data.height) + "px";
+      }
+    });
+    target.appendChild(frame);
+  }
+
+  function applyTheme(root, theme) {
+    var mode = attr("theme") || theme.mode || "auto";
+    if (mode === "auto") {
+      mode = window.matchMedia && window.matchMedia("(prefers-color-scheme: dark)").matches ? "dark" : "light";
+    }
+    root.classList.add("owl-" + (mode === "dark" ? "dark" : "light"));
+
+    var colors = {
+      "--owl-accent": attr("accent-color") || theme.accent_color,
+      "--owl-background": attr("background-color") || theme.background_color,
+      "--owl-text": attr("text-color") || theme.text_color,
+    };
+    Object.keys(colors).forEach(function (name) {
+      if (colors[name] && colorPattern.test(colors[name])) root.style.setProperty(name, colors[name]);
+    });
+    var radius = parseInt(attr("border-radius") !== undefined ? attr("border-radius") : theme.border_radius, 10);
+    if (radius >= 0 && radius <= 32) root.style.setProperty("--owl-radius", radius + "px");
+  }
+
+  function injectStyles() {
+    if (document.getElementById("owl-styles")) return;
+    var css =
+      ".owl-widget{--owl-accent:#4f46e5;--owl-radius:8px;font:15px/1.4 system-ui,-apple-system,Segoe UI,Roboto,sans-serif;color:var(--owl-text);background:var(--owl-background);padding:16px;border-radius:var(--owl-radius);box-sizing:border-box;max-width:480px}" +
+      ".owl-light{--owl-text:#111827;--owl-background:#ffffff;--owl-border:#d1d5db;--owl-muted:#6b7280}" +
+      ".owl-dark{--owl-text:#f9fafb;--owl-background:#111827;--owl-border:#374151;--owl-muted:#9ca3af}" +
+      ".owl-widget *{box-sizing:border-box}" +
+      ".owl-title{font-size:18px;font-weight:600;margin:0 0 12px}" +
+      ".owl-field{margin:0 0 12px}" +
+      ".owl-field label{display:block;font-weight:500;margin:0 0 4px}" +
+      ".owl-field input[type=text],.owl-field input[type=email],.owl-field input[type=number],.owl-field input[type=url],.owl-field select{width:100%;padding:8px 10px;font:inherit;color:inherit;background:transparent;border:1px solid var(--owl-border);border-radius:var(--owl-radius)}" +
+      ".owl-check label{display:flex;gap:8px;align-items:flex-start;font-weight:400}" +
+      ".owl-help{color:var(--owl-muted);font-size:13px;margin:4px 0 0}" +
+      ".owl-error{color:#dc2626;font-size:13px;margin:4px 0 0}" +
+      ".owl-hp{position:absolute!important;left:-10000px!important;width:1px;height:1px;overflow:hidden}" +
+      ".owl-submit{width:100%;padding:10px;font:inherit;font-weight:600;color:#fff;background:var(--owl-accent);border:0;border-radius:var(--owl-radius);cursor:pointer}" +
+      ".owl-submit[disabled]{opacity:.6;cursor:wait}" +
+      ".owl-message{margin:12px 0 0}" +
+      ".owl-badge{display:block;text-align:center;margin:12px 0 0;font-size:12px;color:var(--owl-muted);text-decoration:none}";
+    document.head.appendChild(el("style", { id: "owl-styles", text: css }));
+  }
+
+  function fieldInput(field) {
+    var id = "owl-" + slug + "-" + field.key;
+    var attrs = { id: id, name: field.key };
+    if (field.required) attrs.required = "required";
+    if (field.placeholder) attrs.placeholder = field.placeholder;
+
+    var input;
+    switch (field.type) {
+      case "select":
+        input = el("select", attrs, [el("option", { value: "", text: field.required ? "Select…" : "—" })].concat(
+          (field.options || []).map(function (option) {
+            return el("option", { value: option, text: option });
+          })
+        ));
+        break;
+      case "checkbox":
+        attrs.type = "checkbox";
+        input = el("input", attrs);
+        return { input: input, node: el("div", { className: "owl-field owl-check" }, [el("label", { for: id }, [input, el("span", { text: field.label })])]) };
+      case "number":
+        attrs.type = "number";
+        attrs.step = field.integer ? "1" : "any";
+        if (field.min !== undefined) attrs.min = String(field.min);
+        if (field.max !== undefined) attrs.max = String(field.max);
+        input = el("input", attrs);
+        break;
+      case "url":
+        attrs.type = "url";
+        input = el("input", attrs);
+        break;
+      default:
+        attrs.type = "text";
+        if (field.max_length) attrs.maxlength = String(field.max_length);
+        input = el("input", attrs);
+    }
+    return { input: input, node: el("div", { className: "owl-field" }, [el("label", { for: id, text: field.label }), input]) };
+  }
+
+  function leadingZeroBits(bytes) {
+    var bits = 0;
+    for (var i = 0; i < bytes.length; i++) {
+      if (bytes[i] === 0) {
+        bits += 8;
+        continue;
+      }
+      return bits + Math.clz32(bytes[i]) - 24;
+    }
+    return bits;
+  }
+
+  // solveProofOfWork mirrors backend/internal/botcheck: sha256(challenge:email:nonce)
+  // must start with `difficulty` zero bits
+  function solveProofOfWork(challenge, email, difficulty) {
+    var encoder = new TextEncoder();
+    var prefix = challenge + ":" + email.trim().toLowerCase() + ":";
+    var nonce = 0;
+    function attempt() {
+      return crypto.subtle.digest("SHA-256", encoder.encode(prefix + nonce)).then(function (digest) {
+        if (leadingZeroBits(new Uint8Array(digest)) >= difficulty) return String(nonce);
+        nonce++;
+        return attempt();
+      });
+    }
+    return attempt();
+  }
+
+  // referralCode is the ?ref= of the page the widget is on, so referral links
+  // can point at the owner's site as well as the hosted page. The iframe form
+  // gets it passed on in its URL.
+  function referralCode() {
+    return new URLSearchParams(window.location.search).get("ref");
+  }
+
+  // landingPage is the page the visitor found the form on and the page that
+  // sent them there, for attribution. The iframe form gets both passed on in
+  // its URL.
+  function landingPage() {
+    var params = new URLSearchParams(window.location.search);
+    if (window.parent !== window && params.get("landing_url")) {
+      return { url: params.get("landing_url"), referrer: params.get("referrer") || "" };
+    }
+    return { url: window.location.href, referrer: document.referrer };
+  }
+
+  function reportHeight(root) {
+    if (window.parent === window) return;
+    var send = function () {
+      window.parent.postMessage({ type: "openwaitlist:resize", height: root.getBoundingClientRect().height }, "*");
+    };
+    send();
+    if (window.ResizeObserver) new ResizeObserver(send).observe(root);
+  }
+
+  function mountForm(target) {
+    injectStyles();
+    var root = el("div", { className: "owl-widget" });
+    target.appendChild(root);
+    reportHeight(root);
+
+    Promise.all([api(""), api("/challenge")]).then(function (results) {
+      var waitlist = results[0];
+      var challenge = results[1];
+      if (!waitlist || !waitlist.slug) {
+        root.appendChild(el("p", { className: "owl-message", text: (waitlist && waitlist.message) || "This waitlist is not available." }));
+        return;
+      }
+      applyTheme(root, waitlist.theme || {});
+      if (waitlist.state && waitlist.state !== "open" && !waitlist.queue_signups) {
+        root.appendChild(el("p", { className: "owl-title", text: waitlist.name }));
+        root.appendChild(el("p", { className: "owl-message", text: waitlist.state_message }));
+        return;
+      }
+      render(root, waitlist, challenge);
+    }, function () {
+      root.appendChild(el("p", { className: "owl-message", text: "Could not load the signup form." }));
+    });
+  }
+
+  function render(root, waitlist, challenge) {
+    var theme = waitlist.theme || {};
+    var inputs = {};
+    var errors = {};
+    var form = el("form", { novalidate: "novalidate" });
+
+    form.appendChild(el("p", { className: "owl-title", text: "Join " + waitlist.name }));
+    if (waitlist.state && waitlist.state !== "open") {
+      form.appendChild(el("p", { className: "owl-message", text: waitlist.state_message + ", you can still join the queue" }));
+    }
+
+    var email = fieldInput({ key: "email", label: "Email", type: "text", required: true, placeholder: "you@example.com" });
+    email.input.type = "email";
+    email.input.autocomplete = "email";
+    form.appendChild(email.node);
+    errors.email = email.node;
+
+    var name;
+    if (attr("show-name") === "true") {
+      name = fieldInput({ key: "name", label: "Name", type: "text", max_length: 200 });
+      name.input.autocomplete = "name";
+      form.appendChild(name.node);
+    }
+
+    (waitlist.form_fields || []).forEach(function (field) {
+      var rendered = fieldInput(field);
+      if (field.help_text) rendered.node.appendChild(el("p", { className: "owl-help", text: field.help_text }));
+      inputs[field.key] = { field: field, input: rendered.input };
+      errors[field.key] = rendered.node;
+      form.appendChild(rendered.node);
+    });
+
+    // the versions shown are sent with the signup, so it is refused if the text changed meanwhile
+    var consent = {};
+    var consentInputs = {};
+    var consentBox = el("div");
+    form.appendChild(consentBox);
+    function renderConsent(settings) {
+      consent = settings || {};
+      consentInputs = {};
+      consentBox.replaceChildren();
+      [
+        ["accept_terms", consent.terms, true],
+        ["marketing_opt_in", consent.marketing, false],
+      ].forEach(function (box) {
+        delete errors[box[0]];
+        if (!box[1]) return;
+        var rendered = fieldInput({ key: box[0], label: box[1].text, type: "checkbox", required: box[2] });
+        if (box[1].url) {
+          rendered.node.querySelector("label").appendChild(el("a", { href: box[1].url, target: "_blank", rel: "noopener", text: " Read" }));
+        }
+        consentInputs[box[0]] = rendered.input;
+        errors[box[0]] = rendered.node;
+        consentBox.appendChild(rendered.node);
+      });
+    }
+    renderConsent(waitlist.consent);
+
+    var honeypot;
+    if (challenge.honeypot_field) {
+      honeypot = el("input", { type: "text", name: challenge.honeypot_field, tabindex: "-1", autocomplete: "off" });
+      form.appendChild(el("div", { className: "owl-hp", "aria-hidden": "true" }, [honeypot]));
+    }
+
+    var captchaToken = "";
+    if (challenge.captcha_site_key) {
+      var captcha = el("div", { className: "owl-field" });
+      form.appendChild(captcha);
+      var widgetAPI = window.turnstile || window.hcaptcha || window.grecaptcha;
+      if (widgetAPI && widgetAPI.render) {
+        widgetAPI.render(captcha, {
+          sitekey: challenge.captcha_site_key,
+          callback: function (token) {
+            captchaToken = token;
+          },
+        });
+      } else {
+        captcha.appendChild(el("p", { className: "owl-error", text: "Load your captcha provider's script on this page to use this form." }));
+      }
+    }
+
+    var button = el("button", { type: "submit", className: "owl-submit", text: attr("button-text") || theme.button_text || "Join waitlist" });
+    form.appendChild(button);
+    var message = el("p", { className: "owl-message", role: "status" });
+    form.appendChild(message);
+    root.appendChild(form);
+
+    if (waitlist.show_vendor_branding) {
+      root.appendChild(el("a", { className: "owl-badge", href: "https://github.com/anish-chanda/openwaitlist", target: "_blank", rel: "noopener", text: "Powered by OpenWaitlist" }));
+    }
+
+    function clearErrors() {
+      Array.prototype.forEach.call(form.querySelectorAll(".owl-error"), function (node) {
+        node.remove();
+      });
+      message.textContent = "";
+    }
+
+    function showError(key, text) {
+      var node = errors[key];
+      if (node) node.appendChild(el("p", { className: "owl-error", text: text }));
+      else message.textContent = text;
+    }
+
+    form.addEventListener("submit", function (event) {
+      event.preventDefault();
+      clearErrors();
+
+      var answers = {};
+      Object.keys(inputs).forEach(function (key) {
+        var input = inputs[key].input;
+        if (inputs[key].field.type === "checkbox") answers[key] = input.checked;
+        else if (input.value !== "") answers[key] = input.value;
+      });
+      var body = {
+        email: email.input.value.trim(),
+        name: name ? name.input.value.trim() : undefined,
+        answers: answers,
+        ref: referralCode() || undefined,
+        landing_url: landingPage().url,
+        referrer: landingPage().referrer || undefined,
+        form_token: challenge.form_token,
+        captcha_token: captchaToken || undefined,
+        accept_terms: consentInputs.accept_terms ? consentInputs.accept_terms.checked : undefined,
+        terms_version: consent.terms ? consent.terms.version : undefined,
+        marketing_opt_in: consentInputs.marketing_opt_in ? consentInputs.marketing_opt_in.checked : undefined,
+        marketing_version: consent.marketing ? consent.marketing.version : undefined,
+      };
+      if (honeypot) body.website = honeypot.value;
+
+      button.disabled = true;
+      var work = Promise.resolve();
+      if (challenge.pow_challenge && challenge.pow_difficulty) {
+        body.pow_challenge = challenge.pow_challenge;
+        work = solveProofOfWork(challenge.pow_challenge, body.email, challenge.pow_difficulty).then(function (nonce) {
+          body.pow_nonce = nonce;
+        });
+      }
+
+      work
+        .then(function () {
+          return api("/signups", {
+            method: "POST",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify(body),
+          });
+        })
+        .then(function (result) {
+          button.disabled = false;
+          if (result.success) {
+            if (result.redirect_url) {
+              try {
+                window.top.location.href = result.redirect_url;
+              } catch (e) {
+                window.location.href = result.redirect_url;
+              }
+              return;
+            }
+            form.replaceChildren(el("p", { className: "owl-title", text: result.message || "You're on the waitlist!" }));
+            if (result.position) form.appendChild(el("p", { className: "owl-message", text: "You're #" + result.position + " in line." }));
+            if (result.referral_code) {
+              var link = base + "/w/" + encodeURIComponent(slug) + "?ref=" + encodeURIComponent(result.referral_code);
+              form.appendChild(el("p", { className: "owl-message", text: "Move up by sharing your link:" }));
+              form.appendChild(el("div", { className: "owl-field" }, [el("input", { type: "text", readonly: "readonly", value: link })]));
+            }
+            return;
+          }
+          if (result.code === "consent_changed") {
+            // show the new text, it has to be agreed to again
+            return api("").then(function (fresh) {
+              renderConsent(fresh && fresh.consent);
+              message.textContent = result.message;
+            });
+          }
+          if (result.field_errors) {
+            Object.keys(result.field_errors).forEach(function (key) {
+              showError(key, result.field_errors[key]);
+            });
+          }
+          if (result.code && result.code.indexOf("email") !== -1) showError("email", result.message);
+          else message.textContent = result.message || "Something went wrong, please try again";
+        })
+        .catch(function () {
+          button.disabled = false;
+          message.textContent = "Something went wrong, please try again";
+        });
+    });
+  }
+})();
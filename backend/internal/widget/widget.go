@@ -0,0 +1,142 @@
+package widget
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed assets/widget.js assets/frame.html
+var assets embed.FS
+
+var frameTemplate = template.Must(template.ParseFS(assets, "assets/frame.html"))
+
+// Theme modes
+const (
+	ModeAuto  = "auto" // follow the visitor's prefers-color-scheme
+	ModeLight = "light"
+	ModeDark  = "dark"
+)
+
+// Theme limits
+const (
+	maxBorderRadius    = 32
+	maxButtonTextChars = 40
+)
+
+var colorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// Theme styles the embedded signup form. Empty fields use the widget defaults
+// and can be overridden per embed with data attributes or query parameters.
+type Theme struct {
+	Mode            string `json:"mode,omitempty"`
+	AccentColor     string `json:"accent_color,omitempty"`
+	BackgroundColor string `json:"background_color,omitempty"`
+	TextColor       string `json:"text_color,omitempty"`
+	BorderRadius    *int   `json:"border_radius,omitempty"` // in pixels
+	ButtonText      string `json:"button_text,omitempty"`
+}
+
+// Validate checks the theme only holds values that are safe to put in CSS
+func (t Theme) Validate() error {
+	switch t.Mode {
+	case "", ModeAuto, ModeLight, ModeDark:
+	default:
+		return fmt.Errorf("mode must be auto, light or dark")
+	}
+	for name, color := range map[string]string{
+		"accent_color":     t.AccentColor,
+		"background_color": t.BackgroundColor,
+		"text_color":       t.TextColor,
+	} {
+		if color != "" && !colorPattern.MatchString(color) {
+			return fmt.Errorf("%s must be a hex color like #4f46e5", name)
+		}
+	}
+	if t.BorderRadius != nil && (*t.BorderRadius < 0 || *t.BorderRadius > maxBorderRadius) {
+		return fmt.Errorf("border_radius must be between 0 and %d", maxBorderRadius)
+	}
+	if utf8.RuneCountInString(t.ButtonText) > maxButtonTextChars {
+		return fmt.Errorf("button_text must be at most %d characters", maxButtonTextChars)
+	}
+	return nil
+}
+
+// NormalizeOrigins validates an origin allowlist entered by a user, reducing each
+// entry to scheme://host[:port] and dropping blanks and duplicates
+func NormalizeOrigins(origins []string) ([]string, error) {
+	normalized := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("%q is not an origin like https://example.com", origin)
+		}
+		origin = u.Scheme + "://" + strings.ToLower(u.Host)
+		if !containsOrigin(normalized, origin) {
+			normalized = append(normalized, origin)
+		}
+	}
+	return normalized, nil
+}
+
+func containsOrigin(origins []string, origin string) bool {
+	for _, candidate := range origins {
+		if candidate == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// OriginAllowed reports whether a page on origin may use a waitlist's public API.
+// An empty allowlist allows every origin.
+func OriginAllowed(allowed []string, origin string) bool {
+	return len(allowed) == 0 || containsOrigin(allowed, strings.ToLower(origin))
+}
+
+// FrameAncestors returns the CSP frame-ancestors sources for a waitlist's
+// iframe form
+func FrameAncestors(allowed []string) string {
+	if len(allowed) == 0 {
+		return "*"
+	}
+	return "'self' " + strings.Join(allowed, " ")
+}
+
+// ScriptHandler serves the widget script. It is small and changes only with
+// releases, so browsers may cache it briefly.
+func ScriptHandler() http.HandlerFunc {
+	script, err := assets.ReadFile("assets/widget.js")
+	if err != nil {
+		panic(fmt.Sprintf("widget script missing from build: %v", err))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Write(script)
+	}
+}
+
+// FrameData fills the iframe form page
+type FrameData struct {
+	Slug      string
+	Name      string
+	ScriptURL string
+	Theme     Theme // per-embed overrides from the query string
+	ShowName  bool
+}
+
+// RenderFrame writes the iframe form page for a waitlist
+func RenderFrame(w http.ResponseWriter, data FrameData) error {
+	return frameTemplate.Execute(w, data)
+}
@@ -2,15 +2,32 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/anish-chanda/openwaitlist/backend/internal/botcheck"
 	"github.com/anish-chanda/openwaitlist/backend/internal/db"
 	postgres "github.com/anish-chanda/openwaitlist/backend/internal/db/postgresql"
+	"github.com/anish-chanda/openwaitlist/backend/internal/emailcheck"
+	"github.com/anish-chanda/openwaitlist/backend/internal/events"
 	"github.com/anish-chanda/openwaitlist/backend/internal/handlers"
+	"github.com/anish-chanda/openwaitlist/backend/internal/jobs"
 	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+	"github.com/anish-chanda/openwaitlist/backend/internal/mailer"
+	"github.com/anish-chanda/openwaitlist/backend/internal/metrics"
+	"github.com/anish-chanda/openwaitlist/backend/internal/ratelimit"
+	"github.com/anish-chanda/openwaitlist/backend/internal/schedule"
+	"github.com/anish-chanda/openwaitlist/backend/internal/stats"
+	"github.com/anish-chanda/openwaitlist/backend/internal/tracing"
+	"github.com/anish-chanda/openwaitlist/backend/internal/unsubscribe"
+	"github.com/anish-chanda/openwaitlist/backend/internal/views"
+	"github.com/anish-chanda/openwaitlist/backend/internal/widget"
 	"github.com/anish-chanda/openwaitlist/web"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -21,8 +38,21 @@ import (
 )
 
 func main() {
-	// Load and validate config
-	cfg := LoadConfig()
+	// `api config print` inspects the effective configuration without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+
+	flags := flag.NewFlagSet("api", flag.ExitOnError)
+	configPath := flags.String("config", os.Getenv("CONFIG_FILE"), configPathUsage)
+	flags.Parse(os.Args[1:])
+
+	// Load and validate config, every problem is reported before exiting
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 	logConfig := logger.Config{
 		Level:       cfg.LogLevel,
@@ -32,14 +62,43 @@ func main() {
 
 	log := logger.New(logConfig)
 
+	// ctx is cancelled on SIGINT/SIGTERM; anything long-running should stop when it is done
+	ctx, stop := signalContext()
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter:    cfg.TracingExporter,
+		SampleRatio: float64(cfg.TracingSampleRatio),
+		ServiceName: "openwaitlist-" + logConfig.ServiceName,
+		Environment: cfg.Environment,
+	})
+	if err != nil {
+		log.Error("Tracing setup failed: ", err)
+		return
+	}
+	defer func() {
+		// flush buffered spans, bounded so a dead collector can't block exit
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			log.Error("Failed to flush traces: ", err)
+		}
+	}()
+
 	log.Info("Initializng Database...")
 	var database db.Database = postgres.NewPostgresDB(*log)
 	if err := database.Connect(cfg.Dsn); err != nil {
 		log.Error("Database connection failed: ", err)
 		return
 	}
+	defer func() {
+		log.Info("Closing database connection...")
+		if err := database.Close(); err != nil {
+			log.Error("Failed to close database connection: ", err)
+		}
+	}()
 	// ping DB
-	if err := database.Ping(context.Background()); err != nil {
+	if err := database.Ping(ctx); err != nil {
 		log.Error("Database ping failed: ", err)
 		return
 	}
@@ -51,6 +110,131 @@ func main() {
 		return
 	}
 
+	// rate limiting, postgres keeps buckets shared between replicas
+	var rateLimitStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimitStore == "postgres" {
+		rateLimitStore = ratelimit.NewPostgresStore(database)
+	}
+
+	// signup and login hash passwords with argon2, so they get the tightest limits
+	authRateLimit := ratelimit.Middleware(rateLimitStore, ratelimit.Policy{
+		Name: "auth",
+		Rules: []ratelimit.Rule{
+			{Name: "ip", Limit: cfg.RateLimitAuthIP, Key: ratelimit.ByIP},
+			{Name: "account", Limit: cfg.RateLimitAuthAccount, Key: ratelimit.ByField("email", "user")},
+		},
+	})
+	apiRateLimit := ratelimit.Middleware(rateLimitStore, ratelimit.Policy{
+		Name:  "api",
+		Rules: []ratelimit.Rule{{Name: "ip", Limit: cfg.RateLimitAPIIP, Key: ratelimit.ByIP}},
+	})
+	publicRateLimit := ratelimit.Middleware(rateLimitStore, ratelimit.Policy{
+		Name:  "public",
+		Rules: []ratelimit.Rule{{Name: "ip", Limit: cfg.RateLimitPublicIP, Key: ratelimit.ByIP}},
+	})
+	// each privacy request emails a link, so on top of the public limit they are limited per address
+	privacyRateLimit := ratelimit.Middleware(rateLimitStore, ratelimit.Policy{
+		Name:  "privacy",
+		Rules: []ratelimit.Rule{{Name: "email", Limit: cfg.RateLimitPrivacyEmail, Key: ratelimit.ByField("email")}},
+	})
+
+	// bot protection for public signup forms
+	var captchaVerifier botcheck.CaptchaVerifier
+	switch cfg.CaptchaProvider {
+	case "siteverify":
+		captchaVerifier = botcheck.NewSiteVerifyVerifier(cfg.CaptchaVerifyURL, cfg.CaptchaSecret, cfg.CaptchaSiteKey)
+	case "fake":
+		captchaVerifier = botcheck.FakeCaptchaVerifier{ValidToken: "fake-captcha-token"}
+	}
+	botVerifier := botcheck.NewVerifier([]byte(cfg.JWTSecret), captchaVerifier)
+
+	// email validation, the extra blocklist file is re-read when it changes
+	blocklist := emailcheck.NewBlocklist()
+	if cfg.DisposableDomainsFile != "" {
+		if _, err := blocklist.LoadFile(cfg.DisposableDomainsFile); err != nil {
+			log.Error("Failed to load disposable domains: ", err)
+			return
+		}
+	}
+	var mxResolver emailcheck.Resolver
+	if cfg.EmailMXLookup {
+		mxResolver = net.DefaultResolver
+	}
+	emailValidator := emailcheck.NewValidator(blocklist, mxResolver)
+
+	// waitlist and signup events are only logged for now
+	publisher := events.LogPublisher{Log: log}
+
+	// opens, closes and fills scheduled waitlists, publishing their lifecycle events
+	scheduler := schedule.NewScheduler(database, publisher, log)
+
+	// background jobs, shared with the other replicas through postgres
+	queue := jobs.NewQueue(database, log, jobs.Config{
+		Workers:      cfg.JobWorkers,
+		PollInterval: time.Duration(cfg.JobPollInterval) * time.Millisecond,
+	})
+
+	// stats read finished hours from rollups when they are enabled
+	if cfg.StatsRollupInterval > 0 {
+		if err := stats.ScheduleRollups(queue, database, time.Duration(cfg.StatsRollupInterval)*time.Minute); err != nil {
+			log.Error("Failed to schedule signup rollups: ", err)
+			return
+		}
+	}
+
+	// cookieless view counts of public waitlists, visitor hashes only live for a day
+	viewCounter := views.NewCounter(database)
+
+	// signed unsubscribe links for every email sent to people on waitlists
+	unsubscribeLinks := unsubscribe.Links{BaseURL: cfg.APIBaseURL, Secret: []byte(cfg.JWTSecret)}
+
+	// emails are queued as jobs and sent no faster than the provider's rate limit
+	var mailProvider mailer.Provider
+	var outbox *mailer.Outbox
+	switch cfg.MailProvider {
+	case "smtp":
+		mailProvider = &mailer.SMTPProvider{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			Security: cfg.SMTPTLS,
+		}
+	case "http":
+		mailProvider = &mailer.HTTPProvider{URL: cfg.MailAPIURL, APIKey: cfg.MailAPIKey}
+	case "outbox":
+		outbox = &mailer.Outbox{Dir: cfg.MailOutboxPath}
+		mailProvider = outbox
+	}
+	mail := mailer.New(database, mailProvider, rateLimitStore, mailer.Config{
+		From:      cfg.MailFrom,
+		RateLimit: cfg.MailRateLimit,
+		Links:     unsubscribeLinks,
+	})
+	mail.Register(queue)
+
+	// waitlist logos live next to the avatars, in the same kind of store
+	avatarStore := avatar.NewLocalFS(cfg.AvatarPath)
+	logoStore := avatar.NewLocalFS(cfg.LogoPath)
+
+	lockoutPolicy := handlers.LockoutPolicy{
+		Threshold:    cfg.LockoutThreshold,
+		BaseDuration: time.Duration(cfg.LockoutDuration) * time.Minute,
+		MaxDuration:  time.Duration(cfg.LockoutMaxDuration) * time.Minute,
+		UnlockSecret: []byte(cfg.JWTSecret),
+		BaseURL:      cfg.APIBaseURL,
+	}
+
+	// data subject requests from people on waitlists
+	privacy := handlers.PrivacyConfig{
+		BaseURL:  cfg.APIBaseURL,
+		Secret:   []byte(cfg.JWTSecret),
+		Notifier: handlers.MailDataRequestNotifier{Mailer: mail},
+	}
+
+	// invite codes and the access tokens redeeming them earns
+	inviteConfig := handlers.InviteConfig{BaseURL: cfg.APIBaseURL, Mailer: mail}
+
 	// setup auth options
 	authOptions := authpkg.Opts{
 		SecretReader: token.SecretFunc(func(id string) (string, error) { // secret key for JWT
@@ -61,7 +245,14 @@ func main() {
 		Issuer:         "openwaitlist",
 		URL:            cfg.APIBaseURL,
 		DisableXSRF:    true,
-		AvatarStore:    avatar.NewLocalFS(cfg.AvatarPath),
+		AvatarStore:    avatarStore,
+	}
+
+	// unknown emails are checked against a dummy hash, without one they'd be
+	// rejected faster than wrong passwords
+	if err := handlers.InitDummyPasswordHash(ctx); err != nil {
+		log.Error("Login setup failed: ", err)
+		return
 	}
 
 	// create authservice and local provider
@@ -73,30 +264,158 @@ func main() {
 	// create router and attach paths
 	router := chi.NewRouter()
 
-	router.Use(middleware.Logger)
+	if cfg.TrustProxyHeaders {
+		router.Use(middleware.RealIP)
+	}
+	router.Use(tracing.Middleware)
+	router.Use(logger.RequestMiddleware(log))
+	router.Use(metrics.Middleware)
+
+	// probes, kept outside of auth for kubernetes. Metrics are on their own port.
+	router.Get("/healthz", handlers.HealthzHandler())
+	router.Get("/readyz", handlers.ReadyzHandler(database))
 
 	// custom auth routes
-	router.Post("/signup", handlers.SignupHandler(database, *log))
+	router.With(authRateLimit).Post("/signup", handlers.SignupHandler(database, emailValidator))
 
 	// Auth and avatar handlers
 	authHandler, avatarHandler := authService.Handlers()
+	router.With(authRateLimit, handlers.LoginLockoutMiddleware(database, lockoutPolicy, handlers.MailLockoutNotifier{Mailer: mail})).
+		Handle("/auth/local/login", authHandler)
+	router.Get("/auth/unlock", handlers.UnlockAccountHandler(database, lockoutPolicy))
 	router.Mount("/auth", authHandler)
 	router.Mount("/avatar", avatarHandler)
 
 	// API routes
 	router.Route("/api/v1", func(r chi.Router) {
-		// Apply auth middleware to all API routes  
+		r.Use(apiRateLimit)
+
+		// Apply auth middleware to all API routes
 		authMiddleware := authService.Middleware()
 		r.Use(authMiddleware.Auth)
-		
+
+		// account handlers
+		r.Get("/account/export", handlers.AccountExportHandler(database, avatarStore))
+		r.Delete("/account", handlers.DeleteAccountHandler(database, avatarStore))
+		r.Get("/account/transfers", handlers.ListTransfersHandler(database))
+		r.Post("/account/transfers/{id}/accept", handlers.AcceptTransferHandler(database))
+		r.Delete("/account/transfers/{id}", handlers.DeclineTransferHandler(database))
+
 		// waitlist handlers
-		r.Get("/waitlists", handlers.GetWaitlistsHandler(database, *log))
-		r.Post("/waitlists", handlers.CreateWaitlistHandler(database, *log))
-		r.Get("/waitlists/{slug}", handlers.GetWaitlistHandler(database, *log))
-		r.Put("/waitlists/{slug}", handlers.UpdateWaitlistHandler(database, *log))
-		r.Delete("/waitlists/{slug}", handlers.DeleteWaitlistHandler(database, *log))
+		r.Get("/waitlists", handlers.GetWaitlistsHandler(database))
+		r.Post("/waitlists", handlers.CreateWaitlistHandler(database))
+		r.Get("/waitlists/{slug}", handlers.GetWaitlistHandler(database))
+		r.Patch("/waitlists/{slug}", handlers.UpdateWaitlistHandler(database))
+		r.Put("/waitlists/{slug}/logo", handlers.UploadLogoHandler(database, logoStore))
+		r.Delete("/waitlists/{slug}/logo", handlers.DeleteLogoHandler(database, logoStore))
+		r.Delete("/waitlists/{slug}", handlers.DeleteWaitlistHandler(database))
+		r.Get("/waitlists/{slug}/consent/versions", handlers.ConsentVersionsHandler(database))
+		r.Post("/waitlists/{slug}/transfer", handlers.TransferWaitlistHandler(database, handlers.MailTransferNotifier{Mailer: mail}))
+		r.Delete("/waitlists/{slug}/transfer", handlers.CancelTransferHandler(database))
+
+		// analytics handlers
+		r.Get("/waitlists/{slug}/stats", handlers.WaitlistStatsHandler(database, cfg.StatsRollupInterval > 0))
+
+		// signup handlers
+		r.Get("/waitlists/{slug}/signups", handlers.ListSignupsHandler(database))
+		r.Get("/waitlists/{slug}/signups/export", handlers.ExportSignupsHandler(database))
+		r.Post("/waitlists/{slug}/signups/bulk", handlers.BulkSignupsHandler(database))
+		r.Get("/waitlists/{slug}/signups/{id}", handlers.GetSignupHandler(database))
+		r.Patch("/waitlists/{slug}/signups/{id}", handlers.UpdateSignupHandler(database))
+		r.Delete("/waitlists/{slug}/signups/{id}", handlers.DeleteSignupHandler(database))
+		r.Post("/waitlists/{slug}/signups/{id}/move", handlers.MoveSignupHandler(database))
+
+		// invite handlers
+		r.Get("/waitlists/{slug}/invites", handlers.ListInvitesHandler(database))
+		r.Post("/waitlists/{slug}/invites", handlers.CreateInvitesHandler(database, inviteConfig))
+		r.Delete("/waitlists/{slug}/invites/{id}", handlers.RevokeInviteHandler(database))
+		r.Get("/waitlists/{slug}/invites/key", handlers.InviteKeyHandler(database, inviteConfig))
+		r.Post("/waitlists/{slug}/invites/key/rotate", handlers.RotateInviteKeyHandler(database, inviteConfig))
+
+		// admin handlers, for the accounts in ADMIN_USER_IDS
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(handlers.RequireAdmin(database, cfg.AdminUserIDs))
+
+			r.Get("/jobs", handlers.ListJobsHandler(database))
+			r.Post("/jobs/retry", handlers.RetryDeadJobsHandler(database))
+			r.Get("/jobs/{id}", handlers.GetJobHandler(database))
+			r.Post("/jobs/{id}/retry", handlers.RetryJobHandler(database))
+			r.Delete("/jobs/{id}", handlers.DeleteJobHandler(database))
+		})
+	})
+
+	// Public routes used by signup forms, no auth
+	router.Route("/public/v1", func(r chi.Router) {
+		r.Use(publicRateLimit)
+
+		r.Get("/waitlists/{slug}", handlers.PublicWaitlistHandler(database, viewCounter))
+		r.Get("/waitlists/{slug}/challenge", handlers.ChallengeHandler(database, botVerifier))
+		r.Post("/waitlists/{slug}/signups", handlers.JoinWaitlistHandler(database, botVerifier, emailValidator, publisher))
+		r.Post("/waitlists/{slug}/invites/redeem", handlers.RedeemInviteHandler(database, publisher, inviteConfig))
+		r.Options("/waitlists/{slug}", handlers.PublicPreflightHandler(database))
+		r.Options("/waitlists/{slug}/*", handlers.PublicPreflightHandler(database))
+
+		// self-service data export and erasure for people on waitlists
+		r.With(privacyRateLimit).Post("/privacy/requests", handlers.DataRequestLinkHandler(database, privacy))
+		r.Get("/privacy/export", handlers.DataExportHandler(database, privacy))
+		r.Post("/privacy/erase", handlers.DataErasureHandler(database, privacy))
+	})
+
+	// Self-service privacy page, the hosted version of the privacy endpoints
+	router.Route("/privacy", func(r chi.Router) {
+		r.Use(publicRateLimit)
+
+		r.Get("/", handlers.PrivacyPageHandler(database, privacy))
+		r.With(privacyRateLimit).Post("/", handlers.PrivacyRequestHandler(database, privacy))
+		r.Post("/erase", handlers.PrivacyEraseHandler(database, privacy))
 	})
 
+	// Unsubscribe links and the email preference page
+	router.Route("/unsubscribe", func(r chi.Router) {
+		r.Use(publicRateLimit)
+
+		r.Get("/", handlers.UnsubscribePageHandler(database, unsubscribeLinks))
+		r.Post("/", handlers.OneClickUnsubscribeHandler(database, unsubscribeLinks))
+		r.Post("/preferences", handlers.UnsubscribePreferencesHandler(database, unsubscribeLinks))
+	})
+
+	// Bounces and spam complaints reported by the email provider
+	if cfg.BounceWebhookSecret != "" {
+		router.Post("/webhooks/bounces", handlers.BounceWebhookHandler(database, cfg.BounceWebhookSecret))
+	}
+
+	// Emails written by the outbox provider, for trying out email flows locally.
+	// They hold unlock and data request links, so serving them is opt-in.
+	if outbox != nil && cfg.MailOutboxServe {
+		router.Route("/dev/outbox", func(r chi.Router) {
+			r.Get("/", handlers.OutboxListHandler(outbox))
+			r.Get("/{name}", handlers.OutboxMessageHandler(outbox))
+		})
+	}
+
+	// Waitlist logos, stored the same way as avatars
+	router.Get("/logos/{logo}", handlers.LogoHandler(logoStore))
+
+	// Hosted waitlist pages, rendered server-side so they work without the SPA
+	hostedPages := handlers.HostedPageConfig{
+		BaseURL:          cfg.APIBaseURL,
+		Secret:           []byte(cfg.JWTSecret),
+		CaptchaScriptURL: cfg.CaptchaScriptURL,
+	}
+	router.Route("/w/{slug}", func(r chi.Router) {
+		r.Use(publicRateLimit)
+
+		r.Get("/", handlers.HostedPageHandler(database, botVerifier, hostedPages, viewCounter))
+		r.Post("/", handlers.HostedJoinHandler(database, botVerifier, emailValidator, publisher, hostedPages))
+		r.Get("/joined", handlers.HostedJoinedHandler(database, hostedPages))
+		r.Get("/invite", handlers.HostedInvitePageHandler(database))
+		r.Post("/invite", handlers.HostedRedeemInviteHandler(database, publisher, inviteConfig))
+	})
+
+	// Embeddable signup widget, the script plus an iframe version of the form
+	router.Get("/embed/widget.js", widget.ScriptHandler())
+	router.With(publicRateLimit).Get("/embed/{slug}", handlers.EmbedFrameHandler(database))
+
 	// create file server to serve static frontend files
 	fileServer := http.FileServer(http.FS(web.DistDirFS))
 
@@ -128,9 +447,44 @@ func main() {
 	})
 
 	// Root path redirects to login (handled by React Router, but serve the app)
-	router.Get("/", spaHandler) // Start listening
-	log.Info(fmt.Sprintf("Starting server on port %d", cfg.ApiPort))
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.ApiPort), router); err != nil {
-		log.Error("Server failed to start", err)
+	router.Get("/", spaHandler)
+
+	// background workers, started once nothing above can fail so every exit
+	// after this goes through the shutdown below, which waits for them before
+	// the deferred database close runs
+	var workers sync.WaitGroup
+	workers.Go(func() {
+		ratelimit.RunCleanup(ctx, rateLimitStore, time.Minute, log)
+	})
+	if cfg.DisposableDomainsFile != "" {
+		workers.Go(func() {
+			emailcheck.RunReload(ctx, blocklist, cfg.DisposableDomainsFile, time.Minute, log)
+		})
 	}
+	workers.Go(func() {
+		scheduler.Run(ctx, time.Minute)
+	})
+	workers.Go(func() {
+		views.RunCleanup(ctx, database, time.Hour, log)
+	})
+	// every job kind and schedule is registered by now
+	workers.Go(func() {
+		queue.Run(ctx)
+	})
+	// prometheus metrics, on their own port so only the scraper can reach them
+	if cfg.MetricsPort != 0 {
+		workers.Go(func() {
+			runMetricsServer(ctx, cfg, metrics.Handler(), log)
+		})
+	}
+
+	// Start listening, blocks until a shutdown signal is received
+	server := newHTTPServer(cfg, router)
+	if err := runServer(ctx, cfg, server, log); err != nil {
+		log.Error("Server error: ", err)
+	}
+
+	// stop background workers before the deferred database close runs
+	stop()
+	workers.Wait()
 }
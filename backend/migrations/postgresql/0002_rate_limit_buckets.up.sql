@@ -0,0 +1,10 @@
+-- token buckets for the postgres backed rate limiter, shared by all replicas
+CREATE UNLOGGED TABLE rate_limit_buckets (
+  key         TEXT PRIMARY KEY,
+  tokens      DOUBLE PRECISION NOT NULL,
+  allowed     BOOLEAN NOT NULL, -- outcome of the last take, returned by the upsert
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  expires_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX rate_limit_buckets_expires_at_idx ON rate_limit_buckets (expires_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.account_lockouts;
+DROP TABLE IF EXISTS public.login_attempts;
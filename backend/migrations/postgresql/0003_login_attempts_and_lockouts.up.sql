@@ -0,0 +1,20 @@
+CREATE TABLE login_attempts (
+  id            BIGSERIAL PRIMARY KEY,
+  email         TEXT NOT NULL,
+  user_id       INT REFERENCES users(id) ON DELETE CASCADE,
+  ip            TEXT NOT NULL,
+  succeeded     BOOLEAN NOT NULL,
+  blocked       BOOLEAN NOT NULL DEFAULT FALSE, -- rejected without checking the password
+  attempted_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX login_attempts_email_attempted_at_idx ON login_attempts (lower(email), attempted_at DESC);
+
+-- keyed by email rather than user so unknown emails lock the same way as real ones
+CREATE TABLE account_lockouts (
+  email          TEXT PRIMARY KEY, -- lowercased
+  failed_count   INT NOT NULL DEFAULT 0,
+  lockout_count  INT NOT NULL DEFAULT 0,
+  locked_until   TIMESTAMPTZ,
+  updated_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
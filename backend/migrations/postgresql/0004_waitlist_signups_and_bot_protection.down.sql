@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS public.waitlist_signups;
+
+ALTER TABLE public.waitlists
+  DROP COLUMN IF EXISTS bot_honeypot,
+  DROP COLUMN IF EXISTS bot_min_submit_seconds,
+  DROP COLUMN IF EXISTS bot_pow_difficulty,
+  DROP COLUMN IF EXISTS bot_captcha;
@@ -0,0 +1,16 @@
+-- bot protection settings for the public signup form
+ALTER TABLE waitlists
+  ADD COLUMN bot_honeypot            BOOLEAN NOT NULL DEFAULT TRUE,
+  ADD COLUMN bot_min_submit_seconds  INT NOT NULL DEFAULT 3, -- 0 disables the timing check
+  ADD COLUMN bot_pow_difficulty      INT NOT NULL DEFAULT 0, -- leading zero bits, 0 disables proof of work
+  ADD COLUMN bot_captcha             BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE waitlist_signups (
+  id           BIGSERIAL PRIMARY KEY,
+  waitlist_id  INT NOT NULL REFERENCES waitlists(id) ON DELETE CASCADE,
+  email        TEXT NOT NULL,
+  name         TEXT,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX waitlist_signups_waitlist_email_idx ON waitlist_signups (waitlist_id, lower(email));
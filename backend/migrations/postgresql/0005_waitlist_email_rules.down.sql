@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS waitlist_signups_waitlist_email_normalized_idx;
+CREATE UNIQUE INDEX waitlist_signups_waitlist_email_idx ON public.waitlist_signups (waitlist_id, lower(email));
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS email_normalized;
+
+ALTER TABLE public.waitlists
+  DROP COLUMN IF EXISTS email_gmail_aliases,
+  DROP COLUMN IF EXISTS email_block_disposable,
+  DROP COLUMN IF EXISTS email_check_mx,
+  DROP COLUMN IF EXISTS email_allow_domains,
+  DROP COLUMN IF EXISTS email_deny_domains;
@@ -0,0 +1,15 @@
+-- email validation rules for the public signup form
+ALTER TABLE waitlists
+  ADD COLUMN email_gmail_aliases     BOOLEAN NOT NULL DEFAULT FALSE, -- treat Gmail dots and +tags as the same address
+  ADD COLUMN email_block_disposable  BOOLEAN NOT NULL DEFAULT TRUE,
+  ADD COLUMN email_check_mx          BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN email_allow_domains     TEXT[] NOT NULL DEFAULT '{}', -- empty allows every domain
+  ADD COLUMN email_deny_domains      TEXT[] NOT NULL DEFAULT '{}';
+
+-- duplicates are detected on the normalized address instead of lower(email)
+ALTER TABLE waitlist_signups ADD COLUMN email_normalized TEXT;
+UPDATE waitlist_signups SET email_normalized = lower(email);
+ALTER TABLE waitlist_signups ALTER COLUMN email_normalized SET NOT NULL;
+
+DROP INDEX waitlist_signups_waitlist_email_idx;
+CREATE UNIQUE INDEX waitlist_signups_waitlist_email_normalized_idx ON waitlist_signups (waitlist_id, email_normalized);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS public.waitlist_signups_answers_idx;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS answers;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS form_fields;
@@ -0,0 +1,6 @@
+-- custom signup form fields, see the formfields package for the schema format
+ALTER TABLE waitlists ADD COLUMN form_fields JSONB NOT NULL DEFAULT '[]';
+
+-- answers keyed by field key, jsonb_path_ops serves the @> containment filters
+ALTER TABLE waitlist_signups ADD COLUMN answers JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX waitlist_signups_answers_idx ON waitlist_signups USING GIN (answers jsonb_path_ops);
@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS public.waitlist_signups_search_idx;
+DROP INDEX IF EXISTS public.waitlist_signups_tags_idx;
+DROP INDEX IF EXISTS public.waitlist_signups_referred_by_idx;
+DROP INDEX IF EXISTS public.waitlist_signups_order_idx;
+
+ALTER TABLE public.waitlist_signups
+  DROP COLUMN IF EXISTS search_vector,
+  DROP COLUMN IF EXISTS sort_key,
+  DROP COLUMN IF EXISTS notes,
+  DROP COLUMN IF EXISTS tags,
+  DROP COLUMN IF EXISTS referred_by,
+  DROP COLUMN IF EXISTS invited_at,
+  DROP COLUMN IF EXISTS verified_at,
+  DROP COLUMN IF EXISTS status;
+
+DROP SEQUENCE IF EXISTS public.waitlist_signups_sort_key_seq;
@@ -0,0 +1,30 @@
+-- subscriber management: status, verification, invites, referrals, manual ordering, tags and notes
+CREATE SEQUENCE waitlist_signups_sort_key_seq;
+
+ALTER TABLE waitlist_signups
+  ADD COLUMN status       TEXT NOT NULL DEFAULT 'waiting' CHECK (status IN ('waiting', 'invited', 'accepted')),
+  ADD COLUMN verified_at  TIMESTAMPTZ,
+  ADD COLUMN invited_at   TIMESTAMPTZ,
+  ADD COLUMN referred_by  BIGINT REFERENCES waitlist_signups(id) ON DELETE SET NULL,
+  ADD COLUMN tags         TEXT[] NOT NULL DEFAULT '{}',
+  ADD COLUMN notes        TEXT,
+  -- queue order, positions are row_number() over (sort_key, id) so owners can move people
+  ADD COLUMN sort_key     DOUBLE PRECISION;
+
+UPDATE waitlist_signups SET sort_key = nextval('waitlist_signups_sort_key_seq');
+ALTER TABLE waitlist_signups
+  ALTER COLUMN sort_key SET DEFAULT nextval('waitlist_signups_sort_key_seq'),
+  ALTER COLUMN sort_key SET NOT NULL;
+ALTER SEQUENCE waitlist_signups_sort_key_seq OWNED BY waitlist_signups.sort_key;
+
+-- full-text search over email, name and string/number form answers
+ALTER TABLE waitlist_signups
+  ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', email || ' ' || coalesce(name, ''))
+      || jsonb_to_tsvector('simple', answers, '["string", "numeric"]')
+  ) STORED;
+
+CREATE INDEX waitlist_signups_order_idx ON waitlist_signups (waitlist_id, sort_key, id);
+CREATE INDEX waitlist_signups_referred_by_idx ON waitlist_signups (referred_by) WHERE referred_by IS NOT NULL;
+CREATE INDEX waitlist_signups_tags_idx ON waitlist_signups USING GIN (tags);
+CREATE INDEX waitlist_signups_search_idx ON waitlist_signups USING GIN (search_vector);
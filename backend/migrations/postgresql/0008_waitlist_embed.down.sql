@@ -0,0 +1,2 @@
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS widget_theme;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS embed_allowed_origins;
@@ -0,0 +1,5 @@
+-- origins allowed to embed the signup widget, empty allows every origin
+ALTER TABLE waitlists ADD COLUMN embed_allowed_origins TEXT[] NOT NULL DEFAULT '{}';
+
+-- widget styling, see widget.Theme
+ALTER TABLE waitlists ADD COLUMN widget_theme JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS public.waitlist_signups_referral_code_idx;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS referral_code;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS description;
@@ -0,0 +1,8 @@
+-- shown on the hosted page and in link previews
+ALTER TABLE waitlists ADD COLUMN description TEXT NOT NULL DEFAULT '';
+
+-- code in each signup's referral link, new signups get one from the application
+ALTER TABLE waitlist_signups ADD COLUMN referral_code TEXT;
+UPDATE waitlist_signups SET referral_code = substr(md5(random()::text || id::text), 1, 10);
+ALTER TABLE waitlist_signups ALTER COLUMN referral_code SET NOT NULL;
+CREATE UNIQUE INDEX waitlist_signups_referral_code_idx ON waitlist_signups (waitlist_id, referral_code);
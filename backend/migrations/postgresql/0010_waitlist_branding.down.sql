@@ -0,0 +1,5 @@
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS share_text;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS redirect_url;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS success_message;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS brand_colors;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS logo;
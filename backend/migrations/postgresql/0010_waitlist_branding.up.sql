@@ -0,0 +1,6 @@
+-- branding and content of the public pages, the description is markdown
+ALTER TABLE waitlists ADD COLUMN logo TEXT; -- file name in the logo store
+ALTER TABLE waitlists ADD COLUMN brand_colors JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE waitlists ADD COLUMN success_message TEXT NOT NULL DEFAULT '';
+ALTER TABLE waitlists ADD COLUMN redirect_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE waitlists ADD COLUMN share_text TEXT NOT NULL DEFAULT '';
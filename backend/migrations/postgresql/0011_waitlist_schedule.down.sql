@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS public.waitlist_events;
+UPDATE public.waitlist_signups SET status = 'waiting' WHERE status = 'queued';
+ALTER TABLE public.waitlist_signups DROP CONSTRAINT IF EXISTS waitlist_signups_status_check;
+ALTER TABLE public.waitlist_signups ADD CONSTRAINT waitlist_signups_status_check
+  CHECK (status IN ('waiting', 'invited', 'accepted'));
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS overflow_mode;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS max_signups;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS closes_at;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS opens_at;
@@ -0,0 +1,22 @@
+-- signup window and capacity, signups outside them are rejected or queued per overflow_mode
+ALTER TABLE waitlists
+  ADD COLUMN opens_at      TIMESTAMPTZ,
+  ADD COLUMN closes_at     TIMESTAMPTZ,
+  ADD COLUMN max_signups   INTEGER CHECK (max_signups > 0),
+  ADD COLUMN overflow_mode TEXT NOT NULL DEFAULT 'reject' CHECK (overflow_mode IN ('reject', 'queue'));
+
+-- queued signups were taken while the waitlist was closed or full, they don't count towards capacity
+ALTER TABLE waitlist_signups DROP CONSTRAINT waitlist_signups_status_check;
+ALTER TABLE waitlist_signups ADD CONSTRAINT waitlist_signups_status_check
+  CHECK (status IN ('queued', 'waiting', 'invited', 'accepted'));
+
+-- lifecycle events fired by the scheduler, dedup_key keeps each one from firing twice
+CREATE TABLE waitlist_events (
+  id          BIGSERIAL PRIMARY KEY,
+  waitlist_id BIGINT NOT NULL REFERENCES waitlists(id) ON DELETE CASCADE,
+  type        TEXT NOT NULL,
+  dedup_key   TEXT NOT NULL,
+  data        JSONB NOT NULL DEFAULT '{}',
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (waitlist_id, dedup_key)
+);
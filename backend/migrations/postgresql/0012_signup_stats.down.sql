@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.waitlist_signup_rollup_state;
+DROP TABLE IF EXISTS public.waitlist_signup_rollups;
+DROP INDEX IF EXISTS public.waitlist_signups_created_idx;
@@ -0,0 +1,18 @@
+-- stats aggregate a waitlist's signups by creation time
+CREATE INDEX waitlist_signups_created_idx ON waitlist_signups (waitlist_id, created_at);
+
+-- hourly signup counts (UTC hours), refreshed by a background job when STATS_ROLLUP_INTERVAL is set
+CREATE TABLE waitlist_signup_rollups (
+  waitlist_id BIGINT NOT NULL REFERENCES waitlists(id) ON DELETE CASCADE,
+  hour        TIMESTAMPTZ NOT NULL,
+  signups     BIGINT NOT NULL,
+  PRIMARY KEY (waitlist_id, hour)
+);
+
+-- the rollups are complete for every hour before rolled_up_to, later signups are counted live.
+-- a single row, locked while the rollups are refreshed so replicas take turns.
+CREATE TABLE waitlist_signup_rollup_state (
+  id           BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+  rolled_up_to TIMESTAMPTZ
+);
+INSERT INTO waitlist_signup_rollup_state (rolled_up_to) VALUES (NULL);
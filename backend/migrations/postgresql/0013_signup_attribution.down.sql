@@ -0,0 +1,9 @@
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS device;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS landing_url;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS referrer;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS utm_content;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS utm_term;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS utm_campaign;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS utm_medium;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS utm_source;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS capture_attribution;
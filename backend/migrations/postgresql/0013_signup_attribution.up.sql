@@ -0,0 +1,13 @@
+-- where each signup came from, empty when unknown or when the waitlist turned capture off
+ALTER TABLE waitlists
+  ADD COLUMN capture_attribution BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE waitlist_signups
+  ADD COLUMN utm_source   TEXT NOT NULL DEFAULT '',
+  ADD COLUMN utm_medium   TEXT NOT NULL DEFAULT '',
+  ADD COLUMN utm_campaign TEXT NOT NULL DEFAULT '',
+  ADD COLUMN utm_term     TEXT NOT NULL DEFAULT '',
+  ADD COLUMN utm_content  TEXT NOT NULL DEFAULT '',
+  ADD COLUMN referrer     TEXT NOT NULL DEFAULT '', -- without its query string
+  ADD COLUMN landing_url  TEXT NOT NULL DEFAULT '',
+  ADD COLUMN device       TEXT NOT NULL DEFAULT ''; -- desktop, mobile, tablet, bot or unknown
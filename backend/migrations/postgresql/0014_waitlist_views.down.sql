@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.view_salts;
+DROP TABLE IF EXISTS public.waitlist_view_visitors;
+DROP TABLE IF EXISTS public.waitlist_views;
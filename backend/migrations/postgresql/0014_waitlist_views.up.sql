@@ -0,0 +1,23 @@
+-- cookieless page view counts of public waitlist pages and widgets, per UTC day
+CREATE TABLE waitlist_views (
+  waitlist_id BIGINT NOT NULL REFERENCES waitlists(id) ON DELETE CASCADE,
+  day         DATE NOT NULL,
+  views       BIGINT NOT NULL DEFAULT 0,
+  visitors    BIGINT NOT NULL DEFAULT 0, -- distinct visitor hashes that day
+  PRIMARY KEY (waitlist_id, day)
+);
+
+-- visitor hashes seen today, only kept until the day's salt is deleted
+CREATE TABLE waitlist_view_visitors (
+  waitlist_id  BIGINT NOT NULL REFERENCES waitlists(id) ON DELETE CASCADE,
+  day          DATE NOT NULL,
+  visitor_hash BYTEA NOT NULL,
+  PRIMARY KEY (waitlist_id, day, visitor_hash)
+);
+
+-- random salt per day shared by replicas, deleted once the day is over so
+-- hashes can't be linked across days or back to an IP
+CREATE TABLE view_salts (
+  day  DATE PRIMARY KEY,
+  salt BYTEA NOT NULL
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.data_requests;
+DROP INDEX IF EXISTS public.waitlist_signups_email_idx;
@@ -0,0 +1,17 @@
+-- data subject requests look signups up by email across every waitlist
+CREATE INDEX waitlist_signups_email_idx ON waitlist_signups (lower(email));
+
+-- audit trail of data subject requests. The subject is a keyed hash of the
+-- lowercased email so requests by the same person can be told apart without
+-- keeping the address that was erased.
+CREATE TABLE data_requests (
+  id           BIGSERIAL PRIMARY KEY,
+  kind         TEXT NOT NULL CHECK (kind IN ('link', 'export', 'erasure')),
+  subject_hash BYTEA NOT NULL,
+  mode         TEXT CHECK (mode IN ('delete', 'anonymize')), -- erasures only
+  signups      INT NOT NULL DEFAULT 0,         -- signups exported or erased
+  waitlist_ids BIGINT[] NOT NULL DEFAULT '{}', -- no foreign key, the trail outlives waitlists
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX data_requests_subject_idx ON data_requests (subject_hash);
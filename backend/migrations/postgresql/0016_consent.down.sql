@@ -0,0 +1,7 @@
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS consent_ip;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS consent_at;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS marketing_version;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS marketing_opt_in;
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS terms_version;
+DROP TABLE IF EXISTS public.waitlist_consent_versions;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS consent;
@@ -0,0 +1,21 @@
+-- consent checkboxes on the signup form with the current version of their text
+ALTER TABLE waitlists ADD COLUMN consent JSONB NOT NULL DEFAULT '{}';
+
+-- every version of every checkbox's text, so what a signup agreed to can be shown later
+CREATE TABLE waitlist_consent_versions (
+  waitlist_id BIGINT NOT NULL REFERENCES waitlists(id) ON DELETE CASCADE,
+  kind        TEXT NOT NULL CHECK (kind IN ('terms', 'marketing')),
+  version     INT NOT NULL,
+  text        TEXT NOT NULL,
+  url         TEXT NOT NULL DEFAULT '',
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (waitlist_id, kind, version)
+);
+
+-- what each signup agreed to, versions are NULL when the form had no such checkbox
+ALTER TABLE waitlist_signups
+  ADD COLUMN terms_version     INT,
+  ADD COLUMN marketing_opt_in  BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN marketing_version INT,
+  ADD COLUMN consent_at        TIMESTAMPTZ,
+  ADD COLUMN consent_ip        TEXT NOT NULL DEFAULT '';
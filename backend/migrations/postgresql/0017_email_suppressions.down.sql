@@ -0,0 +1,2 @@
+ALTER TABLE public.waitlist_signups DROP COLUMN IF EXISTS unsubscribed_at;
+DROP TABLE IF EXISTS public.email_suppressions;
@@ -0,0 +1,11 @@
+-- addresses no email is sent to, whatever waitlist they're on. Emails are
+-- stored lowercased. Bounces and complaints outrank unsubscribing.
+CREATE TABLE email_suppressions (
+  email      TEXT PRIMARY KEY CHECK (email = lower(email)),
+  reason     TEXT NOT NULL CHECK (reason IN ('unsubscribed', 'bounced', 'complained')),
+  detail     TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- when the signup unsubscribed from its waitlist's updates, NULL while subscribed
+ALTER TABLE waitlist_signups ADD COLUMN unsubscribed_at TIMESTAMPTZ;
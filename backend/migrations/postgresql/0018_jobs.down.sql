@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS public.job_schedules;
+DROP TABLE IF EXISTS public.jobs;
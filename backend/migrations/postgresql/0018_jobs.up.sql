@@ -0,0 +1,35 @@
+-- background jobs, claimed by workers with SELECT ... FOR UPDATE SKIP LOCKED.
+-- Succeeded jobs are deleted, dead ones stay until they are retried or deleted.
+CREATE TABLE jobs (
+  id           BIGSERIAL PRIMARY KEY,
+  kind         TEXT NOT NULL,
+  payload      JSONB NOT NULL DEFAULT '{}',
+  status       TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'dead')),
+  attempts     INT NOT NULL DEFAULT 0,
+  max_attempts INT NOT NULL CHECK (max_attempts > 0),
+  run_at       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  unique_key   TEXT,
+  locked_by    TEXT,
+  locked_at    TIMESTAMPTZ,
+  last_error   TEXT,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- what workers claim from, oldest due job first
+CREATE INDEX jobs_due_idx ON jobs (run_at, id) WHERE status = 'pending';
+
+-- a kind's jobs with the same unique key are only queued once at a time
+CREATE UNIQUE INDEX jobs_unique_key_idx ON jobs (kind, unique_key)
+  WHERE unique_key IS NOT NULL AND status IN ('pending', 'running');
+
+CREATE INDEX jobs_status_kind_idx ON jobs (status, kind, updated_at DESC);
+
+-- when each recurring job is next due, shared by every replica so a slot is
+-- only enqueued once
+CREATE TABLE job_schedules (
+  name        TEXT PRIMARY KEY,
+  spec        TEXT NOT NULL,
+  next_run_at TIMESTAMPTZ NOT NULL,
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
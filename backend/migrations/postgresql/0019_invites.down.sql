@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS public.invite_codes;
+DROP TABLE IF EXISTS public.waitlist_invite_keys;
+ALTER TABLE public.waitlists DROP COLUMN IF EXISTS invite_callback_url;
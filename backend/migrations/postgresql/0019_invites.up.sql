@@ -0,0 +1,28 @@
+-- the product's own signup URL people are sent to, with an access token, after redeeming an invite
+ALTER TABLE waitlists ADD COLUMN invite_callback_url TEXT NOT NULL DEFAULT '';
+
+-- key signing a waitlist's access tokens, created on first use and rotated by the owner
+CREATE TABLE waitlist_invite_keys (
+  waitlist_id BIGINT PRIMARY KEY REFERENCES waitlists(id) ON DELETE CASCADE,
+  secret      BYTEA NOT NULL,
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- invite codes, for one invited signup or shared when signup_id is NULL. Only a
+-- hash of the code is stored, the hint is its last characters to tell codes apart.
+CREATE TABLE invite_codes (
+  id           BIGSERIAL PRIMARY KEY,
+  waitlist_id  BIGINT NOT NULL REFERENCES waitlists(id) ON DELETE CASCADE,
+  signup_id    BIGINT REFERENCES waitlist_signups(id) ON DELETE CASCADE,
+  code_hash    BYTEA NOT NULL UNIQUE,
+  code_hint    TEXT NOT NULL,
+  max_uses     INT CHECK (max_uses > 0), -- NULL is unlimited
+  uses         INT NOT NULL DEFAULT 0,
+  expires_at   TIMESTAMPTZ,
+  revoked_at   TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX invite_codes_waitlist_idx ON invite_codes (waitlist_id, created_at DESC);
+CREATE INDEX invite_codes_signup_idx ON invite_codes (signup_id) WHERE signup_id IS NOT NULL;
@@ -0,0 +1,13 @@
+-- a waitlist offered to another account, at most one pending offer per waitlist.
+-- Ownership only moves when the recipient accepts, and the offer goes with
+-- either account.
+CREATE TABLE waitlist_transfers (
+  id           BIGSERIAL PRIMARY KEY,
+  waitlist_id  BIGINT NOT NULL UNIQUE REFERENCES waitlists(id) ON DELETE CASCADE,
+  from_user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  to_user_id   INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX waitlist_transfers_to_user_idx ON waitlist_transfers (to_user_id);
+CREATE INDEX waitlist_transfers_from_user_idx ON waitlist_transfers (from_user_id);
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/anish-chanda/openwaitlist/backend/internal/logger"
+)
+
+// newHTTPServer builds the http.Server with the timeouts and limits from config
+func newHTTPServer(cfg *Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.ApiPort),
+		Handler:           handler,
+		ReadTimeout:       time.Duration(cfg.ReadTimeout) * time.Second,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cfg.WriteTimeout) * time.Second,
+		IdleTimeout:       time.Duration(cfg.IdleTimeout) * time.Second,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// runServer starts the server and blocks until it fails or ctx is cancelled.
+// On cancellation in-flight requests are given cfg.ShutdownTimeout to drain.
+func runServer(ctx context.Context, cfg *Config, server *http.Server, log *logger.ServiceLogger) error {
+	serverErr := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.TLSEnabled() {
+			log.Info(fmt.Sprintf("Starting server with TLS on port %d", cfg.ApiPort))
+			err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			log.Info(fmt.Sprintf("Starting server on port %d", cfg.ApiPort))
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case err := <-serverErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Info("Shutdown signal received, draining in-flight requests...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("server shutdown failed: %w", err)
+	}
+	log.Info("Server stopped")
+	return nil
+}
+
+// runMetricsServer serves /metrics on cfg.MetricsPort until ctx is cancelled.
+// It is a separate listener so metrics aren't reachable through the public port.
+func runMetricsServer(ctx context.Context, cfg *Config, handler http.Handler, log *logger.ServiceLogger) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.MetricsPort),
+		Handler:           mux,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout) * time.Second,
+		WriteTimeout:      time.Duration(cfg.WriteTimeout) * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info(fmt.Sprintf("Serving metrics on port %d", cfg.MetricsPort))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error("Metrics server error: ", err)
+	}
+}
+
+// signalContext returns a context that is cancelled on SIGINT or SIGTERM
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
@@ -165,7 +165,7 @@ export function WaitlistManagementPage() {
     setIsUpdatingSettings(true);
     try {
       const response = await fetch(`/api/v1/waitlists/${waitlist.slug}`, {
-        method: 'PUT',
+        method: 'PATCH',
         headers: {
           'Content-Type': 'application/json',
         },